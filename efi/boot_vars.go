@@ -0,0 +1,112 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	efi "github.com/canonical/go-efilib"
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+)
+
+const (
+	bootOrderName = "BootOrder" // Unicode variable name for the boot option order
+)
+
+// BootVariableUpdate corresponds to an update to a boot variable that is measured
+// to PCR1, such as BootOrder or a Boot#### load option.
+type BootVariableUpdate struct {
+	Name string // The name of the variable in the EFI global namespace
+	Data []byte // The new contents of the variable, or nil if it is deleted
+}
+
+type bootVariableUpdatesOption []*BootVariableUpdate
+
+func (u bootVariableUpdatesOption) ApplyOptionTo(visitor internal_efi.PCRProfileOptionVisitor) error {
+	for i, update := range u {
+		if update.Name != bootOrderName && !isBootOptionName(update.Name) {
+			return fmt.Errorf("invalid boot variable name %q for update %d", update.Name, i)
+		}
+	}
+
+	visitor.AddInitialVariablesModifier(func(vars internal_efi.VariableSet) error {
+		// Create a branch in the variable set
+		branch := vars.Clone()
+
+		// This creates an initial variable set for each intermediate state.
+		for i, update := range u {
+			if err := branch.WriteVar(update.Name, efi.GlobalVariable,
+				efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess,
+				update.Data); err != nil {
+				return fmt.Errorf("cannot compute boot variable update %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+// WithBootVariableUpdates can be supplied to AddPCRProfile to compute the profile
+// for each of the supplied boot variable updates in turn, in addition to the current
+// boot variable contents. This is only useful in combination with
+// [WithPlatformConfigProfile]. This should only be supplied once. If a profile needs
+// to be computed for more than one boot variable update, provide them all in a single
+// option.
+func WithBootVariableUpdates(updates ...*BootVariableUpdate) PCRProfileOption {
+	return bootVariableUpdatesOption(updates)
+}
+
+// isBootOptionName indicates whether the supplied name is the name of a Boot####
+// load option variable.
+func isBootOptionName(name string) bool {
+	_, ok := bootOptionNumber(name)
+	return ok
+}
+
+// bootOptionNumber returns the number of the Boot#### load option variable with
+// the supplied name.
+func bootOptionNumber(name string) (n uint16, ok bool) {
+	if len(name) != 8 || !strings.HasPrefix(name, "Boot") {
+		return 0, false
+	}
+	x, err := strconv.ParseUint(name[4:], 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(x), true
+}
+
+// decodeBootOrder decodes the supplied BootOrder variable payload.
+func decodeBootOrder(data []byte) ([]uint16, error) {
+	if len(data)%2 != 0 {
+		return nil, errors.New("BootOrder variable contents has odd size")
+	}
+
+	var out []uint16
+	for len(data) > 0 {
+		out = append(out, binary.LittleEndian.Uint16(data))
+		data = data[2:]
+	}
+	return out, nil
+}
@@ -0,0 +1,101 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	efi "github.com/canonical/go-efilib"
+	"github.com/canonical/go-tpm2"
+
+	. "github.com/snapcore/secboot/efi"
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+	"github.com/snapcore/secboot/internal/efitest"
+	"github.com/snapcore/secboot/internal/testutil"
+)
+
+type bootVarsSuite struct{}
+
+var _ = Suite(&bootVarsSuite{})
+
+func (s *bootVarsSuite) TestWithPlatformConfigProfile(c *C) {
+	opt := WithPlatformConfigProfile()
+	pcrs, err := opt.PCRs()
+	c.Check(err, IsNil)
+	c.Check(pcrs, DeepEquals, tpm2.HandleList{internal_efi.PlatformConfigPCR})
+
+	visitor := new(mockPcrProfileOptionVisitor)
+	c.Check(opt.ApplyOptionTo(visitor), IsNil)
+	c.Check(visitor.pcrs, DeepEquals, tpm2.HandleList{internal_efi.PlatformConfigPCR})
+}
+
+func (s *bootVarsSuite) TestWithBootVariableUpdates(c *C) {
+	visitor := new(mockPcrProfileOptionVisitor)
+	opt := WithBootVariableUpdates(
+		&BootVariableUpdate{Name: "Boot0002", Data: []byte{1, 2, 3}},
+		&BootVariableUpdate{Name: "BootOrder", Data: []byte{2, 0, 1, 0}})
+	c.Check(opt.ApplyOptionTo(visitor), IsNil)
+
+	c.Assert(visitor.varModifiers, HasLen, 1)
+
+	collector := NewVariableSetCollector(efitest.NewMockHostEnvironment(efitest.MakeMockVars().AddVar("BootOrder", efi.GlobalVariable, efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, []byte{1, 0}), nil))
+	c.Check(visitor.varModifiers[0](collector.PeekAll()[0]), IsNil)
+
+	// The current variables
+	c.Assert(collector.More(), testutil.IsTrue)
+	vars := collector.Next()
+	data, _, err := vars.ReadVar("BootOrder", efi.GlobalVariable)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, []byte{1, 0})
+	_, _, err = vars.ReadVar("Boot0002", efi.GlobalVariable)
+	c.Check(err, Equals, efi.ErrVarNotExist)
+
+	// The intermediate state after the first update
+	c.Assert(collector.More(), testutil.IsTrue)
+	vars = collector.Next()
+	data, _, err = vars.ReadVar("BootOrder", efi.GlobalVariable)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, []byte{1, 0})
+	data, attrs, err := vars.ReadVar("Boot0002", efi.GlobalVariable)
+	c.Check(err, IsNil)
+	c.Check(attrs, Equals, efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess)
+	c.Check(data, DeepEquals, []byte{1, 2, 3})
+
+	// The final state
+	c.Assert(collector.More(), testutil.IsTrue)
+	vars = collector.Next()
+	data, _, err = vars.ReadVar("BootOrder", efi.GlobalVariable)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, []byte{2, 0, 1, 0})
+	data, _, err = vars.ReadVar("Boot0002", efi.GlobalVariable)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, []byte{1, 2, 3})
+
+	c.Check(collector.More(), testutil.IsFalse)
+}
+
+func (s *bootVarsSuite) TestWithBootVariableUpdatesInvalidName(c *C) {
+	visitor := new(mockPcrProfileOptionVisitor)
+	opt := WithBootVariableUpdates(
+		&BootVariableUpdate{Name: "BootOrder", Data: []byte{2, 0, 1, 0}},
+		&BootVariableUpdate{Name: "BootNext", Data: []byte{2, 0}})
+	c.Check(opt.ApplyOptionTo(visitor), ErrorMatches, `invalid boot variable name "BootNext" for update 1`)
+	c.Check(visitor.varModifiers, HasLen, 0)
+}
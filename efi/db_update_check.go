@@ -0,0 +1,276 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+
+	efi "github.com/canonical/go-efilib"
+	"github.com/canonical/go-tpm2"
+	secboot_tpm2 "github.com/snapcore/secboot/tpm2"
+	"golang.org/x/xerrors"
+)
+
+// SignatureDBUpdateCheckResult is the result of [CheckSignatureDBUpdate].
+type SignatureDBUpdateCheckResult struct {
+	// RevokedImages contains an error for each image in the supplied load
+	// sequences that would be refused by the platform firmware or shim after
+	// the update is applied, because its signing certificate or its digest
+	// is in dbx, or in MokListX for images loaded via shim.
+	RevokedImages []*RevokedImageError
+
+	// RevokedAuthorities contains the certificates from db, shim's vendor
+	// db or MokList that currently authenticate images in the supplied load sequences
+	// and that would be in dbx after the update is applied.
+	RevokedAuthorities []*x509.Certificate
+
+	// Satisfiable indicates whether a secure boot policy profile that includes
+	// the update can be generated for the supplied load sequences. This is
+	// false if any image would be refused either before or after the update,
+	// which also takes the effective SBAT level into account.
+	Satisfiable bool
+}
+
+// CheckSignatureDBUpdate determines whether applying the supplied signature database
+// update would revoke any of the images in the supplied load sequences, which would
+// prevent the host from booting. This should be used before applying a dbx update.
+//
+// The supplied options are the same as those accepted by [AddPCRProfile], and should
+// match the ones that will be used to generate the PCR profile. Options that select
+// a profile are not required. [WithSignatureDBUpdates] must not be supplied - the
+// update to check is already applied - and an error is returned if it is.
+func CheckSignatureDBUpdate(update *SignatureDBUpdate, loadSequences *ImageLoadSequences, options ...PCRProfileOption) (*SignatureDBUpdateCheckResult, error) {
+	if update == nil {
+		return nil, errors.New("no update supplied")
+	}
+	for _, opt := range options {
+		if _, ok := opt.(signatureDBUpdatesOption); ok {
+			return nil, errors.New("WithSignatureDBUpdates must not be supplied")
+		}
+	}
+
+	options = append([]PCRProfileOption{WithSecureBootPolicyProfile()}, options...)
+	options = append(options, WithSignatureDBUpdates(update))
+	gen, err := newPcrProfileGenerator(tpm2.HashAlgorithmSHA256, loadSequences, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	checker, err := newDbUpdateChecker(gen, update)
+	if err != nil {
+		return nil, err
+	}
+	if err := checker.checkImages(loadSequences.images, nil); err != nil {
+		return nil, err
+	}
+
+	// Determine whether a profile that includes the update can be generated
+	// without omitting any revoked images.
+	result := checker.result
+	result.Satisfiable = true
+	handler := gen.revokedImageHandler
+	gen.revokedImageHandler = func(err error) {
+		result.Satisfiable = false
+		if handler != nil {
+			handler(err)
+		}
+	}
+	err = gen.addPCRProfile(secboot_tpm2.NewPCRProtectionProfile().RootBranch())
+	var rie *RevokedImageError
+	switch {
+	case errors.As(err, &rie):
+		result.Satisfiable = false
+	case err != nil:
+		return nil, xerrors.Errorf("cannot generate profile: %w", err)
+	}
+
+	return result, nil
+}
+
+// dbUpdateChecker walks a set of load sequences in order to determine which
+// images and authorities are revoked by a signature database update.
+type dbUpdateChecker struct {
+	secureBootPolicyMixin
+
+	handlers imageLoadHandlerMap
+
+	db       *secureBootDB // db before the update is applied
+	dbx      *secureBootDB // dbx after the update is applied
+	mokList  *secureBootDB // shim's MokListRT
+	mokListX *secureBootDB // shim's MokListXRT
+
+	seen   map[dbUpdateCheckerSeenKey]struct{}
+	result *SignatureDBUpdateCheckResult
+}
+
+// dbUpdateCheckerSeenKey identifies an image that has already been checked.
+// An image that is loaded both directly by the firmware and via shim, or via
+// shims with different vendor databases, may have a different authority in
+// each case, so it is checked once for each. Images are identified by their
+// string representation, as implementations of Image aren't required to be
+// comparable.
+type dbUpdateCheckerSeenKey struct {
+	image    string
+	vendorDb *secureBootDB
+}
+
+func newDbUpdateChecker(gen *pcrProfileGenerator, update *SignatureDBUpdate) (*dbUpdateChecker, error) {
+	vars := newVariableSetCollector(gen.env).Next()
+
+	db, err := readSecureBootDB(vars, Db)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read db: %w", err)
+	}
+	mokList, err := readShimMokList(vars, shimMokListRTName)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read MokList: %w", err)
+	}
+	mokListX, err := readShimMokList(vars, shimMokListXRTName)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read MokListX: %w", err)
+	}
+	if err := applySignatureDBUpdate(vars, update, signatureDBUpdateNoFirmwareQuirk); err != nil {
+		return nil, xerrors.Errorf("cannot apply signature DB update: %w", err)
+	}
+	dbx, err := readSecureBootDB(vars, Dbx)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read updated dbx: %w", err)
+	}
+
+	return &dbUpdateChecker{
+		handlers: gen.handlers,
+		db:       db,
+		dbx:      dbx,
+		mokList:  mokList,
+		mokListX: mokListX,
+		seen:     make(map[dbUpdateCheckerSeenKey]struct{}),
+		result:   new(SignatureDBUpdateCheckResult),
+	}, nil
+}
+
+func readSecureBootDB(vars varReader, name efi.VariableDescriptor) (*secureBootDB, error) {
+	data, _, err := vars.ReadVar(name.Name, name.GUID)
+	if err != nil && err != efi.ErrVarNotExist {
+		return nil, xerrors.Errorf("cannot read variable: %w", err)
+	}
+	contents, err := efi.ReadSignatureDatabase(bytes.NewReader(data))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot decode signatures: %w", err)
+	}
+	return &secureBootDB{Name: name, Contents: contents}, nil
+}
+
+// isRevokedAuthority indicates whether the supplied authority is present
+// in the updated dbx.
+func (c *dbUpdateChecker) isRevokedAuthority(cert *x509.Certificate) bool {
+	for _, l := range c.dbx.Contents {
+		if l.Type != efi.CertX509Guid {
+			continue
+		}
+		for _, s := range l.Signatures {
+			if bytes.Equal(s.Data, cert.Raw) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *dbUpdateChecker) addRevokedAuthority(cert *x509.Certificate) {
+	for _, existing := range c.result.RevokedAuthorities {
+		if existing.Equal(cert) {
+			return
+		}
+	}
+	c.result.RevokedAuthorities = append(c.result.RevokedAuthorities, cert)
+}
+
+func (c *dbUpdateChecker) checkImage(image peImageHandle, vendorDb *secureBootDB) error {
+	// Images loaded via shim are also checked against the MOK databases.
+	dbxs := []*secureBootDB{c.dbx}
+	dbs := []*secureBootDB{c.db}
+	if vendorDb != nil {
+		dbxs = append(dbxs, c.mokListX)
+		dbs = shimAuthorityDBs(vendorDb, c.db, c.mokList)
+	}
+
+	switch err := c.CheckNotRevoked(dbxs, image); {
+	case isImageRevokedError(err):
+		c.result.RevokedImages = append(c.result.RevokedImages, &RevokedImageError{Image: image.Source(), err: err})
+	case err != nil:
+		return xerrors.Errorf("cannot check whether image is revoked: %w", err)
+	}
+
+	authority, err := c.DetermineAuthority(dbs, image)
+	if err != nil {
+		return xerrors.Errorf("cannot determine authority: %w", err)
+	}
+	if authority.Type != efi.CertX509Guid {
+		// The image is authenticated by its digest.
+		return nil
+	}
+	cert, err := x509.ParseCertificate(authority.Signature.Data)
+	if err != nil {
+		return xerrors.Errorf("cannot decode authority certificate: %w", err)
+	}
+	if c.isRevokedAuthority(cert) {
+		c.addRevokedAuthority(cert)
+	}
+
+	return nil
+}
+
+func (c *dbUpdateChecker) checkOneActivity(activity ImageLoadActivity, vendorDb *secureBootDB) error {
+	image, err := openPeImage(activity.source())
+	if err != nil {
+		return xerrors.Errorf("cannot open image %v: %w", activity.source(), err)
+	}
+	defer image.Close()
+
+	key := dbUpdateCheckerSeenKey{image: image.Source().String(), vendorDb: vendorDb}
+	if _, seen := c.seen[key]; !seen {
+		c.seen[key] = struct{}{}
+		if err := c.checkImage(image, vendorDb); err != nil {
+			return xerrors.Errorf("cannot check image %v: %w", image.Source(), err)
+		}
+	}
+
+	// Images loaded via shim may be authenticated by its vendor db.
+	handler, err := c.handlers.LookupHandler(image)
+	if err != nil {
+		return xerrors.Errorf("cannot obtain load handler for image %v: %w", image.Source(), err)
+	}
+	if shim, ok := handler.(*shimLoadHandler); ok && shim.VendorDb != nil {
+		vendorDb = shim.VendorDb
+	}
+
+	return c.checkImages(activity.next(), vendorDb)
+}
+
+func (c *dbUpdateChecker) checkImages(images []ImageLoadActivity, vendorDb *secureBootDB) error {
+	for _, activity := range images {
+		if err := c.checkOneActivity(activity, vendorDb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi_test
+
+import (
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	efi "github.com/canonical/go-efilib"
+	"github.com/canonical/go-tpm2"
+	. "gopkg.in/check.v1"
+
+	. "github.com/snapcore/secboot/efi"
+	"github.com/snapcore/secboot/internal/efitest"
+	"github.com/snapcore/secboot/internal/testutil"
+)
+
+type dbUpdateCheckSuite struct {
+	mockImageHandleMixin
+	mockShimImageHandleMixin
+	mockGrubImageHandleMixin
+}
+
+func (s *dbUpdateCheckSuite) SetUpTest(c *C) {
+	s.mockImageHandleMixin.SetUpTest(c)
+	s.mockShimImageHandleMixin.SetUpTest(c)
+	s.mockGrubImageHandleMixin.SetUpTest(c)
+}
+
+var _ = Suite(&dbUpdateCheckSuite{})
+
+func (s *dbUpdateCheckSuite) newDbxUpdate(c *C, dbx efi.SignatureDatabase) *SignatureDBUpdate {
+	return &SignatureDBUpdate{
+		Name: Dbx,
+		Data: efitest.GenerateSignedVariableUpdate(c,
+			testutil.ParsePKCS1PrivateKey(c, testKEKKey),
+			testutil.ParseCertificate(c, testKEKCert),
+			Dbx.Name, Dbx.GUID,
+			efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess|efi.AttributeTimeBasedAuthenticatedWriteAccess|efi.AttributeAppendWrite,
+			time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+			efitest.MakeVarPayload(c, dbx)),
+	}
+}
+
+type testCheckSignatureDBUpdateData struct {
+	vars          efitest.MockVars
+	update        *SignatureDBUpdate
+	loadSequences *ImageLoadSequences
+}
+
+func (s *dbUpdateCheckSuite) testCheckSignatureDBUpdate(c *C, data *testCheckSignatureDBUpdateData) (*SignatureDBUpdateCheckResult, error) {
+	log := efitest.NewLog(c, &efitest.LogOptions{
+		Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1},
+	})
+	return CheckSignatureDBUpdate(data.update, data.loadSequences, WithHostEnvironment(efitest.NewMockHostEnvironment(data.vars, log)))
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateMsDbxUpdate(c *C) {
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage3(c)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	result, err := s.testCheckSignatureDBUpdate(c, &testCheckSignatureDBUpdateData{
+		vars:   makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		update: &SignatureDBUpdate{Name: Dbx, Data: msDbxUpdate2},
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+	})
+	c.Assert(err, IsNil)
+	c.Check(result.RevokedImages, HasLen, 0)
+	c.Check(result.RevokedAuthorities, HasLen, 0)
+	c.Check(result.Satisfiable, testutil.IsTrue)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateRevokesVendorAuthority(c *C) {
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage3(c)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	result, err := s.testCheckSignatureDBUpdate(c, &testCheckSignatureDBUpdateData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		update: s.newDbxUpdate(c, efi.SignatureDatabase{
+			efitest.NewSignatureListX509(c, canonicalCACert, testOwnerGuid),
+		}),
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result.RevokedImages, HasLen, 2)
+	c.Check(result.RevokedImages[0].Image, Equals, grub)
+	c.Check(result.RevokedImages[0], ErrorMatches, `image .* is revoked: certificate "CN=Canonical Ltd. Master Certificate Authority,O=Canonical Ltd.,L=Douglas,ST=Isle of Man,C=GB" is in dbx`)
+	c.Check(result.RevokedImages[1].Image, Equals, kernel)
+	c.Check(result.RevokedImages[1], ErrorMatches, `image .* is revoked: certificate "CN=Canonical Ltd. Master Certificate Authority,O=Canonical Ltd.,L=Douglas,ST=Isle of Man,C=GB" is in dbx`)
+	c.Check(result.RevokedAuthorities, DeepEquals, []*x509.Certificate{testutil.ParseCertificate(c, canonicalCACert)})
+	c.Check(result.Satisfiable, testutil.IsFalse)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateRevokesImageDigest(c *C) {
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage3(c)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	result, err := s.testCheckSignatureDBUpdate(c, &testCheckSignatureDBUpdateData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		update: s.newDbxUpdate(c, efi.SignatureDatabase{
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3).Digest()},
+				},
+			},
+		}),
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result.RevokedImages, HasLen, 1)
+	c.Check(result.RevokedImages[0].Image, Equals, grub)
+	c.Check(result.RevokedImages[0], ErrorMatches, `image .* is revoked: image digest is in dbx`)
+	c.Check(result.RevokedAuthorities, HasLen, 0)
+	c.Check(result.Satisfiable, testutil.IsFalse)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateRevokesUnusedImage(c *C) {
+	// Test that an update that revokes an image that isn't part of the
+	// supplied load sequences is reported as satisfiable.
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage3(c)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	result, err := s.testCheckSignatureDBUpdate(c, &testCheckSignatureDBUpdateData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		update: s.newDbxUpdate(c, efi.SignatureDatabase{
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig2).Digest()},
+				},
+			},
+		}),
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+	})
+	c.Assert(err, IsNil)
+	c.Check(result.RevokedImages, HasLen, 0)
+	c.Check(result.RevokedAuthorities, HasLen, 0)
+	c.Check(result.Satisfiable, testutil.IsTrue)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateUnsatisfiableSbat(c *C) {
+	// Test that an image that is revoked by SBAT makes the profile
+	// unsatisfiable, even though the update itself doesn't revoke anything.
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage2(c)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	result, err := s.testCheckSignatureDBUpdate(c, &testCheckSignatureDBUpdateData{
+		vars:   makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		update: &SignatureDBUpdate{Name: Dbx, Data: msDbxUpdate2},
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+	})
+	c.Assert(err, IsNil)
+	c.Check(result.RevokedImages, HasLen, 0)
+	c.Check(result.RevokedAuthorities, HasLen, 0)
+	c.Check(result.Satisfiable, testutil.IsFalse)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateNoUpdate(c *C) {
+	_, err := CheckSignatureDBUpdate(nil, NewImageLoadSequences())
+	c.Check(err, ErrorMatches, `no update supplied`)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateSameImageWithAndWithoutShim(c *C) {
+	// Test that an image that is loaded both directly by the firmware and
+	// via shim is checked in both cases, as MokListX only applies to images
+	// that are loaded via shim.
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage3(c)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	result, err := s.testCheckSignatureDBUpdate(c, &testCheckSignatureDBUpdateData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n")), withMokListX(efi.SignatureDatabase{
+			efitest.NewSignatureListX509(c, msUefiCACert, testOwnerGuid),
+		})),
+		update: &SignatureDBUpdate{Name: Dbx, Data: msDbxUpdate2},
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(shim).Loads(
+					NewImageLoadActivity(grub).Loads(
+						NewImageLoadActivity(kernel),
+					),
+				),
+			),
+		),
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result.RevokedImages, HasLen, 1)
+	c.Check(result.RevokedImages[0].Image, Equals, shim)
+	c.Check(result.RevokedImages[0], ErrorMatches, `image .* is revoked: certificate "CN=Microsoft Corporation UEFI CA 2011,O=Microsoft Corporation,L=Redmond,ST=Washington,C=US" is in MokListXRT`)
+	c.Check(result.RevokedAuthorities, HasLen, 0)
+	c.Check(result.Satisfiable, testutil.IsFalse)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateWithSignatureDBUpdates(c *C) {
+	update := &SignatureDBUpdate{Name: Dbx, Data: msDbxUpdate2}
+	_, err := CheckSignatureDBUpdate(update, NewImageLoadSequences(), WithSignatureDBUpdates(update))
+	c.Check(err, ErrorMatches, `WithSignatureDBUpdates must not be supplied`)
+}
+
+func (s *dbUpdateCheckSuite) TestCheckSignatureDBUpdateImageDigestError(c *C) {
+	// Test that an error computing the digest of an image is returned
+	// rather than being reported as a revocation.
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage3(c).withDigest(crypto.SHA1, nil)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	_, err := s.testCheckSignatureDBUpdate(c, &testCheckSignatureDBUpdateData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		update: s.newDbxUpdate(c, efi.SignatureDatabase{
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: testutil.DecodeHexString(c, "317650b68e9328b5c4232f1d6ca5ec9ae4fe6e5be99db36520e0ad67a4f17037")},
+				},
+			},
+		}),
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+	})
+	c.Check(err, ErrorMatches, `cannot check image .*: cannot check whether image is revoked: cannot compute image digest: invalid alg`)
+}
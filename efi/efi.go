@@ -22,7 +22,9 @@ package efi
 import "github.com/canonical/go-tpm2"
 
 const (
+	kernelBootPCR   tpm2.Handle = 11
 	kernelConfigPCR tpm2.Handle = 12
+	sysextPCR       tpm2.Handle = 13
 )
 
 // pcrFlags corresponds to a set of PCRs. This can only represent actual PCRs, it
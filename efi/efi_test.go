@@ -42,9 +42,12 @@ import (
 func Test(t *testing.T) { TestingT(t) }
 
 type mockPcrProfileContext struct {
-	alg      tpm2.HashAlgorithmId
-	pcrs     PcrFlags
-	handlers ImageLoadHandlerMap
+	alg                 tpm2.HashAlgorithmId
+	pcrs                PcrFlags
+	handlers            ImageLoadHandlerMap
+	systemdPCRPolicyKey crypto.PublicKey
+	partitionTable      *efi.PartitionTable
+	revokedImages       []*RevokedImageError
 }
 
 func (c *mockPcrProfileContext) PCRAlg() tpm2.HashAlgorithmId {
@@ -59,6 +62,18 @@ func (c *mockPcrProfileContext) ImageLoadHandlerMap() ImageLoadHandlerMap {
 	return c.handlers
 }
 
+func (c *mockPcrProfileContext) SystemdPCRPolicyKey() crypto.PublicKey {
+	return c.systemdPCRPolicyKey
+}
+
+func (c *mockPcrProfileContext) PartitionTable() *efi.PartitionTable {
+	return c.partitionTable
+}
+
+func (c *mockPcrProfileContext) ReportRevokedImage(err *RevokedImageError) {
+	c.revokedImages = append(c.revokedImages, err)
+}
+
 type mockPcrBranchEventType int
 
 const (
@@ -167,6 +182,14 @@ func (h *mockPeImageHandle) OpenSection(name string) *io.SectionReader {
 	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
 }
 
+func (h *mockPeImageHandle) OpenSectionAsLoaded(name string) io.Reader {
+	data, exists := h.sections[name]
+	if !exists {
+		return nil
+	}
+	return bytes.NewReader(data)
+}
+
 func (h *mockPeImageHandle) HasSection(name string) bool {
 	_, exists := h.sections[name]
 	return exists
@@ -340,8 +363,8 @@ func newMockUbuntuShimImage15_4(c *C) *mockImage {
 	return newMockImage().
 		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig3)).
 		withSbat([]SbatComponent{
-			{Name: "shim"},
-			{Name: "shim.ubuntu"},
+			{Name: "shim", Generation: 1},
+			{Name: "shim.ubuntu", Generation: 1},
 		}).
 		withShimVersion(MustParseShimVersion("15.4")).
 		withShimVendorDb(efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, efi.GUID{})}, ShimVendorCertIsX509)
@@ -351,8 +374,8 @@ func newMockUbuntuShimImage15_7(c *C) *mockImage {
 	return newMockImage().
 		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4)).
 		withSbat([]SbatComponent{
-			{Name: "shim"},
-			{Name: "shim.ubuntu"},
+			{Name: "shim", Generation: 3},
+			{Name: "shim.ubuntu", Generation: 1},
 		}).
 		withShimVersion(MustParseShimVersion("15.7")).
 		withShimVendorDb(efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, efi.GUID{})}, ShimVendorCertIsX509).
@@ -371,8 +394,8 @@ func newMockUbuntuGrubImage2(c *C) *mockImage {
 		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig2)).
 		addSection("mods", nil).
 		withSbat([]SbatComponent{
-			{Name: "grub"},
-			{Name: "grub.ubuntu"},
+			{Name: "grub", Generation: 1},
+			{Name: "grub.ubuntu", Generation: 1},
 		}).
 		withGrubPrefix("/EFI/ubuntu")
 }
@@ -382,8 +405,8 @@ func newMockUbuntuGrubImage3(c *C) *mockImage {
 		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
 		addSection("mods", nil).
 		withSbat([]SbatComponent{
-			{Name: "grub"},
-			{Name: "grub.ubuntu"},
+			{Name: "grub", Generation: 3},
+			{Name: "grub.ubuntu", Generation: 1},
 		}).
 		withGrubPrefix("/EFI/ubuntu")
 }
@@ -402,8 +425,8 @@ func newMockUbuntuKernelImage2(c *C) *mockImage {
 		addSection(".initrd", nil).
 		addSection(".sdmagic", nil).
 		withSbat([]SbatComponent{
-			{Name: "systemd"},
-			{Name: "systemd.ubuntu"},
+			{Name: "systemd", Generation: 1},
+			{Name: "systemd.ubuntu", Generation: 1},
 		})
 }
 
@@ -414,8 +437,8 @@ func newMockUbuntuKernelImage3(c *C) *mockImage {
 		addSection(".initrd", nil).
 		addSection(".sdmagic", nil).
 		withSbat([]SbatComponent{
-			{Name: "systemd"},
-			{Name: "systemd.ubuntu"},
+			{Name: "systemd", Generation: 1},
+			{Name: "systemd.ubuntu", Generation: 1},
 		})
 }
 
@@ -426,8 +449,8 @@ func newMockUbuntuKernelImage4(c *C) *mockImage {
 		addSection(".initrd", nil).
 		addSection(".sdmagic", nil).
 		withSbat([]SbatComponent{
-			{Name: "systemd"},
-			{Name: "systemd.ubuntu"},
+			{Name: "systemd", Generation: 1},
+			{Name: "systemd.ubuntu", Generation: 1},
 		})
 }
 
@@ -755,9 +778,12 @@ func (e *efiSuite) TestPcrFlagsDoesNotContain2(c *C) {
 }
 
 type mockPcrProfileOptionVisitor struct {
-	pcrs         tpm2.HandleList
-	env          HostEnvironment
-	varModifiers []internal_efi.InitialVariablesModifier
+	pcrs                tpm2.HandleList
+	env                 HostEnvironment
+	varModifiers        []internal_efi.InitialVariablesModifier
+	systemdPCRPolicyKey crypto.PublicKey
+	partitionTable      *efi.PartitionTable
+	revokedImageHandler func(err error)
 }
 
 func (v *mockPcrProfileOptionVisitor) AddPCRs(pcrs ...tpm2.Handle) {
@@ -772,6 +798,18 @@ func (v *mockPcrProfileOptionVisitor) AddInitialVariablesModifier(fn internal_ef
 	v.varModifiers = append(v.varModifiers, fn)
 }
 
+func (v *mockPcrProfileOptionVisitor) SetSystemdPCRPolicyKey(key crypto.PublicKey) {
+	v.systemdPCRPolicyKey = key
+}
+
+func (v *mockPcrProfileOptionVisitor) SetPartitionTable(table *efi.PartitionTable) {
+	v.partitionTable = table
+}
+
+func (v *mockPcrProfileOptionVisitor) SetRevokedImageHandler(fn func(err error)) {
+	v.revokedImageHandler = fn
+}
+
 type mockVarReader struct {
 	ctx context.Context
 }
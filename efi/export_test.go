@@ -30,6 +30,7 @@ import (
 // Export constants for testing
 const (
 	GrubChainloaderUsesShimProtocol            = grubChainloaderUsesShimProtocol
+	KernelBootPCR                              = kernelBootPCR
 	KernelConfigPCR                            = kernelConfigPCR
 	ShimFixVariableAuthorityEventsMatchSpec    = shimFixVariableAuthorityEventsMatchSpec
 	ShimHasSbatRevocationManagement            = shimHasSbatRevocationManagement
@@ -42,16 +43,19 @@ const (
 	ShimVendorCertIsDb                         = shimVendorCertIsDb
 	SignatureDBUpdateNoFirmwareQuirk           = signatureDBUpdateNoFirmwareQuirk
 	SignatureDBUpdateFirmwareDedupIgnoresOwner = signatureDBUpdateFirmwareDedupIgnoresOwner
+	SysextPCR                                  = sysextPCR
 )
 
 // Export variables and unexported functions for testing
 var (
 	ApplySignatureDBUpdate                      = applySignatureDBUpdate
+	CheckSbatLevel                              = checkSbatLevel
 	ErrNoHandler                                = errNoHandler
 	ImageAlwaysMatches                          = imageAlwaysMatches
 	ImageDigestMatches                          = imageDigestMatches
 	ImageMatchesAll                             = imageMatchesAll
 	ImageMatchesAny                             = imageMatchesAny
+	IsImageRevokedError                         = isImageRevokedError
 	LookupImageLoadHandler                      = lookupImageLoadHandler
 	MakeFallbackImageRules                      = makeFallbackImageRules
 	MakeImageLoadHandlerMap                     = makeImageLoadHandlerMap
@@ -67,15 +71,21 @@ var (
 	NewPcrImagesMeasurer                        = newPcrImagesMeasurer
 	NewPcrProfileGenerator                      = newPcrProfileGenerator
 	NewRootPcrBranchCtx                         = newRootPcrBranchCtx
+	NewNullLoadHandler                          = newNullLoadHandler
 	NewSecureBootNamespaceRules                 = newSecureBootNamespaceRules
 	NewShimImageHandle                          = newShimImageHandle
 	NewShimLoadHandler                          = newShimLoadHandler
 	NewShimLoadHandlerConstructor               = newShimLoadHandlerConstructor
+	NewSystemdBootLoadHandler                   = newSystemdBootLoadHandler
+	NewSystemdStubUKILoadHandler                = newSystemdStubUKILoadHandler
 	NewVariableSetCollector                     = newVariableSetCollector
+	WithSystemdPCRPolicy                        = withSystemdPCRPolicy
 	OpenPeImage                                 = openPeImage
 	ParseShimVersion                            = parseShimVersion
 	ParseShimVersionDataIdent                   = parseShimVersionDataIdent
+	ReadShimMokList                             = readShimMokList
 	ReadShimSbatPolicy                          = readShimSbatPolicy
+	ReadShimValidationDisabled                  = readShimValidationDisabled
 	SbatSectionExists                           = sbatSectionExists
 	ShimGuid                                    = shimGuid
 	ShimVersionIs                               = shimVersionIs
@@ -95,6 +105,7 @@ type GrubLoadHandler = grubLoadHandler
 type ImageLoadHandler = imageLoadHandler
 type ImageLoadHandlerMap = imageLoadHandlerMap
 type ImageLoadParamsSet = imageLoadParamsSet
+type ImageLoadRevocationChecker = imageLoadRevocationChecker
 type ImageRules = imageRules
 type ImageSectionExists = imageSectionExists
 type ImageSignedByOrganization = imageSignedByOrganization
@@ -121,6 +132,10 @@ type ShimSbatPolicy = shimSbatPolicy
 type ShimVendorCertFormat = shimVendorCertFormat
 type ShimVersion = shimVersion
 type SignatureDBUpdateFirmwareQuirk = signatureDBUpdateFirmwareQuirk
+type SystemdBootLoadHandler = systemdBootLoadHandler
+type SystemdLoaderInfoIs = systemdLoaderInfoIs
+type SystemdPCRPolicyLoadHandler = systemdPCRPolicyLoadHandler
+type SystemdStubUKILoadHandler = systemdStubUKILoadHandler
 type UbuntuCoreUKILoadHandler = ubuntuCoreUKILoadHandler
 type VarBranch = varBranch
 type VariableSetCollector = variableSetCollector
@@ -216,3 +231,7 @@ func (o mockInitialVariablesModifierOption) ApplyOptionTo(visitor internal_efi.P
 func WithMockInitialVariablesModifierOption(fn func(internal_efi.VariableSet) error) PCRProfileOption {
 	return mockInitialVariablesModifierOption(fn)
 }
+
+func (h *SystemdPCRPolicyLoadHandler) Handler() ImageLoadHandler {
+	return h.imageLoadHandler
+}
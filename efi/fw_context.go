@@ -23,12 +23,22 @@ import (
 	"bytes"
 
 	"github.com/canonical/go-tpm2"
+	"github.com/canonical/tcglog-parser"
 )
 
 // fwContext maintains context associated with the platform firmware for a branch
 type fwContext struct {
 	Db                 *secureBootDB
+	Dbx                *secureBootDB
+	SecureBootDisabled bool // the firmware doesn't verify images
 	verificationEvents tpm2.DigestList
+
+	// LoaderConfEvent is the event in the log for the measurement of loader.conf
+	// by systemd-boot, if there is one. This and the events that follow it in
+	// the boot manager config PCR (5), which are in PendingBootManagerConfigEvents,
+	// are measured by the systemd-boot load handler.
+	LoaderConfEvent                *tcglog.Event
+	PendingBootManagerConfigEvents []*tcglog.Event
 }
 
 func (c *fwContext) AppendVerificationEvent(digest tpm2.Digest) {
@@ -87,6 +87,63 @@ func (h *fwLoadHandler) measureAuthorizedSignatureDb(ctx pcrBranchContext) error
 	return nil
 }
 
+func (h *fwLoadHandler) setForbiddenSignatureDb(ctx pcrBranchContext, data []byte) error {
+	dbx, err := efi.ReadSignatureDatabase(bytes.NewReader(data))
+	if err != nil {
+		return xerrors.Errorf("cannot decode signatures: %w", err)
+	}
+	ctx.FwContext().Dbx = &secureBootDB{Name: Dbx, Contents: dbx}
+	return nil
+}
+
+func (h *fwLoadHandler) measureForbiddenSignatureDb(ctx pcrBranchContext) error {
+	data, err := h.readAndMeasureSignatureDb(ctx, Dbx)
+	if err != nil {
+		return err
+	}
+	return h.setForbiddenSignatureDb(ctx, data)
+}
+
+func (h *fwLoadHandler) readForbiddenSignatureDb(ctx pcrBranchContext) error {
+	data, _, err := ctx.Vars().ReadVar(Dbx.Name, Dbx.GUID)
+	if err != nil && err != efi.ErrVarNotExist {
+		return xerrors.Errorf("cannot read current variable: %w", err)
+	}
+	return h.setForbiddenSignatureDb(ctx, data)
+}
+
+// readSecureBootEnabled indicates whether secure boot is enabled. It is
+// disabled if the SecureBoot variable doesn't exist.
+func readSecureBootEnabled(vars varReader) (bool, error) {
+	data, _, err := vars.ReadVar(sbStateName, efi.GlobalVariable)
+	switch {
+	case err == efi.ErrVarNotExist:
+		return false, nil
+	case err != nil:
+		return false, err
+	case len(data) != 1:
+		return false, errors.New("invalid SecureBoot length")
+	default:
+		return data[0] == 1, nil
+	}
+}
+
+func (h *fwLoadHandler) readSecureBootPolicy(ctx pcrBranchContext) error {
+	enabled, err := readSecureBootEnabled(ctx.Vars())
+	if err != nil {
+		return xerrors.Errorf("cannot read SecureBoot: %w", err)
+	}
+	if !enabled {
+		// Images aren't verified, so dbx isn't required.
+		ctx.FwContext().SecureBootDisabled = true
+		return nil
+	}
+	if err := h.readForbiddenSignatureDb(ctx); err != nil {
+		return xerrors.Errorf("cannot read dbx: %w", err)
+	}
+	return nil
+}
+
 func (h *fwLoadHandler) measureSecureBootPolicyPreOS(ctx pcrBranchContext) error {
 	// This hard-codes a profile that will only work on devices with secure boot enabled,
 	// deployed mode on (where UEFI >= 2.5), without a UEFI debugger enabled and which
@@ -101,7 +158,7 @@ func (h *fwLoadHandler) measureSecureBootPolicyPreOS(ctx pcrBranchContext) error
 	if err := h.measureAuthorizedSignatureDb(ctx); err != nil {
 		return xerrors.Errorf("cannot measure db: %w", err)
 	}
-	if _, err := h.readAndMeasureSignatureDb(ctx, Dbx); err != nil {
+	if err := h.measureForbiddenSignatureDb(ctx); err != nil {
 		return xerrors.Errorf("cannot measure dbx: %w", err)
 	}
 	// TODO: Support optional dbt/dbr databases
@@ -197,6 +254,124 @@ func (h *fwLoadHandler) measurePlatformFirmware(ctx pcrBranchContext) error {
 	return errors.New("missing separator")
 }
 
+// measureBootVariable measures the current value of the specified boot variable to
+// the specified PCR, using the same event type as the supplied event type from the log.
+// Variables that don't exist aren't measured by the firmware.
+func (h *fwLoadHandler) measureBootVariable(ctx pcrBranchContext, pcr tpm2.Handle, eventType tcglog.EventType, name string) error {
+	data, _, err := ctx.Vars().ReadVar(name, efi.GlobalVariable)
+	switch {
+	case err == efi.ErrVarNotExist:
+		return nil
+	case err != nil:
+		return xerrors.Errorf("cannot read current variable: %w", err)
+	case len(data) == 0:
+		// The variable has been deleted by an update.
+		return nil
+	}
+
+	if eventType == tcglog.EventTypeEFIVariableBoot {
+		// EV_EFI_VARIABLE_BOOT events only contain a digest of the variable
+		// data rather than the entire UEFI_VARIABLE_DATA structure.
+		h := ctx.PCRAlg().NewHash()
+		h.Write(data)
+		ctx.ExtendPCR(pcr, h.Sum(nil))
+		return nil
+	}
+
+	ctx.MeasureVariable(pcr, efi.GlobalVariable, name, data)
+	return nil
+}
+
+// measureBootOrderAndOptions measures the current value of BootOrder and the
+// Boot#### load options that it references to PCR1, in the order in which the
+// firmware measures them.
+func (h *fwLoadHandler) measureBootOrderAndOptions(ctx pcrBranchContext, eventType tcglog.EventType) error {
+	if err := h.measureBootVariable(ctx, internal_efi.PlatformConfigPCR, eventType, bootOrderName); err != nil {
+		return fmt.Errorf("cannot measure BootOrder: %w", err)
+	}
+
+	data, _, err := ctx.Vars().ReadVar(bootOrderName, efi.GlobalVariable)
+	switch {
+	case err == efi.ErrVarNotExist:
+		return nil
+	case err != nil:
+		return xerrors.Errorf("cannot read BootOrder: %w", err)
+	}
+
+	order, err := decodeBootOrder(data)
+	if err != nil {
+		return fmt.Errorf("cannot decode BootOrder: %w", err)
+	}
+	for _, n := range order {
+		name := fmt.Sprintf("Boot%04X", n)
+		if err := h.measureBootVariable(ctx, internal_efi.PlatformConfigPCR, eventType, name); err != nil {
+			return fmt.Errorf("cannot measure %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (h *fwLoadHandler) measurePlatformConfig(ctx pcrBranchContext) error {
+	// Replay the log until the transition to the OS. Most events (such as those
+	// associated with SMBIOS tables and other handoff tables) are copied from the
+	// log. Boot variables are measured from the current variable set so that
+	// changes to them can be predicted. The firmware measures BootOrder followed
+	// by each Boot#### load option referenced by it, so load options that were
+	// referenced by the BootOrder value from the log are skipped once BootOrder
+	// has been measured, and are measured in the order that they appear in the
+	// current BootOrder value instead.
+	bootOrderOptions := make(map[uint16]struct{})
+	for _, event := range h.log.Events {
+		if event.PCRIndex != internal_efi.PlatformConfigPCR {
+			continue
+		}
+
+		switch event.EventType {
+		case tcglog.EventTypeNoAction:
+			// not measured
+		case tcglog.EventTypeSeparator:
+			return h.measureSeparator(ctx, internal_efi.PlatformConfigPCR, event)
+		case tcglog.EventTypeEFIVariableBoot, tcglog.EventTypeEFIVariableBoot2:
+			data, ok := event.Data.(*tcglog.EFIVariableData)
+			if !ok {
+				// if the event data failed to decode, the resulting implementation is guaranteed to implement error.
+				return fmt.Errorf("cannot measure invalid boot variable event: %w", event.Data.(error))
+			}
+
+			n, isBootOption := bootOptionNumber(data.UnicodeName)
+			switch {
+			case data.VariableName != efi.GlobalVariable:
+				ctx.ExtendPCR(internal_efi.PlatformConfigPCR, event.Digests[ctx.PCRAlg()])
+			case data.UnicodeName == bootOrderName:
+				order, err := decodeBootOrder(data.VariableData)
+				if err != nil {
+					return fmt.Errorf("cannot decode BootOrder from log: %w", err)
+				}
+				for _, n := range order {
+					bootOrderOptions[n] = struct{}{}
+				}
+				if err := h.measureBootOrderAndOptions(ctx, event.EventType); err != nil {
+					return err
+				}
+			case isBootOption:
+				if _, measured := bootOrderOptions[n]; measured {
+					continue
+				}
+				if err := h.measureBootVariable(ctx, internal_efi.PlatformConfigPCR, event.EventType, data.UnicodeName); err != nil {
+					return fmt.Errorf("cannot measure %s: %w", data.UnicodeName, err)
+				}
+			default:
+				ctx.ExtendPCR(internal_efi.PlatformConfigPCR, event.Digests[ctx.PCRAlg()])
+			}
+		default:
+			ctx.ExtendPCR(internal_efi.PlatformConfigPCR, event.Digests[ctx.PCRAlg()])
+		}
+	}
+
+	return errors.New("missing separator")
+}
+
 func (h *fwLoadHandler) measureDriversAndApps(ctx pcrBranchContext) error {
 	for _, event := range h.log.Events {
 		if event.PCRIndex != internal_efi.DriversAndAppsPCR {
@@ -212,6 +387,133 @@ func (h *fwLoadHandler) measureDriversAndApps(ctx pcrBranchContext) error {
 	return errors.New("missing separator")
 }
 
+// measurePreOSEventsFromLog replays the events from the log for the specified PCR
+// up to and including the separator, for PCRs where nothing is predicted.
+func (h *fwLoadHandler) measurePreOSEventsFromLog(ctx pcrBranchContext, pcr tpm2.Handle) error {
+	for _, event := range h.log.Events {
+		if event.PCRIndex != pcr {
+			continue
+		}
+
+		switch event.EventType {
+		case tcglog.EventTypeNoAction:
+			// not measured
+		case tcglog.EventTypeSeparator:
+			return h.measureSeparator(ctx, pcr, event)
+		default:
+			ctx.ExtendPCR(pcr, event.Digests[ctx.PCRAlg()])
+		}
+	}
+
+	return errors.New("missing separator")
+}
+
+// measureGPT measures the partition table of the boot disk supplied to the profile
+// to PCR5, using the same event type as the supplied event type from the log.
+func (h *fwLoadHandler) measureGPT(ctx pcrBranchContext, eventType tcglog.EventType) error {
+	data := newEFIGPTData(ctx.PartitionTable())
+
+	var digest []byte
+	var err error
+	switch eventType {
+	case tcglog.EventTypeEFIGPTEvent:
+		digest, err = tcglog.ComputeEFIGPTDataDigest(ctx.PCRAlg().GetHash(), data)
+	default:
+		digest, err = tcglog.ComputeEFIGPT2DataDigest(ctx.PCRAlg().GetHash(), data)
+	}
+	if err != nil {
+		return xerrors.Errorf("cannot compute digest: %w", err)
+	}
+	ctx.ExtendPCR(internal_efi.BootManagerConfigPCR, digest)
+	return nil
+}
+
+func (h *fwLoadHandler) measureBootManagerConfig(ctx pcrBranchContext) error {
+	// Replay the entire log for this PCR. Events in this PCR aren't only measured in
+	// the pre-OS environment - the GPT event is measured when a boot option is launched,
+	// and EV_EFI_ACTION events are measured when ExitBootServices is called from the
+	// OS-present environment. Boot variables are measured from the current variable set
+	// and the GPT event is computed from the supplied partition table if there is one,
+	// so that changes to these can be predicted.
+	if ctx.PartitionTable() != nil {
+		n := 0
+		for _, event := range h.log.Events {
+			if event.PCRIndex != internal_efi.BootManagerConfigPCR {
+				continue
+			}
+			if event.EventType == tcglog.EventTypeEFIGPTEvent || event.EventType == tcglog.EventTypeEFIGPTEvent2 {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("cannot compute GPT event from the supplied partition table because the log contains %d GPT events", n)
+		}
+	}
+
+	measuredSeparator := false
+	for i, event := range h.log.Events {
+		if event.PCRIndex != internal_efi.BootManagerConfigPCR {
+			continue
+		}
+
+		if isLoaderConfEvent(event) {
+			// systemd-boot measures loader.conf when it starts, so this and
+			// the events that follow it, such as those associated with
+			// ExitBootServices, are measured by the systemd-boot load handler.
+			fc := ctx.FwContext()
+			fc.LoaderConfEvent = event
+			fc.PendingBootManagerConfigEvents = nil
+			for _, event := range h.log.Events[i+1:] {
+				if event.PCRIndex == internal_efi.BootManagerConfigPCR {
+					fc.PendingBootManagerConfigEvents = append(fc.PendingBootManagerConfigEvents, event)
+				}
+			}
+			break
+		}
+
+		switch event.EventType {
+		case tcglog.EventTypeNoAction:
+			// not measured
+		case tcglog.EventTypeSeparator:
+			if measuredSeparator {
+				return errors.New("unexpected separator")
+			}
+			if err := h.measureSeparator(ctx, internal_efi.BootManagerConfigPCR, event); err != nil {
+				return err
+			}
+			measuredSeparator = true
+		case tcglog.EventTypeEFIGPTEvent, tcglog.EventTypeEFIGPTEvent2:
+			if ctx.PartitionTable() == nil {
+				ctx.ExtendPCR(internal_efi.BootManagerConfigPCR, event.Digests[ctx.PCRAlg()])
+				break
+			}
+			if err := h.measureGPT(ctx, event.EventType); err != nil {
+				return fmt.Errorf("cannot measure GPT: %w", err)
+			}
+		case tcglog.EventTypeEFIVariableBoot, tcglog.EventTypeEFIVariableBoot2:
+			data, ok := event.Data.(*tcglog.EFIVariableData)
+			if !ok {
+				// if the event data failed to decode, the resulting implementation is guaranteed to implement error.
+				return fmt.Errorf("cannot measure invalid boot variable event: %w", event.Data.(error))
+			}
+			if data.VariableName != efi.GlobalVariable {
+				ctx.ExtendPCR(internal_efi.BootManagerConfigPCR, event.Digests[ctx.PCRAlg()])
+				break
+			}
+			if err := h.measureBootVariable(ctx, internal_efi.BootManagerConfigPCR, event.EventType, data.UnicodeName); err != nil {
+				return fmt.Errorf("cannot measure %s: %w", data.UnicodeName, err)
+			}
+		default:
+			ctx.ExtendPCR(internal_efi.BootManagerConfigPCR, event.Digests[ctx.PCRAlg()])
+		}
+	}
+
+	if !measuredSeparator {
+		return errors.New("missing separator")
+	}
+	return nil
+}
+
 func (h *fwLoadHandler) measureBootManagerCodePreOS(ctx pcrBranchContext) error {
 	// Replay the log until the transition to the OS. Different firmware implementations and
 	// configurations perform different pre-OS measurements, and these events need to be preserved
@@ -327,25 +629,57 @@ func (h *fwLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
 			return fmt.Errorf("cannot measure platform firmware: %w", err)
 		}
 	}
+	if ctx.PCRs().Contains(internal_efi.PlatformConfigPCR) {
+		if err := h.measurePlatformConfig(ctx); err != nil {
+			return fmt.Errorf("cannot measure platform config: %w", err)
+		}
+	}
 	if ctx.PCRs().Contains(internal_efi.DriversAndAppsPCR) {
 		if err := h.measureDriversAndApps(ctx); err != nil {
 			return fmt.Errorf("cannot measure drivers and apps: %w", err)
 		}
 	}
+	if ctx.PCRs().Contains(internal_efi.DriversAndAppsConfigPCR) {
+		if err := h.measurePreOSEventsFromLog(ctx, internal_efi.DriversAndAppsConfigPCR); err != nil {
+			return fmt.Errorf("cannot measure drivers and apps config: %w", err)
+		}
+	}
 	if ctx.PCRs().Contains(internal_efi.BootManagerCodePCR) {
 		if err := h.measureBootManagerCodePreOS(ctx); err != nil {
 			return fmt.Errorf("cannot measure boot manager code: %w", err)
 		}
 	}
+	if ctx.PCRs().Contains(internal_efi.BootManagerConfigPCR) {
+		if err := h.measureBootManagerConfig(ctx); err != nil {
+			return fmt.Errorf("cannot measure boot manager config: %w", err)
+		}
+	}
+	if ctx.PCRs().Contains(internal_efi.PlatformManufacturerPCR) {
+		if err := h.measurePreOSEventsFromLog(ctx, internal_efi.PlatformManufacturerPCR); err != nil {
+			return fmt.Errorf("cannot measure platform manufacturer: %w", err)
+		}
+	}
 	if ctx.PCRs().Contains(internal_efi.SecureBootPolicyPCR) {
 		if err := h.measureSecureBootPolicyPreOS(ctx); err != nil {
 			return xerrors.Errorf("cannot measure secure boot policy: %w", err)
 		}
+	} else {
+		// The secure boot state and dbx are still required in order to check
+		// that images aren't revoked. The secure boot policy profile assumes
+		// that secure boot is enabled.
+		if err := h.readSecureBootPolicy(ctx); err != nil {
+			return xerrors.Errorf("cannot read secure boot policy: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// CheckImageLoadNotRevoked implements imageLoadRevocationChecker.CheckImageLoadNotRevoked.
+func (h *fwLoadHandler) CheckImageLoadNotRevoked(ctx pcrBranchContext, image peImageHandle) error {
+	return newFwImageLoadMeasurer(ctx, image).checkNotRevoked()
+}
+
 // MeasureImageLoad implements imageLoadHandler.MeasureImageLoad.
 func (h *fwLoadHandler) MeasureImageLoad(ctx pcrBranchContext, image peImageHandle) (imageLoadHandler, error) {
 	m := newFwImageLoadMeasurer(ctx, image)
@@ -403,6 +737,22 @@ func (m *fwImageLoadMeasurer) measurePEImageDigest() error {
 	return nil
 }
 
+// checkNotRevoked returns a *RevokedImageError if the firmware would refuse
+// to load the image because it is revoked by dbx.
+func (m *fwImageLoadMeasurer) checkNotRevoked() error {
+	if m.FwContext().SecureBootDisabled {
+		// The firmware doesn't verify images.
+		return nil
+	}
+	if err := m.CheckNotRevoked([]*secureBootDB{m.FwContext().Dbx}, m.image); err != nil {
+		return &RevokedImageError{Image: m.image.Source(), err: err}
+	}
+	return nil
+}
+
+// measure measures the verification and loading of the image. This doesn't
+// check whether the image is revoked, which is done once per image by the caller
+// with checkNotRevoked.
 func (m *fwImageLoadMeasurer) measure() error {
 	if m.PCRs().Contains(internal_efi.SecureBootPolicyPCR) {
 		if err := m.measureVerification(); err != nil {
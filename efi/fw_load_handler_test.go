@@ -20,6 +20,8 @@
 package efi_test
 
 import (
+	"crypto"
+	_ "crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -51,14 +53,16 @@ type testFwMeasureImageStartData struct {
 	logOptions     *efitest.LogOptions
 	alg            tpm2.HashAlgorithmId
 	pcrs           PcrFlags
+	partitionTable *efi.PartitionTable
 	expectedEvents []*mockPcrBranchEvent
 }
 
 func (s *fwLoadHandlerSuite) testMeasureImageStart(c *C, data *testFwMeasureImageStartData) *FwContext {
 	collector := NewVariableSetCollector(efitest.NewMockHostEnvironment(data.vars, nil))
 	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
-		alg:  data.alg,
-		pcrs: data.pcrs}, nil, collector.Next())
+		alg:            data.alg,
+		pcrs:           data.pcrs,
+		partitionTable: data.partitionTable}, nil, collector.Next())
 
 	handler := NewFwLoadHandler(efitest.NewLog(c, data.logOptions))
 	c.Check(handler.MeasureImageStart(ctx), IsNil)
@@ -89,6 +93,33 @@ func (s *fwLoadHandlerSuite) TestMeasureImageStartSecureBootPolicyProfile(c *C)
 	})
 }
 
+func (s *fwLoadHandlerSuite) TestMeasureImageStartReadsDbxWithoutSecureBootPolicyProfile(c *C) {
+	// Verify that dbx is read in order to check for revoked images even
+	// when it isn't measured.
+	vars := makeMockVars(c, withMsSecureBootConfig())
+	fc := s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:       vars,
+		logOptions: &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}},
+		alg:        tpm2.HashAlgorithmSHA256,
+	})
+	c.Check(fc.SecureBootDisabled, testutil.IsFalse)
+	c.Assert(fc.Dbx, NotNil)
+	c.Check(fc.Dbx.Name, Equals, Dbx)
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartSecureBootDisabledWithoutSecureBootPolicyProfile(c *C) {
+	// Verify that dbx isn't used when secure boot is disabled and the
+	// profile doesn't require it.
+	vars := makeMockVars(c, withMsSecureBootConfig(), withSecureBootDisabled())
+	fc := s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:       vars,
+		logOptions: &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}},
+		alg:        tpm2.HashAlgorithmSHA256,
+	})
+	c.Check(fc.SecureBootDisabled, testutil.IsTrue)
+	c.Check(fc.Dbx, IsNil)
+}
+
 func (s *fwLoadHandlerSuite) TestMeasureImageStartSecureBootPolicyProfileSecureBootDisabled(c *C) {
 	// Verify that we generate a profile that requires secure boot regardless of the state of
 	// the current environment.
@@ -310,6 +341,283 @@ func (s *fwLoadHandlerSuite) TestMeasureImageStartPlatformFirmwareProfileSL3(c *
 	})
 }
 
+// withBootVarsFromLog returns a mockVarsConfig that adds the boot variables
+// measured to PCR1 in the supplied log.
+func withBootVarsFromLog(log *tcglog.Log) mockVarsConfig {
+	return func(c *C, vars efitest.MockVars) {
+		for _, ev := range log.Events {
+			if ev.PCRIndex != internal_efi.PlatformConfigPCR || ev.EventType != tcglog.EventTypeEFIVariableBoot {
+				continue
+			}
+			data := ev.Data.(*tcglog.EFIVariableData)
+			vars.AddVar(data.UnicodeName, data.VariableName, efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, data.VariableData)
+		}
+	}
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartPlatformConfigProfile(c *C) {
+	logOptions := &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}}
+	log := efitest.NewLog(c, logOptions)
+
+	// The profile should match the log when the boot variables haven't changed.
+	expectedEvents := []*mockPcrBranchEvent{{pcr: 1, eventType: mockPcrBranchResetEvent}}
+	for _, ev := range log.Events {
+		if ev.PCRIndex != internal_efi.PlatformConfigPCR {
+			continue
+		}
+		expectedEvents = append(expectedEvents, &mockPcrBranchEvent{pcr: 1, eventType: mockPcrBranchExtendEvent, digest: ev.Digests[tpm2.HashAlgorithmSHA256]})
+	}
+	c.Assert(expectedEvents, HasLen, 6)
+
+	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:           makeMockVars(c, withBootVarsFromLog(log)),
+		logOptions:     logOptions,
+		alg:            tpm2.HashAlgorithmSHA256,
+		pcrs:           MakePcrFlags(internal_efi.PlatformConfigPCR),
+		expectedEvents: expectedEvents,
+	})
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartPlatformConfigProfileModifiedBootOrder(c *C) {
+	logOptions := &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}}
+	log := efitest.NewLog(c, logOptions)
+
+	vars := makeMockVars(c, withBootVarsFromLog(log))
+	// Change the boot order to 1,3 and remove Boot0000
+	order := []byte{0x01, 0x00, 0x03, 0x00}
+	vars.AddVar("BootOrder", efi.GlobalVariable, efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, order)
+
+	digest := func(data []byte) tpm2.Digest {
+		h := crypto.SHA256.New()
+		h.Write(data)
+		return h.Sum(nil)
+	}
+
+	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:       vars,
+		logOptions: logOptions,
+		alg:        tpm2.HashAlgorithmSHA256,
+		pcrs:       MakePcrFlags(internal_efi.PlatformConfigPCR),
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 1, eventType: mockPcrBranchResetEvent},
+			{pcr: 1, eventType: mockPcrBranchExtendEvent, digest: digest(order)},
+			{pcr: 1, eventType: mockPcrBranchExtendEvent, digest: digest(vars[efi.VariableDescriptor{Name: "Boot0001", GUID: efi.GlobalVariable}].Payload)},
+			{pcr: 1, eventType: mockPcrBranchExtendEvent, digest: digest(vars[efi.VariableDescriptor{Name: "Boot0003", GUID: efi.GlobalVariable}].Payload)},
+			{pcr: 1, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119")},
+		},
+	})
+}
+
+// partitionTableFromLog returns the partition table measured to PCR5 in the
+// supplied log.
+func partitionTableFromLog(c *C, log *tcglog.Log) *efi.PartitionTable {
+	for _, ev := range log.Events {
+		if ev.PCRIndex != internal_efi.BootManagerConfigPCR || ev.EventType != tcglog.EventTypeEFIGPTEvent {
+			continue
+		}
+		data := ev.Data.(*tcglog.EFIGPTData)
+		hdr := data.Hdr
+		return &efi.PartitionTable{Hdr: &hdr, Entries: data.Partitions}
+	}
+	c.Fatal("no GPT event")
+	return nil
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartBootManagerConfigProfile(c *C) {
+	logOptions := &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}}
+	log := efitest.NewLog(c, logOptions)
+
+	expectedEvents := []*mockPcrBranchEvent{{pcr: 5, eventType: mockPcrBranchResetEvent}}
+	for _, ev := range log.Events {
+		if ev.PCRIndex != internal_efi.BootManagerConfigPCR {
+			continue
+		}
+		expectedEvents = append(expectedEvents, &mockPcrBranchEvent{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: ev.Digests[tpm2.HashAlgorithmSHA256]})
+	}
+	c.Assert(expectedEvents, HasLen, 5)
+
+	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:           makeMockVars(c),
+		logOptions:     logOptions,
+		alg:            tpm2.HashAlgorithmSHA256,
+		pcrs:           MakePcrFlags(internal_efi.BootManagerConfigPCR),
+		expectedEvents: expectedEvents,
+	})
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartBootManagerConfigProfileWithPartitionTable(c *C) {
+	logOptions := &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}}
+	log := efitest.NewLog(c, logOptions)
+
+	// Supplying the same partition table with unused entries should produce the
+	// same profile as the log.
+	table := partitionTableFromLog(c, log)
+	table.Entries = append(table.Entries, new(efi.PartitionEntry), new(efi.PartitionEntry))
+
+	expectedEvents := []*mockPcrBranchEvent{{pcr: 5, eventType: mockPcrBranchResetEvent}}
+	for _, ev := range log.Events {
+		if ev.PCRIndex != internal_efi.BootManagerConfigPCR {
+			continue
+		}
+		expectedEvents = append(expectedEvents, &mockPcrBranchEvent{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: ev.Digests[tpm2.HashAlgorithmSHA256]})
+	}
+
+	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:           makeMockVars(c),
+		logOptions:     logOptions,
+		alg:            tpm2.HashAlgorithmSHA256,
+		pcrs:           MakePcrFlags(internal_efi.BootManagerConfigPCR),
+		partitionTable: table,
+		expectedEvents: expectedEvents,
+	})
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartBootManagerConfigProfileWithModifiedPartitionTable(c *C) {
+	logOptions := &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}}
+	log := efitest.NewLog(c, logOptions)
+
+	// Remove the last partition and extend the previous one.
+	table := partitionTableFromLog(c, log)
+	table.Entries = table.Entries[:2]
+	entry := *table.Entries[1]
+	entry.EndingLBA = 4000796671
+	table.Entries[1] = &entry
+
+	expectedGPTDigest, err := tcglog.ComputeEFIGPTDataDigest(crypto.SHA256, &tcglog.EFIGPTData{Hdr: *table.Hdr, Partitions: table.Entries})
+	c.Assert(err, IsNil)
+
+	expectedEvents := []*mockPcrBranchEvent{{pcr: 5, eventType: mockPcrBranchResetEvent}}
+	for _, ev := range log.Events {
+		if ev.PCRIndex != internal_efi.BootManagerConfigPCR {
+			continue
+		}
+		digest := ev.Digests[tpm2.HashAlgorithmSHA256]
+		if ev.EventType == tcglog.EventTypeEFIGPTEvent {
+			digest = expectedGPTDigest
+		}
+		expectedEvents = append(expectedEvents, &mockPcrBranchEvent{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: digest})
+	}
+
+	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:           makeMockVars(c),
+		logOptions:     logOptions,
+		alg:            tpm2.HashAlgorithmSHA256,
+		pcrs:           MakePcrFlags(internal_efi.BootManagerConfigPCR),
+		partitionTable: table,
+		expectedEvents: expectedEvents,
+	})
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartBootManagerConfigProfileWithLoaderConf(c *C) {
+	logOptions := &efitest.LogOptions{
+		Algorithms:            []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1},
+		SystemdBootLoaderConf: []byte("timeout 3\n"),
+	}
+	log := efitest.NewLog(c, logOptions)
+
+	// The events from the loader.conf event onwards are measured by the
+	// systemd-boot load handler.
+	expectedEvents := []*mockPcrBranchEvent{{pcr: 5, eventType: mockPcrBranchResetEvent}}
+	var loaderConfEvent *tcglog.Event
+	var pendingEvents []*tcglog.Event
+	for _, ev := range log.Events {
+		if ev.PCRIndex != internal_efi.BootManagerConfigPCR {
+			continue
+		}
+		switch {
+		case ev.EventType == tcglog.EventTypeEventTag:
+			loaderConfEvent = ev
+		case loaderConfEvent != nil:
+			pendingEvents = append(pendingEvents, ev)
+		default:
+			expectedEvents = append(expectedEvents, &mockPcrBranchEvent{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: ev.Digests[tpm2.HashAlgorithmSHA256]})
+		}
+	}
+	c.Assert(expectedEvents, HasLen, 3)
+	c.Assert(loaderConfEvent, NotNil)
+	c.Assert(pendingEvents, HasLen, 2)
+
+	fc := s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:           makeMockVars(c),
+		logOptions:     logOptions,
+		alg:            tpm2.HashAlgorithmSHA256,
+		pcrs:           MakePcrFlags(internal_efi.BootManagerConfigPCR),
+		expectedEvents: expectedEvents,
+	})
+	c.Check(fc.LoaderConfEvent, DeepEquals, loaderConfEvent)
+	c.Check(fc.PendingBootManagerConfigEvents, DeepEquals, pendingEvents)
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartDriversAndAppsConfigProfile(c *C) {
+	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:       makeMockVars(c),
+		logOptions: &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}},
+		alg:        tpm2.HashAlgorithmSHA256,
+		pcrs:       MakePcrFlags(internal_efi.DriversAndAppsConfigPCR),
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 3, eventType: mockPcrBranchResetEvent},
+			{pcr: 3, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119")},
+		},
+	})
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartPlatformManufacturerProfile(c *C) {
+	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
+		vars:       makeMockVars(c),
+		logOptions: &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}},
+		alg:        tpm2.HashAlgorithmSHA256,
+		pcrs:       MakePcrFlags(internal_efi.PlatformManufacturerPCR),
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 6, eventType: mockPcrBranchResetEvent},
+			{pcr: 6, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119")},
+		},
+	})
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartPlatformManufacturerProfileIgnoresEventsAfterSeparator(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{
+		Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}})
+
+	// Insert an event before and after the separator, and a EV_NO_ACTION event
+	// which isn't measured.
+	var events []*tcglog.Event
+	for _, event := range log.Events {
+		if event.PCRIndex == internal_efi.PlatformManufacturerPCR && event.EventType == tcglog.EventTypeSeparator {
+			events = append(events,
+				&tcglog.Event{
+					PCRIndex:  internal_efi.PlatformManufacturerPCR,
+					EventType: tcglog.EventTypeNoAction,
+					Digests:   tcglog.DigestMap{tpm2.HashAlgorithmSHA256: make(tpm2.Digest, 32)},
+					Data:      &tcglog.SpecIdEvent03{}},
+				&tcglog.Event{
+					PCRIndex:  internal_efi.PlatformManufacturerPCR,
+					EventType: tcglog.EventTypeCompactHash,
+					Digests:   tcglog.DigestMap{tpm2.HashAlgorithmSHA256: testutil.DecodeHexString(c, "a31e0a2e2c3d8dcd2c3c8e3c2e1b3d6d8e3c9d4b6e3a5c9d2f1e6a7b8c9d0e1f")}})
+			events = append(events, event,
+				&tcglog.Event{
+					PCRIndex:  internal_efi.PlatformManufacturerPCR,
+					EventType: tcglog.EventTypeCompactHash,
+					Digests:   tcglog.DigestMap{tpm2.HashAlgorithmSHA256: testutil.DecodeHexString(c, "0fd6c8e6cbd2dd7dccbc1a1e1a4bd8b1ab9f3d4a4da0e6a1b0e2d8e2a4e5f1c2")}})
+			continue
+		}
+		events = append(events, event)
+	}
+	log.Events = events
+
+	collector := NewVariableSetCollector(efitest.NewMockHostEnvironment(nil, nil))
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(internal_efi.PlatformManufacturerPCR)}, nil, collector.Next())
+
+	handler := NewFwLoadHandler(log)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 6, eventType: mockPcrBranchResetEvent},
+		{pcr: 6, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "a31e0a2e2c3d8dcd2c3c8e3c2e1b3d6d8e3c9d4b6e3a5c9d2f1e6a7b8c9d0e1f")},
+		{pcr: 6, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119")},
+	})
+}
+
 func (s *fwLoadHandlerSuite) TestMeasureImageStartDriversAndAppsProfile(c *C) {
 	s.testMeasureImageStart(c, &testFwMeasureImageStartData{
 		logOptions: &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}},
@@ -570,6 +878,11 @@ func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogSeparatorErrorPCR2(c
 	c.Check(err, ErrorMatches, `cannot measure drivers and apps: separator indicates that a firmware error occurred \(error code from log: 4176\)`)
 }
 
+func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogSeparatorErrorPCR3(c *C) {
+	err := s.testMeasureImageStartErrBadLogSeparatorError(c, 3)
+	c.Check(err, ErrorMatches, `cannot measure drivers and apps config: separator indicates that a firmware error occurred \(error code from log: 4176\)`)
+}
+
 func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogSeparatorErrorPCR4(c *C) {
 	err := s.testMeasureImageStartErrBadLogSeparatorError(c, 4)
 	c.Check(err, ErrorMatches, `cannot measure boot manager code: separator indicates that a firmware error occurred \(error code from log: 4176\)`)
@@ -655,11 +968,49 @@ func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogMissingSeparatorPCR2(
 	c.Check(err, ErrorMatches, `cannot measure drivers and apps: missing separator`)
 }
 
+func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogMissingSeparatorPCR3(c *C) {
+	err := s.testMeasureImageStartErrBadLogMissingSeparator(c, 3)
+	c.Check(err, ErrorMatches, `cannot measure drivers and apps config: missing separator`)
+}
+
 func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogMissingSeparatorPCR4(c *C) {
 	err := s.testMeasureImageStartErrBadLogMissingSeparator(c, 4)
 	c.Check(err, ErrorMatches, `cannot measure boot manager code: missing separator`)
 }
 
+func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogMissingSeparatorPCR5(c *C) {
+	err := s.testMeasureImageStartErrBadLogMissingSeparator(c, 5)
+	c.Check(err, ErrorMatches, `cannot measure boot manager config: missing separator`)
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartErrMultipleGPTEventsWithPartitionTable(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{
+		Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1}})
+	table := partitionTableFromLog(c, log)
+	for i, event := range log.Events {
+		if event.PCRIndex == internal_efi.BootManagerConfigPCR && event.EventType == tcglog.EventTypeEFIGPTEvent {
+			// Duplicate the GPT event
+			events := append([]*tcglog.Event{}, log.Events[:i+1]...)
+			log.Events = append(append(events, event), log.Events[i+1:]...)
+			break
+		}
+	}
+
+	collector := NewVariableSetCollector(efitest.NewMockHostEnvironment(nil, nil))
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:            tpm2.HashAlgorithmSHA256,
+		pcrs:           MakePcrFlags(internal_efi.BootManagerConfigPCR),
+		partitionTable: table}, nil, collector.Next())
+
+	handler := NewFwLoadHandler(log)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `cannot measure boot manager config: cannot compute GPT event from the supplied partition table because the log contains 2 GPT events`)
+}
+
+func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogMissingSeparatorPCR6(c *C) {
+	err := s.testMeasureImageStartErrBadLogMissingSeparator(c, 6)
+	c.Check(err, ErrorMatches, `cannot measure platform manufacturer: missing separator`)
+}
+
 func (s *fwLoadHandlerSuite) TestMeasureImageStartErrBadLogMissingSeparatorPCR7(c *C) {
 	err := s.testMeasureImageStartErrBadLogMissingSeparator(c, 7)
 	c.Check(err, ErrorMatches, `cannot measure secure boot policy: unexpected verification event`)
@@ -731,6 +1082,25 @@ func (s *fwLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfileExisting
 	})
 }
 
+func (s *fwLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfileDigestInDb(c *C) {
+	digest := testutil.DecodeHexString(c, "a6bb8e6b0c6a0a5a2b9bfa2cf3a0bdfd6bd0c7bcbb8cb34b9b4f1a1c2b3c4d5e")
+	verificationDigest := testutil.DecodeHexString(c, "e683937ab404575d82dcf0a5169d9db50464557096c7b6d505fa394b96273b97")
+
+	s.testMeasureImageLoad(c, &testFwMeasureImageLoadData{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		db: append(msDb(c), &efi.SignatureList{
+			Type:       efi.CertSHA256Guid,
+			Signatures: []*efi.SignatureData{{Owner: testOwnerGuid, Data: digest}},
+		}),
+		image: newMockImage().withDigest(crypto.SHA256, digest),
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: verificationDigest},
+		},
+		verificationDigest: verificationDigest,
+	})
+}
+
 func (s *fwLoadHandlerSuite) TestMeasureImageLoadBootManagerCodeProfile1(c *C) {
 	s.testMeasureImageLoad(c, &testFwMeasureImageLoadData{
 		alg:   tpm2.HashAlgorithmSHA256,
@@ -768,3 +1138,50 @@ func (s *fwLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyAndBootManagerC
 		verificationDigest: verificationDigest,
 	})
 }
+
+func (s *fwLoadHandlerSuite) TestMeasureImageLoadRevokedByDbxSecureBootDisabled(c *C) {
+	// The firmware doesn't check dbx when secure boot is disabled.
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.BootManagerCodePCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().SecureBootDisabled = true
+	ctx.FwContext().Dbx = &SecureBootDB{
+		Name:     Dbx,
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, msUefiCACert, msOwnerGuid)},
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4))
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := NewFwLoadHandler(nil)
+	c.Check(handler.(ImageLoadRevocationChecker).CheckImageLoadNotRevoked(ctx, image.newPeImageHandle()), IsNil)
+	_, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(ctx.events, HasLen, 1)
+}
+
+func (s *fwLoadHandlerSuite) TestCheckImageLoadNotRevokedByDbx(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{Name: Db, Contents: msDb(c)}
+	ctx.FwContext().Dbx = &SecureBootDB{
+		Name:     Dbx,
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, msUefiCACert, msOwnerGuid)},
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4))
+
+	handler := NewFwLoadHandler(nil)
+	err := handler.(ImageLoadRevocationChecker).CheckImageLoadNotRevoked(ctx, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `image .* is revoked: certificate "CN=Microsoft Corporation UEFI CA 2011,O=Microsoft Corporation,L=Redmond,ST=Washington,C=US" is in dbx`)
+
+	var e *RevokedImageError
+	c.Assert(errors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Image, Equals, image)
+	c.Check(ctx.events, HasLen, 0)
+}
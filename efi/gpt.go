@@ -0,0 +1,73 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi
+
+import (
+	"fmt"
+	"io"
+
+	efi "github.com/canonical/go-efilib"
+	"github.com/canonical/tcglog-parser"
+
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+)
+
+type bootDiskPartitionTableOption struct {
+	disk    io.ReaderAt
+	totalSz int64
+	blockSz int64
+}
+
+func (o *bootDiskPartitionTableOption) ApplyOptionTo(visitor internal_efi.PCRProfileOptionVisitor) error {
+	table, err := efi.ReadPartitionTable(o.disk, o.totalSz, o.blockSz, efi.PrimaryPartitionTable, true)
+	if err != nil {
+		return fmt.Errorf("cannot read partition table from boot disk: %w", err)
+	}
+	visitor.SetPartitionTable(table)
+	return nil
+}
+
+// WithBootDiskPartitionTable can be supplied to AddPCRProfile to compute the
+// EV_EFI_GPT_EVENT measurement from the primary GUID partition table of the supplied
+// boot disk rather than copying it from the log. This makes it possible to predict
+// a planned change to the partition table, and is only useful in combination with
+// [WithBootManagerConfigProfile]. The total size and logical block size of the disk
+// must be supplied - the logical block size is 512 bytes for a file, but must be
+// obtained from the kernel for a block device.
+func WithBootDiskPartitionTable(disk io.ReaderAt, totalSz, blockSz int64) PCRProfileOption {
+	return &bootDiskPartitionTableOption{
+		disk:    disk,
+		totalSz: totalSz,
+		blockSz: blockSz}
+}
+
+// newEFIGPTData returns the UEFI_GPT_DATA that the firmware measures for the supplied
+// partition table. This only contains the partition entries that are in use, in the
+// order in which they appear in the table.
+func newEFIGPTData(table *efi.PartitionTable) *tcglog.EFIGPTData {
+	data := &tcglog.EFIGPTData{Hdr: *table.Hdr}
+	for _, entry := range table.Entries {
+		if entry.PartitionTypeGUID == (efi.GUID{}) {
+			continue
+		}
+		data.Partitions = append(data.Partitions, entry)
+	}
+	return data
+}
@@ -0,0 +1,130 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi_test
+
+import (
+	"bytes"
+	"hash/crc32"
+
+	. "gopkg.in/check.v1"
+
+	efi "github.com/canonical/go-efilib"
+	"github.com/canonical/go-tpm2"
+
+	. "github.com/snapcore/secboot/efi"
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+)
+
+type gptSuite struct{}
+
+var _ = Suite(&gptSuite{})
+
+// makeMockDisk returns the contents of a disk with 512 byte logical blocks, a
+// protective MBR and a primary GUID partition table containing the supplied
+// entries. The partition entry array CRC in the supplied header is updated.
+func makeMockDisk(c *C, hdr *efi.PartitionTableHeader, entries []*efi.PartitionEntry) []byte {
+	const blockSz = 512
+
+	entriesData := new(bytes.Buffer)
+	for i := uint32(0); i < hdr.NumberOfPartitionEntries; i++ {
+		entry := new(efi.PartitionEntry)
+		if int(i) < len(entries) {
+			entry = entries[i]
+		}
+		b := new(bytes.Buffer)
+		c.Assert(entry.Write(b), IsNil)
+		entryData := make([]byte, hdr.SizeOfPartitionEntry)
+		copy(entryData, b.Bytes())
+		entriesData.Write(entryData)
+	}
+	hdr.PartitionEntryArrayCRC32 = crc32.ChecksumIEEE(entriesData.Bytes())
+
+	disk := make([]byte, (hdr.PartitionEntryLBA*blockSz)+efi.LBA(entriesData.Len()))
+
+	// Protective MBR
+	disk[446+4] = 0xee
+	disk[510] = 0x55
+	disk[511] = 0xaa
+
+	hdrData := new(bytes.Buffer)
+	c.Assert(hdr.Write(hdrData), IsNil)
+	copy(disk[blockSz:], hdrData.Bytes())
+	copy(disk[hdr.PartitionEntryLBA*blockSz:], entriesData.Bytes())
+
+	return disk
+}
+
+func (s *gptSuite) TestWithBootManagerConfigProfile(c *C) {
+	opt := WithBootManagerConfigProfile()
+	pcrs, err := opt.PCRs()
+	c.Check(err, IsNil)
+	c.Check(pcrs, DeepEquals, tpm2.HandleList{internal_efi.BootManagerConfigPCR})
+
+	visitor := new(mockPcrProfileOptionVisitor)
+	c.Check(opt.ApplyOptionTo(visitor), IsNil)
+	c.Check(visitor.pcrs, DeepEquals, tpm2.HandleList{internal_efi.BootManagerConfigPCR})
+}
+
+func (s *gptSuite) TestWithBootDiskPartitionTable(c *C) {
+	hdr := &efi.PartitionTableHeader{
+		HeaderSize:               92,
+		MyLBA:                    1,
+		AlternateLBA:             8191,
+		FirstUsableLBA:           34,
+		LastUsableLBA:            8158,
+		DiskGUID:                 efi.MakeGUID(0xa4ae73c2, 0x0e2f, 0x4513, 0xbd3c, [...]uint8{0x45, 0x6d, 0xa7, 0xf7, 0xf0, 0xfd}),
+		PartitionEntryLBA:        2,
+		NumberOfPartitionEntries: 128,
+		SizeOfPartitionEntry:     128}
+	entries := []*efi.PartitionEntry{
+		{
+			PartitionTypeGUID:   efi.MakeGUID(0xc12a7328, 0xf81f, 0x11d2, 0xba4b, [...]uint8{0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b}),
+			UniquePartitionGUID: efi.MakeGUID(0x66de947b, 0xfdb2, 0x4525, 0xb752, [...]uint8{0x30, 0xd6, 0x6b, 0xb2, 0xb9, 0x60}),
+			StartingLBA:         2048,
+			EndingLBA:           4095,
+			PartitionName:       "EFI System Partition",
+		},
+		{
+			PartitionTypeGUID:   efi.MakeGUID(0x0fc63daf, 0x8483, 0x4772, 0x8e79, [...]uint8{0x3d, 0x69, 0xd8, 0x47, 0x7d, 0xe4}),
+			UniquePartitionGUID: efi.MakeGUID(0x631b17dc, 0xedb7, 0x4d1d, 0xa761, [...]uint8{0x6d, 0xce, 0x3e, 0xfc, 0xe4, 0x15}),
+			StartingLBA:         4096,
+			EndingLBA:           8158,
+		}}
+	disk := makeMockDisk(c, hdr, entries)
+
+	visitor := new(mockPcrProfileOptionVisitor)
+	c.Check(WithBootDiskPartitionTable(bytes.NewReader(disk), int64(len(disk)), 512).ApplyOptionTo(visitor), IsNil)
+	c.Assert(visitor.partitionTable, NotNil)
+	c.Check(visitor.partitionTable.Hdr, DeepEquals, hdr)
+	c.Assert(visitor.partitionTable.Entries, HasLen, 128)
+	c.Check(visitor.partitionTable.Entries[:2], DeepEquals, entries)
+	c.Check(visitor.partitionTable.Entries[2], DeepEquals, new(efi.PartitionEntry))
+}
+
+func (s *gptSuite) TestWithBootDiskPartitionTableNoProtectiveMBR(c *C) {
+	disk := make([]byte, 34*512)
+	disk[510] = 0x55
+	disk[511] = 0xaa
+
+	visitor := new(mockPcrProfileOptionVisitor)
+	c.Check(WithBootDiskPartitionTable(bytes.NewReader(disk), int64(len(disk)), 512).ApplyOptionTo(visitor), ErrorMatches,
+		`cannot read partition table from boot disk: no protective master boot record found`)
+	c.Check(visitor.partitionTable, IsNil)
+}
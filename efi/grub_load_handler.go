@@ -53,15 +53,21 @@ func (h *grubLoadHandler) MeasureImageStart(_ pcrBranchContext) error {
 	return nil
 }
 
+// CheckImageLoadNotRevoked implements imageLoadRevocationChecker.CheckImageLoadNotRevoked.
+func (h *grubLoadHandler) CheckImageLoadNotRevoked(ctx pcrBranchContext, image peImageHandle) error {
+	if h.Flags&grubChainloaderUsesShimProtocol != 0 {
+		return checkImageLoadUsingShimIfLoadedNotRevoked(ctx, image)
+	}
+	return newFwImageLoadMeasurer(ctx, image).checkNotRevoked()
+}
+
 // MeasureImageLoad implements imageLoadHandler.MeasureImageLoad.
 func (h *grubLoadHandler) MeasureImageLoad(ctx pcrBranchContext, image peImageHandle) (imageLoadHandler, error) {
 	var err error
 	if h.Flags&grubChainloaderUsesShimProtocol != 0 {
-		m := newShimImageLoadMeasurer(ctx, image)
-		err = m.measure()
+		err = measureImageLoadUsingShimIfLoaded(ctx, image)
 	} else {
-		m := newFwImageLoadMeasurer(ctx, image)
-		err = m.measure()
+		err = newFwImageLoadMeasurer(ctx, image).measure()
 	}
 	if err != nil {
 		return nil, xerrors.Errorf("cannot measure image: %w", err)
@@ -98,6 +98,39 @@ func (s *grubLoadHandlerSuite) TestMeasureImageLoadUbuntuUsesShim15_6(c *C) {
 	c.Check(ctx.ShimContext().HasVerificationEvent(ctx.events[0].digest), testutil.IsTrue)
 }
 
+func (s *grubLoadHandlerSuite) TestMeasureImageLoadUsesShimNoSbatSection(c *C) {
+	// Shim doesn't require a .sbat section for images that are verified
+	// using its protocol, so a kernel without one is not revoked.
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{
+		Name:     Db,
+		Contents: msDb(c),
+	}
+	ctx.ShimContext().Flags = ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement
+	ctx.ShimContext().VendorDb = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+	}
+	ctx.ShimContext().SbatLevel = []byte("sbat,1,2022052400\ngrub,2\n")
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, kernelUbuntuSig3))
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := &GrubLoadHandler{Flags: GrubChainloaderUsesShimProtocol}
+	c.Check(handler.CheckImageLoadNotRevoked(ctx, image.newPeImageHandle()), IsNil)
+
+	childHandler, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(childHandler, Equals, s.mockImageLoadHandlerMap[image])
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "68bdff38e48c399326ca7356eb992693d13301f3925caf10e7b39dc9240789cd")},
+	})
+}
+
 func (s *grubLoadHandlerSuite) TestMeasureImageLoadNoShim(c *C) {
 	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
 		alg:      tpm2.HashAlgorithmSHA256,
@@ -106,8 +106,14 @@ func (p FileImage) Open() (ImageReader, error) {
 // loadParams correspond to a set of parameters that apply to a single branch
 // in a PCR profile.
 type loadParams struct {
-	KernelCommandline string
-	SnapModel         secboot.SnapModel
+	KernelCommandline  string
+	SnapModel          secboot.SnapModel
+	SystemdCredentials [][]byte
+	SystemdSysexts     []Image
+	SystemdConfexts    []Image
+	UKIAddons          []Image
+	Devicetree         []byte
+	LoaderConf         []byte
 }
 
 // ImageLoadParams provides one or more values for an external parameter that
@@ -161,6 +167,148 @@ func (p snapModelParams) applyTo(params ...loadParams) []loadParams {
 	return out
 }
 
+type systemdCredentialsParams [][][]byte
+
+// SystemdCredentialsParams returns a ImageLoadParams for the specified sets of
+// credentials that are loaded from the ESP and measured by systemd-stub. Each set
+// consists of the contents of each credential file in the order in which systemd-stub
+// measures them, which is the credentials specific to the UKI (in the UKI's .extra.d
+// directory) sorted by filename, followed by the global credentials (in the
+// /loader/credentials directory) sorted by filename.
+func SystemdCredentialsParams(sets ...[][]byte) ImageLoadParams {
+	return systemdCredentialsParams(sets)
+}
+
+func (p systemdCredentialsParams) applyTo(params ...loadParams) []loadParams {
+	var out []loadParams
+	for _, creds := range [][][]byte(p) {
+		p := make([]loadParams, len(params))
+		copy(p, params)
+		for i := range p {
+			p[i].SystemdCredentials = creds
+		}
+		out = append(out, p...)
+	}
+	return out
+}
+
+type systemdSysextParams [][]Image
+
+// SystemdSysextParams returns a ImageLoadParams for the specified sets of system
+// extension images that are loaded from the ESP and measured by systemd-stub. Each
+// set consists of each system extension image in the order in which systemd-stub
+// measures them, which is the images specific to the UKI (in the UKI's .extra.d
+// directory) sorted by filename, followed by the global images (in the
+// /loader/extensions directory) sorted by filename.
+func SystemdSysextParams(sets ...[]Image) ImageLoadParams {
+	return systemdSysextParams(sets)
+}
+
+func (p systemdSysextParams) applyTo(params ...loadParams) []loadParams {
+	var out []loadParams
+	for _, sysexts := range [][]Image(p) {
+		p := make([]loadParams, len(params))
+		copy(p, params)
+		for i := range p {
+			p[i].SystemdSysexts = sysexts
+		}
+		out = append(out, p...)
+	}
+	return out
+}
+
+type systemdConfextParams [][]Image
+
+// SystemdConfextParams returns a ImageLoadParams for the specified sets of
+// configuration extension images that are loaded from the ESP and measured by
+// systemd-stub. Each set consists of each configuration extension image in the
+// order in which systemd-stub measures them, which is the images specific to the
+// UKI (in the UKI's .extra.d directory) sorted by filename.
+func SystemdConfextParams(sets ...[]Image) ImageLoadParams {
+	return systemdConfextParams(sets)
+}
+
+func (p systemdConfextParams) applyTo(params ...loadParams) []loadParams {
+	var out []loadParams
+	for _, confexts := range [][]Image(p) {
+		p := make([]loadParams, len(params))
+		copy(p, params)
+		for i := range p {
+			p[i].SystemdConfexts = confexts
+		}
+		out = append(out, p...)
+	}
+	return out
+}
+
+type ukiAddonParams [][]Image
+
+// UKIAddonParams returns a ImageLoadParams for the specified sets of UKI addons
+// that are loaded from the ESP by systemd-stub. Each set consists of each addon
+// PE image in the order in which systemd-stub loads them, which is the global
+// addons (in the /loader/addons directory) sorted by filename, followed by the
+// addons specific to the UKI (in the UKI's .extra.d directory) sorted by filename.
+func UKIAddonParams(sets ...[]Image) ImageLoadParams {
+	return ukiAddonParams(sets)
+}
+
+func (p ukiAddonParams) applyTo(params ...loadParams) []loadParams {
+	var out []loadParams
+	for _, addons := range [][]Image(p) {
+		p := make([]loadParams, len(params))
+		copy(p, params)
+		for i := range p {
+			p[i].UKIAddons = addons
+		}
+		out = append(out, p...)
+	}
+	return out
+}
+
+type devicetreeParams [][]byte
+
+// DevicetreeParams returns a ImageLoadParams for the specified devicetree blobs,
+// which are installed and measured by systemd-boot when it loads a kernel from a
+// type #1 boot loader entry with the devicetree key.
+func DevicetreeParams(blobs ...[]byte) ImageLoadParams {
+	return devicetreeParams(blobs)
+}
+
+func (p devicetreeParams) applyTo(params ...loadParams) []loadParams {
+	var out []loadParams
+	for _, blob := range [][]byte(p) {
+		p := make([]loadParams, len(params))
+		copy(p, params)
+		for i := range p {
+			p[i].Devicetree = blob
+		}
+		out = append(out, p...)
+	}
+	return out
+}
+
+type loaderConfParams [][]byte
+
+// SystemdBootLoaderConfParams returns a ImageLoadParams for the specified contents
+// of systemd-boot's loader.conf, which is measured by systemd-boot when it starts.
+// These should be supplied to the systemd-boot image.
+func SystemdBootLoaderConfParams(confs ...[]byte) ImageLoadParams {
+	return loaderConfParams(confs)
+}
+
+func (p loaderConfParams) applyTo(params ...loadParams) []loadParams {
+	var out []loadParams
+	for _, conf := range [][]byte(p) {
+		p := make([]loadParams, len(params))
+		copy(p, params)
+		for i := range p {
+			p[i].LoaderConf = conf
+		}
+		out = append(out, p...)
+	}
+	return out
+}
+
 type imageLoadParamsSet []ImageLoadParams
 
 func (s imageLoadParamsSet) Resolve(initial *loadParams) []loadParams {
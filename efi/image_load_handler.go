@@ -38,6 +38,16 @@ type imageLoadHandler interface {
 	MeasureImageLoad(ctx pcrBranchContext, image peImageHandle) (imageLoadHandler, error)
 }
 
+// imageLoadRevocationChecker is implemented by imageLoadHandlers for images
+// that verify the images that they load, either directly or by using the
+// platform firmware or shim.
+type imageLoadRevocationChecker interface {
+	// CheckImageLoadNotRevoked returns a *RevokedImageError if the supplied
+	// image would be refused by the image associated with this handler because
+	// it is revoked in the supplied branch.
+	CheckImageLoadNotRevoked(ctx pcrBranchContext, image peImageHandle) error
+}
+
 // errNoHandler is returned from a imageLoadHandlerConstructor if there is
 // no appropriate handler
 var errNoHandler = errors.New("no handler")
@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"crypto"
 	"fmt"
+	"io"
 
 	"golang.org/x/xerrors"
 )
@@ -203,6 +204,25 @@ func (p sbatComponentExists) Matches(image peImageHandle) (bool, error) {
 	return false, nil
 }
 
+// systemdLoaderInfoIs is a predicate that is satisfied if an image has a
+// .sdmagic section that identifies it as the specified systemd EFI
+// component, eg, "systemd-boot" or "systemd-stub".
+type systemdLoaderInfoIs string
+
+func (p systemdLoaderInfoIs) Matches(image peImageHandle) (bool, error) {
+	r := image.OpenSection(".sdmagic")
+	if r == nil {
+		return false, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return false, xerrors.Errorf("cannot read .sdmagic section: %w", err)
+	}
+
+	// The section contains "#### LoaderInfo: <component> <version> ####".
+	return bytes.HasPrefix(data, []byte("#### LoaderInfo: "+string(p)+" ")), nil
+}
+
 type shimVersionPredicate struct {
 	operator string
 	version  string
@@ -168,6 +168,17 @@ func makeMicrosoftUEFICASecureBootNamespaceRules() *secureBootNamespaceRules {
 			),
 			newGrubLoadHandler,
 		),
+		withImageRule(
+			"systemd-boot",
+			imageMatchesAny(
+				imageMatchesAll(
+					sbatSectionExists,
+					sbatComponentExists("systemd-boot"),
+				),
+				systemdLoaderInfoIs("systemd-boot"),
+			),
+			newSystemdBootLoadHandler,
+		),
 		withImageRule(
 			"Ubuntu Core UKI",
 			imageMatchesAny(
@@ -184,7 +195,7 @@ func makeMicrosoftUEFICASecureBootNamespaceRules() *secureBootNamespaceRules {
 					imageSignedByOrganization("Canonical Ltd."),
 				),
 			),
-			newUbuntuCoreUKILoadHandler,
+			withSystemdPCRPolicy(newUbuntuCoreUKILoadHandler),
 		),
 	)
 }
@@ -213,7 +224,52 @@ func makeFallbackImageRules() *imageRules {
 			imageSectionExists("mods"),
 			newGrubLoadHandler,
 		),
-		// TODO: add rules for Ubuntu Core UKIs that are not part of the MS UEFI CA
+		// systemd-boot
+		newImageRule(
+			"systemd-boot",
+			systemdLoaderInfoIs("systemd-boot"),
+			newSystemdBootLoadHandler,
+		),
+		// Ubuntu Core UKI. This has to come before the generic systemd-stub UKI
+		// rules because its handler measures the snap model.
+		newImageRule(
+			"Ubuntu Core UKI",
+			imageMatchesAny(
+				imageMatchesAll(
+					sbatSectionExists,
+					sbatComponentExists("systemd.ubuntu"),
+				),
+				imageMatchesAll(
+					imageSectionExists(".linux"),
+					imageSectionExists(".initrd"),
+					imageSignedByOrganization("Canonical Ltd."),
+				),
+			),
+			withSystemdPCRPolicy(newUbuntuCoreUKILoadHandler),
+		),
+		// UKIs with PCR policies signed by systemd-measure
+		newImageRule(
+			"systemd-stub UKI with signed PCR policies",
+			imageMatchesAll(
+				imageSectionExists(".linux"),
+				imageSectionExists(systemdPCRSigSection),
+				imageSectionExists(systemdPCRPKeySection),
+			),
+			withSystemdPCRPolicy(newSystemdStubUKILoadHandler),
+		),
+		// Other UKIs based on systemd-stub, such as those from other distributions
+		// or signed with a custom key.
+		newImageRule(
+			"systemd-stub UKI",
+			imageMatchesAll(
+				imageSectionExists(".linux"),
+				imageMatchesAny(
+					imageSectionExists(".sdmagic"),
+					imageSectionExists(".osrel"),
+				),
+			),
+			newSystemdStubUKILoadHandler,
+		),
 		//
 		// Catch-all for unrecognized leaf images
 		newImageRule(
@@ -21,6 +21,10 @@ package efi_test
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
 	"io"
 
 	efi "github.com/canonical/go-efilib"
@@ -196,7 +200,8 @@ func (s *imageRulesDefsSuite) TestMSNewImageLoadHandlerUbuntuUKISbat(c *C) {
 	rules.AddAuthorities(testutil.ParseCertificate(c, canonicalCACert))
 	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
 	c.Assert(err, IsNil)
-	c.Assert(handler, testutil.ConvertibleTo, &UbuntuCoreUKILoadHandler{})
+	c.Assert(handler, testutil.ConvertibleTo, &SystemdPCRPolicyLoadHandler{})
+	c.Check(handler.(*SystemdPCRPolicyLoadHandler).Handler(), testutil.ConvertibleTo, &UbuntuCoreUKILoadHandler{})
 }
 
 func (s *imageRulesDefsSuite) TestMSNewImageLoadHandlerUbuntuUKINoSbat(c *C) {
@@ -207,7 +212,38 @@ func (s *imageRulesDefsSuite) TestMSNewImageLoadHandlerUbuntuUKINoSbat(c *C) {
 	rules.AddAuthorities(testutil.ParseCertificate(c, canonicalCACert))
 	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
 	c.Assert(err, IsNil)
-	c.Assert(handler, testutil.ConvertibleTo, &UbuntuCoreUKILoadHandler{})
+	c.Assert(handler, testutil.ConvertibleTo, &SystemdPCRPolicyLoadHandler{})
+	c.Check(handler.(*SystemdPCRPolicyLoadHandler).Handler(), testutil.ConvertibleTo, &UbuntuCoreUKILoadHandler{})
+}
+
+func (s *imageRulesDefsSuite) TestMSNewImageLoadHandlerSystemdBootSbat(c *C) {
+	// Verify that we get a systemdBootLoadHandler for systemd-boot
+	image := newMockImage().
+		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
+		withSbat([]SbatComponent{
+			{Name: "sbat"},
+			{Name: "systemd-boot"},
+		})
+
+	rules := MakeMicrosoftUEFICASecureBootNamespaceRules()
+	rules.AddAuthorities(testutil.ParseCertificate(c, canonicalCACert))
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler, testutil.ConvertibleTo, &SystemdBootLoadHandler{})
+}
+
+func (s *imageRulesDefsSuite) TestMSNewImageLoadHandlerSystemdBootSdMagic(c *C) {
+	// Verify that we get a systemdBootLoadHandler for systemd-boot without
+	// a SBAT component that identifies it
+	image := newMockImage().
+		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
+		addSection(".sdmagic", []byte("#### LoaderInfo: systemd-boot 255 ####"))
+
+	rules := MakeMicrosoftUEFICASecureBootNamespaceRules()
+	rules.AddAuthorities(testutil.ParseCertificate(c, canonicalCACert))
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler, testutil.ConvertibleTo, &SystemdBootLoadHandler{})
 }
 
 func (s *imageRulesDefsSuite) TestMSNewImageLoadHandlerUbuntuGrubRecognized(c *C) {
@@ -272,6 +308,92 @@ func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerGrub(c *C) {
 	c.Check(handler.(*GrubLoadHandler), DeepEquals, new(GrubLoadHandler))
 }
 
+func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerSystemdBoot(c *C) {
+	// verify that systemd-boot is recognized by the fallback rules
+	image := newMockImage().
+		addSection(".sdmagic", []byte("#### LoaderInfo: systemd-boot 255 ####"))
+
+	rules := MakeFallbackImageRules()
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler, testutil.ConvertibleTo, &SystemdBootLoadHandler{})
+}
+
+func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerUbuntuUKISbat(c *C) {
+	// verify that an Ubuntu Core UKI is recognized by the fallback rules and
+	// isn't handled by the generic systemd-stub UKI rules
+	image := newMockImage().
+		addSection(".linux", nil).
+		addSection(".initrd", nil).
+		addSection(".osrel", []byte("ID=ubuntu-core\n")).
+		withSbat([]SbatComponent{
+			{Name: "sbat"},
+			{Name: "systemd"},
+			{Name: "systemd.ubuntu"},
+		})
+
+	rules := MakeFallbackImageRules()
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Assert(handler, testutil.ConvertibleTo, &SystemdPCRPolicyLoadHandler{})
+	c.Check(handler.(*SystemdPCRPolicyLoadHandler).Handler(), testutil.ConvertibleTo, &UbuntuCoreUKILoadHandler{})
+}
+
+func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerUbuntuUKINoSbat(c *C) {
+	// verify that an Ubuntu Core UKI (pre-SBAT) is recognized by the fallback rules
+	image := newMockUbuntuKernelImage1(c)
+
+	rules := MakeFallbackImageRules()
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Assert(handler, testutil.ConvertibleTo, &SystemdPCRPolicyLoadHandler{})
+	c.Check(handler.(*SystemdPCRPolicyLoadHandler).Handler(), testutil.ConvertibleTo, &UbuntuCoreUKILoadHandler{})
+}
+
+func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerSystemdStubUKI(c *C) {
+	// verify that a UKI with signed PCR policies is recognized by the fallback rules
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	c.Assert(err, IsNil)
+
+	image := newMockImage().
+		addSection(".linux", nil).
+		addSection(".pcrsig", []byte("{}")).
+		addSection(".pcrpkey", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	rules := MakeFallbackImageRules()
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Assert(handler, testutil.ConvertibleTo, &SystemdPCRPolicyLoadHandler{})
+	c.Check(handler.(*SystemdPCRPolicyLoadHandler).Handler(), testutil.ConvertibleTo, &SystemdStubUKILoadHandler{})
+}
+
+func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerGenericSystemdStubUKI(c *C) {
+	// verify that a UKI without signed PCR policies is recognized by the fallback rules
+	image := newMockImage().
+		addSection(".linux", nil).
+		addSection(".osrel", []byte("ID=fedora\n")).
+		addSection(".initrd", nil)
+
+	rules := MakeFallbackImageRules()
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler, testutil.ConvertibleTo, &SystemdStubUKILoadHandler{})
+}
+
+func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerGenericSystemdStubUKISdMagic(c *C) {
+	// verify that a UKI without signed PCR policies is recognized by the fallback rules
+	image := newMockImage().
+		addSection(".linux", nil).
+		addSection(".sdmagic", []byte("#### LoaderInfo: systemd-stub 255 ####"))
+
+	rules := MakeFallbackImageRules()
+	handler, err := rules.NewImageLoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler, testutil.ConvertibleTo, &SystemdStubUKILoadHandler{})
+}
+
 func (s *imageRulesDefsSuite) TestFallbackNewImageLoadHandlerNull(c *C) {
 	// verify that an unrecognized leaf image is recognized by the fallback rules
 	image := newMockImage()
@@ -538,6 +538,42 @@ func (s *imageRulesSuite) TestGrubHasPrefixErr(c *C) {
 	c.Check(err, ErrorMatches, `cannot obtain grub prefix: no prefix`)
 }
 
+func (s *imageRulesSuite) TestSystemdLoaderInfoIsTrue1(c *C) {
+	image := newMockImage().addSection(".sdmagic", []byte("#### LoaderInfo: systemd-boot 255 ####")).newPeImageHandle()
+
+	pred := SystemdLoaderInfoIs("systemd-boot")
+	match, err := pred.Matches(image)
+	c.Check(err, IsNil)
+	c.Check(match, testutil.IsTrue)
+}
+
+func (s *imageRulesSuite) TestSystemdLoaderInfoIsTrue2(c *C) {
+	image := newMockImage().addSection(".sdmagic", []byte("#### LoaderInfo: systemd-stub 252.5 ####")).newPeImageHandle()
+
+	pred := SystemdLoaderInfoIs("systemd-stub")
+	match, err := pred.Matches(image)
+	c.Check(err, IsNil)
+	c.Check(match, testutil.IsTrue)
+}
+
+func (s *imageRulesSuite) TestSystemdLoaderInfoIsFalse(c *C) {
+	image := newMockImage().addSection(".sdmagic", []byte("#### LoaderInfo: systemd-stub 255 ####")).newPeImageHandle()
+
+	pred := SystemdLoaderInfoIs("systemd-boot")
+	match, err := pred.Matches(image)
+	c.Check(err, IsNil)
+	c.Check(match, testutil.IsFalse)
+}
+
+func (s *imageRulesSuite) TestSystemdLoaderInfoIsNoSection(c *C) {
+	image := newMockImage().newPeImageHandle()
+
+	pred := SystemdLoaderInfoIs("systemd-boot")
+	match, err := pred.Matches(image)
+	c.Check(err, IsNil)
+	c.Check(match, testutil.IsFalse)
+}
+
 func (s *imageRulesSuite) TestImageRulesMatch1(c *C) {
 	image := newMockImage().newPeImageHandle()
 
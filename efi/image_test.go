@@ -202,6 +202,58 @@ func (s *imageSuite) TestSnapModelParamsInherited(c *C) {
 		{KernelCommandline: "foo", SnapModel: models[1]}})
 }
 
+func (s *imageSuite) TestSystemdCredentialsParams(c *C) {
+	activity := NewImageLoadActivity(nil, SystemdCredentialsParams(
+		[][]byte{[]byte("cred1"), []byte("cred2")},
+		[][]byte{[]byte("cred3")}))
+	params := ImageLoadActivityParams(activity).Resolve(&LoadParams{KernelCommandline: "foo"})
+	c.Check(params, DeepEquals, []LoadParams{
+		{KernelCommandline: "foo", SystemdCredentials: [][]byte{[]byte("cred1"), []byte("cred2")}},
+		{KernelCommandline: "foo", SystemdCredentials: [][]byte{[]byte("cred3")}}})
+}
+
+func (s *imageSuite) TestSystemdSysextParams(c *C) {
+	sysexts1 := []Image{NewFileImage("/boot/efi/loader/extensions/foo.raw")}
+	sysexts2 := []Image{NewFileImage("/boot/efi/loader/extensions/foo.raw"), NewFileImage("/boot/efi/loader/extensions/bar.raw")}
+	activity := NewImageLoadActivity(nil, SystemdSysextParams(sysexts1, sysexts2))
+	params := ImageLoadActivityParams(activity).Resolve(&LoadParams{KernelCommandline: "foo"})
+	c.Check(params, DeepEquals, []LoadParams{
+		{KernelCommandline: "foo", SystemdSysexts: sysexts1},
+		{KernelCommandline: "foo", SystemdSysexts: sysexts2}})
+}
+
+func (s *imageSuite) TestSystemdConfextParams(c *C) {
+	confexts := []Image{NewFileImage("/boot/efi/EFI/Linux/uki.efi.extra.d/foo.confext.raw")}
+	activity := NewImageLoadActivity(nil, SystemdConfextParams(confexts))
+	params := ImageLoadActivityParams(activity).Resolve(&LoadParams{KernelCommandline: "foo"})
+	c.Check(params, DeepEquals, []LoadParams{{KernelCommandline: "foo", SystemdConfexts: confexts}})
+}
+
+func (s *imageSuite) TestUKIAddonParams(c *C) {
+	addons1 := []Image{NewFileImage("/boot/efi/loader/addons/foo.addon.efi")}
+	activity := NewImageLoadActivity(nil, UKIAddonParams(addons1, nil))
+	params := ImageLoadActivityParams(activity).Resolve(&LoadParams{KernelCommandline: "foo"})
+	c.Check(params, DeepEquals, []LoadParams{
+		{KernelCommandline: "foo", UKIAddons: addons1},
+		{KernelCommandline: "foo"}})
+}
+
+func (s *imageSuite) TestDevicetreeParams(c *C) {
+	activity := NewImageLoadActivity(nil, DevicetreeParams([]byte("dtb1"), []byte("dtb2")))
+	params := ImageLoadActivityParams(activity).Resolve(&LoadParams{KernelCommandline: "foo"})
+	c.Check(params, DeepEquals, []LoadParams{
+		{KernelCommandline: "foo", Devicetree: []byte("dtb1")},
+		{KernelCommandline: "foo", Devicetree: []byte("dtb2")}})
+}
+
+func (s *imageSuite) TestSystemdBootLoaderConfParams(c *C) {
+	activity := NewImageLoadActivity(nil, SystemdBootLoaderConfParams([]byte("timeout 3\n"), []byte("timeout 5\n")))
+	params := ImageLoadActivityParams(activity).Resolve(&LoadParams{KernelCommandline: "foo"})
+	c.Check(params, DeepEquals, []LoadParams{
+		{KernelCommandline: "foo", LoaderConf: []byte("timeout 3\n")},
+		{KernelCommandline: "foo", LoaderConf: []byte("timeout 5\n")}})
+}
+
 func (s *imageSuite) TestSnapModelParamsOverride(c *C) {
 	model := testutil.MakeMockCore20ModelAssertion(c, map[string]interface{}{
 		"authority-id": "fake-brand",
@@ -20,6 +20,8 @@
 package efi
 
 import (
+	"errors"
+
 	"golang.org/x/xerrors"
 )
 
@@ -38,6 +40,7 @@ type pcrImagesMeasurer struct {
 	images []ImageLoadActivity
 
 	nextToMeasure []*pcrImagesMeasurer
+	revoked       []*RevokedImageError // images omitted because they are revoked
 }
 
 func newPcrImagesMeasurer(branchContext *pcrBranchCtx, handler imageLoadHandler, images ...ImageLoadActivity) *pcrImagesMeasurer {
@@ -59,6 +62,22 @@ func (m *pcrImagesMeasurer) measureOneImage(bp *pcrBranchPointCtx, image ImageLo
 	}
 	defer handle.Close()
 
+	// Omit the image from the profile if it is revoked, as the image associated
+	// with the current branch would refuse to load it. This doesn't depend on the
+	// parameters, so it is only checked once.
+	if checker, ok := m.loadHandler.(imageLoadRevocationChecker); ok {
+		err := checker.CheckImageLoadNotRevoked(m.context, handle)
+		var rie *RevokedImageError
+		switch {
+		case errors.As(err, &rie):
+			m.revoked = append(m.revoked, rie)
+			m.context.ReportRevokedImage(rie)
+			return nil
+		case err != nil:
+			return xerrors.Errorf("cannot check if image is revoked: %w", err)
+		}
+	}
+
 	// Create a new descendent branch for each parameter combination.
 	for _, p := range params {
 		context := bp.AddBranch(&p)
@@ -86,6 +105,7 @@ func (m *pcrImagesMeasurer) measureOneImage(bp *pcrBranchPointCtx, image ImageLo
 func (m *pcrImagesMeasurer) Measure() ([]*pcrImagesMeasurer, error) {
 	bp := m.context.AddBranchPoint()
 	m.nextToMeasure = nil
+	m.revoked = nil
 
 	for _, image := range m.images {
 		if err := m.measureOneImage(bp, image); err != nil {
@@ -93,5 +113,12 @@ func (m *pcrImagesMeasurer) Measure() ([]*pcrImagesMeasurer, error) {
 		}
 	}
 
+	if len(m.revoked) > 0 && len(m.revoked) == len(m.images) {
+		// Every image that can be loaded from this branch is revoked. Pruning
+		// all of them would leave this branch ending before the next image is
+		// loaded, so fail instead.
+		return nil, xerrors.Errorf("cannot measure any image because they are all revoked: %w", m.revoked[0])
+	}
+
 	return m.nextToMeasure, nil
 }
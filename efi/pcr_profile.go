@@ -20,9 +20,11 @@
 package efi
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 
+	efi "github.com/canonical/go-efilib"
 	"github.com/canonical/go-tpm2"
 	"github.com/canonical/tcglog-parser"
 	internal_efi "github.com/snapcore/secboot/internal/efi"
@@ -74,6 +76,24 @@ func WithPlatformFirmwareProfile() PCRProfileEnablePCRsOption {
 	return newPcrProfileSetPcrOption(internal_efi.PlatformFirmwarePCR)
 }
 
+// WithPlatformConfigProfile adds the host platform configuration profile (measured
+// to PCR1). Events associated with the platform configuration, such as SMBIOS tables,
+// other handoff tables and firmware configuration data, are copied directly from the
+// current host environment configuration.
+//
+// Boot variables that are measured to this PCR (BootOrder and the Boot#### load options
+// that it references) are measured from the current EFI variables rather than being
+// copied from the log, which means that changes to these can be predicted by supplying
+// details of them to AddPCRProfile using [WithBootVariableUpdates]. This assumes that
+// the platform firmware measures BootOrder followed by each of the load options
+// referenced by it in order, which is what EDK2 does.
+//
+// Note that the firmware may modify boot variables itself, eg, when it detects new
+// boot devices. This can make a profile that includes this PCR inherently fragile.
+func WithPlatformConfigProfile() PCRProfileEnablePCRsOption {
+	return newPcrProfileSetPcrOption(internal_efi.PlatformConfigPCR)
+}
+
 // WithDriversAndAppsProfile adds the UEFI Drivers and UEFI Applications profile
 // (measured to PCR2). This is copied directly from the current host environment
 // configiguration.
@@ -81,6 +101,15 @@ func WithDriversAndAppsProfile() PCRProfileEnablePCRsOption {
 	return newPcrProfileSetPcrOption(internal_efi.DriversAndAppsPCR)
 }
 
+// WithDriversAndAppsConfigProfile adds the UEFI Drivers and UEFI Applications
+// configuration and data profile (measured to PCR3). This is copied directly from the
+// current host environment configuration up to the pre-OS to OS-present transition.
+// The preinstall package can be used to check that the firmware doesn't measure
+// anything to this PCR after the transition, as the generated profile would be invalid.
+func WithDriversAndAppsConfigProfile() PCRProfileEnablePCRsOption {
+	return newPcrProfileSetPcrOption(internal_efi.DriversAndAppsConfigPCR)
+}
+
 // WithSecureBootPolicyProfile requests that the UEFI secure boot policy profile is
 // added, which restricts access to a resource based on a set of secure boot policies
 // measured to PCR7. The secure boot policy that is measured to PCR7 is defined in
@@ -92,16 +121,23 @@ func WithDriversAndAppsProfile() PCRProfileEnablePCRsOption {
 // db -> dbx).
 //
 // The secure boot policy includes events that correspond to the authentication of EFI
-// applications. All images supplied to AddPCRProfile must have one ore more Authenticode
-// signatures that have a trust anchor in the host environment's signature database,
-// else an error will be returned. If any image has a non Authenticode signature or an
-// Authenticode signature with a digest algorithm other than SHA-256, then an error
-// will be returned.
+// applications. All images supplied to AddPCRProfile must either have one ore more
+// Authenticode signatures that have a trust anchor in the host environment's signature
+// database, or have their SHA-256 digest in the signature database, else an error will
+// be returned. If any image has a non Authenticode signature or an Authenticode signature
+// with a digest algorithm other than SHA-256, then an error will be returned.
+//
+// Images that are authenticated by adding their digests to the signature database (or
+// shim's vendor database) are supported. If an image has an Authenticode signature that
+// doesn't have a trust anchor in the signature database, this assumes that the platform
+// firmware will then search the signature database for the image's digest before testing
+// the next signature.
 //
-// This does not support generating policy for images that are authenticated by adding
-// their digests to the signature database. If a supplied image has a valid Authenticode
-// signature with a trust anchor in the signature database but it is subsequently
-// authenticated by its image digest, the generated policy will be incorrect.
+// Images loaded via shim can also be authenticated by a machine owner key (MOK) that
+// the user has enrolled, which is read from the host's MokListRT variable. Shim's
+// MokListXRT variable is used to determine whether an image is revoked. If the user
+// has disabled shim's validation (MokSBStateRT), no authentication events are
+// included for images loaded via shim.
 //
 // If an image has an Authenticode signature with more than one trust anchor in the
 // signature database, this assumes that the platform firmware will try them in the
@@ -124,7 +160,14 @@ func WithDriversAndAppsProfile() PCRProfileEnablePCRsOption {
 // the signatures are in reverse order with respect to how their trust anchors are
 // enrolled.
 //
-// Note that AddPCRProfile does not consider the host's revocation policy.
+// AddPCRProfile considers the host's revocation policy for each branch of the profile.
+// If an image would be refused by the platform firmware or shim because it is revoked
+// by dbx or by the effective SBAT level, the branches for it are omitted from the
+// profile. This is not an error, because the image can't be part of a working boot
+// chain. These images are omitted silently unless [WithRevokedImageHandler] is
+// supplied. If every image that can be loaded at a point in a load sequence is
+// revoked, a *[RevokedImageError] is returned. If this profile isn't used, revocation is only
+// considered if secure boot is currently enabled.
 //
 // The secure boot policy includes information about the secure boot configuration,
 // including signature databases. In order to support atomic updates to these databases,
@@ -177,17 +220,78 @@ func WithBootManagerCodeProfile() PCRProfileEnablePCRsOption {
 	return newPcrProfileSetPcrOption(internal_efi.BootManagerCodePCR)
 }
 
+// WithBootManagerConfigProfile adds the boot manager code configuration and data
+// profile (measured to PCR5). Events measured to this PCR, such as EV_EFI_ACTION events
+// and the EV_EFI_GPT_EVENT event containing the partition table of the boot disk, are
+// copied directly from the current host environment configuration. This includes the
+// events associated with ExitBootServices, which are measured after the pre-OS to
+// OS-present transition.
+//
+// Boot variables in the EFI global namespace that are measured to this PCR are measured
+// from the current EFI variables rather than being copied from the log, so changes to
+// these can be predicted with [WithBootVariableUpdates].
+//
+// A planned change to the partition table of the boot disk can be predicted by supplying
+// the disk to AddPCRProfile using [WithBootDiskPartitionTable]. In this case, the log must
+// contain a single EV_EFI_GPT_EVENT or EV_EFI_GPT_EVENT2 event.
+//
+// If the log contains a measurement of loader.conf by systemd-boot, this and the events
+// that follow it are measured when systemd-boot starts, so they are only included in
+// branches of the profile that load systemd-boot. The contents of loader.conf can be
+// supplied to the systemd-boot image with [SystemdBootLoaderConfParams] in order to
+// predict changes to it, else the measurement is copied from the log.
+//
+// Including this PCR prevents an attacker from booting with a crafted partition table.
+// Note that the firmware measures an EV_EFI_ACTION event for each boot attempt, so a
+// profile that includes this PCR may be invalid if the firmware falls back to another
+// boot option.
+func WithBootManagerConfigProfile() PCRProfileEnablePCRsOption {
+	return newPcrProfileSetPcrOption(internal_efi.BootManagerConfigPCR)
+}
+
+// WithPlatformManufacturerProfile adds the host platform manufacturer specific profile
+// (measured to PCR6). This is copied directly from the current host environment
+// configuration up to the pre-OS to OS-present transition. The preinstall package can
+// be used to check that the firmware doesn't measure anything to this PCR after the
+// transition, as the generated profile would be invalid.
+func WithPlatformManufacturerProfile() PCRProfileEnablePCRsOption {
+	return newPcrProfileSetPcrOption(internal_efi.PlatformManufacturerPCR)
+}
+
+// WithKernelBootProfile adds the kernel boot profile (measured to PCR11). For UKIs
+// based on systemd-stub, this predicts the measurement of each UKI section by the stub.
+// This doesn't include any measurements made from the OS, such as the boot phases
+// measured by systemd-pcrphase, so the generated profile will be invalid if any of
+// these are measured before the key is used.
+//
+// This shouldn't be used for keys that are bound to PCR policies signed by
+// systemd-measure (see [WithSystemdPCRPolicyKey]), as these already cover PCR11.
+func WithKernelBootProfile() PCRProfileEnablePCRsOption {
+	return newPcrProfileSetPcrOption(kernelBootPCR)
+}
+
 // WithKernelConfigProfile adds the kernel config profile. This binds a policy to a
 // set of externally supplied commandlines. On Ubuntu Core, this also binds a policy
 // to a set of model assertions and the initrd phase of the boot.
 //
 // Kernel commandlines can be injected into the profile with [KernelCommandlineParams].
 // Snap models can be injected into the profile with [SnapModelParams]. Note that a model
-// assertion is mandatory for profiles that include a UKI for Ubuntu Core.
+// assertion is mandatory for profiles that include a UKI for Ubuntu Core. Credentials
+// loaded by systemd-stub can be injected into the profile with [SystemdCredentialsParams],
+// configuration extensions with [SystemdConfextParams] and UKI addons that contribute to
+// the commandline with [UKIAddonParams]. Devicetree blobs installed by systemd-boot for
+// type #1 boot loader entries can be injected into the profile with [DevicetreeParams].
 func WithKernelConfigProfile() PCRProfileEnablePCRsOption {
 	return newPcrProfileSetPcrOption(kernelConfigPCR)
 }
 
+// WithSystemExtensionsProfile adds the system extensions profile (measured to PCR13).
+// This binds a policy to a set of system extension images loaded from the ESP by
+// systemd-stub, which can be injected into the profile with [SystemdSysextParams].
+func WithSystemExtensionsProfile() PCRProfileEnablePCRsOption {
+	return newPcrProfileSetPcrOption(sysextPCR)
+}
+
 // AddPCRProfile adds a profile defined by the supplied options to the supplied
 // secboot_tpm2.PCRProtectionProfileBranch, using the specified digest algorithm
 // for the PCR digest. The generated profile is defined by the supplied load
@@ -232,6 +336,19 @@ type pcrProfileGenerator struct {
 	// SbatPolicy.
 	varModifiers []internal_efi.InitialVariablesModifier
 
+	// systemdPCRPolicyKey is the key that is expected to have signed the PCR
+	// policies embedded in UKIs, set with the WithSystemdPCRPolicyKey option.
+	systemdPCRPolicyKey crypto.PublicKey
+
+	// partitionTable is the partition table of the boot disk, set with the
+	// WithBootDiskPartitionTable option.
+	partitionTable *efi.PartitionTable
+
+	// revokedImageHandler is called for each image that is omitted from
+	// the profile because it is revoked, set with the WithRevokedImageHandler
+	// option.
+	revokedImageHandler func(err error)
+
 	// log is the host TCG log, which is read from the associated env.
 	log *tcglog.Log
 }
@@ -336,6 +453,21 @@ func (g *pcrProfileGenerator) AddInitialVariablesModifier(fn internal_efi.Initia
 	g.varModifiers = append(g.varModifiers, fn)
 }
 
+// SetSystemdPCRPolicyKey implements [internal_efi.PCRProfileOptionVisitor.SetSystemdPCRPolicyKey]
+func (g *pcrProfileGenerator) SetSystemdPCRPolicyKey(key crypto.PublicKey) {
+	g.systemdPCRPolicyKey = key
+}
+
+// SetPartitionTable implements [internal_efi.PCRProfileOptionVisitor.SetPartitionTable]
+func (g *pcrProfileGenerator) SetPartitionTable(table *efi.PartitionTable) {
+	g.partitionTable = table
+}
+
+// SetRevokedImageHandler implements [internal_efi.PCRProfileOptionVisitor.SetRevokedImageHandler]
+func (g *pcrProfileGenerator) SetRevokedImageHandler(fn func(err error)) {
+	g.revokedImageHandler = fn
+}
+
 // PCRAlg implements pcrProfileContext.PCRAlg.
 func (g *pcrProfileGenerator) PCRAlg() tpm2.HashAlgorithmId {
 	return g.pcrAlg
@@ -350,10 +482,32 @@ func (g *pcrProfileGenerator) ImageLoadHandlerMap() imageLoadHandlerMap {
 	return g.handlers
 }
 
+// SystemdPCRPolicyKey implements pcrProfileContext.SystemdPCRPolicyKey.
+func (g *pcrProfileGenerator) SystemdPCRPolicyKey() crypto.PublicKey {
+	return g.systemdPCRPolicyKey
+}
+
+// PartitionTable implements pcrProfileContext.PartitionTable.
+func (g *pcrProfileGenerator) PartitionTable() *efi.PartitionTable {
+	return g.partitionTable
+}
+
+// ReportRevokedImage implements pcrProfileContext.ReportRevokedImage.
+func (g *pcrProfileGenerator) ReportRevokedImage(err *RevokedImageError) {
+	if g.revokedImageHandler != nil {
+		g.revokedImageHandler(err)
+	}
+}
+
 // pcrProfileContext corresponds to the global environment of an EFI PCR profile generation.
 type pcrProfileContext interface {
 	PCRAlg() tpm2.HashAlgorithmId // the PCR digest algorithm for the profile
 	PCRs() pcrFlags
 
 	ImageLoadHandlerMap() imageLoadHandlerMap
+
+	SystemdPCRPolicyKey() crypto.PublicKey // the key expected to have signed PCR policies embedded in UKIs
+	PartitionTable() *efi.PartitionTable   // the partition table of the boot disk, if supplied
+
+	ReportRevokedImage(err *RevokedImageError) // report an image that is omitted from the profile because it is revoked
 }
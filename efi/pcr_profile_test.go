@@ -1239,6 +1239,126 @@ func (s *pcrProfileSuite) TestAddPCRProfileUC20WithDbxUpdate(c *C) {
 	c.Check(err, IsNil)
 }
 
+func (s *pcrProfileSuite) TestAddPCRProfileKernelSignedByMOK(c *C) {
+	// Test with a kernel that is signed with a key enrolled by the user
+	// in MokList.
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage3(c)
+	kernel := newMockUbuntuKernelImage3(c).unsign().sign(c, testutil.ParsePKCS1PrivateKey(c, testUefiSigningKey1_1), testutil.ParseCertificate(c, testUefiSigningCert1_1))
+
+	err := s.testAddPCRProfile(c, &testAddPCRProfileData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n")),
+			withMokList(efi.SignatureDatabase{efitest.NewSignatureListX509(c, testUefiCACert1, testOwnerGuid)})),
+		log: efitest.NewLog(c, &efitest.LogOptions{
+			Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1},
+		}),
+		alg: tpm2.HashAlgorithmSHA256,
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+		expected: []tpm2.PCRValues{
+			{
+				tpm2.HashAlgorithmSHA256: {
+					7: testutil.DecodeHexString(c, "fd90e2ea530d66d538c3fad13c3a8764ae2f2baae2a377c7b78e917b7bfaf625"),
+				},
+			},
+		},
+	}, WithSecureBootPolicyProfile())
+	c.Check(err, IsNil)
+}
+
+func (s *pcrProfileSuite) TestAddPCRProfileRevokedBySbat(c *C) {
+	shim := newMockUbuntuShimImage15_7(c)
+	grub := newMockUbuntuGrubImage2(c)
+	kernel := newMockUbuntuKernelImage3(c)
+
+	err := s.testAddPCRProfile(c, &testAddPCRProfileData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		log: efitest.NewLog(c, &efitest.LogOptions{
+			Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1},
+		}),
+		alg: tpm2.HashAlgorithmSHA256,
+		loadSequences: NewImageLoadSequences().Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(grub).Loads(
+					NewImageLoadActivity(kernel),
+				),
+			),
+		),
+	}, WithSecureBootPolicyProfile(), WithBootManagerCodeProfile())
+	c.Check(err, ErrorMatches, `cannot measure any image because they are all revoked: image 0x[[:xdigit:]]+ is revoked: SBAT component grub with generation 1 is revoked by the minimum generation of 2`)
+
+	var e *RevokedImageError
+	c.Assert(errors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Image, Equals, grub)
+}
+
+func (s *pcrProfileSuite) TestAddPCRProfileUC20OmitsRevokedImage(c *C) {
+	// Test that a revoked image is omitted from a standard UC20 profile
+	// and reported, leaving the same PCR values as TestAddPCRProfileUC20.
+	shim := newMockUbuntuShimImage15_7(c)
+	revokedGrub := newMockUbuntuGrubImage2(c)
+	grub := newMockUbuntuGrubImage3(c)
+	recoverKernel := newMockUbuntuKernelImage2(c)
+	runKernel := newMockUbuntuKernelImage3(c)
+
+	var revoked []*RevokedImageError
+	err := s.testAddPCRProfile(c, &testAddPCRProfileData{
+		vars: makeMockVars(c, withMsSecureBootConfig(), withSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n"))),
+		log: efitest.NewLog(c, &efitest.LogOptions{
+			Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256, tpm2.HashAlgorithmSHA1},
+		}),
+		alg: tpm2.HashAlgorithmSHA256,
+		loadSequences: NewImageLoadSequences(
+			SnapModelParams(testutil.MakeMockCore20ModelAssertion(c, map[string]interface{}{
+				"authority-id": "fake-brand",
+				"series":       "16",
+				"brand-id":     "fake-brand",
+				"model":        "fake-model",
+				"grade":        "secured",
+			}, "Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij")),
+		).Append(
+			NewImageLoadActivity(shim).Loads(
+				NewImageLoadActivity(revokedGrub, KernelCommandlineParams("console=ttyS0 console=tty1 panic=-1 systemd.gpt_auto=0 snapd_recovery_mode=recover")).Loads(
+					NewImageLoadActivity(recoverKernel),
+				),
+				NewImageLoadActivity(grub, KernelCommandlineParams("console=ttyS0 console=tty1 panic=-1 systemd.gpt_auto=0 snapd_recovery_mode=recover")).Loads(
+					NewImageLoadActivity(grub, KernelCommandlineParams("console=ttyS0 console=tty1 panic=-1 systemd.gpt_auto=0 snapd_recovery_mode=run")).Loads(
+						NewImageLoadActivity(runKernel),
+					),
+					NewImageLoadActivity(recoverKernel),
+				),
+			),
+		),
+		expected: []tpm2.PCRValues{
+			{
+				tpm2.HashAlgorithmSHA256: {
+					4:  testutil.DecodeHexString(c, "bec6121586508581e08a41244944292ef452879f8e19c7f93d166e912c6aac5e"),
+					7:  testutil.DecodeHexString(c, "3d65dbe406e9427d402488ea4f87e07e8b584c79c578a735d48d21a6405fc8bb"),
+					12: testutil.DecodeHexString(c, "fd1000c6f691c3054e2ff5cfacb39305820c9f3534ba67d7894cb753aa85074b"),
+				},
+			},
+			{
+				tpm2.HashAlgorithmSHA256: {
+					4:  testutil.DecodeHexString(c, "c731a39b7fc6475c7d8a9264e704902157c7cee40c22f59fa1690ea99ff70c67"),
+					7:  testutil.DecodeHexString(c, "3d65dbe406e9427d402488ea4f87e07e8b584c79c578a735d48d21a6405fc8bb"),
+					12: testutil.DecodeHexString(c, "5b354c57a61bb9f71fcf596d7e9ef9e2e0d6f4ad8151c9f358e6f0aaa7823756"),
+				},
+			},
+		},
+	}, WithSecureBootPolicyProfile(), WithBootManagerCodeProfile(), WithKernelConfigProfile(), WithRevokedImageHandler(func(err *RevokedImageError) {
+		revoked = append(revoked, err)
+	}))
+	c.Check(err, IsNil)
+	c.Assert(revoked, HasLen, 1)
+	c.Check(revoked[0].Image, Equals, revokedGrub)
+	c.Check(revoked[0], ErrorMatches, `image 0x[[:xdigit:]]+ is revoked: SBAT component grub with generation 1 is revoked by the minimum generation of 2`)
+}
+
 func (s *pcrProfileSuite) TestAddPCRProfileLoadFailsFromLeafImage(c *C) {
 	shim := newMockUbuntuShimImage15_7(c)
 	grub := newMockUbuntuGrubImage3(c)
@@ -58,6 +58,13 @@ type peImageHandle interface {
 	// the specified name, or nil if no section exists.
 	OpenSection(name string) *io.SectionReader
 
+	// OpenSectionAsLoaded returns a new io.Reader for the contents of the
+	// section with the specified name as they appear in memory once the
+	// image is loaded, or nil if no section exists. This is the size of the
+	// section's virtual size, and any data beyond the end of the section's
+	// raw data is zero-filled.
+	OpenSectionAsLoaded(name string) io.Reader
+
 	// HasSection indicates whether a section with the specified name
 	// exists.
 	HasSection(name string) bool
@@ -127,6 +134,19 @@ func (h *peImageHandleImpl) OpenSection(name string) *io.SectionReader {
 	return io.NewSectionReader(section.ReaderAt, 0, int64(section.Size))
 }
 
+func (h *peImageHandleImpl) OpenSectionAsLoaded(name string) io.Reader {
+	section := h.pefile.Section(name)
+	if section == nil {
+		return nil
+	}
+	if section.VirtualSize <= section.Size {
+		return io.NewSectionReader(section.ReaderAt, 0, int64(section.VirtualSize))
+	}
+	return io.MultiReader(
+		io.NewSectionReader(section.ReaderAt, 0, int64(section.Size)),
+		bytes.NewReader(make([]byte, section.VirtualSize-section.Size)))
+}
+
 func (h *peImageHandleImpl) HasSection(name string) bool {
 	return h.pefile.Section(name) != nil
 }
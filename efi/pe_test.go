@@ -23,6 +23,7 @@ import (
 	"crypto"
 	_ "crypto/sha1"
 	_ "crypto/sha256"
+	"io"
 
 	. "gopkg.in/check.v1"
 
@@ -74,6 +75,42 @@ func (s *peSuite) TestPeImageHandleOpenSectionMissing(c *C) {
 	c.Check(section, IsNil)
 }
 
+func (s *peSuite) TestPeImageHandleOpenSectionAsLoaded(c *C) {
+	source := NewFileImage("testdata/amd64/mockshim.efi.signed.1.1.1")
+
+	r, err := source.Open()
+	c.Assert(err, IsNil)
+	defer r.Close()
+
+	pefile, err := pe.NewFile(r)
+	c.Assert(err, IsNil)
+	expected, err := pefile.Section(".text").Data()
+	c.Assert(err, IsNil)
+	if vsz := int(pefile.Section(".text").VirtualSize); vsz <= len(expected) {
+		expected = expected[:vsz]
+	} else {
+		expected = append(expected, make([]byte, vsz-len(expected))...)
+	}
+
+	image, err := OpenPeImage(source)
+	c.Assert(err, IsNil)
+	defer image.Close()
+
+	section := image.OpenSectionAsLoaded(".text")
+	c.Assert(section, NotNil)
+	data, err := io.ReadAll(section)
+	c.Check(err, IsNil)
+	c.Check(data, DeepEquals, expected)
+}
+
+func (s *peSuite) TestPeImageHandleOpenSectionAsLoadedMissing(c *C) {
+	image, err := OpenPeImage(NewFileImage("testdata/amd64/mockshim.efi.signed.1.1.1"))
+	c.Assert(err, IsNil)
+	defer image.Close()
+
+	c.Check(image.OpenSectionAsLoaded(".foo"), IsNil)
+}
+
 func (s *peSuite) TestPeImageHandleHasSectionTrue(c *C) {
 	image, err := OpenPeImage(NewFileImage("testdata/amd64/mockshim.efi.signed.1.1.1"))
 	c.Assert(err, IsNil)
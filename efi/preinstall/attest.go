@@ -0,0 +1,385 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package preinstall
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/util"
+	"github.com/canonical/tcglog-parser"
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+	"github.com/snapcore/secboot/internal/tcg"
+)
+
+// maxQuoteAttempts is the number of times that [AttestationKey.Quote] will try to
+// obtain PCR values that are consistent with the quote before giving up.
+const maxQuoteAttempts = 3
+
+// AttestationKeyParent describes the parent of an attestation key.
+type AttestationKeyParent int
+
+const (
+	// AttestationKeyParentSRK indicates that the attestation key is a child of
+	// the storage root key in the storage hierarchy. The SRK is expected at the
+	// handle selected during provisioning, which is the standard handle unless a
+	// custom one was supplied. If the SRK isn't persisted, a transient one is
+	// created from the default template, which requires the storage hierarchy to
+	// have an empty authorization value.
+	AttestationKeyParentSRK AttestationKeyParent = iota
+
+	// AttestationKeyParentEK indicates that the attestation key is a child of
+	// the endorsement key in the endorsement hierarchy. This requires the
+	// endorsement hierarchy to have an empty authorization value. A key created
+	// under the EK can be certified by a remote party using the EK certificate
+	// and TPM2_ActivateCredential.
+	AttestationKeyParentEK
+)
+
+// attestationKeyTemplate is the template for RSA2048 restricted signing keys with
+// a RSASSA-SHA256 scheme, used to sign quotes.
+var attestationKeyTemplate = &tpm2.Public{
+	Type:    tpm2.ObjectTypeRSA,
+	NameAlg: tpm2.HashAlgorithmSHA256,
+	Attrs: tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrUserWithAuth | tpm2.AttrNoDA |
+		tpm2.AttrRestricted | tpm2.AttrSign,
+	Params: &tpm2.PublicParamsU{
+		RSADetail: &tpm2.RSAParams{
+			Symmetric: tpm2.SymDefObject{Algorithm: tpm2.SymObjectAlgorithmNull},
+			Scheme: tpm2.RSAScheme{
+				Scheme: tpm2.RSASchemeRSASSA,
+				Details: &tpm2.AsymSchemeU{
+					RSASSA: &tpm2.SigSchemeRSASSA{HashAlg: tpm2.HashAlgorithmSHA256}}},
+			KeyBits:  2048,
+			Exponent: 0}}}
+
+// attestationKeyParentContext corresponds to the loaded parent of an attestation key.
+type attestationKeyParentContext struct {
+	tpm       *tpm2.TPMContext
+	parent    AttestationKeyParent
+	resource  tpm2.ResourceContext
+	transient bool // the parent key was created by loadAttestationKeyParent and must be flushed
+}
+
+// loadAttestationKeyParent obtains a context for the specified attestation key parent,
+// creating a transient key from the default template if one isn't persisted at the
+// expected handle. The caller should call flush on the returned context when finished
+// with it.
+func loadAttestationKeyParent(tpm *tpm2.TPMContext, parent AttestationKeyParent) (*attestationKeyParentContext, error) {
+	var (
+		handle    tpm2.Handle
+		hierarchy tpm2.ResourceContext
+		template  *tpm2.Public
+	)
+	switch parent {
+	case AttestationKeyParentSRK:
+		var err error
+		handle, err = tcg.SelectSRKHandle(tpm)
+		if err != nil {
+			return nil, fmt.Errorf("cannot select SRK handle: %w", err)
+		}
+		hierarchy = tpm.OwnerHandleContext()
+		template = tcg.SRKTemplate
+	case AttestationKeyParentEK:
+		handle = tcg.EKHandle
+		hierarchy = tpm.EndorsementHandleContext()
+		template = tcg.EKTemplate
+	default:
+		return nil, fmt.Errorf("invalid attestation key parent %d", parent)
+	}
+
+	out := &attestationKeyParentContext{tpm: tpm, parent: parent}
+
+	resource, err := tpm.CreateResourceContextFromTPM(handle)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, handle):
+		// The parent key isn't persisted, so create it.
+		resource, _, _, _, _, err = tpm.CreatePrimary(hierarchy, nil, template, nil, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create parent key: %w", err)
+		}
+		out.transient = true
+	case err != nil:
+		return nil, fmt.Errorf("cannot obtain parent key context: %w", err)
+	}
+	out.resource = resource
+
+	return out, nil
+}
+
+// flush flushes the parent key if it is a transient key.
+func (p *attestationKeyParentContext) flush() {
+	if !p.transient {
+		return
+	}
+	p.tpm.FlushContext(p.resource)
+}
+
+// authSession returns a session that can be used to authorize the use of the parent
+// key with the user role. This returns a nil session for the SRK, which is authorized
+// with its empty authorization value.
+func (p *attestationKeyParentContext) authSession() (tpm2.SessionContext, error) {
+	if p.parent != AttestationKeyParentEK {
+		return nil, nil
+	}
+
+	// The EK doesn't permit authorization with its authorization value for the user
+	// role, so satisfy its policy instead, which requires TPM2_PolicySecret with the
+	// endorsement hierarchy. The session doesn't have the continueSession attribute so
+	// it is flushed by the command that it authorizes.
+	session, err := p.tpm.StartAuthSession(nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := p.tpm.PolicySecret(p.tpm.EndorsementHandleContext(), session, nil, nil, 0, nil); err != nil {
+		p.tpm.FlushContext(session)
+		return nil, err
+	}
+	return session, nil
+}
+
+// AttestationKey corresponds to a restricted signing key in the TPM that is used to
+// sign quotes. It is created with [NewAttestationKey], and the Public and Private
+// fields can be serialized with [github.com/canonical/go-tpm2/mu] so that the same
+// key can be used for subsequent attestations.
+//
+// The public area of the key must be delivered to the verifier in a trusted way. For
+// keys created under the EK, this can be done by the verifier using the EK certificate
+// and TPM2_MakeCredential with the name of the key.
+type AttestationKey struct {
+	Parent  AttestationKeyParent // The parent of the key
+	Public  *tpm2.Public         // The public area of the key
+	Private tpm2.Private         // The private area of the key, protected by the parent
+}
+
+// NewAttestationKey creates a new restricted signing key under the specified parent,
+// that can be used to sign quotes with [AttestationKey.Quote].
+func NewAttestationKey(tpm *tpm2.TPMContext, parent AttestationKeyParent) (*AttestationKey, error) {
+	p, err := loadAttestationKeyParent(tpm, parent)
+	if err != nil {
+		return nil, err
+	}
+	defer p.flush()
+
+	session, err := p.authSession()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create session to authorize parent key: %w", err)
+	}
+
+	priv, pub, _, _, _, err := tpm.Create(p.resource, nil, attestationKeyTemplate, nil, nil, session)
+	if err != nil {
+		if session != nil {
+			tpm.FlushContext(session)
+		}
+		return nil, fmt.Errorf("cannot create attestation key: %w", err)
+	}
+
+	return &AttestationKey{
+		Parent:  parent,
+		Public:  pub,
+		Private: priv,
+	}, nil
+}
+
+// Attestation contains a TPM quote together with the values of the quoted PCRs and the
+// TCG log, and is returned from [AttestationKey.Quote]. It can be verified with
+// [VerifyAttestation].
+type Attestation struct {
+	Quote     *tpm2.Attest    // The TPMS_ATTEST structure returned from TPM2_Quote
+	Signature *tpm2.Signature // The signature of Quote
+	PCRValues tpm2.PCRValues  // The values of the quoted PCRs
+	Log       *tcglog.Log     // The TCG log
+}
+
+// Quote obtains a TPM quote over the specified PCRs that is signed by this key and
+// which includes the supplied caller nonce, and returns it along with the values of
+// the quoted PCRs and the TCG log obtained from the supplied environment.
+//
+// The values of the quoted PCRs are read separately from the quote. If one of them
+// changes between reading them and obtaining the quote, another attempt will be made.
+// The TCG log is read after obtaining a quote with consistent PCR values, and it is
+// checked that it replays to the quoted values of the TCG defined PCRs (0-7). If it
+// doesn't, because something was measured between obtaining the quote and reading the
+// log, another attempt will be made. An error is returned if a consistent quote and
+// log cannot be obtained.
+func (k *AttestationKey) Quote(tpm *tpm2.TPMContext, env internal_efi.HostEnvironmentEFI, nonce tpm2.Data, pcrs tpm2.PCRSelectionList) (*Attestation, error) {
+	p, err := loadAttestationKeyParent(tpm, k.Parent)
+	if err != nil {
+		return nil, err
+	}
+	defer p.flush()
+
+	session, err := p.authSession()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create session to authorize parent key: %w", err)
+	}
+
+	ak, err := tpm.Load(p.resource, k.Private, k.Public, session)
+	if err != nil {
+		if session != nil {
+			tpm.FlushContext(session)
+		}
+		return nil, fmt.Errorf("cannot load attestation key: %w", err)
+	}
+	defer tpm.FlushContext(ak)
+
+	var logErr error
+	for i := 0; i < maxQuoteAttempts; i++ {
+		_, values, err := tpm.PCRRead(pcrs)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read PCR values: %w", err)
+		}
+
+		quote, sig, err := tpm.Quote(ak, nonce, nil, pcrs, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain quote: %w", err)
+		}
+
+		digest, err := util.ComputePCRDigest(sig.HashAlg(), quote.Attested.Quote.PCRSelect, values)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute PCR digest: %w", err)
+		}
+		if !bytes.Equal(digest, quote.Attested.Quote.PCRDigest) {
+			// A PCR was extended between reading the values and
+			// obtaining the quote, so try again.
+			continue
+		}
+
+		// Read the log after obtaining the quote, so that it contains
+		// at least every event that was measured before the quote.
+		log, err := env.ReadEventLog()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read TCG log: %w", err)
+		}
+		if err := checkLogConsistentWithPCRValues(log, quote.Attested.Quote.PCRSelect, values); err != nil {
+			// Something was measured between obtaining the quote and
+			// reading the log, so try again.
+			logErr = err
+			continue
+		}
+
+		return &Attestation{
+			Quote:     quote,
+			Signature: sig,
+			PCRValues: values,
+			Log:       log,
+		}, nil
+	}
+
+	if logErr != nil {
+		return nil, fmt.Errorf("cannot obtain a TCG log that is consistent with the quote: %w", logErr)
+	}
+	return nil, errors.New("cannot obtain PCR values that are consistent with the quote")
+}
+
+// checkLogConsistentWithPCRValues replays the supplied TCG log for each of the
+// supplied PCR selections, and checks that it is consistent with the supplied
+// values of the TCG defined PCRs (0-7). Other PCRs are ignored.
+func checkLogConsistentWithPCRValues(log *tcglog.Log, pcrSelect tpm2.PCRSelectionList, pcrValues tpm2.PCRValues) error {
+	if !log.Spec.IsEFI_2() {
+		return errors.New("invalid log spec")
+	}
+
+	for _, selection := range pcrSelect {
+		// Only the TCG defined PCRs can be checked against the log.
+		var pcrs tpm2.HandleList
+		values := tpm2.PCRValues{selection.Hash: make(map[int]tpm2.Digest)}
+		for _, pcr := range selection.Select {
+			if !internal_efi.IsTCGDefinedPCR(tpm2.Handle(pcr)) {
+				continue
+			}
+			pcrs = append(pcrs, tpm2.Handle(pcr))
+			values[selection.Hash][pcr] = pcrValues[selection.Hash][pcr]
+		}
+		if len(pcrs) == 0 {
+			continue
+		}
+
+		results, err := replayFirmwareLogForAlg(log, selection.Hash, pcrs)
+		if err != nil {
+			return fmt.Errorf("cannot replay log for %v bank: %w", selection.Hash, err)
+		}
+		if err := results.setPcrValues(values); err != nil {
+			return fmt.Errorf("cannot process quoted PCR values for %v bank: %w", selection.Hash, err)
+		}
+		for _, pcr := range pcrs {
+			if err := results.Lookup(pcr).Err(); err != nil {
+				return fmt.Errorf("log is inconsistent with %v(PCR%d): %w", selection.Hash, pcr, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// VerifyAttestation verifies the supplied attestation using the public area of the
+// attestation key and the nonce supplied to [AttestationKey.Quote]. The caller is
+// responsible for establishing that the attestation key is trustworthy.
+//
+// This checks that the quote is signed by the attestation key, that it contains the
+// supplied nonce, and that the PCR values in the attestation are the ones that were
+// quoted. It then replays the TCG log for each quoted PCR bank and checks that it is
+// consistent with the quoted values of the TCG defined PCRs (0-7). The values of any
+// other quoted PCRs are authenticated by the quote but not checked against the log.
+//
+// If the attestation cannot be trusted, a *[AttestationVerificationError] error is
+// returned.
+func VerifyAttestation(attestation *Attestation, akPublic *tpm2.Public, nonce tpm2.Data) error {
+	if attestation == nil || attestation.Quote == nil || attestation.Signature == nil || attestation.Log == nil {
+		return errors.New("incomplete attestation")
+	}
+	const required = tpm2.AttrFixedTPM | tpm2.AttrRestricted | tpm2.AttrSign
+	if akPublic == nil || akPublic.Attrs&required != required {
+		return errors.New("attestation key is not a restricted signing key")
+	}
+
+	quote := attestation.Quote
+	if quote.Magic != tpm2.TPMGeneratedValue || quote.Type != tpm2.TagAttestQuote {
+		return &AttestationVerificationError{errors.New("not a TPM generated quote")}
+	}
+
+	ok, err := util.VerifyAttestationSignature(akPublic.Public(), quote, attestation.Signature)
+	if err != nil {
+		return fmt.Errorf("cannot verify quote signature: %w", err)
+	}
+	if !ok {
+		return &AttestationVerificationError{errors.New("invalid quote signature")}
+	}
+	if !bytes.Equal(quote.ExtraData, nonce) {
+		return &AttestationVerificationError{errors.New("quote does not contain the expected nonce")}
+	}
+
+	quoteInfo := quote.Attested.Quote
+	digest, err := util.ComputePCRDigest(attestation.Signature.HashAlg(), quoteInfo.PCRSelect, attestation.PCRValues)
+	if err != nil {
+		return &AttestationVerificationError{fmt.Errorf("cannot compute PCR digest: %w", err)}
+	}
+	if !bytes.Equal(digest, quoteInfo.PCRDigest) {
+		return &AttestationVerificationError{errors.New("PCR values are inconsistent with the quote")}
+	}
+
+	if err := checkLogConsistentWithPCRValues(attestation.Log, quoteInfo.PCRSelect, attestation.PCRValues); err != nil {
+		return &AttestationVerificationError{err}
+	}
+
+	return nil
+}
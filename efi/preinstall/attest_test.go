@@ -0,0 +1,426 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package preinstall_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/templates"
+	tpm2_testutil "github.com/canonical/go-tpm2/testutil"
+	"github.com/canonical/go-tpm2/util"
+	"github.com/canonical/tcglog-parser"
+	. "github.com/snapcore/secboot/efi/preinstall"
+	"github.com/snapcore/secboot/internal/efitest"
+	"github.com/snapcore/secboot/internal/tcg"
+	"github.com/snapcore/secboot/internal/testutil"
+	. "gopkg.in/check.v1"
+)
+
+// replayLogForPCRValues computes the values of the specified PCRs in the specified
+// bank from the supplied log, assuming a startup locality of 0.
+func replayLogForPCRValues(log *tcglog.Log, alg tpm2.HashAlgorithmId, pcrs ...int) tpm2.PCRValues {
+	values := tpm2.PCRValues{alg: make(map[int]tpm2.Digest)}
+	for _, pcr := range pcrs {
+		values[alg][pcr] = make(tpm2.Digest, alg.Size())
+	}
+	for _, ev := range log.Events {
+		if ev.EventType == tcglog.EventTypeNoAction {
+			continue
+		}
+		value, ok := values[alg][int(ev.PCRIndex)]
+		if !ok {
+			continue
+		}
+		h := alg.NewHash()
+		h.Write(value)
+		h.Write(ev.Digests[alg])
+		values[alg][int(ev.PCRIndex)] = h.Sum(nil)
+	}
+	return values
+}
+
+type attestNoTPMSuite struct {
+	key      *rsa.PrivateKey
+	akPublic *tpm2.Public
+}
+
+var _ = Suite(&attestNoTPMSuite{})
+
+func (s *attestNoTPMSuite) SetUpSuite(c *C) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+	s.key = key
+	s.akPublic = s.newAKPublic(&key.PublicKey)
+}
+
+func (s *attestNoTPMSuite) newAKPublic(key *rsa.PublicKey) *tpm2.Public {
+	pub := util.NewExternalRSAPublicKey(tpm2.HashAlgorithmSHA256, templates.KeyUsageSign, nil, key)
+	pub.Attrs |= tpm2.AttrFixedTPM | tpm2.AttrRestricted
+	return pub
+}
+
+// newAttestation creates an attestation that is signed in software in the same
+// way that TPM2_Quote would sign it.
+func (s *attestNoTPMSuite) newAttestation(c *C, key *rsa.PrivateKey, log *tcglog.Log, nonce tpm2.Data, pcrs tpm2.PCRSelectionList, values tpm2.PCRValues) *Attestation {
+	digest, err := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, pcrs, values)
+	c.Assert(err, IsNil)
+
+	quote := &tpm2.Attest{
+		Magic:     tpm2.TPMGeneratedValue,
+		Type:      tpm2.TagAttestQuote,
+		ExtraData: nonce,
+		Attested: &tpm2.AttestU{
+			Quote: &tpm2.QuoteInfo{
+				PCRSelect: pcrs,
+				PCRDigest: digest}}}
+
+	h := tpm2.HashAlgorithmSHA256.NewHash()
+	_, err = mu.MarshalToWriter(h, quote)
+	c.Assert(err, IsNil)
+	sig, err := util.Sign(key, &tpm2.SigScheme{
+		Scheme: tpm2.SigSchemeAlgRSASSA,
+		Details: &tpm2.SigSchemeU{
+			RSASSA: &tpm2.SigSchemeRSASSA{HashAlg: tpm2.HashAlgorithmSHA256}}}, h.Sum(nil))
+	c.Assert(err, IsNil)
+
+	return &Attestation{
+		Quote:     quote,
+		Signature: sig,
+		PCRValues: values,
+		Log:       log,
+	}
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationGood(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	c.Check(VerifyAttestation(attestation, s.akPublic, []byte("nonce")), IsNil)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationGoodSubset(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 4, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 4, 7)
+
+	attestation := s.newAttestation(c, s.key, log, []byte("foo"), pcrs, values)
+	c.Check(VerifyAttestation(attestation, s.akPublic, []byte("foo")), IsNil)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationGoodWithNonTCGPCR(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{4, 7, 12}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 4, 7)
+	// PCR12 isn't measured by the firmware, so any value is accepted.
+	values[tpm2.HashAlgorithmSHA256][12] = testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	c.Check(VerifyAttestation(attestation, s.akPublic, []byte("nonce")), IsNil)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationInvalidSignature(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	c.Assert(err, IsNil)
+
+	attestation := s.newAttestation(c, key, log, []byte("nonce"), pcrs, values)
+	err = VerifyAttestation(attestation, s.akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: invalid quote signature`)
+	var e *AttestationVerificationError
+	c.Check(errors.As(err, &e), testutil.IsTrue)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationWrongNonce(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+
+	attestation := s.newAttestation(c, s.key, log, []byte("old nonce"), pcrs, values)
+	err := VerifyAttestation(attestation, s.akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: quote does not contain the expected nonce`)
+	var e *AttestationVerificationError
+	c.Check(errors.As(err, &e), testutil.IsTrue)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationPCRValuesMismatch(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	attestation.PCRValues = replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+	attestation.PCRValues[tpm2.HashAlgorithmSHA256][4] = make(tpm2.Digest, 32)
+
+	err := VerifyAttestation(attestation, s.akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: PCR values are inconsistent with the quote`)
+	var e *AttestationVerificationError
+	c.Check(errors.As(err, &e), testutil.IsTrue)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationMissingPCRValue(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	delete(attestation.PCRValues[tpm2.HashAlgorithmSHA256], 7)
+
+	err := VerifyAttestation(attestation, s.akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: cannot compute PCR digest: .*`)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationLogMismatch(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+	values[tpm2.HashAlgorithmSHA256][4] = testutil.DecodeHexString(c, "b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c")
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	err := VerifyAttestation(attestation, s.akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: log is inconsistent with TPM_ALG_SHA256\(PCR4\): PCR value mismatch \(actual from TPM 0xb5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c, reconstructed from log 0x[[:xdigit:]]{64}\)`)
+	var e *AttestationVerificationError
+	c.Check(errors.As(err, &e), testutil.IsTrue)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationMissingLogBank(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA384, Select: []int{0}}}
+	values := tpm2.PCRValues{tpm2.HashAlgorithmSHA384: {0: make(tpm2.Digest, 48)}}
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	err := VerifyAttestation(attestation, s.akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: cannot replay log for TPM_ALG_SHA384 bank: digest algorithm not present in log`)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationNotQuote(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	attestation.Quote.Magic = 0
+
+	err := VerifyAttestation(attestation, s.akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: not a TPM generated quote`)
+}
+
+func (s *attestNoTPMSuite) TestVerifyAttestationUnrestrictedKey(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+	values := replayLogForPCRValues(log, tpm2.HashAlgorithmSHA256, 0, 1, 2, 3, 4, 5, 6, 7)
+
+	attestation := s.newAttestation(c, s.key, log, []byte("nonce"), pcrs, values)
+	akPublic := util.NewExternalRSAPublicKey(tpm2.HashAlgorithmSHA256, templates.KeyUsageSign, nil, &s.key.PublicKey)
+
+	err := VerifyAttestation(attestation, akPublic, []byte("nonce"))
+	c.Check(err, ErrorMatches, `attestation key is not a restricted signing key`)
+}
+
+type attestSuite struct {
+	tpm2_testutil.TPMSimulatorTest
+}
+
+var _ = Suite(&attestSuite{})
+
+// resetTPMAndReplayLog resets the TPM and then extends the measurements from
+// the supplied log to the SHA-256 bank.
+func (s *attestSuite) resetTPMAndReplayLog(c *C, log *tcglog.Log) {
+	s.ResetTPMSimulator(c)
+	for _, ev := range log.Events {
+		if ev.EventType == tcglog.EventTypeNoAction {
+			continue
+		}
+		digests := tpm2.TaggedHashList{tpm2.MakeTaggedHash(tpm2.HashAlgorithmSHA256, tpm2.Digest(ev.Digests[tpm2.HashAlgorithmSHA256]))}
+		c.Assert(s.TPM.PCRExtend(s.TPM.PCRHandleContext(int(ev.PCRIndex)), digests, nil), IsNil)
+	}
+}
+
+type testQuoteAndVerifyParams struct {
+	parent AttestationKeyParent
+	nonce  tpm2.Data
+	pcrs   tpm2.PCRSelectionList
+}
+
+func (s *attestSuite) testQuoteAndVerify(c *C, params *testQuoteAndVerifyParams) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	s.resetTPMAndReplayLog(c, log)
+	env := efitest.NewMockHostEnvironmentWithOpts(efitest.WithLog(log))
+
+	ak, err := NewAttestationKey(s.TPM, params.parent)
+	c.Assert(err, IsNil)
+	c.Check(ak.Parent, Equals, params.parent)
+
+	attestation, err := ak.Quote(s.TPM, env, params.nonce, params.pcrs)
+	c.Assert(err, IsNil)
+	c.Check(attestation.Log, Equals, log)
+	c.Check(attestation.Quote.ExtraData, DeepEquals, params.nonce)
+
+	c.Check(VerifyAttestation(attestation, ak.Public, params.nonce), IsNil)
+}
+
+func (s *attestSuite) TestQuoteAndVerifySRK(c *C) {
+	s.testQuoteAndVerify(c, &testQuoteAndVerifyParams{
+		parent: AttestationKeyParentSRK,
+		nonce:  []byte("nonce"),
+		pcrs:   tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}},
+	})
+}
+
+func (s *attestSuite) TestQuoteAndVerifyEK(c *C) {
+	s.testQuoteAndVerify(c, &testQuoteAndVerifyParams{
+		parent: AttestationKeyParentEK,
+		nonce:  []byte("nonce"),
+		pcrs:   tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}},
+	})
+}
+
+func (s *attestSuite) TestQuoteAndVerifyDifferentNonce(c *C) {
+	s.testQuoteAndVerify(c, &testQuoteAndVerifyParams{
+		parent: AttestationKeyParentSRK,
+		nonce:  []byte("foo"),
+		pcrs:   tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}},
+	})
+}
+
+func (s *attestSuite) TestQuoteAndVerifyWithNonTCGPCRs(c *C) {
+	s.testQuoteAndVerify(c, &testQuoteAndVerifyParams{
+		parent: AttestationKeyParentSRK,
+		nonce:  []byte("nonce"),
+		pcrs:   tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{4, 7, 11, 12}}},
+	})
+}
+
+func (s *attestSuite) TestQuoteAndVerifyPersistentSRK(c *C) {
+	srk := s.CreatePrimary(c, tpm2.HandleOwner, tcg.SRKTemplate)
+	s.EvictControl(c, tpm2.HandleOwner, srk, tcg.SRKHandle)
+
+	s.testQuoteAndVerify(c, &testQuoteAndVerifyParams{
+		parent: AttestationKeyParentSRK,
+		nonce:  []byte("nonce"),
+		pcrs:   tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}},
+	})
+}
+
+func (s *attestSuite) TestQuoteAndVerifyPersistentSRKCustomHandle(c *C) {
+	handle := tpm2.Handle(0x81000002)
+	srk := s.CreatePrimary(c, tpm2.HandleOwner, tcg.ECCSRKTemplate)
+	srk = s.EvictControl(c, tpm2.HandleOwner, srk, handle)
+
+	handleB, err := mu.MarshalToBytes(handle)
+	c.Assert(err, IsNil)
+	nv := s.NVDefineSpace(c, tpm2.HandleOwner, nil, tcg.MakeSRKHandleIndexPublic())
+	c.Assert(s.TPM.NVWrite(nv, nv, handleB, 0, nil), IsNil)
+	c.Assert(s.TPM.NVWriteLock(nv, nv, nil), IsNil)
+
+	s.testQuoteAndVerify(c, &testQuoteAndVerifyParams{
+		parent: AttestationKeyParentSRK,
+		nonce:  []byte("nonce"),
+		pcrs:   tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}},
+	})
+
+	// The attestation key should have been created under the SRK at the custom handle.
+	ak, err := NewAttestationKey(s.TPM, AttestationKeyParentSRK)
+	c.Assert(err, IsNil)
+	_, err = s.TPM.Load(srk, ak.Private, ak.Public, nil)
+	c.Check(err, IsNil)
+}
+
+func (s *attestSuite) TestQuoteReusesAttestationKey(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	s.resetTPMAndReplayLog(c, log)
+	env := efitest.NewMockHostEnvironmentWithOpts(efitest.WithLog(log))
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+
+	ak, err := NewAttestationKey(s.TPM, AttestationKeyParentEK)
+	c.Assert(err, IsNil)
+
+	for _, nonce := range []tpm2.Data{[]byte("nonce1"), []byte("nonce2")} {
+		attestation, err := ak.Quote(s.TPM, env, nonce, pcrs)
+		c.Assert(err, IsNil)
+		c.Check(VerifyAttestation(attestation, ak.Public, nonce), IsNil)
+	}
+}
+
+func (s *attestSuite) TestVerifyAttestationWrongKey(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	s.resetTPMAndReplayLog(c, log)
+	env := efitest.NewMockHostEnvironmentWithOpts(efitest.WithLog(log))
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+
+	ak, err := NewAttestationKey(s.TPM, AttestationKeyParentSRK)
+	c.Assert(err, IsNil)
+	otherAk, err := NewAttestationKey(s.TPM, AttestationKeyParentSRK)
+	c.Assert(err, IsNil)
+
+	attestation, err := ak.Quote(s.TPM, env, []byte("nonce"), pcrs)
+	c.Assert(err, IsNil)
+
+	err = VerifyAttestation(attestation, otherAk.Public, []byte("nonce"))
+	c.Check(err, ErrorMatches, `cannot verify attestation: invalid quote signature`)
+}
+
+func (s *attestSuite) TestQuoteLogMismatch(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	s.resetTPMAndReplayLog(c, log)
+	env := efitest.NewMockHostEnvironmentWithOpts(efitest.WithLog(log))
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{0, 1, 2, 3, 4, 5, 6, 7}}}
+
+	// Make an unlogged measurement to PCR4.
+	_, err := s.TPM.PCREvent(s.TPM.PCRHandleContext(4), []byte("foo"), nil)
+	c.Assert(err, IsNil)
+
+	ak, err := NewAttestationKey(s.TPM, AttestationKeyParentSRK)
+	c.Assert(err, IsNil)
+
+	_, err = ak.Quote(s.TPM, env, []byte("nonce"), pcrs)
+	c.Check(err, ErrorMatches, `cannot obtain a TCG log that is consistent with the quote: log is inconsistent with TPM_ALG_SHA256\(PCR4\): PCR value mismatch .*`)
+}
+
+func (s *attestSuite) TestQuoteNonTCGPCRsNotCheckedAgainstLog(c *C) {
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	s.resetTPMAndReplayLog(c, log)
+	env := efitest.NewMockHostEnvironmentWithOpts(efitest.WithLog(log))
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{4, 7, 12}}}
+
+	// Make an unlogged measurement to PCR12, which isn't checked against the log.
+	_, err := s.TPM.PCREvent(s.TPM.PCRHandleContext(12), []byte("foo"), nil)
+	c.Assert(err, IsNil)
+
+	ak, err := NewAttestationKey(s.TPM, AttestationKeyParentSRK)
+	c.Assert(err, IsNil)
+
+	attestation, err := ak.Quote(s.TPM, env, []byte("nonce"), pcrs)
+	c.Assert(err, IsNil)
+	c.Check(VerifyAttestation(attestation, ak.Public, []byte("nonce")), IsNil)
+}
+
+func (s *attestSuite) TestNewAttestationKeyInvalidParent(c *C) {
+	_, err := NewAttestationKey(s.TPM, AttestationKeyParent(5))
+	c.Check(err, ErrorMatches, `invalid attestation key parent 5`)
+}
@@ -241,11 +241,12 @@ func (r *pcrBankResults) pcrErrs() (out map[tpm2.Handle]error) {
 	return out
 }
 
-// checkFirmwareLogAgainstTPMForAlg checks the supplied TCG log consistency, reconstructed against the
-// TPM PCRs for the specified algorithm. This only checks TCG defined PCRs (0-7). The supplied
-// mandatoryPcrs argument is required by the returned results so that it can use this to make a decision
-// on whether the bank is ok.
-func checkFirmwareLogAgainstTPMForAlg(tpm *tpm2.TPMContext, log *tcglog.Log, alg tpm2.HashAlgorithmId, mandatoryPcrs tpm2.HandleList) (results *pcrBankResults, err error) {
+// replayFirmwareLogForAlg reconstructs the expected values of the TCG defined PCRs (0-7) from the
+// supplied TCG log for the specified algorithm. The returned results don't contain any actual PCR
+// values, so the caller must supply these with setPcrValues before the results are usable. The
+// supplied mandatoryPcrs argument is required by the returned results so that it can use this to
+// make a decision on whether the bank is ok.
+func replayFirmwareLogForAlg(log *tcglog.Log, alg tpm2.HashAlgorithmId, mandatoryPcrs tpm2.HandleList) (results *pcrBankResults, err error) {
 	// Check that the TCG log contains the specified algorithm
 	supported := false
 	for _, logAlg := range log.Algorithms {
@@ -350,6 +351,19 @@ func checkFirmwareLogAgainstTPMForAlg(tpm *tpm2.TPMContext, log *tcglog.Log, alg
 		}
 	}
 
+	return results, nil
+}
+
+// checkFirmwareLogAgainstTPMForAlg checks the supplied TCG log consistency, reconstructed against the
+// TPM PCRs for the specified algorithm. This only checks TCG defined PCRs (0-7). The supplied
+// mandatoryPcrs argument is required by the returned results so that it can use this to make a decision
+// on whether the bank is ok.
+func checkFirmwareLogAgainstTPMForAlg(tpm *tpm2.TPMContext, log *tcglog.Log, alg tpm2.HashAlgorithmId, mandatoryPcrs tpm2.HandleList) (results *pcrBankResults, err error) {
+	results, err = replayFirmwareLogForAlg(log, alg, mandatoryPcrs)
+	if err != nil {
+		return nil, err
+	}
+
 	// Read the actual PCR values from the TPM.
 	var pcrs []int
 	for _, pcr := range supportedPcrs {
@@ -366,6 +380,14 @@ func checkFirmwareLogAgainstTPMForAlg(tpm *tpm2.TPMContext, log *tcglog.Log, alg
 		return nil, fmt.Errorf("cannot process PCR values from TPM: %w", err)
 	}
 
+	// Mark PCRs that are generated by copying events from the log up to the
+	// EV_SEPARATOR event as unsuitable if there are measurements after it.
+	for _, pcr := range []tpm2.Handle{internal_efi.DriversAndAppsConfigPCR, internal_efi.PlatformManufacturerPCR} {
+		if err := checkNoMeasurementsAfterSeparator(log, pcr); err != nil {
+			results.Lookup(pcr).setErr(err)
+		}
+	}
+
 	return results, nil
 }
 
@@ -565,6 +587,8 @@ func (t *tcglogPhaseTracker) reachedOSPresent() bool {
 //     although the one in PCR7 separates secure boot configuratuib from secure boot authentication).
 //   - that none of the EV_SEPARATORs in the TCG defined PCRs indicated that an error occurred.
 //   - there are no pre-OS measurements to non-TCG defined PCRs (8-).
+//   - there are no measurements after the EV_SEPARATOR event in PCRs 3 and 6. If there are, the
+//     result for the PCR will have a *MeasurementsAfterSeparatorError error.
 //
 // This won't return an error for failures in TCG defined PCRs if they aren't part of the specified mandatory
 // PCRs set, but the errors will be accessible on the returned results struct.
@@ -631,3 +655,28 @@ func checkFirmwareLogAndChoosePCRBank(tpm *tpm2.TPMContext, log *tcglog.Log, man
 	// tests to perform later on as well.
 	return chosenResults, nil
 }
+
+// checkNoMeasurementsAfterSeparator checks that the firmware doesn't measure anything
+// to the specified PCR after the EV_SEPARATOR event that marks the transition from
+// pre-OS to OS-present. This is used for PCRs where the profile is generated by
+// copying events from the log up to the EV_SEPARATOR event, as any measurements after
+// it make the PCR value unpredictable. This applies to the UEFI driver and application
+// configuration PCR (3) for efi.WithDriversAndAppsConfigProfile and to the host platform
+// manufacturer PCR (6) for efi.WithPlatformManufacturerProfile. A missing EV_SEPARATOR
+// event isn't detected here.
+func checkNoMeasurementsAfterSeparator(log *tcglog.Log, pcr tpm2.Handle) error {
+	seenSeparator := false
+	for _, ev := range log.Events {
+		if ev.PCRIndex != pcr || ev.EventType == tcglog.EventTypeNoAction {
+			// Not this PCR or not measured
+			continue
+		}
+		if !seenSeparator {
+			seenSeparator = ev.EventType == tcglog.EventTypeSeparator
+			continue
+		}
+		return &MeasurementsAfterSeparatorError{PCR: pcr, EventType: ev.EventType}
+	}
+
+	return nil
+}
@@ -22,6 +22,7 @@ package preinstall_test
 import (
 	"crypto"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/canonical/go-tpm2"
@@ -976,3 +977,122 @@ func (s *tcglogSuite) TestCheckFirmwareLogAndChoosePCRBankTruncatedLog(c *C) {
 	_, err := CheckFirmwareLogAndChoosePCRBank(s.TPM, log, nil)
 	c.Check(err, ErrorMatches, `reached the end of the log without seeing EV_SEPARATOR events in all TCG defined PCRs`)
 }
+
+func (s *tcglogSuite) TestCheckFirmwareLogAndChoosePCRBankMeasurementsAfterSeparatorNonMandatory(c *C) {
+	s.allocatePCRBanks(c, tpm2.HashAlgorithmSHA256)
+
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	log.Events = append(log.Events, &tcglog.Event{
+		PCRIndex:  internal_efi.PlatformManufacturerPCR,
+		EventType: tcglog.EventTypeEventTag,
+		Digests:   tcglog.DigestMap{tpm2.HashAlgorithmSHA256: testutil.DecodeHexString(c, "1f2d8a2cf20cb1bbf1ef6a4ab0ddb1ef1ce2d4d3aa3efb8c1b4c5d6e7f8a9b0c")},
+		Data:      &tcglog.TaggedEvent{EventID: 1, Data: []byte{1}}})
+	s.resetTPMAndReplayLog(c, log, tpm2.HashAlgorithmSHA256)
+
+	results, err := CheckFirmwareLogAndChoosePCRBank(s.TPM, log, tpm2.HandleList{
+		internal_efi.PlatformFirmwarePCR,
+		internal_efi.PlatformConfigPCR,
+		internal_efi.DriversAndAppsPCR,
+		internal_efi.DriversAndAppsConfigPCR,
+		internal_efi.BootManagerCodePCR,
+		internal_efi.BootManagerConfigPCR,
+		internal_efi.SecureBootPolicyPCR,
+	})
+	c.Assert(err, IsNil)
+	c.Check(results.Alg, Equals, tpm2.HashAlgorithmSHA256)
+	c.Check(results.Ok(), Equals, true)
+	c.Check(results.Lookup(internal_efi.DriversAndAppsConfigPCR).Ok(), Equals, true)
+	c.Check(results.Lookup(internal_efi.PlatformManufacturerPCR).Ok(), Equals, false)
+	c.Check(results.Lookup(internal_efi.PlatformManufacturerPCR).Err(), DeepEquals,
+		&MeasurementsAfterSeparatorError{PCR: internal_efi.PlatformManufacturerPCR, EventType: tcglog.EventTypeEventTag})
+}
+
+func (s *tcglogSuite) TestCheckFirmwareLogAndChoosePCRBankMeasurementsAfterSeparatorMandatory(c *C) {
+	s.allocatePCRBanks(c, tpm2.HashAlgorithmSHA256)
+
+	log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+	log.Events = append(log.Events, &tcglog.Event{
+		PCRIndex:  internal_efi.DriversAndAppsConfigPCR,
+		EventType: tcglog.EventTypeEventTag,
+		Digests:   tcglog.DigestMap{tpm2.HashAlgorithmSHA256: testutil.DecodeHexString(c, "1f2d8a2cf20cb1bbf1ef6a4ab0ddb1ef1ce2d4d3aa3efb8c1b4c5d6e7f8a9b0c")},
+		Data:      &tcglog.TaggedEvent{EventID: 1, Data: []byte{1}}})
+	s.resetTPMAndReplayLog(c, log, tpm2.HashAlgorithmSHA256)
+
+	_, err := CheckFirmwareLogAndChoosePCRBank(s.TPM, log, tpm2.HandleList{internal_efi.DriversAndAppsConfigPCR})
+	c.Check(err, ErrorMatches, `no suitable PCR algorithm available:
+- TPM_ALG_SHA512: digest algorithm not present in log.
+- TPM_ALG_SHA384: digest algorithm not present in log.
+- TPM_ALG_SHA256\(PCR3\): unexpected EV_EVENT_TAG event in PCR 3 after EV_SEPARATOR.
+`)
+	var e *NoSuitablePCRAlgorithmError
+	c.Check(errors.As(err, &e), testutil.IsTrue)
+}
+
+type tcglogNoTPMSuite struct{}
+
+var _ = Suite(&tcglogNoTPMSuite{})
+
+func (s *tcglogNoTPMSuite) TestCheckNoMeasurementsAfterSeparator(c *C) {
+	eventTag := func(pcr tpm2.Handle) *tcglog.Event {
+		return &tcglog.Event{
+			PCRIndex:  pcr,
+			EventType: tcglog.EventTypeEventTag,
+			Digests:   tcglog.DigestMap{tpm2.HashAlgorithmSHA256: testutil.DecodeHexString(c, "1f2d8a2cf20cb1bbf1ef6a4ab0ddb1ef1ce2d4d3aa3efb8c1b4c5d6e7f8a9b0c")},
+			Data:      &tcglog.TaggedEvent{EventID: 1, Data: []byte{1}}}
+	}
+
+	for _, pcr := range []tpm2.Handle{internal_efi.DriversAndAppsConfigPCR, internal_efi.PlatformManufacturerPCR} {
+		for _, t := range []struct {
+			desc   string
+			modify func(events []*tcglog.Event) []*tcglog.Event
+			err    string
+		}{
+			{
+				desc: "good",
+			},
+			{
+				desc: "good with pre-OS event",
+				modify: func(events []*tcglog.Event) (out []*tcglog.Event) {
+					// Insert an event before the transition to OS-present.
+					inserted := false
+					for _, ev := range events {
+						if !inserted && ev.PCRIndex != internal_efi.SecureBootPolicyPCR && ev.EventType == tcglog.EventTypeSeparator {
+							inserted = true
+							out = append(out, eventTag(pcr))
+						}
+						out = append(out, ev)
+					}
+					return out
+				},
+			},
+			{
+				desc: "event after separator",
+				modify: func(events []*tcglog.Event) []*tcglog.Event {
+					return append(events, eventTag(pcr))
+				},
+				err: fmt.Sprintf(`unexpected EV_EVENT_TAG event in PCR %d after EV_SEPARATOR`, pcr),
+			},
+			{
+				desc: "not measured after separator",
+				modify: func(events []*tcglog.Event) []*tcglog.Event {
+					ev := eventTag(pcr)
+					ev.EventType = tcglog.EventTypeNoAction
+					return append(events, ev)
+				},
+			},
+		} {
+			c.Logf("PCR %d: %s", pcr, t.desc)
+			log := efitest.NewLog(c, &efitest.LogOptions{Algorithms: []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256}})
+			if t.modify != nil {
+				log.Events = t.modify(log.Events)
+			}
+			err := CheckNoMeasurementsAfterSeparator(log, pcr)
+			if t.err == "" {
+				c.Check(err, IsNil)
+			} else {
+				c.Check(err, ErrorMatches, t.err)
+				c.Check(err, DeepEquals, &MeasurementsAfterSeparatorError{PCR: pcr, EventType: tcglog.EventTypeEventTag})
+			}
+		}
+	}
+}
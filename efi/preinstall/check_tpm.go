@@ -20,10 +20,14 @@
 package preinstall
 
 import (
+	"bytes"
+	"crypto/x509"
+	"errors"
 	"fmt"
 
 	"github.com/canonical/go-tpm2"
 	internal_efi "github.com/snapcore/secboot/internal/efi"
+	"github.com/snapcore/secboot/internal/tcg"
 )
 
 const (
@@ -179,3 +183,60 @@ func openAndCheckTPM2Device(env internal_efi.HostEnvironment, flags checkTPM2Dev
 	}
 	return tpm, discreteTPM, nil
 }
+
+// CheckTPM2EndorsementKey verifies the TPM's endorsement key against the supplied
+// TPM manufacturer roots and optional intermediate certificates, and returns the
+// verified EK certificate. The EK certificate is read from the standard NV index.
+// If the EK is not persisted at the standard handle, it is created from the
+// default template, which requires that the endorsement hierarchy authorization
+// value is empty.
+//
+// If there is no EK certificate, a ErrNoTPMEKCertificate error is returned. If
+// the EK certificate cannot be verified against the supplied roots or doesn't
+// certify the endorsement key, a *TPMEndorsementKeyVerificationError error is
+// returned.
+func CheckTPM2EndorsementKey(tpm *tpm2.TPMContext, roots, intermediates *x509.CertPool) (*x509.Certificate, error) {
+	var ekPublic *tpm2.Public
+
+	ek, err := tpm.CreateResourceContextFromTPM(tcg.EKHandle)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, tcg.EKHandle):
+		// The EK isn't persisted, so create it.
+		transientEk, pub, _, _, _, err := tpm.CreatePrimary(tpm.EndorsementHandleContext(), nil, tcg.EKTemplate, nil, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create EK: %w", err)
+		}
+		tpm.FlushContext(transientEk)
+		ekPublic = pub
+	case err != nil:
+		return nil, fmt.Errorf("cannot obtain EK context: %w", err)
+	default:
+		// Use the public area associated with the context rather than reading it
+		// again with TPM2_ReadPublic. The context's name is checked against this
+		// public area when it is created, and it is the one that would be used to
+		// salt sessions.
+		if obj, ok := ek.(tpm2.ObjectContext); ok {
+			ekPublic = obj.Public()
+		}
+		if ekPublic == nil {
+			return nil, errors.New("cannot obtain EK public area")
+		}
+		if !bytes.Equal(ekPublic.Name(), ek.Name()) {
+			return nil, errors.New("EK public area is inconsistent with its name")
+		}
+	}
+
+	cert, err := tcg.ReadEKCertificate(tpm, ekPublic.Type)
+	switch {
+	case err == tcg.ErrNoEKCertificate:
+		return nil, ErrNoTPMEKCertificate
+	case err != nil:
+		return nil, fmt.Errorf("cannot read EK certificate: %w", err)
+	}
+
+	if err := tcg.VerifyEKCertificate(cert, ekPublic, roots, intermediates); err != nil {
+		return nil, &TPMEndorsementKeyVerificationError{err: err}
+	}
+
+	return cert, nil
+}
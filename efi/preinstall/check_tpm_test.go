@@ -21,13 +21,17 @@ package preinstall_test
 
 import (
 	"bytes"
+	"crypto/x509"
+	"errors"
 
 	"github.com/canonical/go-tpm2"
 	"github.com/canonical/go-tpm2/mu"
 	tpm2_testutil "github.com/canonical/go-tpm2/testutil"
 	. "github.com/snapcore/secboot/efi/preinstall"
 	"github.com/snapcore/secboot/internal/efitest"
+	"github.com/snapcore/secboot/internal/tcg"
 	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
 	. "gopkg.in/check.v1"
 )
 
@@ -293,3 +297,55 @@ func (s *tpmSuite) TestOpenAndCheckTPM2DeviceInsufficientNVCountersPostInstall(c
 	c.Check(err, Equals, ErrTPMInsufficientNVCounters)
 	c.Check(dev.NumberOpen(), Equals, int(0))
 }
+
+func (s *tpmSuite) ekPublic(c *C) *tpm2.Public {
+	ek, pub, _, _, _, err := s.TPM.CreatePrimary(s.TPM.EndorsementHandleContext(), nil, tcg.EKTemplate, nil, nil, nil)
+	c.Assert(err, IsNil)
+	c.Check(s.TPM.FlushContext(ek), IsNil)
+	return pub
+}
+
+func (s *tpmSuite) writeEKCert(c *C, cert []byte) {
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   tcg.EKCertHandle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA),
+		Size:    uint16(len(cert))})
+	c.Assert(s.TPM.NVWrite(index, index, cert, 0, nil), IsNil)
+}
+
+func (s *tpmSuite) TestCheckTPM2EndorsementKeyGood(c *C) {
+	ca, caKey := tpm2test.NewTestTPMManufacturerCA(c)
+	s.writeEKCert(c, tpm2test.NewTestEKCertificate(c, s.ekPublic(c), ca, caKey))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	cert, err := CheckTPM2EndorsementKey(s.TPM, roots, nil)
+	c.Check(err, IsNil)
+	c.Assert(cert, NotNil)
+	c.Check(cert.Issuer.CommonName, Equals, "Test TPM Manufacturer Root CA")
+}
+
+func (s *tpmSuite) TestCheckTPM2EndorsementKeyUntrustedRoot(c *C) {
+	ca, caKey := tpm2test.NewTestTPMManufacturerCA(c)
+	s.writeEKCert(c, tpm2test.NewTestEKCertificate(c, s.ekPublic(c), ca, caKey))
+
+	otherCA, _ := tpm2test.NewTestTPMManufacturerCA(c)
+	roots := x509.NewCertPool()
+	roots.AddCert(otherCA)
+
+	_, err := CheckTPM2EndorsementKey(s.TPM, roots, nil)
+	c.Check(err, ErrorMatches, `cannot verify TPM endorsement key: cannot verify certificate: x509: certificate signed by unknown authority.*`)
+	var e *TPMEndorsementKeyVerificationError
+	c.Check(errors.As(err, &e), testutil.IsTrue)
+}
+
+func (s *tpmSuite) TestCheckTPM2EndorsementKeyNoCertificate(c *C) {
+	ca, _ := tpm2test.NewTestTPMManufacturerCA(c)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	_, err := CheckTPM2EndorsementKey(s.TPM, roots, nil)
+	c.Check(err, Equals, ErrNoTPMEKCertificate)
+}
@@ -25,6 +25,7 @@ import (
 	"fmt"
 
 	"github.com/canonical/go-tpm2"
+	"github.com/canonical/tcglog-parser"
 	internal_efi "github.com/snapcore/secboot/internal/efi"
 )
 
@@ -130,10 +131,63 @@ var (
 	// [github.com/canonical/go-tpm2/ppi.PPI] interface, obtained by using
 	// [github.com/canonical/go-tpm2/linux/RawDevice.PhysicalPresenceInterface].
 	ErrTPMDisabled = errors.New("TPM2 device is present but is currently disabled by the platform firmware")
+
+	// ErrNoTPMEKCertificate is returned from CheckTPM2EndorsementKey if there is
+	// no EK certificate in the TPM's NV storage.
+	ErrNoTPMEKCertificate = errors.New("TPM2 device has no EK certificate")
 )
 
+// TPMEndorsementKeyVerificationError is returned from [CheckTPM2EndorsementKey] if
+// the EK certificate cannot be verified against the supplied TPM manufacturer roots
+// or doesn't certify the endorsement key. This might indicate that the TPM is not
+// genuine or that there is an active interposer.
+type TPMEndorsementKeyVerificationError struct {
+	err error
+}
+
+func (e *TPMEndorsementKeyVerificationError) Error() string {
+	return "cannot verify TPM endorsement key: " + e.err.Error()
+}
+
+func (e *TPMEndorsementKeyVerificationError) Unwrap() error {
+	return e.err
+}
+
+// Errors related to attestation.
+
+// AttestationVerificationError is returned from [VerifyAttestation] if the supplied
+// attestation cannot be trusted, either because the quote signature or nonce is
+// invalid, the PCR values don't match the quote, or the TCG log is inconsistent with
+// the quoted PCR values.
+type AttestationVerificationError struct {
+	err error
+}
+
+func (e *AttestationVerificationError) Error() string {
+	return "cannot verify attestation: " + e.err.Error()
+}
+
+func (e *AttestationVerificationError) Unwrap() error {
+	return e.err
+}
+
 // Errors related to general TCG log checks and PCR bank selection.
 
+// MeasurementsAfterSeparatorError is the error associated with the result for the
+// UEFI driver and application configuration PCR (3) or the host platform manufacturer
+// PCR (6) if the firmware measures events to it after the EV_SEPARATOR event. The
+// profiles for these PCRs are generated by copying events from the log up to the
+// EV_SEPARATOR event, so this makes the PCR unsuitable for use in a profile. If the
+// PCR is mandatory, it is reported as part of a [NoSuitablePCRAlgorithmError].
+type MeasurementsAfterSeparatorError struct {
+	PCR       tpm2.Handle      // The PCR that the unexpected event was measured to
+	EventType tcglog.EventType // The type of the first unexpected event
+}
+
+func (e *MeasurementsAfterSeparatorError) Error() string {
+	return fmt.Sprintf("unexpected %v event in PCR %d after EV_SEPARATOR", e.EventType, e.PCR)
+}
+
 // NoSuitablePCRAlgorithmError is returned wrapped from [RunChecks] if there is no suitable PCR bank
 // where the log matches the TPM values when reconstructed. As multiple errors can occur during
 // testing (multiple banks and multiple PCRs), this error tries to keep as much information as
@@ -0,0 +1,135 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi
+
+import (
+	"errors"
+
+	"github.com/canonical/tcglog-parser"
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+	"golang.org/x/xerrors"
+)
+
+// loaderConfEventTagID is the ID of the EV_EVENT_TAG event that systemd-boot uses
+// to measure the contents of loader.conf.
+const loaderConfEventTagID = 0xf5bc582a
+
+// isLoaderConfEvent indicates whether the supplied event is the measurement of
+// loader.conf by systemd-boot.
+func isLoaderConfEvent(event *tcglog.Event) bool {
+	if event.PCRIndex != internal_efi.BootManagerConfigPCR || event.EventType != tcglog.EventTypeEventTag {
+		return false
+	}
+	data, ok := event.Data.(*tcglog.TaggedEvent)
+	return ok && data.EventID == loaderConfEventTagID
+}
+
+// systemdBootLoadHandler is an implementation of imageLoadHandler for
+// systemd-boot.
+type systemdBootLoadHandler struct{}
+
+func newSystemdBootLoadHandler(_ peImageHandle) (imageLoadHandler, error) {
+	return new(systemdBootLoadHandler), nil
+}
+
+// MeasureImageStart implements imageLoadHandler.MeasureImageStart.
+func (h *systemdBootLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
+	if ctx.PCRs().Contains(internal_efi.BootManagerConfigPCR) {
+		if err := h.measureLoaderConf(ctx); err != nil {
+			return xerrors.Errorf("cannot measure loader.conf: %w", err)
+		}
+	}
+	return nil
+}
+
+func (h *systemdBootLoadHandler) measureLoaderConf(ctx pcrBranchContext) error {
+	// systemd-boot measures the contents of loader.conf to the boot manager
+	// config PCR (5) when it starts. The firmware load handler stops replaying
+	// this PCR from the log at this event, so measure it here followed by the
+	// rest of the events in this PCR, such as the EV_EFI_ACTION events associated
+	// with ExitBootServices.
+	fc := ctx.FwContext()
+	conf := ctx.Params().LoaderConf
+	switch {
+	case fc.LoaderConfEvent == nil && conf != nil:
+		return errors.New("the log doesn't contain a loader.conf event")
+	case fc.LoaderConfEvent == nil:
+		// systemd-boot didn't measure loader.conf because it doesn't exist.
+		return nil
+	case conf != nil:
+		h := ctx.PCRAlg().NewHash()
+		h.Write(conf)
+		ctx.ExtendPCR(internal_efi.BootManagerConfigPCR, h.Sum(nil))
+	default:
+		ctx.ExtendPCR(internal_efi.BootManagerConfigPCR, fc.LoaderConfEvent.Digests[ctx.PCRAlg()])
+	}
+
+	for _, event := range fc.PendingBootManagerConfigEvents {
+		if event.EventType == tcglog.EventTypeNoAction {
+			// not measured
+			continue
+		}
+		ctx.ExtendPCR(internal_efi.BootManagerConfigPCR, event.Digests[ctx.PCRAlg()])
+	}
+
+	fc.LoaderConfEvent = nil
+	fc.PendingBootManagerConfigEvents = nil
+	return nil
+}
+
+func (h *systemdBootLoadHandler) measureKernelConfig(ctx pcrBranchContext, image peImageHandle) {
+	// For UKIs (type #2 entries), systemd-boot leaves it to systemd-stub to
+	// measure the commandline.
+	if image.HasSection(".linux") {
+		return
+	}
+
+	// For type #1 entries, systemd-boot measures the devicetree blob that it
+	// installs, followed by the commandline from the loader entry.
+	if len(ctx.Params().Devicetree) > 0 {
+		dtHash := ctx.PCRAlg().NewHash()
+		dtHash.Write(ctx.Params().Devicetree)
+		ctx.ExtendPCR(kernelConfigPCR, dtHash.Sum(nil))
+	}
+	if ctx.Params().KernelCommandline != "" {
+		ctx.ExtendPCR(kernelConfigPCR,
+			tcglog.ComputeSystemdEFIStubCommandlineDigest(ctx.PCRAlg().GetHash(), ctx.Params().KernelCommandline))
+	}
+}
+
+// CheckImageLoadNotRevoked implements imageLoadRevocationChecker.CheckImageLoadNotRevoked.
+func (h *systemdBootLoadHandler) CheckImageLoadNotRevoked(ctx pcrBranchContext, image peImageHandle) error {
+	return checkImageLoadUsingShimIfLoadedNotRevoked(ctx, image)
+}
+
+// MeasureImageLoad implements imageLoadHandler.MeasureImageLoad.
+func (h *systemdBootLoadHandler) MeasureImageLoad(ctx pcrBranchContext, image peImageHandle) (imageLoadHandler, error) {
+	// systemd-boot uses shim's protocol to verify images if it was loaded
+	// by shim, else it relies on the firmware.
+	if err := measureImageLoadUsingShimIfLoaded(ctx, image); err != nil {
+		return nil, xerrors.Errorf("cannot measure image: %w", err)
+	}
+
+	if ctx.PCRs().Contains(kernelConfigPCR) {
+		h.measureKernelConfig(ctx, image)
+	}
+
+	return lookupImageLoadHandler(ctx, image)
+}
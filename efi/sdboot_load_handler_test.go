@@ -0,0 +1,258 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi_test
+
+import (
+	"crypto"
+
+	. "gopkg.in/check.v1"
+
+	efi "github.com/canonical/go-efilib"
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/tcglog-parser"
+	. "github.com/snapcore/secboot/efi"
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+	"github.com/snapcore/secboot/internal/efitest"
+	"github.com/snapcore/secboot/internal/testutil"
+)
+
+type sdbootLoadHandlerSuite struct {
+	mockImageLoadHandlerMap
+}
+
+func (s *sdbootLoadHandlerSuite) SetUpTest(c *C) {
+	s.mockImageLoadHandlerMap = make(mockImageLoadHandlerMap)
+}
+
+var _ = Suite(&sdbootLoadHandlerSuite{})
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageStart(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(internal_efi.BootManagerConfigPCR, KernelConfigPCR),
+	}, nil, nil)
+
+	handler, err := NewSystemdBootLoadHandler(newMockImage().newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, HasLen, 0)
+}
+
+func (s *sdbootLoadHandlerSuite) newLoaderConfContext(c *C, params *LoadParams) *mockPcrBranchContext {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(internal_efi.BootManagerConfigPCR),
+	}, params, nil)
+
+	log := efitest.NewLog(c, &efitest.LogOptions{
+		Algorithms:            []tpm2.HashAlgorithmId{tpm2.HashAlgorithmSHA256},
+		SystemdBootLoaderConf: []byte("timeout 3\n"),
+	})
+	for _, ev := range log.Events {
+		if ev.PCRIndex != internal_efi.BootManagerConfigPCR {
+			continue
+		}
+		switch {
+		case ev.EventType == tcglog.EventTypeEventTag:
+			ctx.FwContext().LoaderConfEvent = ev
+		case ctx.FwContext().LoaderConfEvent != nil:
+			ctx.FwContext().PendingBootManagerConfigEvents = append(ctx.FwContext().PendingBootManagerConfigEvents, ev)
+		}
+	}
+	c.Assert(ctx.FwContext().LoaderConfEvent, NotNil)
+	return ctx
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageStartLoaderConfFromLog(c *C) {
+	ctx := s.newLoaderConfContext(c, nil)
+
+	handler, err := NewSystemdBootLoadHandler(newMockImage().newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "c135274c6471e4e4178533086b5b680104d1e0c3c4605dbd0820426201c0555d")},
+		{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeStringEventDigest(crypto.SHA256, string(tcglog.EFIExitBootServicesInvocationEvent))},
+		{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeStringEventDigest(crypto.SHA256, string(tcglog.EFIExitBootServicesSucceededEvent))},
+	})
+	c.Check(ctx.FwContext().LoaderConfEvent, IsNil)
+	c.Check(ctx.FwContext().PendingBootManagerConfigEvents, HasLen, 0)
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageStartLoaderConf(c *C) {
+	ctx := s.newLoaderConfContext(c, &LoadParams{LoaderConf: []byte("timeout 5\n")})
+
+	handler, err := NewSystemdBootLoadHandler(newMockImage().newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "842fde287446e59d87c7c83fe5604b5e30e2ee94538ac2b512cd2dca1cd90346")},
+		{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeStringEventDigest(crypto.SHA256, string(tcglog.EFIExitBootServicesInvocationEvent))},
+		{pcr: 5, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeStringEventDigest(crypto.SHA256, string(tcglog.EFIExitBootServicesSucceededEvent))},
+	})
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageStartLoaderConfNoEvent(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(internal_efi.BootManagerConfigPCR),
+	}, &LoadParams{LoaderConf: []byte("timeout 5\n")}, nil)
+
+	handler, err := NewSystemdBootLoadHandler(newMockImage().newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `cannot measure loader.conf: the log doesn't contain a loader.conf event`)
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageLoadUsesShim(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{
+		Name:     Db,
+		Contents: msDb(c),
+	}
+	ctx.ShimContext().Flags = ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement
+	ctx.ShimContext().VendorDb = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, kernelUbuntuSig3))
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := new(SystemdBootLoadHandler)
+	childHandler, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(childHandler, Equals, s.mockImageLoadHandlerMap[image])
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "68bdff38e48c399326ca7356eb992693d13301f3925caf10e7b39dc9240789cd")},
+	})
+	c.Check(ctx.ShimContext().HasVerificationEvent(ctx.events[0].digest), testutil.IsTrue)
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageLoadNoShim(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{
+		Name:     Db,
+		Contents: append(msDb(c), efitest.NewSignatureListX509(c, canonicalCACert, testOwnerGuid)),
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, kernelUbuntuSig3))
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := new(SystemdBootLoadHandler)
+	childHandler, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(childHandler, Equals, s.mockImageLoadHandlerMap[image])
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "8c06c18055bc8f82df1405ae0fe80f64bc9b444ba82b2879acc113b9c751f6fb")},
+	})
+	c.Check(ctx.FwContext().HasVerificationEvent(ctx.events[0].digest), testutil.IsTrue)
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageLoadNoShimError(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{
+		Name:     Db,
+		Contents: msDb(c),
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, kernelUbuntuSig3))
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := new(SystemdBootLoadHandler)
+	_, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, "cannot measure image: cannot measure secure boot event: cannot determine authority")
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageLoadType1Entry(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(KernelConfigPCR),
+		handlers: s,
+	}, &LoadParams{
+		KernelCommandline: "root=/dev/sda2 ro quiet",
+		Devicetree:        []byte("dtb"),
+	}, nil)
+
+	image := newMockImage()
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := new(SystemdBootLoadHandler)
+	childHandler, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(childHandler, Equals, s.mockImageLoadHandlerMap[image])
+
+	dtHash := crypto.SHA256.New()
+	dtHash.Write([]byte("dtb"))
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: dtHash.Sum(nil)},
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeSystemdEFIStubCommandlineDigest(crypto.SHA256, "root=/dev/sda2 ro quiet")},
+	})
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageLoadType1EntryNoDevicetree(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(KernelConfigPCR),
+		handlers: s,
+	}, &LoadParams{KernelCommandline: "root=/dev/sda2 ro quiet"}, nil)
+
+	image := newMockImage()
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := new(SystemdBootLoadHandler)
+	_, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeSystemdEFIStubCommandlineDigest(crypto.SHA256, "root=/dev/sda2 ro quiet")},
+	})
+}
+
+func (s *sdbootLoadHandlerSuite) TestMeasureImageLoadUKI(c *C) {
+	// systemd-boot doesn't measure anything to PCR12 for UKIs, as
+	// this is done by systemd-stub.
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(KernelConfigPCR),
+		handlers: s,
+	}, &LoadParams{
+		KernelCommandline: "root=/dev/sda2 ro quiet",
+		Devicetree:        []byte("dtb"),
+	}, nil)
+
+	image := newMockImage().addSection(".linux", nil)
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := new(SystemdBootLoadHandler)
+	childHandler, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(childHandler, Equals, s.mockImageLoadHandlerMap[image])
+	c.Check(ctx.events, HasLen, 0)
+}
@@ -0,0 +1,262 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/tcglog-parser"
+	"golang.org/x/xerrors"
+)
+
+// systemdStubUKISections are the UKI sections that systemd-stub measures to the
+// kernel boot PCR (11), in the order in which it measures them. Note that this
+// doesn't include .pcrsig, which isn't measured.
+var systemdStubUKISections = []string{
+	".linux",
+	".osrel",
+	".cmdline",
+	".initrd",
+	".ucode",
+	".splash",
+	".dtb",
+	".uname",
+	".sbat",
+	".pcrpkey",
+}
+
+// systemdStubUKIUnpredictableSections are UKI sections that systemd-stub uses to
+// select between alternative sets of sections at boot time, either by profile
+// (.profile) or by matching the hardware (.hwids, .dtbauto and .efifw). The
+// measurements for UKIs with any of these can't be predicted.
+var systemdStubUKIUnpredictableSections = []string{
+	".profile",
+	".dtbauto",
+	".hwids",
+	".efifw",
+}
+
+// systemdStubUKIDigestAlgs are the algorithms for which the digests of UKI
+// sections are computed.
+var systemdStubUKIDigestAlgs = []crypto.Hash{crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// systemdStubUKISection corresponds to a section in a UKI that is measured by
+// systemd-stub.
+type systemdStubUKISection struct {
+	name    string
+	digests map[crypto.Hash][]byte
+}
+
+// systemdStubUKILoadHandler is the handler for a generic UKI based on systemd-stub.
+type systemdStubUKILoadHandler struct {
+	hasCmdline bool
+	sections   []systemdStubUKISection
+}
+
+func newSystemdStubUKILoadHandler(image peImageHandle) (imageLoadHandler, error) {
+	for _, name := range systemdStubUKIUnpredictableSections {
+		if image.HasSection(name) {
+			return nil, fmt.Errorf("cannot predict measurements for UKI with %s section", name)
+		}
+	}
+
+	out := &systemdStubUKILoadHandler{hasCmdline: image.HasSection(".cmdline")}
+
+	for _, name := range systemdStubUKISections {
+		r := image.OpenSectionAsLoaded(name)
+		if r == nil {
+			continue
+		}
+
+		// Compute the digests of each section up front so that we
+		// only read them once.
+		hashes := make(map[crypto.Hash]hash.Hash)
+		var w []io.Writer
+		for _, alg := range systemdStubUKIDigestAlgs {
+			h := alg.New()
+			hashes[alg] = h
+			w = append(w, h)
+		}
+		if _, err := io.Copy(io.MultiWriter(w...), r); err != nil {
+			return nil, xerrors.Errorf("cannot compute digest of %s section: %w", name, err)
+		}
+
+		section := systemdStubUKISection{name: name, digests: make(map[crypto.Hash][]byte)}
+		for alg, h := range hashes {
+			section.digests[alg] = h.Sum(nil)
+		}
+		out.sections = append(out.sections, section)
+	}
+
+	return out, nil
+}
+
+func (h *systemdStubUKILoadHandler) measureKernelBoot(ctx pcrBranchContext) error {
+	// The stub measures the name of each section (including the NULL terminator)
+	// followed by its contents.
+	alg := ctx.PCRAlg().GetHash()
+	for _, section := range h.sections {
+		digest, ok := section.digests[alg]
+		if !ok {
+			return errors.New("unsupported digest algorithm")
+		}
+
+		nameHash := alg.New()
+		io.WriteString(nameHash, section.name)
+		nameHash.Write([]byte{0})
+
+		ctx.ExtendPCR(kernelBootPCR, nameHash.Sum(nil))
+		ctx.ExtendPCR(kernelBootPCR, digest)
+	}
+
+	return nil
+}
+
+func (h *systemdStubUKILoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
+	// The measurements to the kernel boot PCR (11) are not required for UKIs that
+	// are bound to signed PCR policies, as these are covered by the signed PCR
+	// policies embedded in the UKI. In that case, the kernel boot PCR shouldn't be
+	// part of the profile.
+	if ctx.PCRs().Contains(kernelBootPCR) {
+		if err := h.measureKernelBoot(ctx); err != nil {
+			return xerrors.Errorf("cannot measure kernel boot events: %w", err)
+		}
+	}
+
+	// The stub only measures a commandline supplied by the loader, which is
+	// ignored if the UKI has an embedded commandline (this assumes that secure
+	// boot is enabled). It doesn't measure anything if the commandline is empty.
+	if ctx.PCRs().Contains(kernelConfigPCR) && !h.hasCmdline && ctx.Params().KernelCommandline != "" {
+		ctx.ExtendPCR(kernelConfigPCR,
+			tcglog.ComputeSystemdEFIStubCommandlineDigest(ctx.PCRAlg().GetHash(), ctx.Params().KernelCommandline))
+	}
+
+	return measureSystemdStubExtensions(ctx)
+}
+
+func (h *systemdStubUKILoadHandler) MeasureImageLoad(_ pcrBranchContext, _ peImageHandle) (imageLoadHandler, error) {
+	return nil, errors.New("kernel is a leaf image")
+}
+
+func measureSystemdStubAddon(ctx pcrBranchContext, addon Image) error {
+	handle, err := openPeImage(addon)
+	if err != nil {
+		return xerrors.Errorf("cannot open image: %w", err)
+	}
+	defer handle.Close()
+
+	// The stub loads addons with shim's protocol if shim was loaded, else it
+	// relies on the firmware. Addons aren't loaded via the image measurer, so
+	// check that the addon isn't revoked here.
+	if err := checkImageLoadUsingShimIfLoadedNotRevoked(ctx, handle); err != nil {
+		return err
+	}
+	if err := measureImageLoadUsingShimIfLoaded(ctx, handle); err != nil {
+		return xerrors.Errorf("cannot measure image load: %w", err)
+	}
+
+	if !ctx.PCRs().Contains(kernelConfigPCR) {
+		return nil
+	}
+
+	// The stub measures the commandline contained in the addon's .cmdline
+	// section in the same way as the commandline supplied by the loader.
+	r := handle.OpenSectionAsLoaded(".cmdline")
+	if r == nil {
+		return nil
+	}
+	cmdline, err := io.ReadAll(r)
+	if err != nil {
+		return xerrors.Errorf("cannot read .cmdline section: %w", err)
+	}
+	if n := bytes.IndexByte(cmdline, 0); n >= 0 {
+		cmdline = cmdline[:n]
+	}
+	if len(cmdline) > 0 {
+		ctx.ExtendPCR(kernelConfigPCR,
+			tcglog.ComputeSystemdEFIStubCommandlineDigest(ctx.PCRAlg().GetHash(), string(cmdline)))
+	}
+
+	return nil
+}
+
+func measureSystemdStubExtensionImage(ctx pcrBranchContext, pcr tpm2.Handle, image Image) error {
+	r, err := image.Open()
+	if err != nil {
+		return xerrors.Errorf("cannot open image: %w", err)
+	}
+	defer r.Close()
+
+	h := ctx.PCRAlg().NewHash()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, r.Size())); err != nil {
+		return xerrors.Errorf("cannot compute digest: %w", err)
+	}
+	ctx.ExtendPCR(pcr, h.Sum(nil))
+	return nil
+}
+
+// measureSystemdStubExtensions measures the events associated with the addons,
+// credentials, configuration extensions and system extensions that systemd-stub
+// loads from the ESP, which are supplied via UKIAddonParams,
+// SystemdCredentialsParams, SystemdConfextParams and SystemdSysextParams. This
+// should be called after the commandline supplied by the loader is measured.
+func measureSystemdStubExtensions(ctx pcrBranchContext) error {
+	for _, addon := range ctx.Params().UKIAddons {
+		if err := measureSystemdStubAddon(ctx, addon); err != nil {
+			return xerrors.Errorf("cannot measure addon %v: %w", addon, err)
+		}
+	}
+
+	if ctx.PCRs().Contains(kernelConfigPCR) {
+		// The stub measures the contents of each credential file that it loads.
+		for _, cred := range ctx.Params().SystemdCredentials {
+			credHash := ctx.PCRAlg().NewHash()
+			credHash.Write(cred)
+			ctx.ExtendPCR(kernelConfigPCR, credHash.Sum(nil))
+		}
+	}
+
+	if ctx.PCRs().Contains(sysextPCR) {
+		for _, sysext := range ctx.Params().SystemdSysexts {
+			if err := measureSystemdStubExtensionImage(ctx, sysextPCR, sysext); err != nil {
+				return xerrors.Errorf("cannot measure system extension %v: %w", sysext, err)
+			}
+		}
+	}
+
+	if ctx.PCRs().Contains(kernelConfigPCR) {
+		for _, confext := range ctx.Params().SystemdConfexts {
+			if err := measureSystemdStubExtensionImage(ctx, kernelConfigPCR, confext); err != nil {
+				return xerrors.Errorf("cannot measure configuration extension %v: %w", confext, err)
+			}
+		}
+	}
+
+	return nil
+}
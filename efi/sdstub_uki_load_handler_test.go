@@ -0,0 +1,281 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi_test
+
+import (
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	efi "github.com/canonical/go-efilib"
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/tcglog-parser"
+
+	. "github.com/snapcore/secboot/efi"
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+	"github.com/snapcore/secboot/internal/efitest"
+	"github.com/snapcore/secboot/internal/testutil"
+)
+
+type sdstubUKILoadHandlerSuite struct {
+	mockImageHandleMixin
+}
+
+var _ = Suite(&sdstubUKILoadHandlerSuite{})
+
+func (s *sdstubUKILoadHandlerSuite) makeMockUKI() *mockImage {
+	return newMockImage().
+		addSection(".sdmagic", []byte("#### LoaderInfo: systemd-stub 255 ####")).
+		addSection(".initrd", []byte("mock initrd")).
+		addSection(".linux", []byte("mock kernel")).
+		addSection(".osrel", []byte("ID=fedora\n")).
+		addSection(".uname", []byte("6.8.0")).
+		addSection(".pcrsig", []byte("{}"))
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartKernelBoot(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, pcrs: MakePcrFlags(KernelBootPCR)}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+
+	// The sections are measured in a well defined order and .pcrsig and .sdmagic
+	// are not measured.
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "0da293e37ad5511c59be47993769aacb91b243f7d010288e118dc90e95aaef5a")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "c3363bf9734cf30d42f49ed9d5d04a122990610c1ebac8271a8efffe55387e9c")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "3fb9e4e3cc810d4326b5c13cef18aee1f9df8c5f4f7f5b96665724fa3b846e08")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "bfe6178059c27c6eca7341b8cfbf5250edc8c90a76a23a19d00678ecf7d3cc9d")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "15ee37e75f1e8d42080e91fdbbd2560780918c81fe3687ae6d15c472bbdaac75")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "7ccf4abcb13623e561bfa728501bc1e18c4d5efb3ecc88bea669dbfc6fa1e490")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "da7a6d941caa9d28b8a3665c4865c143db8f99400ac88d883370ae3021636c30")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "3b1506f0ce0d28130e896c0777062ae9607e7552764e4fd2601a65259e49303c")},
+	})
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartKernelBootSHA384(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(newMockImage().addSection(".linux", []byte("mock kernel")).newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA384, pcrs: MakePcrFlags(KernelBootPCR)}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+
+	nameHash := crypto.SHA384.New()
+	nameHash.Write([]byte(".linux\x00"))
+	dataHash := crypto.SHA384.New()
+	dataHash.Write([]byte("mock kernel"))
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: nameHash.Sum(nil)},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: dataHash.Sum(nil)},
+	})
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartKernelConfig(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, pcrs: MakePcrFlags(KernelConfigPCR)}, &LoadParams{
+		KernelCommandline:  "console=ttyS0 console=tty1 panic=-1",
+		SystemdCredentials: [][]byte{[]byte("cred1"), []byte("cred2")},
+	}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: tpm2.Digest(tcglog.ComputeSystemdEFIStubCommandlineDigest(crypto.SHA256, "console=ttyS0 console=tty1 panic=-1"))},
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "2173a7c424c827f5a60a3e1f6063847206a626ee5d2db848e19af80c49c62b41")},
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "6f467ab7cfde4471de615bc730fc2ea2b9c1772d1da7144ffb47cabbb2620c7c")},
+	})
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartKernelConfigEmbeddedCommandline(c *C) {
+	// The embedded commandline overrides the one supplied by the loader, and
+	// isn't measured to PCR12.
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().addSection(".cmdline", []byte("foo")).newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, pcrs: MakePcrFlags(KernelConfigPCR)}, &LoadParams{
+		KernelCommandline:  "console=ttyS0 console=tty1 panic=-1",
+		SystemdCredentials: [][]byte{[]byte("cred1")},
+	}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "2173a7c424c827f5a60a3e1f6063847206a626ee5d2db848e19af80c49c62b41")},
+	})
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartKernelBootEmbeddedCommandline(c *C) {
+	// The embedded commandline is measured to PCR11 instead.
+	handler, err := NewSystemdStubUKILoadHandler(newMockImage().
+		addSection(".linux", []byte("mock kernel")).
+		addSection(".cmdline", []byte("foo")).newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, pcrs: MakePcrFlags(KernelBootPCR, KernelConfigPCR)}, &LoadParams{
+		KernelCommandline: "console=ttyS0 console=tty1 panic=-1",
+	}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "0da293e37ad5511c59be47993769aacb91b243f7d010288e118dc90e95aaef5a")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "c3363bf9734cf30d42f49ed9d5d04a122990610c1ebac8271a8efffe55387e9c")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "461203a89f23e36c3a4dc817f905b00484d2cf7e7d9376f13df91c41d84abe46")},
+		{pcr: 11, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")},
+	})
+}
+
+func (s *sdstubUKILoadHandlerSuite) makeMockExtension(c *C, name string, data []byte) Image {
+	path := filepath.Join(c.MkDir(), name)
+	c.Assert(os.WriteFile(path, data, 0644), IsNil)
+	return NewFileImage(path)
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartAddons(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	addon1 := newMockImage().
+		withDigest(crypto.SHA256, testutil.DecodeHexString(c, "a6a4ba3d6fd2b5b4b9f1c9c4e5bb1c4b6a2a8f6a6c1b1f5a8c5d4e3f2a1b0c9d")).
+		addSection(".cmdline", []byte("quiet splash\x00\x00\x00"))
+	addon2 := newMockImage().
+		withDigest(crypto.SHA256, testutil.DecodeHexString(c, "0b2e3d4c5f6a7b8c9d0e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e"))
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(internal_efi.BootManagerCodePCR, KernelConfigPCR),
+	}, &LoadParams{
+		KernelCommandline: "console=ttyS0",
+		UKIAddons:         []Image{addon1, addon2},
+	}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+
+	// The commandline from each addon is measured after the commandline
+	// supplied by the loader.
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeSystemdEFIStubCommandlineDigest(crypto.SHA256, "console=ttyS0")},
+		{pcr: 4, eventType: mockPcrBranchExtendEvent, digest: addon1.digest},
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: tcglog.ComputeSystemdEFIStubCommandlineDigest(crypto.SHA256, "quiet splash")},
+		{pcr: 4, eventType: mockPcrBranchExtendEvent, digest: addon2.digest},
+	})
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartAddonRevoked(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	addon := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4))
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(internal_efi.BootManagerCodePCR),
+	}, &LoadParams{UKIAddons: []Image{addon}}, nil)
+	ctx.FwContext().Db = &SecureBootDB{Name: Db, Contents: msDb(c)}
+	ctx.FwContext().Dbx = &SecureBootDB{
+		Name:     Dbx,
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, msUefiCACert, msOwnerGuid)},
+	}
+
+	err = handler.MeasureImageStart(ctx)
+	c.Check(err, ErrorMatches, `cannot measure addon .*: image .* is revoked: certificate "CN=Microsoft Corporation UEFI CA 2011,O=Microsoft Corporation,L=Redmond,ST=Washington,C=US" is in dbx`)
+
+	var e *RevokedImageError
+	c.Assert(errors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Image, Equals, addon)
+	c.Check(ctx.events, HasLen, 0)
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartCredentialsAndExtensions(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(KernelConfigPCR, SysextPCR),
+	}, &LoadParams{
+		SystemdCredentials: [][]byte{[]byte("cred1")},
+		SystemdSysexts: []Image{
+			s.makeMockExtension(c, "foo.raw", []byte("sysext1")),
+			s.makeMockExtension(c, "bar.raw", []byte("sysext2")),
+		},
+		SystemdConfexts: []Image{s.makeMockExtension(c, "foo.confext.raw", []byte("confext1"))},
+	}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+
+	digest := func(data string) tpm2.Digest {
+		h := crypto.SHA256.New()
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: digest("cred1")},
+		{pcr: 13, eventType: mockPcrBranchExtendEvent, digest: digest("sysext1")},
+		{pcr: 13, eventType: mockPcrBranchExtendEvent, digest: digest("sysext2")},
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: digest("confext1")},
+	})
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartSysextsNotInProfile(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(KernelConfigPCR),
+	}, &LoadParams{
+		SystemdSysexts: []Image{NewFileImage(filepath.Join(c.MkDir(), "missing.raw"))},
+	}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, HasLen, 0)
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestMeasureImageStartSysextErr(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(c.MkDir(), "missing.raw")
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(SysextPCR),
+	}, &LoadParams{
+		SystemdSysexts: []Image{NewFileImage(path)},
+	}, nil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `cannot measure system extension .*/missing.raw: cannot open image: open .*/missing.raw: no such file or directory`)
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestNewSystemdStubUKILoadHandlerProfile(c *C) {
+	_, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().addSection(".profile", []byte("ID=foo\n")).newPeImageHandle())
+	c.Check(err, ErrorMatches, `cannot predict measurements for UKI with .profile section`)
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestNewSystemdStubUKILoadHandlerDtbAuto(c *C) {
+	_, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().addSection(".dtbauto", nil).newPeImageHandle())
+	c.Check(err, ErrorMatches, `cannot predict measurements for UKI with .dtbauto section`)
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestNewSystemdStubUKILoadHandlerHwids(c *C) {
+	_, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().addSection(".hwids", nil).newPeImageHandle())
+	c.Check(err, ErrorMatches, `cannot predict measurements for UKI with .hwids section`)
+}
+
+func (s *sdstubUKILoadHandlerSuite) TestNewSystemdStubUKILoadHandlerEfiFw(c *C) {
+	_, err := NewSystemdStubUKILoadHandler(s.makeMockUKI().addSection(".efifw", nil).newPeImageHandle())
+	c.Check(err, ErrorMatches, `cannot predict measurements for UKI with .efifw section`)
+}
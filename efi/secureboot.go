@@ -21,6 +21,8 @@ package efi
 
 import (
 	"bytes"
+	"crypto"
+	_ "crypto/sha256"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -87,6 +89,45 @@ func WithSignatureDBUpdates(updates ...*SignatureDBUpdate) PCRProfileOption {
 type secureBootAuthority struct {
 	Source    efi.VariableDescriptor
 	Signature *efi.SignatureData
+	Type      efi.GUID // The type of the signature list that contains Signature
+}
+
+// RevokedImageError describes an image that is part of the load sequences supplied
+// to [AddPCRProfile] which would be refused by the platform firmware or shim because
+// it is revoked, either by an entry in the forbidden signature database (dbx) or by the
+// effective SBAT revocation level. This considers the revocation policy of each branch
+// in the profile, including branches created by [WithSignatureDBUpdates] and
+// [WithShimSbatPolicyLatest]. It is supplied to the function passed to
+// [WithRevokedImageHandler], and returned from [AddPCRProfile] if every image at a
+// point in a load sequence is revoked.
+type RevokedImageError struct {
+	Image Image // The revoked image
+	err   error
+}
+
+func (e *RevokedImageError) Error() string {
+	return fmt.Sprintf("image %v is revoked: %v", e.Image, e.err)
+}
+
+func (e *RevokedImageError) Unwrap() error {
+	return e.err
+}
+
+type revokedImageHandlerOption func(*RevokedImageError)
+
+func (o revokedImageHandlerOption) ApplyOptionTo(visitor internal_efi.PCRProfileOptionVisitor) error {
+	visitor.SetRevokedImageHandler(func(err error) {
+		o(err.(*RevokedImageError))
+	})
+	return nil
+}
+
+// WithRevokedImageHandler can be supplied to [AddPCRProfile] in order to be notified
+// about images that are omitted from the profile because they are revoked. The supplied
+// function is called once for each revoked image in each branch of the profile. If this
+// isn't supplied, revoked images are omitted from the profile without being reported.
+func WithRevokedImageHandler(fn func(err *RevokedImageError)) PCRProfileOption {
+	return revokedImageHandlerOption(fn)
 }
 
 // secureBootDB describes a secure boot database containing signatures that can be
@@ -98,23 +139,92 @@ type secureBootDB struct {
 
 type secureBootPolicyMixin struct{}
 
-// DetermineAuthority returns the CA that will authenticate the specified image using the
-// supplied signature databases, in order to determine the verification digest that will
-// be measured before the image is loaded.
+// findCertificateAuthority returns the CA from the supplied signature databases that
+// is the trust anchor for the supplied Authenticode signature, or nil if there isn't
+// one.
+func (m secureBootPolicyMixin) findCertificateAuthority(dbs []*secureBootDB, sig *efi.WinCertificateAuthenticode) *secureBootAuthority {
+	for _, db := range dbs {
+		// Iterate over ESLs
+		for _, l := range db.Contents {
+			// Ignore ESLs that aren't X509 certificates
+			if l.Type != efi.CertX509Guid {
+				continue
+			}
+
+			// Shouldn't happen, but just in case...
+			if len(l.Signatures) == 0 {
+				continue
+			}
+
+			ca, err := x509.ParseCertificate(l.Signatures[0].Data)
+			if err != nil {
+				continue
+			}
+
+			if sig.CertLikelyTrustAnchor(ca) {
+				return &secureBootAuthority{
+					Source:    db.Name,
+					Signature: l.Signatures[0],
+					Type:      l.Type}
+			}
+		}
+	}
+
+	return nil
+}
+
+// findDigestAuthority returns the entry from the supplied signature databases that
+// contains the SHA-256 digest of the supplied image, or nil if there isn't one. The
+// digest is only computed if one of the databases contains SHA-256 digests.
+func (m secureBootPolicyMixin) findDigestAuthority(dbs []*secureBootDB, image peImageHandle) (*secureBootAuthority, error) {
+	var digest []byte
+	for _, db := range dbs {
+		// Iterate over ESLs
+		for _, l := range db.Contents {
+			// Ignore ESLs that aren't SHA-256 digests
+			if l.Type != efi.CertSHA256Guid {
+				continue
+			}
+
+			if digest == nil {
+				var err error
+				digest, err = image.ImageDigest(crypto.SHA256)
+				if err != nil {
+					return nil, xerrors.Errorf("cannot compute image digest: %w", err)
+				}
+			}
+
+			for _, sig := range l.Signatures {
+				if bytes.Equal(sig.Data, digest) {
+					return &secureBootAuthority{
+						Source:    db.Name,
+						Signature: sig,
+						Type:      l.Type}, nil
+				}
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// DetermineAuthority returns the CA or image digest entry that will authenticate the
+// specified image using the supplied signature databases, in order to determine the
+// verification digest that will be measured before the image is loaded.
 //
 // Where an image has multiple signatures, each signature will be tested against the provided
 // databases in the order that they appear in the image.
 //
 // For each signature in the image, this will iterate over the supplied signature databases
 // in the order that they are provided, and the certificates in the order that they appear in
-// each database. The first valid CA will be returned.
+// each database. The first valid CA will be returned. If there isn't a valid CA for a
+// signature, the supplied signature databases are searched for the image's SHA-256 digest
+// before the next signature is tested. Unsigned images can only be authenticated by their
+// image digest.
 //
 // The behaviour with multiple signatures isn't defined in the UEFI specification, but the
 // implementation of this function matches the behaviour of EDK2 and the firmware on the Intel
 // NUC.
-//
-// This only supports images that are verified with an asymmetric signature - it does not
-// support images that are authenticated by their image digest.
 func (m secureBootPolicyMixin) DetermineAuthority(dbs []*secureBootDB, image peImageHandle) (*secureBootAuthority, error) {
 	sigs, err := image.SecureBootSignatures()
 	if err != nil {
@@ -122,44 +232,105 @@ func (m secureBootPolicyMixin) DetermineAuthority(dbs []*secureBootDB, image peI
 	}
 
 	if len(sigs) == 0 {
-		return nil, errors.New("no secure boot signatures")
+		authority, err := m.findDigestAuthority(dbs, image)
+		switch {
+		case err != nil:
+			return nil, err
+		case authority == nil:
+			return nil, errors.New("no secure boot signatures")
+		}
+		return authority, nil
 	}
 
-	var authority *secureBootAuthority
-SignatureLoop:
 	for _, sig := range sigs {
-		for _, db := range dbs {
-			// Iterate over ESLs
-			for _, l := range db.Contents {
-				// Ignore ESLs that aren't X509 certificates
-				if l.Type != efi.CertX509Guid {
-					continue
-				}
+		if authority := m.findCertificateAuthority(dbs, sig); authority != nil {
+			return authority, nil
+		}
 
-				// Shouldn't happen, but just in case...
-				if len(l.Signatures) == 0 {
-					continue
-				}
+		authority, err := m.findDigestAuthority(dbs, image)
+		if err != nil {
+			return nil, err
+		}
+		if authority != nil {
+			return authority, nil
+		}
+	}
 
-				ca, err := x509.ParseCertificate(l.Signatures[0].Data)
-				if err != nil {
-					continue
-				}
+	return nil, errors.New("cannot determine authority")
+}
 
-				if sig.CertLikelyTrustAnchor(ca) {
-					authority = &secureBootAuthority{
-						Source:    db.Name,
-						Signature: l.Signatures[0]}
-					break SignatureLoop
+// imageRevokedError is returned from secureBootPolicyMixin.CheckNotRevoked if an
+// image is revoked, in order to distinguish this from other errors.
+type imageRevokedError string
+
+func (e imageRevokedError) Error() string {
+	return string(e)
+}
+
+// isImageRevokedError indicates whether the supplied error indicates that an
+// image is revoked.
+func isImageRevokedError(err error) bool {
+	var e imageRevokedError
+	return errors.As(err, &e)
+}
+
+// CheckNotRevoked returns an error if the specified image is revoked by any of the supplied
+// forbidden signature databases, either because one of its signing certificates or its
+// SHA-256 digest is present in one of them. In this case, the returned error is an
+// imageRevokedError. Other errors indicate that the check couldn't be performed.
+func (m secureBootPolicyMixin) CheckNotRevoked(dbs []*secureBootDB, image peImageHandle) error {
+	// The signatures and digest are only obtained if they are needed.
+	var (
+		sigs    []*efi.WinCertificateAuthenticode
+		gotSigs bool
+		digest  []byte
+		err     error
+	)
+	for _, db := range dbs {
+		if db == nil {
+			continue
+		}
+
+		// Iterate over ESLs
+		for _, l := range db.Contents {
+			switch l.Type {
+			case efi.CertX509Guid:
+				if !gotSigs {
+					sigs, err = image.SecureBootSignatures()
+					if err != nil {
+						return xerrors.Errorf("cannot obtain secure boot signatures: %w", err)
+					}
+					gotSigs = true
+				}
+				for _, entry := range l.Signatures {
+					cert, err := x509.ParseCertificate(entry.Data)
+					if err != nil {
+						continue
+					}
+					for _, sig := range sigs {
+						signer := sig.GetSigner()
+						if (signer != nil && bytes.Equal(signer.Raw, cert.Raw)) || sig.CertLikelyTrustAnchor(cert) {
+							return imageRevokedError(fmt.Sprintf("certificate \"%v\" is in %s", cert.Subject, db.Name.Name))
+						}
+					}
+				}
+			case efi.CertSHA256Guid:
+				if digest == nil {
+					digest, err = image.ImageDigest(crypto.SHA256)
+					if err != nil {
+						return xerrors.Errorf("cannot compute image digest: %w", err)
+					}
+				}
+				for _, entry := range l.Signatures {
+					if bytes.Equal(entry.Data, digest) {
+						return imageRevokedError(fmt.Sprintf("image digest is in %s", db.Name.Name))
+					}
 				}
 			}
 		}
 	}
 
-	if authority == nil {
-		return nil, errors.New("cannot determine authority")
-	}
-	return authority, nil
+	return nil
 }
 
 type signatureDBUpdateFirmwareQuirk int
@@ -68,7 +68,8 @@ func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityShim(c *C)
 		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4)),
 		expected: &SecureBootAuthority{
 			Source:    Db,
-			Signature: db.Contents[1].Signatures[0]}})
+			Signature: db.Contents[1].Signatures[0],
+			Type:      db.Contents[1].Type}})
 	c.Check(err, IsNil)
 }
 
@@ -89,7 +90,8 @@ func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityGrub(c *C)
 		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)),
 		expected: &SecureBootAuthority{
 			Source:    vendorDb.Name,
-			Signature: vendorDb.Contents[0].Signatures[0]}})
+			Signature: vendorDb.Contents[0].Signatures[0],
+			Type:      vendorDb.Contents[0].Type}})
 	c.Check(err, IsNil)
 }
 
@@ -111,7 +113,8 @@ func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityGrubFromDb(
 		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)),
 		expected: &SecureBootAuthority{
 			Source:    Db,
-			Signature: db.Contents[2].Signatures[0]}})
+			Signature: db.Contents[2].Signatures[0],
+			Type:      db.Contents[2].Type}})
 	c.Check(err, IsNil)
 }
 
@@ -135,7 +138,8 @@ func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityDualSignatu
 			appendSignatures(sig),
 		expected: &SecureBootAuthority{
 			Source:    Db,
-			Signature: db.Contents[2].Signatures[0]}})
+			Signature: db.Contents[2].Signatures[0],
+			Type:      db.Contents[2].Type}})
 	c.Check(err, IsNil)
 }
 
@@ -158,7 +162,8 @@ func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityDualSignatu
 			appendSignatures(sig),
 		expected: &SecureBootAuthority{
 			Source:    Db,
-			Signature: db.Contents[1].Signatures[0]}})
+			Signature: db.Contents[1].Signatures[0],
+			Type:      db.Contents[1].Type}})
 	c.Check(err, IsNil)
 }
 
@@ -183,6 +188,240 @@ func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityNoSignature
 	c.Check(err, ErrorMatches, "no secure boot signatures")
 }
 
+func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityDigestUnsigned(c *C) {
+	digest := testutil.DecodeHexString(c, "a6bb8e6b0c6a0a5a2b9bfa2cf3a0bdfd6bd0c7bcbb8cb34b9b4f1a1c2b3c4d5e")
+	db := &SecureBootDB{
+		Name: Db,
+		Contents: efi.SignatureDatabase{
+			efitest.NewSignatureListX509(c, msUefiCACert, msOwnerGuid),
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: testutil.DecodeHexString(c, "317650b68e9328b5c4232f1d6ca5ec9ae4fe6e5be99db36520e0ad67a4f17037")},
+					{Owner: testOwnerGuid, Data: digest},
+				},
+			},
+		},
+	}
+
+	err := s.testSecureBootPolicyMixinDetermineAuthority(c, &testSecureBootPolicyMixinDetermineAuthorityData{
+		dbs:   []*SecureBootDB{db},
+		image: newMockImage().withDigest(crypto.SHA256, digest),
+		expected: &SecureBootAuthority{
+			Source:    Db,
+			Signature: db.Contents[1].Signatures[1],
+			Type:      db.Contents[1].Type}})
+	c.Check(err, IsNil)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityDigestNoTrustAnchor(c *C) {
+	// Verify that a signed image without a trust anchor in the signature
+	// database is authenticated by its digest.
+	sig := efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4)
+	db := &SecureBootDB{
+		Name: Db,
+		Contents: efi.SignatureDatabase{
+			efitest.NewSignatureListX509(c, testUefiCACert1, testOwnerGuid),
+			{
+				Type:       efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{{Owner: testOwnerGuid, Data: sig.Digest()}},
+			},
+		},
+	}
+
+	err := s.testSecureBootPolicyMixinDetermineAuthority(c, &testSecureBootPolicyMixinDetermineAuthorityData{
+		dbs:   []*SecureBootDB{db},
+		image: newMockImage().appendSignatures(sig),
+		expected: &SecureBootAuthority{
+			Source:    Db,
+			Signature: db.Contents[1].Signatures[0],
+			Type:      db.Contents[1].Type}})
+	c.Check(err, IsNil)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityCertPreferredOverDigest(c *C) {
+	sig := efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4)
+	db := &SecureBootDB{
+		Name: Db,
+		Contents: efi.SignatureDatabase{
+			{
+				Type:       efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{{Owner: testOwnerGuid, Data: sig.Digest()}},
+			},
+			efitest.NewSignatureListX509(c, msUefiCACert, msOwnerGuid),
+		},
+	}
+
+	err := s.testSecureBootPolicyMixinDetermineAuthority(c, &testSecureBootPolicyMixinDetermineAuthorityData{
+		dbs:   []*SecureBootDB{db},
+		image: newMockImage().appendSignatures(sig),
+		expected: &SecureBootAuthority{
+			Source:    Db,
+			Signature: db.Contents[1].Signatures[0],
+			Type:      db.Contents[1].Type}})
+	c.Check(err, IsNil)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityDigestFromVendorDb(c *C) {
+	digest := testutil.DecodeHexString(c, "a6bb8e6b0c6a0a5a2b9bfa2cf3a0bdfd6bd0c7bcbb8cb34b9b4f1a1c2b3c4d5e")
+	db := &SecureBootDB{
+		Name: Db,
+		Contents: efi.SignatureDatabase{
+			efitest.NewSignatureListX509(c, msUefiCACert, msOwnerGuid),
+		},
+	}
+	vendorDb := &SecureBootDB{
+		Name: efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{
+			{
+				Type:       efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{{Owner: ShimGuid, Data: digest}},
+			},
+		},
+	}
+
+	err := s.testSecureBootPolicyMixinDetermineAuthority(c, &testSecureBootPolicyMixinDetermineAuthorityData{
+		dbs:   []*SecureBootDB{db, vendorDb},
+		image: newMockImage().withDigest(crypto.SHA256, digest),
+		expected: &SecureBootAuthority{
+			Source:    vendorDb.Name,
+			Signature: vendorDb.Contents[0].Signatures[0],
+			Type:      vendorDb.Contents[0].Type}})
+	c.Check(err, IsNil)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityUnsignedNoDigest(c *C) {
+	db := &SecureBootDB{
+		Name: Db,
+		Contents: efi.SignatureDatabase{
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: testutil.DecodeHexString(c, "317650b68e9328b5c4232f1d6ca5ec9ae4fe6e5be99db36520e0ad67a4f17037")},
+				},
+			},
+		},
+	}
+	err := s.testSecureBootPolicyMixinDetermineAuthority(c, &testSecureBootPolicyMixinDetermineAuthorityData{
+		dbs:   []*SecureBootDB{db},
+		image: newMockImage().withDigest(crypto.SHA256, testutil.DecodeHexString(c, "a6bb8e6b0c6a0a5a2b9bfa2cf3a0bdfd6bd0c7bcbb8cb34b9b4f1a1c2b3c4d5e"))})
+	c.Check(err, ErrorMatches, "no secure boot signatures")
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinDetermineAuthorityDigestErr(c *C) {
+	db := &SecureBootDB{
+		Name: Db,
+		Contents: efi.SignatureDatabase{
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: testutil.DecodeHexString(c, "317650b68e9328b5c4232f1d6ca5ec9ae4fe6e5be99db36520e0ad67a4f17037")},
+				},
+			},
+		},
+	}
+	err := s.testSecureBootPolicyMixinDetermineAuthority(c, &testSecureBootPolicyMixinDetermineAuthorityData{
+		dbs:   []*SecureBootDB{db},
+		image: newMockImage()})
+	c.Check(err, ErrorMatches, "cannot compute image digest: invalid alg")
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinCheckNotRevokedGood(c *C) {
+	dbx := &SecureBootDB{
+		Name: Dbx,
+		Contents: efi.SignatureDatabase{
+			efitest.NewSignatureListX509(c, testUefiCACert1, testOwnerGuid),
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: testutil.DecodeHexString(c, "317650b68e9328b5c4232f1d6ca5ec9ae4fe6e5be99db36520e0ad67a4f17037")},
+				},
+			},
+		},
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4))
+	c.Check(s.CheckNotRevoked([]*SecureBootDB{dbx}, image.newPeImageHandle()), IsNil)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinCheckNotRevokedNilDb(c *C) {
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4))
+	c.Check(s.CheckNotRevoked([]*SecureBootDB{nil}, image.newPeImageHandle()), IsNil)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinCheckNotRevokedCert(c *C) {
+	dbx := &SecureBootDB{
+		Name: Dbx,
+		Contents: efi.SignatureDatabase{
+			efitest.NewSignatureListX509(c, msUefiCACert, msOwnerGuid),
+		},
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4))
+	err := s.CheckNotRevoked([]*SecureBootDB{dbx}, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `certificate \"CN=Microsoft Corporation UEFI CA 2011,O=Microsoft Corporation,L=Redmond,ST=Washington,C=US\" is in dbx`)
+	c.Check(IsImageRevokedError(err), testutil.IsTrue)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinCheckNotRevokedDigest(c *C) {
+	sig := efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4)
+	dbx := &SecureBootDB{
+		Name: Dbx,
+		Contents: efi.SignatureDatabase{
+			{
+				Type: efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{
+					{Owner: testOwnerGuid, Data: testutil.DecodeHexString(c, "317650b68e9328b5c4232f1d6ca5ec9ae4fe6e5be99db36520e0ad67a4f17037")},
+					{Owner: testOwnerGuid, Data: sig.Digest()},
+				},
+			},
+		},
+	}
+
+	image := newMockImage().appendSignatures(sig)
+	err := s.CheckNotRevoked([]*SecureBootDB{dbx}, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `image digest is in dbx`)
+	c.Check(IsImageRevokedError(err), testutil.IsTrue)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinCheckNotRevokedDigestError(c *C) {
+	dbx := &SecureBootDB{
+		Name: Dbx,
+		Contents: efi.SignatureDatabase{
+			{
+				Type:       efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{{Owner: testOwnerGuid, Data: testutil.DecodeHexString(c, "317650b68e9328b5c4232f1d6ca5ec9ae4fe6e5be99db36520e0ad67a4f17037")}},
+			},
+		},
+	}
+
+	image := newMockImage().withDigest(crypto.SHA1, nil)
+	err := s.CheckNotRevoked([]*SecureBootDB{dbx}, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `cannot compute image digest: invalid alg`)
+	c.Check(IsImageRevokedError(err), testutil.IsFalse)
+}
+
+func (s *securebootSuite) TestSecureBootPolicyMixinCheckNotRevokedMultipleDbs(c *C) {
+	sig := efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)
+	dbx := &SecureBootDB{
+		Name: Dbx,
+		Contents: efi.SignatureDatabase{
+			{
+				Type:       efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{{Owner: testOwnerGuid, Data: sig.Digest()}},
+			},
+		},
+	}
+	otherDbx := &SecureBootDB{
+		Name:     Dbx,
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, testUefiCACert1, testOwnerGuid)},
+	}
+
+	image := newMockImage().appendSignatures(sig)
+	err := s.CheckNotRevoked([]*SecureBootDB{nil, otherDbx, dbx}, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `image digest is in dbx`)
+}
+
 type testApplySignatureDBUpdateData struct {
 	vars          efitest.MockVars
 	update        *SignatureDBUpdate
@@ -39,12 +39,14 @@ import (
 )
 
 const (
-	shimMokListRTName   = "MokListRT"
-	shimName            = "Shim"
-	shimSbatLevelName   = "SbatLevel"
-	shimSbatLevelRTName = "SbatLevelRT"
-	shimSbatPolicyName  = "SbatPolicy"
-	shimVendorDbName    = "vendor_db"
+	shimMokListRTName    = "MokListRT"
+	shimMokListXRTName   = "MokListXRT"
+	shimMokSBStateRTName = "MokSBStateRT"
+	shimName             = "Shim"
+	shimSbatLevelName    = "SbatLevel"
+	shimSbatLevelRTName  = "SbatLevelRT"
+	shimSbatPolicyName   = "SbatPolicy"
+	shimVendorDbName     = "vendor_db"
 )
 
 var (
@@ -94,6 +96,67 @@ func readShimSbatPolicy(vars varReader) (shimSbatPolicy, error) {
 	}
 }
 
+// readShimMokList returns the contents of the supplied MOK database from the supplied
+// environment. Shim mirrors the boot services only MokList and MokListX variables to
+// the runtime accessible MokListRT and MokListXRT variables, and these include the
+// built-in vendor certificates. Shim splits databases that are too large for a single
+// variable across several variables with a numeric suffix.
+func readShimMokList(vars varReader, name string) (*secureBootDB, error) {
+	var data []byte
+	for i := 0; ; i++ {
+		varName := name
+		if i > 0 {
+			varName = fmt.Sprintf("%s%d", name, i)
+		}
+		d, _, err := vars.ReadVar(varName, shimGuid)
+		if err == efi.ErrVarNotExist {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read %s: %w", varName, err)
+		}
+		data = append(data, d...)
+	}
+
+	db, err := efi.ReadSignatureDatabase(bytes.NewReader(data))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot decode %s: %w", name, err)
+	}
+	return &secureBootDB{
+		Name:     efi.VariableDescriptor{Name: name, GUID: shimGuid},
+		Contents: db,
+	}, nil
+}
+
+// shimAuthorityDBs returns the signature databases that shim uses to authenticate
+// images, in the order in which they are considered when determining the authority
+// that is measured. Images signed with a machine owner key are measured with the
+// MokListRT name.
+func shimAuthorityDBs(vendorDb, db, mokList *secureBootDB) []*secureBootDB {
+	dbs := []*secureBootDB{vendorDb, db}
+	if mokList != nil {
+		dbs = append(dbs, mokList)
+	}
+	return dbs
+}
+
+// readShimValidationDisabled indicates whether the user has disabled shim's
+// signature validation with mokutil --disable-validation, in which case shim
+// mirrors a MokSBState value of 1 to the MokSBStateRT variable.
+func readShimValidationDisabled(vars varReader) (bool, error) {
+	data, _, err := vars.ReadVar(shimMokSBStateRTName, shimGuid)
+	switch {
+	case err == efi.ErrVarNotExist:
+		return false, nil
+	case err != nil:
+		return false, err
+	case len(data) != 1:
+		return false, errors.New("invalid MokSBStateRT length")
+	default:
+		return data[0] == 1, nil
+	}
+}
+
 type shimSbatPolicyLatestOption struct{}
 
 // WithShimSbatPolicyLatest can be supplied to AddPCRProfile to compute the profile
@@ -151,6 +214,35 @@ func newestSbatLevel(levels ...[]byte) ([]byte, error) {
 	return newest, nil
 }
 
+// checkSbatLevel returns an error if any of the supplied SBAT components are
+// revoked by the supplied SBAT revocation level.
+func checkSbatLevel(level []byte, components []sbatComponent) error {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimRight(level, "\x00")))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return xerrors.Errorf("cannot parse SBAT level: %w", err)
+	}
+
+	for _, record := range records {
+		if len(record) < 2 {
+			return errors.New("invalid SBAT level")
+		}
+		generation, err := strconv.Atoi(record[1])
+		if err != nil {
+			return xerrors.Errorf("invalid SBAT level generation for %s: %w", record[0], err)
+		}
+
+		for _, c := range components {
+			if c.Name == record[0] && c.Generation < generation {
+				return fmt.Errorf("SBAT component %s with generation %d is revoked by the minimum generation of %d", c.Name, c.Generation, generation)
+			}
+		}
+	}
+
+	return nil
+}
+
 // shimVersion corresponds to the version of shim.
 type shimVersion struct {
 	Major uint
@@ -58,6 +58,10 @@ const (
 type shimContext struct {
 	Flags              shimFlags
 	VendorDb           *secureBootDB
+	MokList            *secureBootDB // MOKs that can authenticate images
+	MokListX           *secureBootDB // MOKs that are revoked
+	ValidationDisabled bool          // MokSBState indicates that shim doesn't verify images
+	SbatLevel          []byte        // the effective SBAT revocation level
 	verificationEvents tpm2.DigestList
 }
 
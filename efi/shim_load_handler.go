@@ -177,10 +177,24 @@ func (h *shimLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
 	ctx.ShimContext().Flags = h.Flags
 	ctx.ShimContext().VendorDb = h.VendorDb
 
-	if !ctx.PCRs().Contains(internal_efi.SecureBootPolicyPCR) {
-		// We're not generating secure boot policy
-		return nil
+	// Read the machine owner keys, which shim uses in addition to the vendor
+	// and platform databases to authenticate images.
+	mokList, err := readShimMokList(ctx.Vars(), shimMokListRTName)
+	if err != nil {
+		return xerrors.Errorf("cannot read MokList: %w", err)
+	}
+	ctx.ShimContext().MokList = mokList
+	mokListX, err := readShimMokList(ctx.Vars(), shimMokListXRTName)
+	if err != nil {
+		return xerrors.Errorf("cannot read MokListX: %w", err)
+	}
+	ctx.ShimContext().MokListX = mokListX
+	validationDisabled, err := readShimValidationDisabled(ctx.Vars())
+	if err != nil {
+		return xerrors.Errorf("cannot read MokSBState: %w", err)
 	}
+	ctx.ShimContext().ValidationDisabled = validationDisabled
+
 	if h.Flags&shimHasSbatVerification == 0 {
 		// This shim doesn't support SBAT verification
 		return nil
@@ -196,7 +210,6 @@ func (h *shimLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
 	// Read the policy first.
 	policy := shimSbatPolicyLatest
 	if h.Flags&shimHasSbatRevocationManagement != 0 {
-		var err error
 		policy, err = readShimSbatPolicy(ctx.Vars())
 		switch {
 		case err != nil:
@@ -204,16 +217,6 @@ func (h *shimLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
 		case policy == shimSbatPolicyReset:
 			return errors.New("cannot handle SbatPolicy == reset")
 		}
-
-		// shim resets this back to previous for the next boot.
-		if policy == shimSbatPolicyLatest {
-			if err := ctx.Vars().WriteVar(
-				shimSbatPolicyName, shimGuid,
-				efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess,
-				[]byte{uint8(shimSbatPolicyPrevious)}); err != nil {
-				return xerrors.Errorf("cannot clear SbatPolicy: %w", err)
-			}
-		}
 	}
 	// Determine the SBAT level that will be measured by shim
 	var sbatLevel []byte
@@ -234,6 +237,24 @@ func (h *shimLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
 		}
 	}
 
+	// This is the level that shim uses to check subsequent images.
+	ctx.ShimContext().SbatLevel = sbatLevel
+
+	if !ctx.PCRs().Contains(internal_efi.SecureBootPolicyPCR) {
+		// We're not generating secure boot policy
+		return nil
+	}
+
+	// shim resets this back to previous for the next boot.
+	if h.Flags&shimHasSbatRevocationManagement != 0 && policy == shimSbatPolicyLatest {
+		if err := ctx.Vars().WriteVar(
+			shimSbatPolicyName, shimGuid,
+			efi.AttributeNonVolatile|efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess,
+			[]byte{uint8(shimSbatPolicyPrevious)}); err != nil {
+			return xerrors.Errorf("cannot clear SbatPolicy: %w", err)
+		}
+	}
+
 	// Measure SbatLevel
 	ctx.MeasureVariable(internal_efi.SecureBootPolicyPCR, shimGuid, shimSbatLevelName, sbatLevel)
 
@@ -250,9 +271,14 @@ func (h *shimLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
 	return nil
 }
 
+// CheckImageLoadNotRevoked implements imageLoadRevocationChecker.CheckImageLoadNotRevoked.
+func (h *shimLoadHandler) CheckImageLoadNotRevoked(ctx pcrBranchContext, image peImageHandle) error {
+	return newShimImageLoadMeasurer(ctx, image, false).checkNotRevoked()
+}
+
 // MeasureImageLoad implements imageLoadHandler.MeasureImageLoad.
 func (h *shimLoadHandler) MeasureImageLoad(ctx pcrBranchContext, image peImageHandle) (imageLoadHandler, error) {
-	m := newShimImageLoadMeasurer(ctx, image)
+	m := newShimImageLoadMeasurer(ctx, image, false)
 	if err := m.measure(); err != nil {
 		return nil, xerrors.Errorf("cannot measure image: %w", err)
 	}
@@ -263,12 +289,17 @@ type shimImageLoadMeasurer struct {
 	secureBootPolicyMixin
 	pcrBranchContext
 	image peImageHandle
+
+	// inProtocol indicates that the image is verified by another loader
+	// using shim's protocol rather than loaded directly by shim.
+	inProtocol bool
 }
 
-func newShimImageLoadMeasurer(bc pcrBranchContext, image peImageHandle) *shimImageLoadMeasurer {
+func newShimImageLoadMeasurer(bc pcrBranchContext, image peImageHandle, inProtocol bool) *shimImageLoadMeasurer {
 	return &shimImageLoadMeasurer{
 		pcrBranchContext: bc,
-		image:            image}
+		image:            image,
+		inProtocol:       inProtocol}
 }
 
 func (m *shimImageLoadMeasurer) measurePEImageDigest() error {
@@ -283,7 +314,7 @@ func (m *shimImageLoadMeasurer) measurePEImageDigest() error {
 func (m *shimImageLoadMeasurer) measureVerification() error {
 	sc := m.ShimContext()
 
-	authority, err := m.DetermineAuthority([]*secureBootDB{sc.VendorDb, m.FwContext().Db}, m.image)
+	authority, err := m.DetermineAuthority(shimAuthorityDBs(sc.VendorDb, m.FwContext().Db, sc.MokList), m.image)
 	if err != nil {
 		return err
 	}
@@ -323,8 +354,63 @@ func (m *shimImageLoadMeasurer) measureVerification() error {
 	return nil
 }
 
+func (m *shimImageLoadMeasurer) checkRevocationPolicy() error {
+	// Shim refuses to load images that are revoked by dbx or MokListX.
+	if err := m.CheckNotRevoked([]*secureBootDB{m.FwContext().Dbx, m.ShimContext().MokListX}, m.image); err != nil {
+		return err
+	}
+
+	// Shim with SBAT support refuses to load images with components that
+	// are revoked by the current SBAT level. The .sbat section is mandatory
+	// for images that shim loads directly, but it is optional for images
+	// that are verified by another loader using shim's protocol.
+	sc := m.ShimContext()
+	if sc.Flags&shimHasSbatVerification == 0 {
+		return nil
+	}
+	if !m.image.HasSbatSection() {
+		if m.inProtocol {
+			return nil
+		}
+		return errors.New("image has no .sbat section")
+	}
+	if len(sc.SbatLevel) == 0 {
+		return nil
+	}
+	components, err := m.image.SbatComponents()
+	if err != nil {
+		return xerrors.Errorf("cannot obtain SBAT components: %w", err)
+	}
+	return checkSbatLevel(sc.SbatLevel, components)
+}
+
+// validationEnabled indicates whether shim verifies the image. When secure
+// boot is disabled or the user has disabled validation, shim loads images
+// without verifying them, so it doesn't check revocation or measure any
+// verification events.
+func (m *shimImageLoadMeasurer) validationEnabled() bool {
+	return !m.FwContext().SecureBootDisabled && !m.ShimContext().ValidationDisabled
+}
+
+// checkNotRevoked returns a *RevokedImageError if shim would refuse to load
+// the image because it is revoked.
+func (m *shimImageLoadMeasurer) checkNotRevoked() error {
+	if !m.validationEnabled() {
+		return nil
+	}
+	if err := m.checkRevocationPolicy(); err != nil {
+		return &RevokedImageError{Image: m.image.Source(), err: err}
+	}
+	return nil
+}
+
+// measure measures the verification and loading of the image. This doesn't
+// check whether the image is revoked, which is done once per image by the caller
+// with checkNotRevoked.
 func (m *shimImageLoadMeasurer) measure() error {
-	if m.PCRs().Contains(internal_efi.SecureBootPolicyPCR) {
+	validate := m.validationEnabled()
+
+	if validate && m.PCRs().Contains(internal_efi.SecureBootPolicyPCR) {
 		if err := m.measureVerification(); err != nil {
 			return xerrors.Errorf("cannot measure secure boot event: %w", err)
 		}
@@ -338,3 +424,24 @@ func (m *shimImageLoadMeasurer) measure() error {
 
 	return nil
 }
+
+// checkImageLoadUsingShimIfLoadedNotRevoked returns a *RevokedImageError if the
+// supplied image would be refused by a loader that uses shim's protocol if shim
+// was loaded earlier in the current branch, or by the firmware's LoadImage
+// otherwise, because it is revoked.
+func checkImageLoadUsingShimIfLoadedNotRevoked(ctx pcrBranchContext, image peImageHandle) error {
+	if ctx.ShimContext().VendorDb != nil {
+		return newShimImageLoadMeasurer(ctx, image, true).checkNotRevoked()
+	}
+	return newFwImageLoadMeasurer(ctx, image).checkNotRevoked()
+}
+
+// measureImageLoadUsingShimIfLoaded measures the verification and loading of the
+// supplied image by a loader that uses shim's protocol if shim was loaded earlier
+// in the current branch, and the firmware's LoadImage otherwise.
+func measureImageLoadUsingShimIfLoaded(ctx pcrBranchContext, image peImageHandle) error {
+	if ctx.ShimContext().VendorDb != nil {
+		return newShimImageLoadMeasurer(ctx, image, true).measure()
+	}
+	return newFwImageLoadMeasurer(ctx, image).measure()
+}
@@ -20,7 +20,9 @@
 package efi_test
 
 import (
+	"crypto"
 	"crypto/x509"
+	"errors"
 
 	efi "github.com/canonical/go-efilib"
 	"github.com/canonical/go-tpm2"
@@ -429,7 +431,7 @@ func (s *shimLoadHandlerSuite) TestMeasureImageStartSecureBootPolicyProfile15_2T
 }
 
 func (s *shimLoadHandlerSuite) TestMeasureImageStartBootManagerCodeProfile(c *C) {
-	_, collector := s.testMeasureImageStart(c, &testShimMeasureImageStartData{
+	ctx, collector := s.testMeasureImageStart(c, &testShimMeasureImageStartData{
 		alg:       tpm2.HashAlgorithmSHA256,
 		pcrs:      MakePcrFlags(internal_efi.BootManagerCodePCR),
 		vars:      makeMockVars(c, withMsSecureBootConfig()),
@@ -440,15 +442,41 @@ func (s *shimLoadHandlerSuite) TestMeasureImageStartBootManagerCodeProfile(c *C)
 		},
 		sbatLevel: ShimSbatLevel{[]byte("sbat,1,2022052400\ngrub,2\n"), []byte("sbat,1,2021030218\n")},
 	})
+	// The SBAT level is still needed to check that images aren't revoked.
+	c.Check(ctx.ShimContext().SbatLevel, DeepEquals, []byte("sbat,1,2021030218\n"))
 	c.Check(collector.More(), testutil.IsFalse)
 }
 
+func (s *shimLoadHandlerSuite) TestMeasureImageStartMokState(c *C) {
+	mokList := efi.SignatureDatabase{efitest.NewSignatureListX509(c, testUefiCACert1, testOwnerGuid)}
+	mokListX := efi.SignatureDatabase{efitest.NewSignatureListX509(c, testUefiCACert2, testOwnerGuid)}
+
+	ctx, _ := s.testMeasureImageStart(c, &testShimMeasureImageStartData{
+		alg:       tpm2.HashAlgorithmSHA256,
+		pcrs:      MakePcrFlags(internal_efi.BootManagerCodePCR),
+		vars:      makeMockVars(c, withMsSecureBootConfig(), withMokList(mokList), withMokListX(mokListX), withMokSBState(1)),
+		shimFlags: ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimHasSbatRevocationManagement,
+		vendorDb: &SecureBootDB{
+			Name:     efi.VariableDescriptor{Name: "Shim", GUID: ShimGuid},
+			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, efi.GUID{})},
+		},
+		sbatLevel: ShimSbatLevel{[]byte("sbat,1,2022052400\ngrub,2\n"), []byte("sbat,1,2021030218\n")},
+	})
+	c.Check(ctx.ShimContext().MokList.Name, Equals, efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid})
+	c.Check(efitest.MakeVarPayload(c, ctx.ShimContext().MokList.Contents), DeepEquals, efitest.MakeVarPayload(c, mokList))
+	c.Check(ctx.ShimContext().MokListX.Name, Equals, efi.VariableDescriptor{Name: "MokListXRT", GUID: ShimGuid})
+	c.Check(efitest.MakeVarPayload(c, ctx.ShimContext().MokListX.Contents), DeepEquals, efitest.MakeVarPayload(c, mokListX))
+	c.Check(ctx.ShimContext().ValidationDisabled, testutil.IsTrue)
+}
+
 type testShimMeasureImageLoadData struct {
 	alg                tpm2.HashAlgorithmId
 	pcrs               PcrFlags
 	db                 efi.SignatureDatabase
 	shimFlags          ShimFlags
 	vendorDb           *SecureBootDB
+	mokList            *SecureBootDB
+	validationDisabled bool
 	image              *mockImage
 	expectedEvents     []*mockPcrBranchEvent
 	verificationDigest tpm2.Digest
@@ -466,6 +494,8 @@ func (s *shimLoadHandlerSuite) testMeasureImageLoad(c *C, data *testShimMeasureI
 	}
 	ctx.ShimContext().Flags = data.shimFlags
 	ctx.ShimContext().VendorDb = data.vendorDb
+	ctx.ShimContext().MokList = data.mokList
+	ctx.ShimContext().ValidationDisabled = data.validationDisabled
 
 	s.mockImageLoadHandlerMap[data.image] = newMockLoadHandler()
 
@@ -494,7 +524,36 @@ func (s *shimLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfile15_7(c
 			Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
 			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
 		},
-		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)),
+		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
+			withSbat([]SbatComponent{{Name: "sbat", Generation: 1}}),
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: verificationDigest},
+		},
+		verificationDigest: verificationDigest,
+	})
+}
+
+func (s *shimLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfileDigestInVendorDb(c *C) {
+	digest := testutil.DecodeHexString(c, "a6bb8e6b0c6a0a5a2b9bfa2cf3a0bdfd6bd0c7bcbb8cb34b9b4f1a1c2b3c4d5e")
+	verificationDigest := testutil.DecodeHexString(c, "44cfba738e5e9b3f30dd2f65a6513841d2d06fdbd335061726d9219d31510207")
+
+	s.testMeasureImageLoad(c, &testShimMeasureImageLoadData{
+		alg:       tpm2.HashAlgorithmSHA256,
+		pcrs:      MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		db:        msDb(c),
+		shimFlags: ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement,
+		vendorDb: &SecureBootDB{
+			Name: efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+			Contents: efi.SignatureDatabase{
+				efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid),
+				{
+					Type:       efi.CertSHA256Guid,
+					Signatures: []*efi.SignatureData{{Owner: testOwnerGuid, Data: digest}},
+				},
+			},
+		},
+		image: newMockImage().withDigest(crypto.SHA256, digest).
+			withSbat([]SbatComponent{{Name: "sbat", Generation: 1}}),
 		expectedEvents: []*mockPcrBranchEvent{
 			{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: verificationDigest},
 		},
@@ -514,7 +573,8 @@ func (s *shimLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfile15_6(c
 			Name:     efi.VariableDescriptor{Name: "Shim", GUID: ShimGuid},
 			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, efi.GUID{})},
 		},
-		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)),
+		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
+			withSbat([]SbatComponent{{Name: "sbat", Generation: 1}}),
 		expectedEvents: []*mockPcrBranchEvent{
 			{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: verificationDigest},
 		},
@@ -534,7 +594,8 @@ func (s *shimLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfileVendor
 			Name:     efi.VariableDescriptor{Name: "Shim", GUID: ShimGuid},
 			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, testOwnerGuid)},
 		},
-		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)),
+		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
+			withSbat([]SbatComponent{{Name: "sbat", Generation: 1}}),
 		expectedEvents: []*mockPcrBranchEvent{
 			{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: verificationDigest},
 		},
@@ -554,7 +615,8 @@ func (s *shimLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfileVerify
 			Name:     efi.VariableDescriptor{Name: "Shim", GUID: ShimGuid},
 			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, efi.GUID{})},
 		},
-		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4)),
+		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, shimUbuntuSig4)).
+			withSbat([]SbatComponent{{Name: "sbat", Generation: 1}}),
 		expectedEvents: []*mockPcrBranchEvent{
 			{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: verificationDigest},
 		},
@@ -581,6 +643,53 @@ func (s *shimLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfileVerify
 	})
 }
 
+func (s *shimLoadHandlerSuite) TestMeasureImageLoadSecureBootPolicyProfileMokList(c *C) {
+	// Test that an image signed by a machine owner key is measured with
+	// the MokListRT authority.
+	verificationDigest := testutil.DecodeHexString(c, "68bdff38e48c399326ca7356eb992693d13301f3925caf10e7b39dc9240789cd")
+
+	s.testMeasureImageLoad(c, &testShimMeasureImageLoadData{
+		alg:       tpm2.HashAlgorithmSHA256,
+		pcrs:      MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		db:        msDb(c),
+		shimFlags: ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimHasSbatRevocationManagement,
+		vendorDb: &SecureBootDB{
+			Name:     efi.VariableDescriptor{Name: "Shim", GUID: ShimGuid},
+			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, testUefiCACert1, efi.GUID{})},
+		},
+		mokList: &SecureBootDB{
+			Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+		},
+		image: newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, kernelUbuntuSig3)).
+			withSbat([]SbatComponent{{Name: "sbat", Generation: 1}}),
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 7, eventType: mockPcrBranchExtendEvent, digest: verificationDigest},
+		},
+		verificationDigest: verificationDigest,
+	})
+}
+
+func (s *shimLoadHandlerSuite) TestMeasureImageLoadValidationDisabled(c *C) {
+	// Test that no verification event is measured if the user has
+	// disabled shim's validation.
+	s.testMeasureImageLoad(c, &testShimMeasureImageLoadData{
+		alg:       tpm2.HashAlgorithmSHA256,
+		pcrs:      MakePcrFlags(internal_efi.SecureBootPolicyPCR, internal_efi.BootManagerCodePCR),
+		db:        msDb(c),
+		shimFlags: ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimHasSbatRevocationManagement,
+		vendorDb: &SecureBootDB{
+			Name:     efi.VariableDescriptor{Name: "Shim", GUID: ShimGuid},
+			Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, testUefiCACert1, efi.GUID{})},
+		},
+		validationDisabled: true,
+		image:              newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)),
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 4, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "3709c5a882490fa5b9b7a471f3466341da4267060419491954324d3bfb6aa0c6")},
+		},
+	})
+}
+
 func (s *shimLoadHandlerSuite) TestMeasureImageLoadBootManagerCodeProfile1(c *C) {
 	s.testMeasureImageLoad(c, &testShimMeasureImageLoadData{
 		alg:   tpm2.HashAlgorithmSHA256,
@@ -602,3 +711,172 @@ func (s *shimLoadHandlerSuite) TestMeasureImageLoadBootManagerCodeProfile2(c *C)
 		},
 	})
 }
+
+func (s *shimLoadHandlerSuite) TestCheckImageLoadNotRevokedBySbat(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{Name: Db, Contents: msDb(c)}
+	ctx.ShimContext().Flags = ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement
+	ctx.ShimContext().VendorDb = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+	}
+	ctx.ShimContext().SbatLevel = []byte("sbat,1,2022052400\ngrub,2\n")
+
+	image := newMockImage().
+		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
+		withSbat([]SbatComponent{
+			{Name: "sbat", Generation: 1},
+			{Name: "grub", Generation: 1},
+			{Name: "grub.ubuntu", Generation: 1},
+		})
+
+	handler := &ShimLoadHandler{
+		Flags:    ctx.ShimContext().Flags,
+		VendorDb: ctx.ShimContext().VendorDb,
+	}
+	err := handler.CheckImageLoadNotRevoked(ctx, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `image .* is revoked: SBAT component grub with generation 1 is revoked by the minimum generation of 2`)
+
+	var e *RevokedImageError
+	c.Assert(errors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Image, Equals, image)
+	c.Check(ctx.events, HasLen, 0)
+}
+
+func (s *shimLoadHandlerSuite) TestCheckImageLoadNotRevokedNoSbatSection(c *C) {
+	// Shim with SBAT verification refuses to load images without a .sbat
+	// section.
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{Name: Db, Contents: msDb(c)}
+	ctx.ShimContext().Flags = ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement
+	ctx.ShimContext().VendorDb = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3))
+
+	handler := &ShimLoadHandler{
+		Flags:    ctx.ShimContext().Flags,
+		VendorDb: ctx.ShimContext().VendorDb,
+	}
+	err := handler.CheckImageLoadNotRevoked(ctx, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `image .* is revoked: image has no .sbat section`)
+
+	var e *RevokedImageError
+	c.Assert(errors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Image, Equals, image)
+	c.Check(ctx.events, HasLen, 0)
+}
+
+func (s *shimLoadHandlerSuite) TestMeasureImageLoadRevokedBySbatSecureBootDisabled(c *C) {
+	// Shim doesn't verify images when secure boot is disabled.
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.BootManagerCodePCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().SecureBootDisabled = true
+	ctx.ShimContext().Flags = ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement
+	ctx.ShimContext().VendorDb = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+	}
+	ctx.ShimContext().SbatLevel = []byte("sbat,1,2022052400\ngrub,2\n")
+
+	image := newMockImage().
+		appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)).
+		withSbat([]SbatComponent{
+			{Name: "sbat", Generation: 1},
+			{Name: "grub", Generation: 1},
+			{Name: "grub.ubuntu", Generation: 1},
+		})
+	s.mockImageLoadHandlerMap[image] = newMockLoadHandler()
+
+	handler := &ShimLoadHandler{
+		Flags:    ctx.ShimContext().Flags,
+		VendorDb: ctx.ShimContext().VendorDb,
+	}
+	c.Check(handler.CheckImageLoadNotRevoked(ctx, image.newPeImageHandle()), IsNil)
+	_, err := handler.MeasureImageLoad(ctx, image.newPeImageHandle())
+	c.Check(err, IsNil)
+	c.Check(ctx.events, HasLen, 1)
+}
+
+func (s *shimLoadHandlerSuite) TestCheckImageLoadNotRevokedByDbx(c *C) {
+	sig := efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{Name: Db, Contents: msDb(c)}
+	ctx.FwContext().Dbx = &SecureBootDB{
+		Name: Dbx,
+		Contents: efi.SignatureDatabase{
+			{
+				Type:       efi.CertSHA256Guid,
+				Signatures: []*efi.SignatureData{{Owner: testOwnerGuid, Data: sig.Digest()}},
+			},
+		},
+	}
+	ctx.ShimContext().Flags = ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement
+	ctx.ShimContext().VendorDb = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+	}
+
+	image := newMockImage().appendSignatures(sig)
+
+	handler := &ShimLoadHandler{
+		Flags:    ctx.ShimContext().Flags,
+		VendorDb: ctx.ShimContext().VendorDb,
+	}
+	err := handler.CheckImageLoadNotRevoked(ctx, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `image .* is revoked: image digest is in dbx`)
+
+	var e *RevokedImageError
+	c.Assert(errors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Image, Equals, image)
+}
+
+func (s *shimLoadHandlerSuite) TestCheckImageLoadNotRevokedByMokListX(c *C) {
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{
+		alg:      tpm2.HashAlgorithmSHA256,
+		pcrs:     MakePcrFlags(internal_efi.SecureBootPolicyPCR),
+		handlers: s,
+	}, nil, nil)
+	ctx.FwContext().Db = &SecureBootDB{Name: Db, Contents: msDb(c)}
+	ctx.ShimContext().Flags = ShimHasSbatVerification | ShimFixVariableAuthorityEventsMatchSpec | ShimVendorCertContainsDb | ShimHasSbatRevocationManagement
+	ctx.ShimContext().VendorDb = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)},
+	}
+	ctx.ShimContext().MokListX = &SecureBootDB{
+		Name:     efi.VariableDescriptor{Name: "MokListXRT", GUID: ShimGuid},
+		Contents: efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, testOwnerGuid)},
+	}
+
+	image := newMockImage().appendSignatures(efitest.ReadWinCertificateAuthenticodeDetached(c, grubUbuntuSig3))
+
+	handler := &ShimLoadHandler{
+		Flags:    ctx.ShimContext().Flags,
+		VendorDb: ctx.ShimContext().VendorDb,
+	}
+	err := handler.CheckImageLoadNotRevoked(ctx, image.newPeImageHandle())
+	c.Check(err, ErrorMatches, `image .* is revoked: certificate "CN=Canonical Ltd. Master Certificate Authority,O=Canonical Ltd.,L=Douglas,ST=Isle of Man,C=GB" is in MokListXRT`)
+
+	var e *RevokedImageError
+	c.Assert(errors.As(err, &e), testutil.IsTrue)
+	c.Check(e.Image, Equals, image)
+	c.Check(ctx.events, HasLen, 0)
+}
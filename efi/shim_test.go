@@ -74,6 +74,76 @@ func (s *shimSuite) TestReadShimSbatPolicyInvalid(c *C) {
 	c.Check(err, ErrorMatches, "invalid SbatPolicy value")
 }
 
+func (s *shimSuite) TestReadShimMokList(c *C) {
+	db := efi.SignatureDatabase{efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid)}
+	env := efitest.NewMockHostEnvironment(makeMockVars(c, withMokList(db)), nil)
+
+	mokList, err := ReadShimMokList(newMockVarReader(env), "MokListRT")
+	c.Assert(err, IsNil)
+	c.Check(mokList.Name, Equals, efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid})
+	c.Check(efitest.MakeVarPayload(c, mokList.Contents), DeepEquals, efitest.MakeVarPayload(c, db))
+}
+
+func (s *shimSuite) TestReadShimMokListSplit(c *C) {
+	// Test that a database mirrored across several variables is read correctly.
+	db := efi.SignatureDatabase{
+		efitest.NewSignatureListX509(c, canonicalCACert, ShimGuid),
+		efitest.NewSignatureListX509(c, testUefiCACert1, testOwnerGuid),
+	}
+	vars := makeMockVars(c).
+		AddVar("MokListXRT", ShimGuid, efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, efitest.MakeVarPayload(c, db[:1])).
+		AddVar("MokListXRT1", ShimGuid, efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, efitest.MakeVarPayload(c, db[1:]))
+	env := efitest.NewMockHostEnvironment(vars, nil)
+
+	mokListX, err := ReadShimMokList(newMockVarReader(env), "MokListXRT")
+	c.Assert(err, IsNil)
+	c.Check(mokListX.Name, Equals, efi.VariableDescriptor{Name: "MokListXRT", GUID: ShimGuid})
+	c.Check(efitest.MakeVarPayload(c, mokListX.Contents), DeepEquals, efitest.MakeVarPayload(c, db))
+}
+
+func (s *shimSuite) TestReadShimMokListNotExist(c *C) {
+	env := efitest.NewMockHostEnvironment(nil, nil)
+	mokList, err := ReadShimMokList(newMockVarReader(env), "MokListRT")
+	c.Assert(err, IsNil)
+	c.Check(mokList.Name, Equals, efi.VariableDescriptor{Name: "MokListRT", GUID: ShimGuid})
+	c.Check(mokList.Contents, HasLen, 0)
+}
+
+func (s *shimSuite) TestReadShimMokListInvalid(c *C) {
+	vars := makeMockVars(c).AddVar("MokListRT", ShimGuid, efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, []byte{1, 2, 3})
+	env := efitest.NewMockHostEnvironment(vars, nil)
+	_, err := ReadShimMokList(newMockVarReader(env), "MokListRT")
+	c.Check(err, ErrorMatches, `cannot decode MokListRT: .*`)
+}
+
+func (s *shimSuite) TestReadShimValidationDisabled(c *C) {
+	env := efitest.NewMockHostEnvironment(makeMockVars(c, withMokSBState(1)), nil)
+	disabled, err := ReadShimValidationDisabled(newMockVarReader(env))
+	c.Check(err, IsNil)
+	c.Check(disabled, testutil.IsTrue)
+}
+
+func (s *shimSuite) TestReadShimValidationDisabledEnabled(c *C) {
+	env := efitest.NewMockHostEnvironment(makeMockVars(c, withMokSBState(0)), nil)
+	disabled, err := ReadShimValidationDisabled(newMockVarReader(env))
+	c.Check(err, IsNil)
+	c.Check(disabled, testutil.IsFalse)
+}
+
+func (s *shimSuite) TestReadShimValidationDisabledNotExist(c *C) {
+	env := efitest.NewMockHostEnvironment(nil, nil)
+	disabled, err := ReadShimValidationDisabled(newMockVarReader(env))
+	c.Check(err, IsNil)
+	c.Check(disabled, testutil.IsFalse)
+}
+
+func (s *shimSuite) TestReadShimValidationDisabledInvalidLength(c *C) {
+	vars := makeMockVars(c).AddVar("MokSBStateRT", ShimGuid, efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, []byte{1, 0})
+	env := efitest.NewMockHostEnvironment(vars, nil)
+	_, err := ReadShimValidationDisabled(newMockVarReader(env))
+	c.Check(err, ErrorMatches, `invalid MokSBStateRT length`)
+}
+
 func (s *shimSuite) TestNewestSbatLevel1(c *C) {
 	levels := [][]byte{
 		[]byte("sbat,1,2021030218\n"),
@@ -112,6 +182,33 @@ func (s *shimSuite) TestNewestSbatLevel4(c *C) {
 	c.Check(newest, DeepEquals, levels[1])
 }
 
+func (s *shimSuite) TestCheckSbatLevelGood(c *C) {
+	err := CheckSbatLevel([]byte("sbat,1,2022111500\nshim,2\ngrub,3\n"), []SbatComponent{
+		{Name: "sbat", Generation: 1},
+		{Name: "grub", Generation: 3},
+		{Name: "grub.ubuntu", Generation: 1}})
+	c.Check(err, IsNil)
+}
+
+func (s *shimSuite) TestCheckSbatLevelTrailingNul(c *C) {
+	err := CheckSbatLevel([]byte("sbat,1,2022052400\ngrub,2\n\x00"), []SbatComponent{
+		{Name: "grub", Generation: 2}})
+	c.Check(err, IsNil)
+}
+
+func (s *shimSuite) TestCheckSbatLevelRevoked(c *C) {
+	err := CheckSbatLevel([]byte("sbat,1,2022111500\nshim,2\ngrub,3\n"), []SbatComponent{
+		{Name: "sbat", Generation: 1},
+		{Name: "grub", Generation: 2},
+		{Name: "grub.ubuntu", Generation: 1}})
+	c.Check(err, ErrorMatches, `SBAT component grub with generation 2 is revoked by the minimum generation of 3`)
+}
+
+func (s *shimSuite) TestCheckSbatLevelInvalid(c *C) {
+	err := CheckSbatLevel([]byte("sbat,1,2022111500\ngrub\n"), nil)
+	c.Check(err, ErrorMatches, `invalid SBAT level`)
+}
+
 func (s *shimSuite) TestParseShimVersion15_6(c *C) {
 	version, err := ParseShimVersion("15.6")
 	c.Check(err, IsNil)
@@ -0,0 +1,178 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+
+	"golang.org/x/xerrors"
+
+	internal_efi "github.com/snapcore/secboot/internal/efi"
+	secboot_tpm2 "github.com/snapcore/secboot/tpm2"
+)
+
+const (
+	systemdPCRSigSection  = ".pcrsig"  // the section containing signed PCR policies in a UKI
+	systemdPCRPKeySection = ".pcrpkey" // the section containing the PCR policy signing key in a UKI
+)
+
+type systemdPCRPolicyKeyOption struct {
+	key crypto.PublicKey
+}
+
+func (o *systemdPCRPolicyKeyOption) ApplyOptionTo(visitor internal_efi.PCRProfileOptionVisitor) error {
+	visitor.SetSystemdPCRPolicyKey(o.key)
+	return nil
+}
+
+// WithSystemdPCRPolicyKey indicates that the key for which a profile is generated is
+// bound to PCR policies signed by systemd-measure with the supplied key (see
+// secboot_tpm2.ProtectKeyParams.SystemdPCRPolicyKey). When this is supplied, every UKI
+// in the supplied load sequences must contain the same key in its .pcrpkey section and
+// at least one valid PCR policy signed by it for the SHA-256 PCR bank in its .pcrsig
+// section, else an error will be returned. This doesn't add any PCRs to the profile -
+// PCR 11 is covered by the signed PCR policies.
+func WithSystemdPCRPolicyKey(key crypto.PublicKey) PCRProfileOption {
+	return &systemdPCRPolicyKeyOption{key: key}
+}
+
+func readSystemdPCRPolicyKeyFromSection(r io.Reader) (crypto.PublicKey, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(bytes.TrimRight(data, "\x00"))
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
+
+// ReadSystemdPCRPolicyKey returns the key that is used to sign the PCR policies
+// embedded in the supplied UKI, from its .pcrpkey section. This can be supplied to
+// secboot_tpm2.ProtectKeyParams.SystemdPCRPolicyKey.
+func ReadSystemdPCRPolicyKey(image Image) (crypto.PublicKey, error) {
+	pe, err := openPeImage(image)
+	if err != nil {
+		return nil, err
+	}
+	defer pe.Close()
+
+	r := pe.OpenSection(systemdPCRPKeySection)
+	if r == nil {
+		return nil, errors.New("no .pcrpkey section")
+	}
+	key, err := readSystemdPCRPolicyKeyFromSection(r)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot decode key: %w", err)
+	}
+	return key, nil
+}
+
+// systemdPCRPolicyLoadHandler wraps the imageLoadHandler for a UKI that may contain
+// PCR policies signed by systemd-measure in its .pcrsig section and the public key
+// for these in its .pcrpkey section. These are used by the TPM key data policy for
+// keys that are bound to signed PCR policies, and this handler checks that they are
+// present and valid for the key supplied with WithSystemdPCRPolicyKey. The sections
+// are only decoded when this option is supplied, so that profile generation for
+// other keys doesn't depend on their contents.
+type systemdPCRPolicyLoadHandler struct {
+	imageLoadHandler
+	pkeyData []byte // the contents of the .pcrpkey section, or nil
+	sigData  []byte // the contents of the .pcrsig section, or nil
+}
+
+// withSystemdPCRPolicy returns a newImageLoadHandlerFn that wraps the handler returned
+// from the supplied function with a systemdPCRPolicyLoadHandler.
+func withSystemdPCRPolicy(fn newImageLoadHandlerFn) newImageLoadHandlerFn {
+	return func(image peImageHandle) (imageLoadHandler, error) {
+		handler, err := fn(image)
+		if err != nil {
+			return nil, err
+		}
+
+		out := &systemdPCRPolicyLoadHandler{imageLoadHandler: handler}
+
+		if r := image.OpenSection(systemdPCRPKeySection); r != nil {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot read PCR policy key: %w", err)
+			}
+			out.pkeyData = data
+		}
+
+		if r := image.OpenSection(systemdPCRSigSection); r != nil {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot read signed PCR policies: %w", err)
+			}
+			out.sigData = data
+		}
+
+		return out, nil
+	}
+}
+
+func (h *systemdPCRPolicyLoadHandler) checkSystemdPCRPolicy(key crypto.PublicKey) error {
+	if h.pkeyData == nil {
+		return errors.New("UKI has no PCR policy key")
+	}
+	ukiKey, err := readSystemdPCRPolicyKeyFromSection(bytes.NewReader(h.pkeyData))
+	if err != nil {
+		return xerrors.Errorf("cannot decode PCR policy key: %w", err)
+	}
+	if !publicKeysEqual(ukiKey, key) {
+		return errors.New("UKI has an unexpected PCR policy key")
+	}
+
+	if h.sigData == nil {
+		return errors.New("UKI has no signed PCR policies")
+	}
+	sigs, err := secboot_tpm2.ReadSystemdPCRSignatures(h.sigData)
+	if err != nil {
+		return xerrors.Errorf("cannot decode signed PCR policies: %w", err)
+	}
+	if err := sigs.Verify(key); err != nil {
+		return xerrors.Errorf("cannot verify signed PCR policies in UKI: %w", err)
+	}
+
+	return nil
+}
+
+// MeasureImageStart implements imageLoadHandler.MeasureImageStart.
+func (h *systemdPCRPolicyLoadHandler) MeasureImageStart(ctx pcrBranchContext) error {
+	if key := ctx.SystemdPCRPolicyKey(); key != nil {
+		if err := h.checkSystemdPCRPolicy(key); err != nil {
+			return err
+		}
+	}
+
+	return h.imageLoadHandler.MeasureImageStart(ctx)
+}
@@ -0,0 +1,232 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package efi_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/util"
+	"github.com/canonical/tcglog-parser"
+	. "gopkg.in/check.v1"
+
+	. "github.com/snapcore/secboot/efi"
+	"github.com/snapcore/secboot/internal/testutil"
+	secboot_tpm2 "github.com/snapcore/secboot/tpm2"
+)
+
+type systemdPCRPolicySuite struct {
+	mockImageHandleMixin
+	key crypto.Signer
+}
+
+func (s *systemdPCRPolicySuite) SetUpSuite(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	s.key = key
+}
+
+var _ = Suite(&systemdPCRPolicySuite{})
+
+func (s *systemdPCRPolicySuite) pcrpkey(c *C, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	c.Assert(err, IsNil)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func (s *systemdPCRPolicySuite) pcrsig(c *C, key crypto.Signer) []byte {
+	selection := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{11}}}
+	pcrDigest, err := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, selection, tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {11: make(tpm2.Digest, 32)}})
+	c.Assert(err, IsNil)
+
+	trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+	trial.PolicyPCR(pcrDigest, selection)
+	pol := trial.GetDigest()
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	c.Assert(err, IsNil)
+	fp := sha256.Sum256(der)
+
+	digest := sha256.Sum256(pol)
+	sig, err := key.Sign(testutil.RandReader, digest[:], crypto.SHA256)
+	c.Assert(err, IsNil)
+
+	data, err := json.Marshal(secboot_tpm2.SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {{PCRs: []int{11}, PublicKeyFingerprint: fp[:], PolicyDigest: pol, Signature: sig}},
+	})
+	c.Assert(err, IsNil)
+	return data
+}
+
+func (s *systemdPCRPolicySuite) newHandler(c *C, image *mockImage) ImageLoadHandler {
+	handler, err := WithSystemdPCRPolicy(NewNullLoadHandler)(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+	c.Assert(handler, testutil.ConvertibleTo, &SystemdPCRPolicyLoadHandler{})
+	return handler
+}
+
+func (s *systemdPCRPolicySuite) TestWithSystemdPCRPolicyKey(c *C) {
+	visitor := new(mockPcrProfileOptionVisitor)
+	c.Check(WithSystemdPCRPolicyKey(s.key.Public()).ApplyOptionTo(visitor), IsNil)
+	c.Check(visitor.systemdPCRPolicyKey, DeepEquals, s.key.Public())
+}
+
+func (s *systemdPCRPolicySuite) TestReadSystemdPCRPolicyKey(c *C) {
+	image := newMockImage().addSection(".pcrpkey", s.pcrpkey(c, s.key.Public()))
+	key, err := ReadSystemdPCRPolicyKey(image)
+	c.Assert(err, IsNil)
+	c.Check(key, DeepEquals, s.key.Public())
+}
+
+func (s *systemdPCRPolicySuite) TestReadSystemdPCRPolicyKeyNoSection(c *C) {
+	_, err := ReadSystemdPCRPolicyKey(newMockImage())
+	c.Check(err, ErrorMatches, `no .pcrpkey section`)
+}
+
+func (s *systemdPCRPolicySuite) TestReadSystemdPCRPolicyKeyInvalid(c *C) {
+	_, err := ReadSystemdPCRPolicyKey(newMockImage().addSection(".pcrpkey", []byte("foo")))
+	c.Check(err, ErrorMatches, `cannot decode key: no PEM block`)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStart(c *C) {
+	image := newMockImage().
+		addSection(".pcrpkey", s.pcrpkey(c, s.key.Public())).
+		addSection(".pcrsig", s.pcrsig(c, s.key))
+	handler := s.newHandler(c, image)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, systemdPCRPolicyKey: s.key.Public()}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, HasLen, 0)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartNoKeyOption(c *C) {
+	// Verify that the sections aren't checked without WithSystemdPCRPolicyKey.
+	handler := s.newHandler(c, newMockImage())
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartNoPCRPKey(c *C) {
+	handler := s.newHandler(c, newMockImage().addSection(".pcrsig", s.pcrsig(c, s.key)))
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, systemdPCRPolicyKey: s.key.Public()}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `UKI has no PCR policy key`)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartUnexpectedKey(c *C) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	image := newMockImage().
+		addSection(".pcrpkey", s.pcrpkey(c, otherKey.Public())).
+		addSection(".pcrsig", s.pcrsig(c, otherKey))
+	handler := s.newHandler(c, image)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, systemdPCRPolicyKey: s.key.Public()}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `UKI has an unexpected PCR policy key`)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartNoPCRSig(c *C) {
+	handler := s.newHandler(c, newMockImage().addSection(".pcrpkey", s.pcrpkey(c, s.key.Public())))
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, systemdPCRPolicyKey: s.key.Public()}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `UKI has no signed PCR policies`)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartInvalidSignature(c *C) {
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	image := newMockImage().
+		addSection(".pcrpkey", s.pcrpkey(c, s.key.Public())).
+		addSection(".pcrsig", s.pcrsig(c, otherKey))
+	handler := s.newHandler(c, image)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, systemdPCRPolicyKey: s.key.Public()}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `cannot verify signed PCR policies in UKI: no signed PCR policies for the supplied key`)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartInvalidPCRPKey(c *C) {
+	image := newMockImage().
+		addSection(".pcrpkey", []byte("foo")).
+		addSection(".pcrsig", s.pcrsig(c, s.key))
+	handler := s.newHandler(c, image)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, systemdPCRPolicyKey: s.key.Public()}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `cannot decode PCR policy key: no PEM block`)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartInvalidPCRSig(c *C) {
+	image := newMockImage().
+		addSection(".pcrpkey", s.pcrpkey(c, s.key.Public())).
+		addSection(".pcrsig", []byte("foo"))
+	handler := s.newHandler(c, image)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, systemdPCRPolicyKey: s.key.Public()}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), ErrorMatches, `cannot decode signed PCR policies: .*`)
+}
+
+func (s *systemdPCRPolicySuite) TestMeasureImageStartInvalidSectionsNoKeyOption(c *C) {
+	// Verify that malformed sections don't cause a failure without
+	// WithSystemdPCRPolicyKey.
+	image := newMockImage().
+		addSection(".pcrpkey", []byte("foo")).
+		addSection(".pcrsig", []byte("foo"))
+	handler := s.newHandler(c, image)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256}, nil, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+}
+
+func (s *systemdPCRPolicySuite) TestSystemdStubUKIMeasureImageStart(c *C) {
+	image := newMockImage().addSection(".linux", nil)
+	handler, err := NewSystemdStubUKILoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, pcrs: MakePcrFlags(KernelConfigPCR)}, &LoadParams{KernelCommandline: "console=ttyS0 console=tty1 panic=-1"}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, DeepEquals, []*mockPcrBranchEvent{
+		{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: tpm2.Digest(tcglog.ComputeSystemdEFIStubCommandlineDigest(crypto.SHA256, "console=ttyS0 console=tty1 panic=-1"))},
+	})
+}
+
+func (s *systemdPCRPolicySuite) TestSystemdStubUKIMeasureImageStartEmbeddedCommandline(c *C) {
+	image := newMockImage().addSection(".linux", nil).addSection(".cmdline", []byte("foo"))
+	handler, err := NewSystemdStubUKILoadHandler(image.newPeImageHandle())
+	c.Assert(err, IsNil)
+
+	ctx := newMockPcrBranchContext(&mockPcrProfileContext{alg: tpm2.HashAlgorithmSHA256, pcrs: MakePcrFlags(KernelConfigPCR)}, &LoadParams{KernelCommandline: "console=ttyS0 console=tty1 panic=-1"}, nil)
+	c.Check(handler.MeasureImageStart(ctx), IsNil)
+	c.Check(ctx.events, HasLen, 0)
+}
+
+func (s *systemdPCRPolicySuite) TestSystemdStubUKIMeasureImageLoad(c *C) {
+	handler, err := NewSystemdStubUKILoadHandler(newMockImage().newPeImageHandle())
+	c.Assert(err, IsNil)
+	_, err = handler.MeasureImageLoad(nil, nil)
+	c.Check(err, ErrorMatches, `kernel is a leaf image`)
+}
@@ -46,12 +46,13 @@ func (h *ubuntuCoreUKILoadHandler) MeasureImageStart(ctx pcrBranchContext) error
 			ctx.ExtendPCR(kernelConfigPCR,
 				tcglog.ComputeSystemdEFIStubCommandlineDigest(ctx.PCRAlg().GetHash(), ctx.Params().KernelCommandline))
 		}
-
-		// TODO: handle credentials, confexts and commandline addons if we need
-		// then in the future. These all go into kernelConfigPCR
 	}
 
-	// TODO: handle sysexts if we need them in the future, which go to the sysext PCR (13).
+	// Addons, credentials and confexts are measured to the kernel config PCR (12)
+	// after the commandline, and sysexts are measured to the sysext PCR (13).
+	if err := measureSystemdStubExtensions(ctx); err != nil {
+		return err
+	}
 
 	if ctx.PCRs().Contains(kernelConfigPCR) {
 		if ctx.Params().SnapModel == nil {
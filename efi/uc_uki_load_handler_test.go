@@ -69,6 +69,30 @@ func (s *ucUkiLoadHandlerSuite) TestMeasureImageStart(c *C) {
 	})
 }
 
+func (s *ucUkiLoadHandlerSuite) TestMeasureImageStartWithCredentials(c *C) {
+	s.testMeasureImageStart(c, &testUCUKIMeasureImageStartParams{
+		alg:  tpm2.HashAlgorithmSHA256,
+		pcrs: MakePcrFlags(KernelConfigPCR),
+		params: LoadParams{
+			KernelCommandline:  "console=ttyS0 console=tty1 panic=-1 systemd.gpt_auto=0 snapd_recovery_mode=run",
+			SystemdCredentials: [][]byte{[]byte("cred1")},
+			SnapModel: testutil.MakeMockCore20ModelAssertion(c, map[string]interface{}{
+				"authority-id": "fake-brand",
+				"series":       "16",
+				"brand-id":     "fake-brand",
+				"model":        "fake-model",
+				"grade":        "secured",
+			}, "Jv8_JiHiIzJVcO9M55pPdqSDWUvuhfDIBJUS-3VW7F_idjix7Ffn5qMxB21ZQuij"),
+		},
+		expectedEvents: []*mockPcrBranchEvent{
+			{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "2dc1d5c9791826cc681892421b14d36e5dd0241de367536f3ba5f7d9caa70e48")},
+			{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "2173a7c424c827f5a60a3e1f6063847206a626ee5d2db848e19af80c49c62b41")},
+			{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "df3f619804a92fdb4057192dc43dd748ea778adc52bc498ce80524c014b81119")},
+			{pcr: 12, eventType: mockPcrBranchExtendEvent, digest: testutil.DecodeHexString(c, "d64df514d7ac57c1a28c5f2a3abc39340d9b7fe3f76cc3acc991d418f095d5b0")},
+		},
+	})
+}
+
 func (s *ucUkiLoadHandlerSuite) TestMeasureImageStartDifferentCommandline(c *C) {
 	s.testMeasureImageStart(c, &testUCUKIMeasureImageStartParams{
 		alg:  tpm2.HashAlgorithmSHA256,
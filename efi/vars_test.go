@@ -136,6 +136,24 @@ func withSbatPolicy(policy ShimSbatPolicy) mockVarsConfig {
 	}
 }
 
+func withMokList(db efi.SignatureDatabase) mockVarsConfig {
+	return func(c *C, vars efitest.MockVars) {
+		vars.AddVar("MokListRT", ShimGuid, efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, efitest.MakeVarPayload(c, db))
+	}
+}
+
+func withMokListX(db efi.SignatureDatabase) mockVarsConfig {
+	return func(c *C, vars efitest.MockVars) {
+		vars.AddVar("MokListXRT", ShimGuid, efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, efitest.MakeVarPayload(c, db))
+	}
+}
+
+func withMokSBState(state uint8) mockVarsConfig {
+	return func(c *C, vars efitest.MockVars) {
+		vars.AddVar("MokSBStateRT", ShimGuid, efi.AttributeBootserviceAccess|efi.AttributeRuntimeAccess, []byte{state})
+	}
+}
+
 func withSecureBootDisabled() mockVarsConfig {
 	return func(c *C, vars efitest.MockVars) {
 		vars.SetSecureBoot(false)
@@ -20,6 +20,8 @@
 package efi
 
 import (
+	"crypto"
+
 	efi "github.com/canonical/go-efilib"
 	"github.com/canonical/go-tpm2"
 )
@@ -36,6 +38,18 @@ type PCRProfileOptionVisitor interface {
 	// AddInitialVariablesModifier adds a function that will be called to allow
 	// the initial variable set for profile generation to be modified.
 	AddInitialVariablesModifier(fn InitialVariablesModifier)
+
+	// SetSystemdPCRPolicyKey sets the key that is expected to have signed
+	// the PCR policies embedded in UKIs.
+	SetSystemdPCRPolicyKey(key crypto.PublicKey)
+
+	// SetPartitionTable sets the partition table of the boot disk, from
+	// which the EV_EFI_GPT_EVENT measurement is computed.
+	SetPartitionTable(table *efi.PartitionTable)
+
+	// SetRevokedImageHandler sets a function that is called for each image
+	// that is omitted from the profile because it is revoked.
+	SetRevokedImageHandler(fn func(err error))
 }
 
 // VariableSet corresponds to a set of EFI variables.
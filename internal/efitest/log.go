@@ -110,6 +110,7 @@ type LogOptions struct {
 	NoCallingEFIApplicationEvent      bool                           // omit the EV_EFI_ACTION "Calling EFI Application from Boot Option" event.
 	IncludeOSPresentFirmwareAppLaunch efi.GUID                       // include a flash based application launch in the log as part of the OS-present phase
 	NoSBAT                            bool                           // omit the SbatLevel measurement to mimic older versions of shim
+	SystemdBootLoaderConf             []byte                         // include a measurement of the supplied loader.conf by systemd-boot
 }
 
 // NewLog creates a mock TCG log for testing. The log will look like a standard
@@ -655,6 +656,16 @@ func NewLog(c *C, opts *LogOptions) *tcglog.Log {
 			data:      data})
 	}
 
+	if opts.SystemdBootLoaderConf != nil {
+		data := &tcglog.TaggedEvent{
+			EventID: 0xf5bc582a,
+			Data:    []byte("l\x00o\x00a\x00d\x00e\x00r\x00.\x00c\x00o\x00n\x00f\x00\x00\x00")}
+		builder.hashLogExtendEvent(c, bytesHashData(opts.SystemdBootLoaderConf), &logEvent{
+			pcrIndex:  5,
+			eventType: tcglog.EventTypeEventTag,
+			data:      data})
+	}
+
 	// Mock EBS
 	for _, action := range []tcglog.StringEventData{tcglog.EFIExitBootServicesInvocationEvent, tcglog.EFIExitBootServicesSucceededEvent} {
 		builder.hashLogExtendEvent(c, action, &logEvent{
@@ -0,0 +1,122 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tcg
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+)
+
+const (
+	// Handle for ECC NIST P256 EK certificate, see section 7.8 of "TCG TPM v2.0 Provisioning Guidance" Version 1.0, Revision 1.0, 15 March 2017.
+	ECCEKCertHandle tpm2.Handle = 0x01c0000a
+)
+
+// ErrNoEKCertificate is returned from ReadEKCertificate if there is no EK
+// certificate for the requested key type.
+var ErrNoEKCertificate = errors.New("no EK certificate")
+
+// ReadEKCertificate reads the EK certificate for the specified key type from
+// the standard NV index. Only RSA and ECC keys are supported. The index is read
+// using its own authorization, which is expected to be empty.
+func ReadEKCertificate(tpm *tpm2.TPMContext, keyType tpm2.ObjectTypeId) (*x509.Certificate, error) {
+	var handle tpm2.Handle
+	switch keyType {
+	case tpm2.ObjectTypeRSA:
+		handle = EKCertHandle
+	case tpm2.ObjectTypeECC:
+		handle = ECCEKCertHandle
+	default:
+		return nil, fmt.Errorf("unsupported key type %v", keyType)
+	}
+
+	index, err := tpm.CreateResourceContextFromTPM(handle)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, handle):
+		return nil, ErrNoEKCertificate
+	case err != nil:
+		return nil, fmt.Errorf("cannot create context for NV index: %w", err)
+	}
+
+	pub, _, err := tpm.NVReadPublic(index)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read public area of NV index: %w", err)
+	}
+
+	data, err := tpm.NVRead(index, index, pub.Size, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read NV index: %w", err)
+	}
+
+	// The certificate may be padded, so don't use x509.ParseCertificate
+	// directly on the contents of the index.
+	certs, err := x509.ParseCertificates(data)
+	switch {
+	case err != nil && len(certs) == 0:
+		return nil, fmt.Errorf("cannot parse certificate: %w", err)
+	case len(certs) == 0:
+		return nil, errors.New("cannot parse certificate: no certificate")
+	}
+	return certs[0], nil
+}
+
+// VerifyEKCertificate verifies that the supplied EK certificate chains to one of
+// the supplied manufacturer roots via the supplied intermediates, and that it
+// certifies the supplied EK public area.
+func VerifyEKCertificate(cert *x509.Certificate, ekPublic *tpm2.Public, roots, intermediates *x509.CertPool) error {
+	if roots == nil {
+		return errors.New("no manufacturer roots supplied")
+	}
+
+	// EK certificates contain a critical subject alternative name extension
+	// with a directoryName which describes the TPM, but this isn't handled by
+	// the x509 package, so remove it from the list of unhandled critical
+	// extensions of a copy of the certificate before verifying it.
+	c := *cert
+	c.UnhandledCriticalExtensions = nil
+	for _, oid := range cert.UnhandledCriticalExtensions {
+		if oid.Equal(OIDExtensionSubjectAltName) {
+			continue
+		}
+		c.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions, oid)
+	}
+
+	if _, err := c.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("cannot verify certificate: %w", err)
+	}
+
+	certKey, ok := cert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return errors.New("unsupported certificate public key type")
+	}
+	if !certKey.Equal(ekPublic.Public()) {
+		return errors.New("certificate does not match the endorsement key")
+	}
+
+	return nil
+}
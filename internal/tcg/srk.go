@@ -0,0 +1,113 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tcg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+)
+
+const (
+	// SRKHandleIndexHandle is the NV index at which we can find the persistent
+	// handle of the storage primary key, if a non-default one is supplied during
+	// provisioning. Unlike a custom template, this can be read without knowledge
+	// of the authorization value for the storage hierarchy because it is required
+	// in order to unseal keys.
+	SRKHandleIndexHandle tpm2.Handle = 0x01810002
+
+	// minSRKHandle and maxSRKHandle define the range of persistent handles reserved
+	// for primary keys in the storage hierarchy, see section 2.3.1 of the "TCG Registry
+	// of Reserved TPM 2.0 Handles and Localities", version 1.1, revision 1.00, 23
+	// October 2017.
+	minSRKHandle tpm2.Handle = 0x81000000
+	maxSRKHandle tpm2.Handle = 0x8100ffff
+)
+
+// IsValidSRKHandle indicates whether the supplied handle can be used for the storage
+// primary key.
+func IsValidSRKHandle(handle tpm2.Handle) bool {
+	return handle >= minSRKHandle && handle <= maxSRKHandle
+}
+
+// MakeSRKHandleIndexPublic returns the public area that the NV index at
+// SRKHandleIndexHandle is defined with. The index is write locked once the
+// handle has been written to it, and the lock persists until the index is
+// undefined.
+func MakeSRKHandleIndexPublic() *tpm2.NVPublic {
+	return &tpm2.NVPublic{
+		Index:   SRKHandleIndexHandle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVWriteDefine | tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA),
+		Size:    uint16(binary.Size(tpm2.Handle(0)))}
+}
+
+// SelectSRKHandle returns the persistent handle for the storage primary key. Either the
+// default handle will be returned if there is no NV index at SRKHandleIndexHandle, or a
+// custom one stored in it. An error is returned if the index exists but cannot be read,
+// or if it wasn't written and locked with the expected public area, so that a foreign
+// index cannot redirect the storage primary key to another persistent handle.
+func SelectSRKHandle(tpm *tpm2.TPMContext) (tpm2.Handle, error) {
+	nv, err := tpm.CreateResourceContextFromTPM(SRKHandleIndexHandle)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, SRKHandleIndexHandle):
+		// No custom handle
+		return SRKHandle, nil
+	case err != nil:
+		return tpm2.HandleUnassigned, fmt.Errorf("cannot create context for SRK handle NV index: %w", err)
+	}
+
+	pub, _, err := tpm.NVReadPublic(nv)
+	if err != nil {
+		return tpm2.HandleUnassigned, fmt.Errorf("cannot read public area of SRK handle NV index: %w", err)
+	}
+
+	expected := MakeSRKHandleIndexPublic()
+	expected.Attrs |= tpm2.AttrNVWritten | tpm2.AttrNVWriteLocked
+	switch {
+	case pub.NameAlg != expected.NameAlg:
+		return tpm2.HandleUnassigned, errors.New("SRK handle NV index has unexpected name algorithm")
+	case pub.Attrs != expected.Attrs:
+		return tpm2.HandleUnassigned, fmt.Errorf("SRK handle NV index has unexpected attributes %v", pub.Attrs)
+	case len(pub.AuthPolicy) > 0:
+		return tpm2.HandleUnassigned, errors.New("SRK handle NV index has unexpected authorization policy")
+	case pub.Size != expected.Size:
+		return tpm2.HandleUnassigned, fmt.Errorf("SRK handle NV index has unexpected size %d", pub.Size)
+	}
+
+	b, err := tpm.NVRead(nv, nv, pub.Size, 0, nil)
+	if err != nil {
+		return tpm2.HandleUnassigned, fmt.Errorf("cannot read SRK handle NV index: %w", err)
+	}
+
+	var handle tpm2.Handle
+	if _, err := mu.UnmarshalFromBytes(b, &handle); err != nil {
+		return tpm2.HandleUnassigned, fmt.Errorf("cannot decode SRK handle: %w", err)
+	}
+
+	if !IsValidSRKHandle(handle) {
+		return tpm2.HandleUnassigned, fmt.Errorf("invalid SRK handle %v", handle)
+	}
+
+	return handle, nil
+}
@@ -56,6 +56,27 @@ func MakeDefaultSRKTemplate() *tpm2.Public {
 		Unique: &tpm2.PublicIDU{RSA: make(tpm2.PublicKeyRSA, 256)}}
 }
 
+func MakeDefaultECCSRKTemplate() *tpm2.Public {
+	return &tpm2.Public{
+		Type:    tpm2.ObjectTypeECC,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs: tpm2.AttrFixedTPM | tpm2.AttrFixedParent | tpm2.AttrSensitiveDataOrigin | tpm2.AttrUserWithAuth | tpm2.AttrNoDA |
+			tpm2.AttrRestricted | tpm2.AttrDecrypt,
+		Params: &tpm2.PublicParamsU{
+			ECCDetail: &tpm2.ECCParams{
+				Symmetric: tpm2.SymDefObject{
+					Algorithm: tpm2.SymObjectAlgorithmAES,
+					KeyBits:   &tpm2.SymKeyBitsU{Sym: 128},
+					Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB}},
+				Scheme:  tpm2.ECCScheme{Scheme: tpm2.ECCSchemeNull},
+				CurveID: tpm2.ECCCurveNIST_P256,
+				KDF:     tpm2.KDFScheme{Scheme: tpm2.KDFAlgorithmNull}}},
+		Unique: &tpm2.PublicIDU{
+			ECC: &tpm2.ECCPoint{
+				X: make(tpm2.ECCParameter, 32),
+				Y: make(tpm2.ECCParameter, 32)}}}
+}
+
 func MakeDefaultEKTemplate() *tpm2.Public {
 	return &tpm2.Public{
 		Type:    tpm2.ObjectTypeRSA,
@@ -80,6 +101,9 @@ var (
 	// srkTemplate is the default RSA2048 SRK template, see section 7.5.1 of "TCG TPM v2.0 Provisioning Guidance", version 1.0, revision 1.0, 15 March 2017.
 	SRKTemplate = MakeDefaultSRKTemplate()
 
+	// ECCSRKTemplate is the default ECC NIST P256 SRK template, see section 7.5.1 of "TCG TPM v2.0 Provisioning Guidance", version 1.0, revision 1.0, 15 March 2017.
+	ECCSRKTemplate = MakeDefaultECCSRKTemplate()
+
 	// Default RSA2048 EK template, see section B.3.3 of "TCG EK Credential Profile For TPM Family 2.0; Level 0", Version 2.1, Revision 13, 10 December 2018
 	EKTemplate = MakeDefaultEKTemplate()
 
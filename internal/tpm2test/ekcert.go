@@ -0,0 +1,85 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot/internal/tcg"
+)
+
+// NewTestTPMManufacturerCA creates a self-signed CA certificate and key that can
+// be used to sign test EK certificates.
+func NewTestTPMManufacturerCA(c *C) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"Test TPM Manufacturer"}, CommonName: "Test TPM Manufacturer Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	c.Assert(err, IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, IsNil)
+
+	return cert, key
+}
+
+// NewTestEKCertificate creates a DER encoded EK certificate for the supplied
+// EK public area, signed by the supplied CA. The certificate contains a critical
+// subject alternative name extension with a directoryName in the same way as
+// real EK certificates.
+func NewTestEKCertificate(c *C, ekPublic *tpm2.Public, ca *x509.Certificate, caKey *ecdsa.PrivateKey) []byte {
+	dirName, err := asn1.Marshal([]pkix.RelativeDistinguishedNameSET{{
+		{Type: tcg.OIDTcgAttributeTpmManufacturer, Value: "id:4D534654"},
+		{Type: tcg.OIDTcgAttributeTpmModel, Value: "TPM Simulator"},
+		{Type: tcg.OIDTcgAttributeTpmVersion, Value: "id:00010002"}}})
+	c.Assert(err, IsNil)
+	san, err := asn1.Marshal([]asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: tcg.SANDirectoryNameTag, IsCompound: true, Bytes: dirName}})
+	c.Assert(err, IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageKeyEncipherment,
+		UnknownExtKeyUsage:    []asn1.ObjectIdentifier{tcg.OIDTcgKpEkCertificate},
+		BasicConstraintsValid: true,
+		ExtraExtensions:       []pkix.Extension{{Id: tcg.OIDExtensionSubjectAltName, Critical: true, Value: san}}}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, ekPublic.Public(), caKey)
+	c.Assert(err, IsNil)
+	return der
+}
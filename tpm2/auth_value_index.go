@@ -0,0 +1,196 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/util"
+
+	"golang.org/x/xerrors"
+)
+
+// authValueIndexPolicy is implemented by keyDataPolicy versions that support
+// binding the authorization value of a sealed key object to a NV index, so that
+// changing it revokes every earlier copy of the key data.
+type authValueIndexPolicy interface {
+	// AuthValueIndex returns the public area of the NV index that the
+	// authorization value is bound to, or nil if there isn't one.
+	AuthValueIndex() *tpm2.NVPublic
+}
+
+// computeAuthValueIndexAuthPolicy computes the authorization policy for a NV index
+// that a sealed key object's authorization value is bound to. This only permits
+// TPM2_NV_ChangeAuth with knowledge of the current authorization value.
+func computeAuthValueIndexAuthPolicy(alg tpm2.HashAlgorithmId) tpm2.Digest {
+	trial := util.ComputeAuthPolicy(alg)
+	trial.PolicyCommandCode(tpm2.CommandNVChangeAuth)
+	trial.PolicyAuthValue()
+	return trial.GetDigest()
+}
+
+// newAuthValueIndexPublic returns the public area of a NV index that a sealed key
+// object's authorization value is bound to. The index can be used in TPM2_PolicySecret
+// assertions with its authorization value. It has no data that is ever read, and it
+// isn't exempt from dictionary attack protection. The returned public area does not
+// have the AttrNVWritten attribute set.
+func newAuthValueIndexPublic(handle tpm2.Handle) *tpm2.NVPublic {
+	nameAlg := tpm2.HashAlgorithmSHA256
+
+	return &tpm2.NVPublic{
+		Index:      handle,
+		NameAlg:    nameAlg,
+		Attrs:      tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead),
+		AuthPolicy: computeAuthValueIndexAuthPolicy(nameAlg),
+		Size:       1}
+}
+
+// createAuthValueIndex creates and initializes a new NV index at the specified handle
+// that a sealed key object's authorization value is bound to. The index is created with
+// an empty authorization value, which is changed with changeAuthValueIndexAuth when the
+// authorization value of the sealed key object is set.
+//
+// If hmacSession is supplied, it is used for authenticating with the storage hierarchy, in
+// order to avoid transmitting the cleartext auth value, and must have the
+// AttrContinueSession attribute set.
+func createAuthValueIndex(tpm *tpm2.TPMContext, handle tpm2.Handle, hmacSession tpm2.SessionContext) (public *tpm2.NVPublic, err error) {
+	public = newAuthValueIndexPublic(handle)
+
+	index, err := tpm.NVDefineSpace(tpm.OwnerHandleContext(), nil, public, hmacSession)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		tpm.NVUndefineSpace(tpm.OwnerHandleContext(), index, hmacSession)
+	}()
+
+	// Initialize the index so that its name doesn't change later on.
+	if err := tpm.NVWrite(index, index, []byte{0}, 0, nil); err != nil {
+		return nil, err
+	}
+
+	// The index has a different name now that it has been written, so update the public
+	// area we return so that it can be used to construct an authorization policy.
+	public.Attrs |= tpm2.AttrNVWritten
+
+	return public, nil
+}
+
+// newAuthValueIndexContext returns a context for the NV index with the supplied public
+// area that a sealed key object's authorization value is bound to, checking that the
+// index on the TPM matches it.
+func newAuthValueIndexContext(tpm *tpm2.TPMContext, pub *tpm2.NVPublic) (tpm2.ResourceContext, error) {
+	name, err := pub.ComputeName()
+	if err != nil {
+		return nil, policyDataError{xerrors.Errorf("cannot compute name of authorization value NV index: %w", err)}
+	}
+
+	index, err := tpm.CreateResourceContextFromTPM(pub.Index)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, pub.Index):
+		return nil, policyDataError{errors.New("no authorization value NV index found")}
+	case err != nil:
+		return nil, err
+	}
+
+	if !bytes.Equal(index.Name(), name) {
+		return nil, policyDataError{errors.New("authorization value NV index has unexpected name")}
+	}
+
+	return index, nil
+}
+
+// executeAuthValueIndexAssertion executes a TPM2_PolicySecret assertion for the NV index
+// with the supplied public area, using the supplied authorization value. If hmacSession
+// is supplied, it is used for authenticating with the NV index in order to avoid
+// transmitting the cleartext authorization value.
+func executeAuthValueIndexAssertion(tpm *tpm2.TPMContext, policySession tpm2.SessionContext, pub *tpm2.NVPublic, authValue []byte, hmacSession tpm2.SessionContext) error {
+	index, err := newAuthValueIndexContext(tpm, pub)
+	if err != nil {
+		return err
+	}
+	index.SetAuthValue(authValue)
+
+	if _, _, err := tpm.PolicySecret(index, policySession, nil, nil, 0, hmacSession); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// changeAuthValueIndexAuth changes the authorization value of the NV index with the
+// supplied public area from oldAuthValue to newAuthValue. The supplied salt key is
+// used to salt the policy session that authorizes the change, which is also used to
+// encrypt the new value.
+func changeAuthValueIndexAuth(tpm *tpm2.TPMContext, pub *tpm2.NVPublic, saltKey tpm2.ResourceContext, oldAuthValue, newAuthValue []byte) error {
+	index, err := newAuthValueIndexContext(tpm, pub)
+	if err != nil {
+		return err
+	}
+	index.SetAuthValue(oldAuthValue)
+
+	symmetric := &tpm2.SymDef{
+		Algorithm: tpm2.SymAlgorithmAES,
+		KeyBits:   &tpm2.SymKeyBitsU{Sym: 128},
+		Mode:      &tpm2.SymModeU{Sym: tpm2.SymModeCFB},
+	}
+	policySession, err := tpm.StartAuthSession(saltKey, nil, tpm2.SessionTypePolicy, symmetric, pub.NameAlg)
+	if err != nil {
+		return xerrors.Errorf("cannot start policy session: %w", err)
+	}
+	defer tpm.FlushContext(policySession)
+
+	if err := tpm.PolicyCommandCode(policySession, tpm2.CommandNVChangeAuth); err != nil {
+		return err
+	}
+	if err := tpm.PolicyAuthValue(policySession); err != nil {
+		return err
+	}
+
+	return tpm.NVChangeAuth(index, newAuthValue, policySession.IncludeAttrs(tpm2.AttrCommandEncrypt))
+}
+
+// authValueIndexHasAuthValue determines whether the NV index with the supplied public
+// area currently has the supplied authorization value, by executing a TPM2_PolicySecret
+// assertion for it. A mismatch counts as an authorization failure for the purposes of
+// the TPM's dictionary attack protection. If hmacSession is supplied, it is used for
+// authenticating with the NV index in order to avoid transmitting the cleartext
+// authorization value.
+func authValueIndexHasAuthValue(tpm *tpm2.TPMContext, pub *tpm2.NVPublic, authValue []byte, hmacSession tpm2.SessionContext) (bool, error) {
+	policySession, err := tpm.StartAuthSession(nil, nil, tpm2.SessionTypePolicy, nil, pub.NameAlg)
+	if err != nil {
+		return false, xerrors.Errorf("cannot start policy session: %w", err)
+	}
+	defer tpm.FlushContext(policySession)
+
+	err = executeAuthValueIndexAssertion(tpm, policySession, pub, authValue, hmacSession)
+	switch {
+	case tpm2.IsTPMSessionError(err, tpm2.ErrorAuthFail, tpm2.CommandPolicySecret, 1):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
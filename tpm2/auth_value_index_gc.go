@@ -0,0 +1,191 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"bytes"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+// AuthValueIndexInfo describes a NV index on the TPM that a sealed key object's
+// authorization value is bound to, created by this package.
+type AuthValueIndexInfo struct {
+	Handle tpm2.Handle // The handle of the NV index
+	Name   tpm2.Name   // The name of the NV index
+
+	// Orphaned indicates that the index is not associated with any of the
+	// live keys supplied to ListAuthValueIndices.
+	Orphaned bool
+}
+
+// isAuthValueIndexPublic determines whether the supplied public area looks like
+// it belongs to a NV index that a sealed key object's authorization value is
+// bound to, created by this package.
+func isAuthValueIndexPublic(pub *tpm2.NVPublic) bool {
+	expected := newAuthValueIndexPublic(pub.Index)
+	expected.Attrs |= tpm2.AttrNVWritten
+
+	return pub.NameAlg == expected.NameAlg && pub.Attrs == expected.Attrs &&
+		bytes.Equal(pub.AuthPolicy, expected.AuthPolicy) && pub.Size == expected.Size
+}
+
+// ListAuthValueIndices returns a list of NV indices on the TPM in the block
+// reserved for owner objects (0x01800000 - 0x01bfffff) that a sealed key object's
+// authorization value is bound to, created by this package with
+// PassphraseProtectKeyParams.AuthValueIndexHandle.
+//
+// An index is only considered to be one of these if it has the attributes, size,
+// name algorithm and authorization policy that this package uses. Unlike PCR policy
+// counters, these indices can't be attributed to a particular primary key.
+//
+// Each index is checked against the supplied live keys - an index is considered
+// to be in use if one of the keys is bound to an index with the same handle and
+// name. Indices that are not in use are marked as orphaned. Keys that are not
+// protected by this platform are ignored.
+func (t *Connection) ListAuthValueIndices(liveKeys []*secboot.KeyData) ([]*AuthValueIndexInfo, error) {
+	live := make(map[tpm2.Handle][]tpm2.Name)
+
+	for i, k := range liveKeys {
+		if k.PlatformName() != platformName {
+			continue
+		}
+		skd, err := NewSealedKeyData(k)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot decode key %d: %w", i, err)
+		}
+		policy, ok := skd.data.Policy().(authValueIndexPolicy)
+		if !ok {
+			continue
+		}
+		pub := policy.AuthValueIndex()
+		if pub == nil {
+			continue
+		}
+		live[pub.Index] = append(live[pub.Index], pub.Name())
+	}
+
+	handles, err := t.GetCapabilityHandles(ownerNVIndexFirst, tpm2.CapabilityMaxProperties)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain NV index handles: %w", err)
+	}
+
+	var out []*AuthValueIndexInfo
+	for _, handle := range handles {
+		if handle > ownerNVIndexLast {
+			break
+		}
+
+		index, err := t.CreateResourceContextFromTPM(handle)
+		switch {
+		case tpm2.IsResourceUnavailableError(err, handle):
+			// The index was undefined after we obtained the list of handles.
+			continue
+		case err != nil:
+			return nil, xerrors.Errorf("cannot create context for NV index %v: %w", handle, err)
+		}
+
+		pub, _, err := t.NVReadPublic(index)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read public area of NV index %v: %w", handle, err)
+		}
+		if !isAuthValueIndexPublic(pub) {
+			continue
+		}
+
+		info := &AuthValueIndexInfo{
+			Handle:   handle,
+			Name:     index.Name(),
+			Orphaned: true}
+		for _, name := range live[handle] {
+			if bytes.Equal(name, info.Name) {
+				info.Orphaned = false
+				break
+			}
+		}
+
+		out = append(out, info)
+	}
+
+	return out, nil
+}
+
+// RemoveOrphanedAuthValueIndices undefines the NV indices with the supplied handles
+// that are returned from ListAuthValueIndices for the supplied live keys and are
+// marked as orphaned, and returns the handles of the indices that were removed.
+// Indices that aren't explicitly named by the handles argument are never removed,
+// even if they are orphaned, and handles that don't correspond to an orphaned index
+// are ignored.
+//
+// This requires knowledge of the authorization value for the storage hierarchy,
+// which must be set on the context returned from Connection.OwnerHandleContext.
+// If the wrong value is set, then a AuthFailError error will be returned.
+//
+// As these indices can't be attributed to a particular primary key, the caller
+// should only name indices that it knows it created and that are no longer used,
+// such as those that keys it has deleted were bound to. An index that is named
+// but is used by a key that isn't supplied via the liveKeys argument will be
+// removed, and that key will no longer be able to be unsealed.
+func (t *Connection) RemoveOrphanedAuthValueIndices(handles []tpm2.Handle, liveKeys []*secboot.KeyData) (removed []tpm2.Handle, err error) {
+	indices, err := t.ListAuthValueIndices(liveKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	named := make(map[tpm2.Handle]bool)
+	for _, handle := range handles {
+		named[handle] = true
+	}
+
+	for _, info := range indices {
+		if !info.Orphaned || !named[info.Handle] {
+			continue
+		}
+
+		index, err := t.CreateResourceContextFromTPM(info.Handle)
+		switch {
+		case tpm2.IsResourceUnavailableError(err, info.Handle):
+			continue
+		case err != nil:
+			return removed, xerrors.Errorf("cannot create context for NV index %v: %w", info.Handle, err)
+		}
+		if !bytes.Equal(index.Name(), info.Name) {
+			// The index was replaced after it was listed.
+			continue
+		}
+
+		// Pass the HMAC session here so that we don't supply the cleartext
+		// auth value for the storage hierarchy.
+		if err := t.NVUndefineSpace(t.OwnerHandleContext(), index, t.HmacSession()); err != nil {
+			if isAuthFailError(err, tpm2.CommandNVUndefineSpace, 1) {
+				return removed, AuthFailError{tpm2.HandleOwner}
+			}
+			return removed, xerrors.Errorf("cannot undefine NV index %v: %w", info.Handle, err)
+		}
+
+		removed = append(removed, info.Handle)
+	}
+
+	return removed, nil
+}
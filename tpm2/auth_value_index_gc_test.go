@@ -0,0 +1,175 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"github.com/canonical/go-tpm2"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type authValueIndexGCSuiteNoTPM struct{}
+
+type authValueIndexGCSuite struct {
+	tpm2test.TPMTest
+}
+
+func (s *authValueIndexGCSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureEndorsementHierarchy |
+		tpm2test.TPMFeatureNV
+}
+
+func (s *authValueIndexGCSuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+}
+
+var _ = Suite(&authValueIndexGCSuiteNoTPM{})
+var _ = Suite(&authValueIndexGCSuite{})
+
+func (s *authValueIndexGCSuiteNoTPM) TestIsAuthValueIndexPublic(c *C) {
+	pub := NewAuthValueIndexPublic(0x01810000)
+	pub.Attrs |= tpm2.AttrNVWritten
+	c.Check(IsAuthValueIndexPublic(pub), testutil.IsTrue)
+}
+
+func (s *authValueIndexGCSuiteNoTPM) TestIsAuthValueIndexPublicNotWritten(c *C) {
+	c.Check(IsAuthValueIndexPublic(NewAuthValueIndexPublic(0x01810000)), testutil.IsFalse)
+}
+
+func (s *authValueIndexGCSuiteNoTPM) TestIsAuthValueIndexPublicDifferentPolicy(c *C) {
+	pub := NewAuthValueIndexPublic(0x01810000)
+	pub.Attrs |= tpm2.AttrNVWritten
+	pub.AuthPolicy = make(tpm2.Digest, 32)
+	c.Check(IsAuthValueIndexPublic(pub), testutil.IsFalse)
+}
+
+func (s *authValueIndexGCSuiteNoTPM) TestIsAuthValueIndexPublicPCRPolicyCounter(c *C) {
+	pub := &tpm2.NVPublic{
+		Index:   0x01810000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVPolicyWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyRead | tpm2.AttrNVNoDA | tpm2.AttrNVWritten),
+		Size:    8}
+	c.Check(IsAuthValueIndexPublic(pub), testutil.IsFalse)
+}
+
+func (s *authValueIndexGCSuite) newKey(c *C, handle tpm2.Handle) *secboot.KeyData {
+	k, _, _, err := NewTPMPassphraseProtectedKey(s.TPM(), &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		KDFOptions:           new(secboot.PBKDF2Options),
+		AuthValueIndexHandle: handle}, "passphrase")
+	c.Assert(err, IsNil)
+	return k
+}
+
+func (s *authValueIndexGCSuite) TestListAuthValueIndices(c *C) {
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.newKey(c, handle2)
+
+	indices, err := s.TPM().ListAuthValueIndices([]*secboot.KeyData{k1})
+	c.Assert(err, IsNil)
+	c.Assert(indices, HasLen, 2)
+	c.Check(indices[0].Handle, Equals, handle1)
+	c.Check(indices[0].Orphaned, testutil.IsFalse)
+	c.Check(indices[1].Handle, Equals, handle2)
+	c.Check(indices[1].Orphaned, testutil.IsTrue)
+}
+
+func (s *authValueIndexGCSuite) TestListAuthValueIndicesIgnoresOtherIndices(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   handle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead),
+		Size:    1})
+
+	// A PCR policy counter shouldn't be listed either.
+	_, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, handle+1)})
+	c.Assert(err, IsNil)
+
+	indices, err := s.TPM().ListAuthValueIndices(nil)
+	c.Check(err, IsNil)
+	c.Check(indices, HasLen, 0)
+}
+
+func (s *authValueIndexGCSuite) TestRemoveOrphanedAuthValueIndices(c *C) {
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.newKey(c, handle2)
+
+	removed, err := s.TPM().RemoveOrphanedAuthValueIndices([]tpm2.Handle{handle1, handle2}, []*secboot.KeyData{k1})
+	c.Check(err, IsNil)
+	c.Check(removed, DeepEquals, []tpm2.Handle{handle2})
+
+	c.Check(s.TPM().DoesHandleExist(handle1), testutil.IsTrue)
+	c.Check(s.TPM().DoesHandleExist(handle2), testutil.IsFalse)
+
+	// The remaining key should still be usable.
+	_, _, err = k1.RecoverKeysWithPassphrase("passphrase")
+	c.Check(err, IsNil)
+}
+
+func (s *authValueIndexGCSuite) TestRemoveOrphanedAuthValueIndicesOnlyNamed(c *C) {
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	k2 := s.newKey(c, handle2)
+	handle3 := s.NextAvailableHandle(c, handle2+1)
+	s.newKey(c, handle3)
+
+	// The index for k2 is orphaned because k2 isn't supplied, but it isn't
+	// named so it shouldn't be removed.
+	removed, err := s.TPM().RemoveOrphanedAuthValueIndices([]tpm2.Handle{handle3}, []*secboot.KeyData{k1})
+	c.Check(err, IsNil)
+	c.Check(removed, DeepEquals, []tpm2.Handle{handle3})
+
+	c.Check(s.TPM().DoesHandleExist(handle1), testutil.IsTrue)
+	c.Check(s.TPM().DoesHandleExist(handle2), testutil.IsTrue)
+	c.Check(s.TPM().DoesHandleExist(handle3), testutil.IsFalse)
+
+	_, _, err = k2.RecoverKeysWithPassphrase("passphrase")
+	c.Check(err, IsNil)
+}
+
+func (s *authValueIndexGCSuite) TestRemoveOrphanedAuthValueIndicesAuthFail(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	s.newKey(c, handle)
+
+	s.HierarchyChangeAuth(c, tpm2.HandleOwner, []byte("1234"))
+	s.TPM().OwnerHandleContext().SetAuthValue(nil)
+
+	_, err := s.TPM().RemoveOrphanedAuthValueIndices([]tpm2.Handle{handle}, nil)
+	c.Check(err, Equals, AuthFailError{tpm2.HandleOwner})
+	c.Check(s.TPM().DoesHandleExist(handle), testutil.IsTrue)
+}
@@ -0,0 +1,116 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"errors"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+)
+
+// DAStatus describes the current state of the TPM's dictionary attack protection
+// logic. It is returned from Connection.DictionaryAttackStatus.
+type DAStatus struct {
+	DAParameters
+
+	// FailedTries is the current number of authorization failures for DA protected
+	// objects.
+	FailedTries uint32
+
+	// InLockout indicates that the TPM is in dictionary attack lockout mode, which
+	// is the case when FailedTries has reached MaxTries.
+	InLockout bool
+}
+
+// MaxTimeUntilDecrement returns the maximum amount of time before the failed tries
+// count is next decremented. The TPM decrements the count every RecoveryTime seconds
+// whilst it is powered on, but doesn't expose when the count was last decremented, so
+// the count may be decremented sooner than this. This returns zero if the count is
+// already zero.
+func (s *DAStatus) MaxTimeUntilDecrement() time.Duration {
+	if s.FailedTries == 0 {
+		return 0
+	}
+	return time.Duration(s.RecoveryTime) * time.Second
+}
+
+// MaxTimeUntilReset returns the maximum amount of time before the failed tries count
+// reaches zero and the TPM leaves lockout mode, if it is in lockout mode. As with
+// MaxTimeUntilDecrement, this is an upper bound of TPM powered-on time.
+func (s *DAStatus) MaxTimeUntilReset() time.Duration {
+	return time.Duration(s.FailedTries) * time.Duration(s.RecoveryTime) * time.Second
+}
+
+// DictionaryAttackStatus returns the current state of the TPM's dictionary attack
+// protection logic, including the current failed tries count and the configured
+// parameters. This does not require any authorization.
+func (t *Connection) DictionaryAttackStatus() (*DAStatus, error) {
+	props, err := t.GetCapabilityTPMProperties(tpm2.PropertyPermanent, 1)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot fetch permanent properties: %w", err)
+	}
+	if len(props) == 0 || props[0].Property != tpm2.PropertyPermanent {
+		return nil, errors.New("TPM returned value for the wrong property")
+	}
+
+	status := &DAStatus{InLockout: tpm2.PermanentAttributes(props[0].Value)&tpm2.AttrInLockout > 0}
+
+	props, err = t.GetCapabilityTPMProperties(tpm2.PropertyLockoutCounter, 4)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot fetch DA properties: %w", err)
+	}
+	if len(props) != 4 || props[0].Property != tpm2.PropertyLockoutCounter || props[1].Property != tpm2.PropertyMaxAuthFail ||
+		props[2].Property != tpm2.PropertyLockoutInterval || props[3].Property != tpm2.PropertyLockoutRecovery {
+		return nil, errors.New("TPM returned values for the wrong properties")
+	}
+	status.FailedTries = props[0].Value
+	status.MaxTries = props[1].Value
+	status.RecoveryTime = props[2].Value
+	status.LockoutRecovery = props[3].Value
+
+	return status, nil
+}
+
+// ResetDictionaryAttackLock resets the TPM's failed tries count to zero, taking
+// the TPM out of lockout mode if it is in lockout mode. This requires knowledge of
+// the authorization value for the lockout hierarchy, which is supplied via the
+// lockoutAuth argument. If the wrong value is supplied, then a AuthFailError error
+// will be returned and the lockout hierarchy will be unavailable for the
+// LockoutRecovery time, during which ErrTPMLockout will be returned.
+func (t *Connection) ResetDictionaryAttackLock(lockoutAuth []byte) error {
+	t.LockoutHandleContext().SetAuthValue(lockoutAuth)
+
+	// Pass the HMAC session here so we don't supply the cleartext auth value for
+	// the lockout hierarchy.
+	if err := t.DictionaryAttackLockReset(t.LockoutHandleContext(), t.HmacSession()); err != nil {
+		switch {
+		case isAuthFailError(err, tpm2.CommandDictionaryAttackLockReset, 1):
+			return AuthFailError{tpm2.HandleLockout}
+		case tpm2.IsTPMWarning(err, tpm2.WarningLockout, tpm2.CommandDictionaryAttackLockReset):
+			return ErrTPMLockout
+		}
+		return xerrors.Errorf("cannot reset dictionary attack lock: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"time"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/util"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type dictionaryAttackSuiteNoTPM struct{}
+
+type dictionaryAttackSuite struct {
+	tpm2test.TPMTest
+}
+
+func (s *dictionaryAttackSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureLockoutHierarchy |
+		tpm2test.TPMFeaturePlatformHierarchy | // Allow the test fixture to undo a lockout hierarchy lockout
+		tpm2test.TPMFeatureClear |
+		tpm2test.TPMFeatureNV
+}
+
+var _ = Suite(&dictionaryAttackSuiteNoTPM{})
+var _ = Suite(&dictionaryAttackSuite{})
+
+func (s *dictionaryAttackSuiteNoTPM) TestDefaultDAParameters(c *C) {
+	c.Check(DefaultDAParameters(), DeepEquals, &DAParameters{MaxTries: 32, RecoveryTime: 7200, LockoutRecovery: 86400})
+}
+
+func (s *dictionaryAttackSuiteNoTPM) TestDAStatusTimes(c *C) {
+	status := &DAStatus{
+		DAParameters: DAParameters{MaxTries: 32, RecoveryTime: 7200, LockoutRecovery: 86400},
+		FailedTries:  3}
+	c.Check(status.MaxTimeUntilDecrement(), Equals, 2*time.Hour)
+	c.Check(status.MaxTimeUntilReset(), Equals, 6*time.Hour)
+}
+
+func (s *dictionaryAttackSuiteNoTPM) TestDAStatusTimesNoFailures(c *C) {
+	status := &DAStatus{DAParameters: DAParameters{MaxTries: 32, RecoveryTime: 7200, LockoutRecovery: 86400}}
+	c.Check(status.MaxTimeUntilDecrement(), Equals, time.Duration(0))
+	c.Check(status.MaxTimeUntilReset(), Equals, time.Duration(0))
+}
+
+func (s *dictionaryAttackSuite) causeAuthFailure(c *C) {
+	pub, sensitive := util.NewExternalSealedObject(tpm2.HashAlgorithmSHA256, []byte("foo"), []byte("bar"))
+	obj, err := s.TPM().LoadExternal(sensitive, pub, tpm2.HandleNull)
+	c.Assert(err, IsNil)
+	defer s.TPM().FlushContext(obj)
+
+	obj.SetAuthValue([]byte("wrong"))
+	_, err = s.TPM().Unseal(obj, nil)
+	c.Assert(tpm2.IsTPMSessionError(err, tpm2.ErrorAuthFail, tpm2.CommandUnseal, 1), testutil.IsTrue)
+}
+
+func (s *dictionaryAttackSuite) TestDictionaryAttackStatus(c *C) {
+	c.Check(s.TPM().DictionaryAttackParameters(s.TPM().LockoutHandleContext(), 32, 7200, 86400, nil), IsNil)
+
+	s.causeAuthFailure(c)
+
+	status, err := s.TPM().DictionaryAttackStatus()
+	c.Assert(err, IsNil)
+	c.Check(status, DeepEquals, &DAStatus{
+		DAParameters: DAParameters{MaxTries: 32, RecoveryTime: 7200, LockoutRecovery: 86400},
+		FailedTries:  1})
+}
+
+func (s *dictionaryAttackSuite) TestResetDictionaryAttackLock(c *C) {
+	c.Check(s.TPM().DictionaryAttackParameters(s.TPM().LockoutHandleContext(), 32, 7200, 86400, nil), IsNil)
+	s.HierarchyChangeAuth(c, tpm2.HandleLockout, []byte("1234"))
+
+	s.causeAuthFailure(c)
+
+	c.Check(s.TPM().ResetDictionaryAttackLock([]byte("1234")), IsNil)
+
+	status, err := s.TPM().DictionaryAttackStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.FailedTries, Equals, uint32(0))
+}
+
+func (s *dictionaryAttackSuite) TestResetDictionaryAttackLockAuthFail(c *C) {
+	s.HierarchyChangeAuth(c, tpm2.HandleLockout, []byte("1234"))
+	defer func() {
+		// This test trips the lockout for the lockout auth, which can't
+		// be undone by the test fixture. Clear the TPM else the test
+		// fixture fails the test.
+		s.ClearTPMUsingPlatformHierarchy(c)
+	}()
+
+	err := s.TPM().ResetDictionaryAttackLock([]byte("5678"))
+	c.Assert(err, testutil.ConvertibleTo, AuthFailError{})
+	c.Check(err.(AuthFailError).Handle, Equals, tpm2.HandleLockout)
+
+	s.TPM().LockoutHandleContext().SetAuthValue([]byte("1234"))
+	c.Check(s.TPM().ResetDictionaryAttackLock([]byte("1234")), Equals, ErrTPMLockout)
+}
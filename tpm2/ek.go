@@ -0,0 +1,87 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot/internal/tcg"
+)
+
+// EKVerificationOptions provides the TPM manufacturer certificates used to verify
+// the endorsement key with Connection.VerifyEndorsementKey.
+type EKVerificationOptions struct {
+	// Roots contains the TPM manufacturer root certificates that are trusted. This
+	// is mandatory.
+	Roots *x509.CertPool
+
+	// Intermediates optionally contains intermediate certificates that are not
+	// trusted but can be used to build a chain from the EK certificate to one of
+	// the roots.
+	Intermediates *x509.CertPool
+}
+
+// VerifyEndorsementKey verifies the endorsement key that is used to salt the
+// session returned from HmacSession. The EK certificate is read from the standard
+// NV index, verified against the TPM manufacturer roots supplied via the opts
+// argument, and then checked to make sure that it certifies the endorsement key.
+//
+// If there is no EK certificate, then ErrNoEKCertificate will be returned. If
+// verification fails, then a EKCertificateVerificationError error will be returned.
+// This might indicate that the TPM is not genuine or that there is an active
+// interposer.
+//
+// On success, the verified certificate is available from VerifiedEKCertificate.
+// The result is discarded if the connection is re-initialized, such as after
+// provisioning the TPM with EnsureProvisioned.
+func (t *Connection) VerifyEndorsementKey(opts *EKVerificationOptions) error {
+	t.ekCert = nil
+
+	if opts == nil || opts.Roots == nil {
+		return errors.New("no TPM manufacturer roots supplied")
+	}
+	if t.ekPublic == nil {
+		return errors.New("no suitable endorsement key is available")
+	}
+
+	cert, err := tcg.ReadEKCertificate(t.TPMContext, t.ekPublic.Type)
+	switch {
+	case err == tcg.ErrNoEKCertificate:
+		return ErrNoEKCertificate
+	case err != nil:
+		return xerrors.Errorf("cannot read EK certificate: %w", err)
+	}
+
+	if err := tcg.VerifyEKCertificate(cert, t.ekPublic, opts.Roots, opts.Intermediates); err != nil {
+		return EKCertificateVerificationError{err}
+	}
+
+	t.ekCert = cert
+	return nil
+}
+
+// VerifiedEKCertificate returns the EK certificate if the endorsement key was
+// successfully verified with VerifyEndorsementKey, or nil if it hasn't been.
+func (t *Connection) VerifiedEKCertificate() *x509.Certificate {
+	return t.ekCert
+}
@@ -0,0 +1,189 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"bytes"
+	"crypto/x509"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot/internal/tcg"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type ekSuite struct {
+	tpm2test.TPMTest
+}
+
+func (s *ekSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureEndorsementHierarchy |
+		tpm2test.TPMFeatureNV
+}
+
+func (s *ekSuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+}
+
+var _ = Suite(&ekSuite{})
+
+func (s *ekSuite) ekPublic(c *C) *tpm2.Public {
+	ek, err := s.TPM().CreateResourceContextFromTPM(tcg.EKHandle)
+	c.Assert(err, IsNil)
+	pub, _, _, err := s.TPM().ReadPublic(ek)
+	c.Assert(err, IsNil)
+	return pub
+}
+
+func (s *ekSuite) writeEKCert(c *C, cert []byte) {
+	index := s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   tcg.EKCertHandle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA),
+		Size:    uint16(len(cert))})
+	c.Assert(s.TPM().NVWrite(index, index, cert, 0, nil), IsNil)
+}
+
+func (s *ekSuite) TestVerifyEndorsementKey(c *C) {
+	ca, caKey := tpm2test.NewTestTPMManufacturerCA(c)
+	s.writeEKCert(c, tpm2test.NewTestEKCertificate(c, s.ekPublic(c), ca, caKey))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	c.Check(s.TPM().VerifiedEKCertificate(), IsNil)
+	c.Check(s.TPM().VerifyEndorsementKey(&EKVerificationOptions{Roots: roots}), IsNil)
+
+	cert := s.TPM().VerifiedEKCertificate()
+	c.Assert(cert, NotNil)
+	c.Check(cert.Issuer.CommonName, Equals, "Test TPM Manufacturer Root CA")
+}
+
+func (s *ekSuite) TestVerifyEndorsementKeyReinitClearsResult(c *C) {
+	ca, caKey := tpm2test.NewTestTPMManufacturerCA(c)
+	s.writeEKCert(c, tpm2test.NewTestEKCertificate(c, s.ekPublic(c), ca, caKey))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	c.Check(s.TPM().VerifyEndorsementKey(&EKVerificationOptions{Roots: roots}), IsNil)
+	c.Check(s.TPM().VerifiedEKCertificate(), NotNil)
+
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+	c.Check(s.TPM().VerifiedEKCertificate(), IsNil)
+}
+
+func (s *ekSuite) TestVerifyEndorsementKeyUntrustedRoot(c *C) {
+	ca, caKey := tpm2test.NewTestTPMManufacturerCA(c)
+	s.writeEKCert(c, tpm2test.NewTestEKCertificate(c, s.ekPublic(c), ca, caKey))
+
+	otherCA, _ := tpm2test.NewTestTPMManufacturerCA(c)
+	roots := x509.NewCertPool()
+	roots.AddCert(otherCA)
+
+	err := s.TPM().VerifyEndorsementKey(&EKVerificationOptions{Roots: roots})
+	c.Check(err, ErrorMatches, `cannot verify endorsement key: cannot verify certificate: x509: certificate signed by unknown authority.*`)
+	c.Check(err, FitsTypeOf, EKCertificateVerificationError{})
+	c.Check(s.TPM().VerifiedEKCertificate(), IsNil)
+}
+
+func (s *ekSuite) TestVerifyEndorsementKeyWrongKey(c *C) {
+	ca, caKey := tpm2test.NewTestTPMManufacturerCA(c)
+
+	// Create a certificate for a different key.
+	otherKey := s.ekPublic(c)
+	otherKey.Unique.RSA[0] ^= 0xff
+	s.writeEKCert(c, tpm2test.NewTestEKCertificate(c, otherKey, ca, caKey))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	err := s.TPM().VerifyEndorsementKey(&EKVerificationOptions{Roots: roots})
+	c.Check(err, ErrorMatches, `cannot verify endorsement key: certificate does not match the endorsement key`)
+	c.Check(err, FitsTypeOf, EKCertificateVerificationError{})
+}
+
+func (s *ekSuite) TestVerifyEndorsementKeyNoCertificate(c *C) {
+	ca, _ := tpm2test.NewTestTPMManufacturerCA(c)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	c.Check(s.TPM().VerifyEndorsementKey(&EKVerificationOptions{Roots: roots}), Equals, ErrNoEKCertificate)
+}
+
+func (s *ekSuite) TestVerifyEndorsementKeyNoRoots(c *C) {
+	c.Check(s.TPM().VerifyEndorsementKey(nil), ErrorMatches, `no TPM manufacturer roots supplied`)
+}
+
+func (s *ekSuite) TestVerifyEndorsementKeyUsesSaltingKey(c *C) {
+	// Simulate an active interposer that returns the public area of a different
+	// key for every TPM2_ReadPublic of the EK after the first one. The verified
+	// key must be the one associated with the context that salts the session.
+	ca, caKey := tpm2test.NewTestTPMManufacturerCA(c)
+	s.writeEKCert(c, tpm2test.NewTestEKCertificate(c, s.ekPublic(c), ca, caKey))
+
+	template := tcg.MakeDefaultEKTemplate()
+	template.Unique = &tpm2.PublicIDU{RSA: make(tpm2.PublicKeyRSA, 256)}
+	template.Unique.RSA[0] = 1
+	other := s.CreatePrimary(c, tpm2.HandleEndorsement, template)
+	otherPub, otherName, otherQn, err := s.TPM().ReadPublic(other)
+	c.Assert(err, IsNil)
+
+	n := 0
+	s.TPMTest.TPMTest.Transport.ResponseIntercept = func(cmdCode tpm2.CommandCode, cmdHandles tpm2.HandleList, cmdAuthArea []tpm2.AuthCommand, cpBytes []byte, rsp *bytes.Buffer) {
+		if cmdCode != tpm2.CommandReadPublic || cmdHandles[0] != tcg.EKHandle {
+			return
+		}
+		n++
+		if n == 1 {
+			return
+		}
+
+		rc, _, rAuthArea, err := tpm2.ReadResponsePacket(bytes.NewReader(rsp.Bytes()), nil)
+		c.Assert(err, IsNil)
+		if rc != tpm2.ResponseSuccess {
+			return
+		}
+
+		rpBytes := mu.MustMarshalToBytes(mu.Sized(otherPub), otherName, otherQn)
+		rsp.Reset()
+		c.Check(tpm2.WriteResponsePacket(rsp, rc, nil, rpBytes, rAuthArea), IsNil)
+	}
+	defer func() { s.TPMTest.TPMTest.Transport.ResponseIntercept = nil }()
+
+	s.ReinitTPMConnectionFromExisting(c)
+
+	// Make sure that the interposer is working.
+	ek, err := s.TPM().CreateResourceContextFromTPM(tcg.EKHandle)
+	c.Assert(err, IsNil)
+	c.Check(ek.Name(), DeepEquals, otherName)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	c.Check(s.TPM().VerifyEndorsementKey(&EKVerificationOptions{Roots: roots}), IsNil)
+}
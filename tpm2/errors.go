@@ -26,6 +26,8 @@ import (
 	"github.com/canonical/go-tpm2"
 
 	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot/internal/tcg"
 )
 
 var (
@@ -48,6 +50,20 @@ var (
 	// the TPM (eg, a recovery key)
 	ErrTPMLockout = errors.New("the TPM is in DA lockout mode")
 
+	// ErrTimeConstraintsNotSatisfied is returned when unsealing a key that was created with
+	// TimeConstraints that aren't satisfied by the current state of the TPM's clock and
+	// reset and restart counters, eg, because the key has expired.
+	ErrTimeConstraintsNotSatisfied = errors.New("the time constraints of the sealed key are not satisfied")
+
+	// ErrWrongLocality is returned when unsealing a key that was created with a
+	// PolicyLocality that doesn't permit the locality from which the TPM is being
+	// accessed. The key data is valid and may be unsealed from a permitted locality.
+	ErrWrongLocality = errors.New("the sealed key object cannot be unsealed from the current locality")
+
+	// ErrNoEKCertificate is returned from Connection.VerifyEndorsementKey if there is
+	// no EK certificate in the TPM's NV storage.
+	ErrNoEKCertificate = tcg.ErrNoEKCertificate
+
 	// ErrNoTPM2Device is returned from ConnectToDefaultTPM or SecureConnectToDefaultTPM if no TPM2 device is avaiable.
 	ErrNoTPM2Device = errors.New("no TPM2 device is available")
 )
@@ -91,3 +107,37 @@ func isInvalidKeyDataError(err error) bool {
 	var e InvalidKeyDataError
 	return xerrors.As(err, &e)
 }
+
+// SRKMismatchError is returned when a sealed key object cannot be loaded into the TPM
+// because it is not protected by the storage root key at the specified handle. This
+// is normally because the TPM has been cleared and reprovisioned since the sealed key
+// object was created, in which case the key cannot be recovered with this TPM.
+type SRKMismatchError struct {
+	Handle tpm2.Handle
+}
+
+func (e SRKMismatchError) Error() string {
+	return fmt.Sprintf("the sealed key object is not protected by the storage root key at handle %v "+
+		"(the TPM may have been cleared since the key was created)", e.Handle)
+}
+
+func isSRKMismatchError(err error) bool {
+	var e SRKMismatchError
+	return xerrors.As(err, &e)
+}
+
+// EKCertificateVerificationError is returned from Connection.VerifyEndorsementKey if
+// the EK certificate cannot be verified against the supplied manufacturer roots, or
+// if it doesn't certify the endorsement key that is used to salt sessions. This might
+// indicate that the TPM is not genuine or that there is an active interposer.
+type EKCertificateVerificationError struct {
+	err error
+}
+
+func (e EKCertificateVerificationError) Error() string {
+	return "cannot verify endorsement key: " + e.err.Error()
+}
+
+func (e EKCertificateVerificationError) Unwrap() error {
+	return e.err
+}
@@ -42,20 +42,30 @@ var (
 	ComputeV3PcrPolicyRef                   = computeV3PcrPolicyRef
 	DeriveV3PolicyAuthKey                   = deriveV3PolicyAuthKey
 	ErrSessionDigestNotFound                = errSessionDigestNotFound
+	IsAuthValueIndexPublic                  = isAuthValueIndexPublic
+	IsPcrPolicyCounterAuthorizedBy          = isPcrPolicyCounterAuthorizedBy
+	IsPcrPolicyCounterPublic                = isPcrPolicyCounterPublic
 	IsPolicyDataError                       = isPolicyDataError
 	MakeSealedKeyData                       = makeSealedKeyData
 	MakeKeyDataNoAuth                       = makeKeyDataNoAuth
 	MakeKeyDataWithPassphraseConstructor    = makeKeyDataWithPassphraseConstructor
+	NewAuthValueIndexPublic                 = newAuthValueIndexPublic
 	NewKeyData                              = newKeyData
 	NewKeyDataPolicy                        = newKeyDataPolicy
 	NewKeyDataPolicyLegacy                  = newKeyDataPolicyLegacy
+	NewKeyDataPolicyV4                      = newKeyDataPolicyV4
+	NewPcrPolicyCounterPublic               = newPcrPolicyCounterPublic
 	NewPolicyAuthPublicKey                  = newPolicyAuthPublicKey
 	NewPolicyOrDataV0                       = newPolicyOrDataV0
 	NewPolicyOrTree                         = newPolicyOrTree
+	NewSystemdPCRPolicyPublicKey            = newSystemdPCRPolicyPublicKey
+	PublicMatchesTemplate                   = publicMatchesTemplate
 	ReadKeyDataV0                           = readKeyDataV0
 	ReadKeyDataV1                           = readKeyDataV1
 	ReadKeyDataV2                           = readKeyDataV2
 	ReadKeyDataV3                           = readKeyDataV3
+	ReadKeyDataV4                           = readKeyDataV4
+	TimeConstraintsFromAssertions           = timeConstraintsFromAssertions
 )
 
 // Alias some unexported types for testing. These are required in order to pass these between functions in tests, or to access
@@ -66,6 +76,7 @@ type KeyData_v0 = keyData_v0
 type KeyData_v1 = keyData_v1
 type KeyData_v2 = keyData_v2
 type KeyData_v3 = keyData_v3
+type KeyData_v4 = keyData_v4
 type AdditionalData_v3 = additionalData_v3
 type KeyDataError = keyDataError
 type SealedKeyDataParams = makeSealedKeyDataParams
@@ -74,6 +85,7 @@ type KeyDataPolicy_v0 = keyDataPolicy_v0
 type KeyDataPolicy_v1 = keyDataPolicy_v1
 type KeyDataPolicy_v2 = keyDataPolicy_v2
 type KeyDataPolicy_v3 = keyDataPolicy_v3
+type KeyDataPolicy_v4 = keyDataPolicy_v4
 
 func NewImportableObjectKeySealer(key *tpm2.Public) keySealer {
 	return &importableObjectKeySealer{key}
@@ -121,6 +133,7 @@ type PcrPolicyData_v0 = pcrPolicyData_v0
 type PcrPolicyData_v1 = pcrPolicyData_v1
 type PcrPolicyData_v2 = pcrPolicyData_v2
 type PcrPolicyData_v3 = pcrPolicyData_v3
+type PcrPolicyData_v4 = pcrPolicyData_v4
 
 type PcrPolicyParams = pcrPolicyParams
 
@@ -134,12 +147,41 @@ func NewPcrPolicyParams(key secboot.PrimaryKey, pcrs tpm2.PCRSelectionList, pcrD
 	}
 }
 
+func NewPcrPolicyParamsWithFallbackPCRs(key secboot.PrimaryKey, pcrs tpm2.PCRSelectionList, pcrDigests tpm2.DigestList, fallbackPCRs []PCRBankDigests, policyCounterName tpm2.Name, policySequence uint64) *PcrPolicyParams {
+	params := NewPcrPolicyParams(key, pcrs, pcrDigests, policyCounterName, policySequence)
+	params.fallbackPCRs = fallbackPCRs
+	return params
+}
+
 type PlatformKeyDataHandler = platformKeyDataHandler
 type SealedKeyDataBase = sealedKeyDataBase
 type SnapModelHasher = snapModelHasher
 type StaticPolicyData_v0 = staticPolicyData_v0
 type StaticPolicyData_v1 = staticPolicyData_v1
 type StaticPolicyData_v3 = staticPolicyData_v3
+type StaticPolicyData_v4 = staticPolicyData_v4
+type StaticPolicyAssertion = staticPolicyAssertion
+type StaticPolicyAssertions = staticPolicyAssertions
+
+func NewStaticPolicyLocalityAssertion(locality tpm2.Locality) *StaticPolicyAssertion {
+	return newStaticPolicyLocalityAssertion(locality)
+}
+
+func NewStaticPolicySystemdPCRPolicyAssertion(key *tpm2.Public) *StaticPolicyAssertion {
+	return newStaticPolicySystemdPCRPolicyAssertion(key)
+}
+
+func NewStaticPolicyAuthValueIndexAssertion(pub *tpm2.NVPublic) *StaticPolicyAssertion {
+	return newStaticPolicyAuthValueIndexAssertion(pub)
+}
+
+func NewStaticPolicyCounterTimerAssertion(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) *StaticPolicyAssertion {
+	return newStaticPolicyCounterTimerAssertion(operandB, offset, operation)
+}
+
+func (c *TimeConstraints) Assertions() StaticPolicyAssertions {
+	return c.assertions()
+}
 
 // Export some helpers for testing.
 type MockPolicyPCRParam struct {
@@ -183,6 +225,14 @@ func MakeMockPolicyPCRValuesFull(params []MockPolicyPCRParam) (out []tpm2.PCRVal
 	return
 }
 
+func MockSystemdPCRSignaturePath(path string) (restore func()) {
+	orig := systemdPCRSignaturePath
+	systemdPCRSignaturePath = path
+	return func() {
+		systemdPCRSignaturePath = orig
+	}
+}
+
 func MockEnsurePcrPolicyCounter(fn func(*tpm2.TPMContext, tpm2.Handle, *tpm2.Public, tpm2.SessionContext) (*tpm2.NVPublic, error)) (restore func()) {
 	orig := ensurePcrPolicyCounter
 	ensurePcrPolicyCounter = fn
@@ -207,6 +257,38 @@ func MockNewPolicyAuthPublicKey(fn func(authKey secboot.PrimaryKey) (*tpm2.Publi
 	}
 }
 
+func MockSecbootAddLUKS2ContainerUnlockKey(fn func(string, string, secboot.DiskUnlockKey, secboot.DiskUnlockKey) error) (restore func()) {
+	orig := secbootAddLUKS2ContainerUnlockKey
+	secbootAddLUKS2ContainerUnlockKey = fn
+	return func() {
+		secbootAddLUKS2ContainerUnlockKey = orig
+	}
+}
+
+func MockSecbootListLUKS2ContainerRecoveryKeyNames(fn func(string) ([]string, error)) (restore func()) {
+	orig := secbootListLUKS2ContainerRecoveryKeyNames
+	secbootListLUKS2ContainerRecoveryKeyNames = fn
+	return func() {
+		secbootListLUKS2ContainerRecoveryKeyNames = orig
+	}
+}
+
+func MockSecbootListLUKS2ContainerUnlockKeyNames(fn func(string) ([]string, error)) (restore func()) {
+	orig := secbootListLUKS2ContainerUnlockKeyNames
+	secbootListLUKS2ContainerUnlockKeyNames = fn
+	return func() {
+		secbootListLUKS2ContainerUnlockKeyNames = orig
+	}
+}
+
+func MockSecbootNewFileKeyDataWriter(fn func(string) secboot.KeyDataWriter) (restore func()) {
+	orig := secbootNewFileKeyDataWriter
+	secbootNewFileKeyDataWriter = fn
+	return func() {
+		secbootNewFileKeyDataWriter = orig
+	}
+}
+
 func MockSecbootNewKeyData(fn func(*secboot.KeyParams) (*secboot.KeyData, error)) (restore func()) {
 	orig := secbootNewKeyData
 	secbootNewKeyData = fn
@@ -223,6 +305,22 @@ func MockSecbootNewKeyDataWithPassphrase(fn func(*secboot.KeyWithPassphraseParam
 	}
 }
 
+func MockSecbootNewLUKS2KeyDataReader(fn func(string, string) (secboot.KeyDataReader, error)) (restore func()) {
+	orig := secbootNewLUKS2KeyDataReader
+	secbootNewLUKS2KeyDataReader = fn
+	return func() {
+		secbootNewLUKS2KeyDataReader = orig
+	}
+}
+
+func MockSecbootNewLUKS2KeyDataWriter(fn func(string, string) (secboot.KeyDataWriter, error)) (restore func()) {
+	orig := secbootNewLUKS2KeyDataWriter
+	secbootNewLUKS2KeyDataWriter = fn
+	return func() {
+		secbootNewLUKS2KeyDataWriter = orig
+	}
+}
+
 func MockSkdbUpdatePCRProtectionPolicyNoValidate(fn func(*sealedKeyDataBase, *tpm2.TPMContext, secboot.PrimaryKey, *tpm2.NVPublic, *PCRProtectionProfile, PcrPolicyVersionOption) error) (restore func()) {
 	orig := skdbUpdatePCRProtectionPolicyNoValidate
 	skdbUpdatePCRProtectionPolicyNoValidate = fn
@@ -263,3 +361,7 @@ func ValidateKeyDataFile(tpm *tpm2.TPMContext, keyFile string, authKey secboot.P
 
 	return k.Validate(tpm, authKey)
 }
+
+func (p *SignedPCRPolicy) Data() *PcrPolicyData_v3 {
+	return p.data
+}
@@ -99,6 +99,8 @@ func readKeyData(r io.Reader, version uint32) (keyData, error) {
 		return readKeyDataV2(r)
 	case 3:
 		return readKeyDataV3(r)
+	case 4:
+		return readKeyDataV4(r)
 	default:
 		return nil, fmt.Errorf("unexpected version number (%d)", version)
 	}
@@ -106,6 +108,12 @@ func readKeyData(r io.Reader, version uint32) (keyData, error) {
 
 func newKeyData(keyPrivate tpm2.Private, keyPublic *tpm2.Public, importSymSeed tpm2.EncryptedSecret, policy keyDataPolicy) (keyData, error) {
 	switch p := policy.(type) {
+	case *keyDataPolicy_v4:
+		return &keyData_v4{
+			KeyPrivate:       keyPrivate,
+			KeyPublic:        keyPublic,
+			KeyImportSymSeed: importSymSeed,
+			PolicyData:       p}, nil
 	case *keyDataPolicy_v3:
 		return &keyData_v3{
 			KeyPrivate:       keyPrivate,
@@ -173,7 +181,11 @@ func (k *sealedKeyDataBase) validateData(tpm *tpm2.TPMContext, role string) (*tp
 		return nil, keyDataError{errors.New("sealed key object has the wrong attributes")}
 	}
 
-	srk, err := tpm.CreateResourceContextFromTPM(tcg.SRKHandle)
+	srkHandle, err := tcg.SelectSRKHandle(tpm)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot select SRK handle: %w", err)
+	}
+	srk, err := tpm.CreateResourceContextFromTPM(srkHandle)
 	if err != nil {
 		return nil, xerrors.Errorf("cannot create context for SRK: %w", err)
 	}
@@ -181,6 +193,8 @@ func (k *sealedKeyDataBase) validateData(tpm *tpm2.TPMContext, role string) (*tp
 	// Load the sealed data object in to the TPM for integrity checking
 	keyContext, err := k.load(tpm, srk)
 	switch {
+	case isLoadParentMismatchError(err) || isImportParentMismatchError(err):
+		return nil, SRKMismatchError{srkHandle}
 	case isLoadInvalidParamError(err) || isImportInvalidParamError(err):
 		return nil, keyDataError{xerrors.Errorf("cannot load sealed key object into TPM (sealed key object is bad or TPM owner has changed): %w", err)}
 	case err != nil:
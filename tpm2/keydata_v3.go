@@ -96,6 +96,14 @@ func (d *keyData_v3) Imported(priv tpm2.Private) {
 }
 
 func (d *keyData_v3) ValidateData(tpm *tpm2.TPMContext, role []byte) (tpm2.ResourceContext, error) {
+	return d.validateData(tpm, role, nil)
+}
+
+// validateData performs version specific validation of this key data. The
+// supplied assertions are additional assertions that are expected to be
+// part of the sealed key object's authorization policy after the
+// PolicyAuthorize and optional PolicyAuthValue assertions.
+func (d *keyData_v3) validateData(tpm *tpm2.TPMContext, role []byte, assertions staticPolicyAssertions) (tpm2.ResourceContext, error) {
 	if d.KeyImportSymSeed != nil {
 		return nil, errors.New("cannot validate importable key data")
 	}
@@ -150,6 +158,9 @@ func (d *keyData_v3) ValidateData(tpm *tpm2.TPMContext, role []byte) (tpm2.Resou
 	if d.PolicyData.StaticData.RequireAuthValue {
 		trial.PolicyAuthValue()
 	}
+	if err := assertions.addToTrial(d.KeyPublic.NameAlg, trial); err != nil {
+		return nil, keyDataError{xerrors.Errorf("cannot compute static authorization policy: %w", err)}
+	}
 
 	if !bytes.Equal(trial.GetDigest(), d.KeyPublic.AuthPolicy) {
 		return nil, keyDataError{errors.New("the sealed key object's authorization policy is inconsistent with the associated metadata or persistent TPM resources")}
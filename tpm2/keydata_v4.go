@@ -0,0 +1,128 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"errors"
+	"io"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+// keyData_v4 represents version 4 of keyData. The only difference between
+// v3 and v4 is support for additional static policy assertions. Version 4
+// is only used for keys that require these - other keys are created as v3.
+type keyData_v4 struct {
+	KeyPrivate       tpm2.Private
+	KeyPublic        *tpm2.Public
+	KeyImportSymSeed tpm2.EncryptedSecret
+	PolicyData       *keyDataPolicy_v4
+}
+
+func readKeyDataV4(r io.Reader) (keyData, error) {
+	var d *keyData_v4
+	if _, err := mu.UnmarshalFromReader(r, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// asV3 returns a version 3 view of this key data, which doesn't include
+// the additional static policy assertions.
+func (d *keyData_v4) asV3() *keyData_v3 {
+	return &keyData_v3{
+		KeyPrivate:       d.KeyPrivate,
+		KeyPublic:        d.KeyPublic,
+		KeyImportSymSeed: d.KeyImportSymSeed,
+		PolicyData:       d.PolicyData.asV3()}
+}
+
+func (d *keyData_v4) Version() uint32 {
+	return 4
+}
+
+func (d *keyData_v4) Private() tpm2.Private {
+	return d.KeyPrivate
+}
+
+func (d *keyData_v4) SetPrivate(priv tpm2.Private) {
+	d.KeyPrivate = priv
+}
+
+func (d *keyData_v4) Public() *tpm2.Public {
+	return d.KeyPublic
+}
+
+func (d *keyData_v4) ImportSymSeed() tpm2.EncryptedSecret {
+	return d.KeyImportSymSeed
+}
+
+func (d *keyData_v4) Imported(priv tpm2.Private) {
+	if d.KeyImportSymSeed == nil {
+		panic("does not need to be imported")
+	}
+	d.KeyPrivate = priv
+	d.KeyImportSymSeed = nil
+}
+
+func (d *keyData_v4) ValidateData(tpm *tpm2.TPMContext, role []byte) (tpm2.ResourceContext, error) {
+	_, static := d.PolicyData.StaticData.Assertions.split()
+	pcrPolicyCounter, err := d.asV3().validateData(tpm, role, static)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure that the NV index that the authorization value is bound to exists.
+	if pub := static.authValueIndex(); pub != nil {
+		if pub.Index.Type() != tpm2.HandleTypeNVIndex {
+			return nil, keyDataError{errors.New("authorization value NV index handle is invalid")}
+		}
+		if _, err := newAuthValueIndexContext(tpm, pub); err != nil {
+			if isPolicyDataError(err) {
+				return nil, keyDataError{err}
+			}
+			return nil, xerrors.Errorf("cannot create context for authorization value NV index: %w", err)
+		}
+	}
+
+	return pcrPolicyCounter, nil
+}
+
+func (d *keyData_v4) Write(w io.Writer) error {
+	_, err := mu.MarshalToWriter(w, d)
+	return err
+}
+
+func (d *keyData_v4) Policy() keyDataPolicy {
+	return d.PolicyData
+}
+
+// Decrypt decrypts the supplied payload. Version 4 uses the same AAD as
+// version 3. A version 4 key can't be downgraded to version 3 because
+// the sealed object's authorization policy includes the additional static
+// policy assertions.
+func (d *keyData_v4) Decrypt(key, payload []byte, generation uint32, kdfAlg tpm2.HashAlgorithmId, authMode secboot.AuthMode) ([]byte, error) {
+	return d.asV3().Decrypt(key, payload, generation, kdfAlg, authMode)
+}
@@ -0,0 +1,127 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"bytes"
+	"math/rand"
+
+	"github.com/canonical/go-tpm2"
+	tpm2_testutil "github.com/canonical/go-tpm2/testutil"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/tcg"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type keyDataV4Suite struct {
+	tpm2test.TPMTest
+	policyV3Mixin
+
+	primary tpm2.ResourceContext
+}
+
+func (s *keyDataV4Suite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy | tpm2test.TPMFeatureNV
+}
+
+func (s *keyDataV4Suite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+
+	primary := s.CreateStoragePrimaryKeyRSA(c)
+	s.primary = s.EvictControl(c, tpm2.HandleOwner, primary, tcg.SRKHandle)
+}
+
+func (s *keyDataV4Suite) newMockKeyData(c *C, role string, locality tpm2.Locality) KeyData {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+
+	authPublicKey := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	template := tpm2_testutil.NewSealedObjectTemplate()
+
+	policyData, policyDigest, err := NewKeyDataPolicy(template.NameAlg, authPublicKey, role, nil, false)
+	c.Assert(err, IsNil)
+	policyData, policyDigest, err = NewKeyDataPolicyV4(template.NameAlg, policyData, policyDigest,
+		StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(locality)})
+	c.Assert(err, IsNil)
+	c.Assert(policyData, testutil.ConvertibleTo, &KeyDataPolicy_v4{})
+
+	template.AuthPolicy = policyDigest
+
+	sensitive := tpm2.SensitiveCreate{Data: []byte("secret data")}
+
+	priv, pub, _, _, _, err := s.TPM().Create(s.primary, &sensitive, template, nil, nil, nil)
+	c.Assert(err, IsNil)
+
+	data, err := NewKeyData(priv, pub, nil, policyData)
+	c.Assert(err, IsNil)
+	return data
+}
+
+var _ = Suite(&keyDataV4Suite{})
+
+func (s *keyDataV4Suite) TestVersion(c *C) {
+	data := s.newMockKeyData(c, "", tpm2.LocalityZero)
+	c.Check(data.Version(), Equals, uint32(4))
+}
+
+func (s *keyDataV4Suite) TestValidateOK(c *C) {
+	data := s.newMockKeyData(c, "foo", tpm2.LocalityThree|tpm2.LocalityFour)
+
+	pcrPolicyCounter, err := data.ValidateData(s.TPM().TPMContext, []byte("foo"))
+	c.Check(err, IsNil)
+	c.Check(pcrPolicyCounter, IsNil)
+}
+
+func (s *keyDataV4Suite) TestValidateWrongLocality(c *C) {
+	data := s.newMockKeyData(c, "foo", tpm2.LocalityThree)
+
+	*data.(*KeyData_v4).PolicyData.StaticData.Assertions[0].Data.Locality = tpm2.LocalityZero
+
+	_, err := data.ValidateData(s.TPM().TPMContext, []byte("foo"))
+	c.Check(err, testutil.ConvertibleTo, KeyDataError{})
+	c.Check(err, ErrorMatches, "the sealed key object's authorization policy is inconsistent with the associated metadata or persistent TPM resources")
+}
+
+func (s *keyDataV4Suite) TestValidateMissingAssertions(c *C) {
+	data := s.newMockKeyData(c, "foo", tpm2.LocalityZero)
+
+	data.(*KeyData_v4).PolicyData.StaticData.Assertions = nil
+
+	_, err := data.ValidateData(s.TPM().TPMContext, []byte("foo"))
+	c.Check(err, testutil.ConvertibleTo, KeyDataError{})
+	c.Check(err, ErrorMatches, "the sealed key object's authorization policy is inconsistent with the associated metadata or persistent TPM resources")
+}
+
+func (s *keyDataV4Suite) TestSerialization(c *C) {
+	data1 := s.newMockKeyData(c, "foo", tpm2.LocalityThree|tpm2.LocalityFour)
+
+	buf := new(bytes.Buffer)
+	c.Check(data1.Write(buf), IsNil)
+
+	data2, err := ReadKeyDataV4(buf)
+	c.Assert(err, IsNil)
+	c.Check(data2, tpm2_testutil.TPMValueDeepEquals, data1)
+}
@@ -0,0 +1,288 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+var (
+	secbootAddLUKS2ContainerUnlockKey         = secboot.AddLUKS2ContainerUnlockKey
+	secbootListLUKS2ContainerUnlockKeyNames   = secboot.ListLUKS2ContainerUnlockKeyNames
+	secbootListLUKS2ContainerRecoveryKeyNames = secboot.ListLUKS2ContainerRecoveryKeyNames
+	secbootNewLUKS2KeyDataWriter              = func(devicePath, name string) (secboot.KeyDataWriter, error) {
+		return secboot.NewLUKS2KeyDataWriter(devicePath, name)
+	}
+)
+
+// MigrateSealedKeyObjectParams provides arguments for MigrateSealedKeyObjectFile.
+type MigrateSealedKeyObjectParams struct {
+	// ProtectKeyParams provides the parameters for the new sealed key data.
+	// The PCR policy of a legacy sealed key object can't be copied to the new
+	// key, so the PCRProfile field must be set to the profile that the legacy
+	// key is currently sealed with.
+	//
+	// If the PrimaryKey field is nil, the private part of the key used for
+	// authorizing PCR policy updates for the legacy key is used as the primary
+	// key for the new key, so that the caller can continue to use the key that
+	// it already has. A new primary key is created for version 0 keys.
+	//
+	// If the PCRPolicyCounterHandle field is not tpm2.HandleNull, it must be
+	// different to the handle used by the legacy key.
+	ProtectKeyParams
+
+	// DevicePath is the path of the LUKS2 container that the legacy key
+	// unlocks.
+	DevicePath string
+
+	// KeyslotName is the name of the new keyslot and the KeyData token that
+	// the new key is stored in. It must not already exist.
+	KeyslotName string
+
+	// RemoveLegacyKey indicates that the legacy key file should be removed
+	// once the new key has been stored.
+	RemoveLegacyKey bool
+
+	// LegacyPCRPolicyCounterKeyPaths contains the paths of every legacy key
+	// file that uses the same PCR policy counter as the legacy key, including
+	// the legacy key itself. Legacy keys that were created together, such as
+	// with SealKeyToTPMMultiple, share a PCR policy counter.
+	//
+	// If RemoveLegacyKey is set and every other file in this list has already
+	// been removed, the PCR policy counter is deleted, which revokes the PCR
+	// policies of every key that uses it. If this is empty or any of the other
+	// files still exist, the PCR policy counter is left in place so that the
+	// other legacy keys remain usable.
+	LegacyPCRPolicyCounterKeyPaths []string
+}
+
+// MigrateSealedKeyObjectFile migrates the legacy sealed key object file at the
+// supplied path (created by SealKeyToTPM or one of the related APIs) to a new
+// TPM sealed key data that is stored in a named LUKS2 KeyData token.
+//
+// The legacy key is unsealed from the TPM, so the current PCR values must satisfy
+// its PCR policy. A new key is then created with NewTPMProtectedKey using the
+// parameters supplied via the params argument, and added to the LUKS2 container
+// at the supplied device path as a new keyslot and token with the supplied name,
+// using the legacy key to authorize this. The keyslot for the legacy key is not
+// removed. If the keyslot can't be added, the PCR policy counter created for the
+// new key is deleted.
+//
+// If the keyslot has been added but the new key data can't be written to its token,
+// the new key data and its primary key are returned along with the error so that
+// the caller can store it, as the new keyslot can't otherwise be used.
+//
+// If the RemoveLegacyKey field of the params argument is set, the legacy key file
+// is removed. The PCR policy counter associated with the legacy key is deleted as
+// well if the LegacyPCRPolicyCounterKeyPaths field indicates that no other legacy
+// key uses it. This requires knowledge of the authorization value for the storage
+// hierarchy, which must be provided by calling Connection.OwnerHandleContext().SetAuthValue()
+// prior to calling this function. If the wrong value is provided for the storage
+// hierarchy authorization, then a AuthFailError error will be returned. If this
+// fails, the new key has already been stored and the legacy key remains usable. In
+// this case, the new key data and its primary key are returned along with the error,
+// as the primary key may have been newly created.
+//
+// On success, this returns the new key data and its primary key.
+func MigrateSealedKeyObjectFile(tpm *Connection, path string, params *MigrateSealedKeyObjectParams) (protectedKey *secboot.KeyData, primaryKey secboot.PrimaryKey, err error) {
+	// params is mandatory.
+	if params == nil {
+		return nil, nil, errors.New("no MigrateSealedKeyObjectParams provided")
+	}
+	if params.DevicePath == "" || params.KeyslotName == "" {
+		return nil, nil, errors.New("no device path or keyslot name provided")
+	}
+
+	removeLegacyCounter := false
+	if params.RemoveLegacyKey && len(params.LegacyPCRPolicyCounterKeyPaths) > 0 {
+		removeLegacyCounter, err = legacyPcrPolicyCounterIsUnused(path, params.LegacyPCRPolicyCounterKeyPaths)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := checkLUKS2KeyslotNameIsUnused(params.DevicePath, params.KeyslotName); err != nil {
+		return nil, nil, err
+	}
+
+	k, err := ReadSealedKeyObjectFromFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	legacyCounterHandle := k.PCRPolicyCounterHandle()
+	if legacyCounterHandle != tpm2.HandleNull && params.PCRPolicyCounterHandle == legacyCounterHandle {
+		return nil, nil, errors.New("the PCR policy counter handle is already used by the legacy key")
+	}
+
+	legacyKey, authKey, err := k.UnsealFromTPM(tpm)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot unseal legacy key: %w", err)
+	}
+
+	protectParams := params.ProtectKeyParams
+	if protectParams.PrimaryKey == nil {
+		protectParams.PrimaryKey = authKey
+	}
+
+	protectedKey, primaryKey, unlockKey, err := NewTPMProtectedKey(tpm, &protectParams)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot create new key: %w", err)
+	}
+
+	if err := secbootAddLUKS2ContainerUnlockKey(params.DevicePath, params.KeyslotName, legacyKey, unlockKey); err != nil {
+		// The new key can't be used, so don't leak its PCR policy counter.
+		removePcrPolicyCounter(tpm, protectParams.PCRPolicyCounterHandle)
+		return nil, nil, xerrors.Errorf("cannot add keyslot for new key: %w", err)
+	}
+
+	// The new keyslot has been added, so return the new key if it can't be
+	// stored in order for the caller to be able to recover.
+	w, err := secbootNewLUKS2KeyDataWriter(params.DevicePath, params.KeyslotName)
+	if err != nil {
+		return protectedKey, primaryKey, xerrors.Errorf("cannot create key data writer: %w", err)
+	}
+	if err := protectedKey.WriteAtomic(w); err != nil {
+		return protectedKey, primaryKey, xerrors.Errorf("cannot write new key data: %w", err)
+	}
+
+	if !params.RemoveLegacyKey {
+		return protectedKey, primaryKey, nil
+	}
+
+	// The new key has been stored, so return it if removing the legacy key fails.
+	if removeLegacyCounter && legacyCounterHandle != tpm2.HandleNull {
+		if err := removeLegacyPcrPolicyCounter(tpm, legacyCounterHandle); err != nil {
+			return protectedKey, primaryKey, err
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return protectedKey, primaryKey, xerrors.Errorf("cannot remove legacy key file: %w", err)
+	}
+
+	return protectedKey, primaryKey, nil
+}
+
+// checkLUKS2KeyslotNameIsUnused returns an error if a keyslot with the supplied name
+// already exists on the LUKS2 container at the supplied path.
+func checkLUKS2KeyslotNameIsUnused(devicePath, name string) error {
+	for _, list := range []func(string) ([]string, error){
+		secbootListLUKS2ContainerUnlockKeyNames,
+		secbootListLUKS2ContainerRecoveryKeyNames,
+	} {
+		names, err := list(devicePath)
+		if err != nil {
+			return xerrors.Errorf("cannot list existing keyslots: %w", err)
+		}
+		for _, n := range names {
+			if n == name {
+				return fmt.Errorf("a keyslot with the name %q already exists", name)
+			}
+		}
+	}
+	return nil
+}
+
+// legacyPcrPolicyCounterIsUnused indicates whether the PCR policy counter of the legacy
+// key at the supplied path can be deleted, based on the supplied paths of every legacy
+// key that uses it. It can be deleted if every other key has already been removed.
+func legacyPcrPolicyCounterIsUnused(path string, paths []string) (bool, error) {
+	found := false
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, errors.New("the legacy PCR policy counter key paths don't include the legacy key")
+	}
+
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			continue
+		}
+		_, err := os.Stat(p)
+		switch {
+		case os.IsNotExist(err):
+			// This key has already been removed.
+		case err != nil:
+			return false, xerrors.Errorf("cannot determine if legacy key %s exists: %w", p, err)
+		default:
+			// Another key still uses the counter.
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// removePcrPolicyCounter deletes the PCR policy counter created for a new key that
+// can't be used. This is best effort - errors are ignored.
+func removePcrPolicyCounter(tpm *Connection, handle tpm2.Handle) {
+	if handle == tpm2.HandleNull {
+		return
+	}
+	index, err := tpm.CreateResourceContextFromTPM(handle)
+	if err != nil {
+		return
+	}
+	tpm.NVUndefineSpace(tpm.OwnerHandleContext(), index, tpm.HmacSession())
+}
+
+// removeLegacyPcrPolicyCounter deletes the PCR policy counter with the supplied
+// handle that was used by legacy keys, which revokes all of their PCR policies.
+// It does nothing if the counter doesn't exist.
+func removeLegacyPcrPolicyCounter(tpm *Connection, handle tpm2.Handle) error {
+	index, err := tpm.CreateResourceContextFromTPM(handle)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, handle):
+		return nil
+	case err != nil:
+		return xerrors.Errorf("cannot create context for legacy PCR policy counter: %w", err)
+	}
+
+	pub, _, err := tpm.NVReadPublic(index)
+	if err != nil {
+		return xerrors.Errorf("cannot read public area of legacy PCR policy counter: %w", err)
+	}
+	if pub.Attrs.Type() != tpm2.NVTypeCounter {
+		return errors.New("the NV index associated with the legacy key is not a counter")
+	}
+
+	if err := tpm.NVUndefineSpace(tpm.OwnerHandleContext(), index, tpm.HmacSession()); err != nil {
+		if isAuthFailError(err, tpm2.CommandNVUndefineSpace, 1) {
+			return AuthFailError{tpm2.HandleOwner}
+		}
+		return xerrors.Errorf("cannot remove legacy PCR policy counter: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,428 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/canonical/go-tpm2"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type migrateLegacySuiteNoTPM struct{}
+
+type migrateLegacySuite struct {
+	tpm2test.TPMTest
+
+	devicePath  string
+	keyslotName string
+	existingKey secboot.DiskUnlockKey
+	newKey      secboot.DiskUnlockKey
+	writer      *mockKeyDataWriter
+}
+
+func (s *migrateLegacySuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureEndorsementHierarchy |
+		tpm2test.TPMFeaturePCR |
+		tpm2test.TPMFeatureNV
+}
+
+func (s *migrateLegacySuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+
+	s.devicePath = ""
+	s.keyslotName = ""
+	s.existingKey = nil
+	s.newKey = nil
+	s.writer = nil
+
+	s.AddCleanup(MockSecbootAddLUKS2ContainerUnlockKey(func(devicePath, keyslotName string, existingKey, newKey secboot.DiskUnlockKey) error {
+		s.devicePath = devicePath
+		s.keyslotName = keyslotName
+		s.existingKey = existingKey
+		s.newKey = newKey
+		return nil
+	}))
+	s.AddCleanup(MockSecbootListLUKS2ContainerUnlockKeyNames(func(devicePath string) ([]string, error) {
+		return []string{"legacy"}, nil
+	}))
+	s.AddCleanup(MockSecbootListLUKS2ContainerRecoveryKeyNames(func(devicePath string) ([]string, error) {
+		return []string{"recovery"}, nil
+	}))
+	s.AddCleanup(MockSecbootNewLUKS2KeyDataWriter(func(devicePath, name string) (secboot.KeyDataWriter, error) {
+		c.Check(devicePath, Equals, s.devicePath)
+		c.Check(name, Equals, s.keyslotName)
+		s.writer = newMockKeyDataWriter()
+		return s.writer, nil
+	}))
+}
+
+var _ = Suite(&migrateLegacySuiteNoTPM{})
+var _ = Suite(&migrateLegacySuite{})
+
+func (s *migrateLegacySuiteNoTPM) TestMigrateNoParams(c *C) {
+	_, _, err := MigrateSealedKeyObjectFile(nil, "/foo", nil)
+	c.Check(err, ErrorMatches, `no MigrateSealedKeyObjectParams provided`)
+}
+
+func (s *migrateLegacySuiteNoTPM) TestMigrateNoDevicePath(c *C) {
+	_, _, err := MigrateSealedKeyObjectFile(nil, "/foo", &MigrateSealedKeyObjectParams{KeyslotName: "default"})
+	c.Check(err, ErrorMatches, `no device path or keyslot name provided`)
+}
+
+func (s *migrateLegacySuiteNoTPM) TestMigrateNoKeyslotName(c *C) {
+	_, _, err := MigrateSealedKeyObjectFile(nil, "/foo", &MigrateSealedKeyObjectParams{DevicePath: "/dev/sda1"})
+	c.Check(err, ErrorMatches, `no device path or keyslot name provided`)
+}
+
+func (s *migrateLegacySuiteNoTPM) TestMigrateMissingFile(c *C) {
+	_, _, err := MigrateSealedKeyObjectFile(nil, filepath.Join(c.MkDir(), "keydata"), &MigrateSealedKeyObjectParams{
+		DevicePath:  "/dev/sda1",
+		KeyslotName: "default"})
+	var e *os.PathError
+	c.Check(errors.As(err, &e), testutil.IsTrue)
+}
+
+func (s *migrateLegacySuite) newLegacyKey(c *C, handle tpm2.Handle) (path string, key secboot.DiskUnlockKey, authKey secboot.PrimaryKey) {
+	key = make(secboot.DiskUnlockKey, 32)
+	rand.Read(key)
+	path = filepath.Join(c.MkDir(), "keydata")
+
+	authKey, err := SealKeyToTPM(s.TPM(), key, path, &KeyCreationParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: handle})
+	c.Assert(err, IsNil)
+
+	return path, key, authKey
+}
+
+func (s *migrateLegacySuite) checkNewKey(c *C, k *secboot.KeyData, primaryKey secboot.PrimaryKey) {
+	c.Assert(s.writer, NotNil)
+	written, err := secboot.ReadKeyData(s.writer.Reader())
+	c.Assert(err, IsNil)
+
+	unlockKey, recoveredPrimaryKey, err := written.RecoverKeys()
+	c.Check(err, IsNil)
+	c.Check(unlockKey, DeepEquals, s.newKey)
+	c.Check(recoveredPrimaryKey, DeepEquals, primaryKey)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	c.Check(skd.Version(), Equals, uint32(3))
+	c.Check(skd.Validate(s.TPM().TPMContext, primaryKey), IsNil)
+}
+
+func (s *migrateLegacySuite) TestMigrate(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+	path, key, authKey := s.newLegacyKey(c, legacyHandle)
+	handle := s.NextAvailableHandle(c, 0x01810000)
+
+	k, primaryKey, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			Role:                   "run",
+			PCRPolicyCounterHandle: handle},
+		DevicePath:  "/dev/sda1",
+		KeyslotName: "default"})
+	c.Assert(err, IsNil)
+	c.Check(primaryKey, DeepEquals, authKey)
+	c.Check(k.Role(), Equals, "run")
+
+	c.Check(s.devicePath, Equals, "/dev/sda1")
+	c.Check(s.keyslotName, Equals, "default")
+	c.Check(s.existingKey, DeepEquals, key)
+	s.checkNewKey(c, k, primaryKey)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	c.Check(skd.PCRPolicyCounterHandle(), Equals, handle)
+
+	// The legacy key should be untouched.
+	c.Check(s.TPM().DoesHandleExist(legacyHandle), testutil.IsTrue)
+	_, err = os.Stat(path)
+	c.Check(err, IsNil)
+}
+
+func (s *migrateLegacySuite) TestMigrateWithPrimaryKey(c *C) {
+	path, _, authKey := s.newLegacyKey(c, tpm2.HandleNull)
+
+	suppliedPrimaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(suppliedPrimaryKey)
+
+	k, primaryKey, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull,
+			PrimaryKey:             suppliedPrimaryKey},
+		DevicePath:  "/dev/sda1",
+		KeyslotName: "default"})
+	c.Assert(err, IsNil)
+	c.Check(primaryKey, DeepEquals, suppliedPrimaryKey)
+	c.Check(primaryKey, Not(DeepEquals), authKey)
+	s.checkNewKey(c, k, primaryKey)
+}
+
+func (s *migrateLegacySuite) TestMigrateRemoveLegacyKey(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+	path, _, _ := s.newLegacyKey(c, legacyHandle)
+
+	k, primaryKey, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000)},
+		DevicePath:      "/dev/sda1",
+		KeyslotName:     "default",
+		RemoveLegacyKey: true})
+	c.Assert(err, IsNil)
+	s.checkNewKey(c, k, primaryKey)
+
+	// The counter may be shared with other legacy keys, so it should
+	// not be removed without LegacyPCRPolicyCounterKeyPaths.
+	c.Check(s.TPM().DoesHandleExist(legacyHandle), testutil.IsTrue)
+	_, err = os.Stat(path)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *migrateLegacySuite) TestMigrateRemoveLegacyKeyAndCounter(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+	path, _, _ := s.newLegacyKey(c, legacyHandle)
+	otherPath := filepath.Join(c.MkDir(), "keydata")
+
+	k, primaryKey, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000)},
+		DevicePath:                     "/dev/sda1",
+		KeyslotName:                    "default",
+		RemoveLegacyKey:                true,
+		LegacyPCRPolicyCounterKeyPaths: []string{path, otherPath}})
+	c.Assert(err, IsNil)
+	s.checkNewKey(c, k, primaryKey)
+
+	c.Check(s.TPM().DoesHandleExist(legacyHandle), testutil.IsFalse)
+	_, err = os.Stat(path)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *migrateLegacySuite) TestMigrateRemoveLegacyKeySharedCounter(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+
+	dir := c.MkDir()
+	paths := []string{filepath.Join(dir, "keydata1"), filepath.Join(dir, "keydata2")}
+	_, err := SealKeyToTPMMultiple(s.TPM(), []*SealKeyRequest{
+		{Key: make(secboot.DiskUnlockKey, 32), Path: paths[0]},
+		{Key: make(secboot.DiskUnlockKey, 32), Path: paths[1]}},
+		&KeyCreationParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: legacyHandle})
+	c.Assert(err, IsNil)
+
+	_, _, err = MigrateSealedKeyObjectFile(s.TPM(), paths[0], &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000)},
+		DevicePath:                     "/dev/sda1",
+		KeyslotName:                    "default",
+		RemoveLegacyKey:                true,
+		LegacyPCRPolicyCounterKeyPaths: paths})
+	c.Assert(err, IsNil)
+
+	// The other legacy key still uses the counter.
+	c.Check(s.TPM().DoesHandleExist(legacyHandle), testutil.IsTrue)
+	_, err = os.Stat(paths[0])
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+
+	other, err := ReadSealedKeyObjectFromFile(paths[1])
+	c.Assert(err, IsNil)
+	_, _, err = other.UnsealFromTPM(s.TPM())
+	c.Check(err, IsNil)
+}
+
+func (s *migrateLegacySuiteNoTPM) TestMigrateLegacyPCRPolicyCounterKeyPathsMissingKey(c *C) {
+	dir := c.MkDir()
+	_, _, err := MigrateSealedKeyObjectFile(nil, filepath.Join(dir, "keydata1"), &MigrateSealedKeyObjectParams{
+		DevicePath:                     "/dev/sda1",
+		KeyslotName:                    "default",
+		RemoveLegacyKey:                true,
+		LegacyPCRPolicyCounterKeyPaths: []string{filepath.Join(dir, "keydata2")}})
+	c.Check(err, ErrorMatches, `the legacy PCR policy counter key paths don't include the legacy key`)
+}
+
+func (s *migrateLegacySuite) TestMigrateKeyslotNameExists(c *C) {
+	path, _, _ := s.newLegacyKey(c, tpm2.HandleNull)
+
+	_, _, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		DevicePath:  "/dev/sda1",
+		KeyslotName: "recovery"})
+	c.Check(err, ErrorMatches, `a keyslot with the name "recovery" already exists`)
+	c.Check(s.existingKey, IsNil)
+}
+
+func (s *migrateLegacySuite) TestMigrateRemoveLegacyKeyNoCounter(c *C) {
+	path, _, _ := s.newLegacyKey(c, tpm2.HandleNull)
+
+	_, _, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		DevicePath:      "/dev/sda1",
+		KeyslotName:     "default",
+		RemoveLegacyKey: true})
+	c.Assert(err, IsNil)
+
+	_, err = os.Stat(path)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *migrateLegacySuite) TestMigrateSameCounterHandle(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+	path, _, _ := s.newLegacyKey(c, legacyHandle)
+
+	_, _, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: legacyHandle},
+		DevicePath:  "/dev/sda1",
+		KeyslotName: "default"})
+	c.Check(err, ErrorMatches, `the PCR policy counter handle is already used by the legacy key`)
+}
+
+func (s *migrateLegacySuite) TestMigrateUnsealError(c *C) {
+	path, _, _ := s.newLegacyKey(c, tpm2.HandleNull)
+
+	_, err := s.TPM().PCREvent(s.TPM().PCRHandleContext(7), tpm2.Event("foo"), nil)
+	c.Check(err, IsNil)
+
+	_, _, err = MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		DevicePath:  "/dev/sda1",
+		KeyslotName: "default"})
+	c.Check(err, ErrorMatches, `cannot unseal legacy key: invalid key data: .*`)
+	c.Check(s.existingKey, IsNil)
+}
+
+func (s *migrateLegacySuite) TestMigrateAddKeyslotError(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+	path, _, _ := s.newLegacyKey(c, legacyHandle)
+
+	handle := s.NextAvailableHandle(c, 0x01810000)
+
+	s.AddCleanup(MockSecbootAddLUKS2ContainerUnlockKey(func(devicePath, keyslotName string, existingKey, newKey secboot.DiskUnlockKey) error {
+		c.Check(s.TPM().DoesHandleExist(handle), testutil.IsTrue)
+		return errors.New("some error")
+	}))
+
+	_, _, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: handle},
+		DevicePath:                     "/dev/sda1",
+		KeyslotName:                    "default",
+		RemoveLegacyKey:                true,
+		LegacyPCRPolicyCounterKeyPaths: []string{path}})
+	c.Check(err, ErrorMatches, `cannot add keyslot for new key: some error`)
+
+	// The new PCR policy counter should have been removed.
+	c.Check(s.TPM().DoesHandleExist(handle), testutil.IsFalse)
+
+	// The legacy key should be untouched.
+	c.Check(s.TPM().DoesHandleExist(legacyHandle), testutil.IsTrue)
+	_, err = os.Stat(path)
+	c.Check(err, IsNil)
+}
+
+func (s *migrateLegacySuite) TestMigrateWriteError(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+	path, _, _ := s.newLegacyKey(c, legacyHandle)
+
+	s.AddCleanup(MockSecbootNewLUKS2KeyDataWriter(func(devicePath, name string) (secboot.KeyDataWriter, error) {
+		return nil, errors.New("some error")
+	}))
+
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k, primaryKey, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: handle},
+		DevicePath:                     "/dev/sda1",
+		KeyslotName:                    "default",
+		RemoveLegacyKey:                true,
+		LegacyPCRPolicyCounterKeyPaths: []string{path}})
+	c.Check(err, ErrorMatches, `cannot create key data writer: some error`)
+
+	// The keyslot has been added, so the new key should be returned.
+	c.Assert(k, NotNil)
+	c.Check(primaryKey, NotNil)
+	c.Check(s.TPM().DoesHandleExist(handle), testutil.IsTrue)
+
+	// The legacy key should be untouched.
+	c.Check(s.TPM().DoesHandleExist(legacyHandle), testutil.IsTrue)
+	_, err = os.Stat(path)
+	c.Check(err, IsNil)
+}
+
+func (s *migrateLegacySuite) TestMigrateRemoveLegacyKeyAuthFail(c *C) {
+	legacyHandle := s.NextAvailableHandle(c, 0x01810000)
+	path, _, _ := s.newLegacyKey(c, legacyHandle)
+
+	s.HierarchyChangeAuth(c, tpm2.HandleOwner, []byte("1234"))
+	s.TPM().OwnerHandleContext().SetAuthValue(nil)
+
+	suppliedPrimaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(suppliedPrimaryKey)
+
+	k, primaryKey, err := MigrateSealedKeyObjectFile(s.TPM(), path, &MigrateSealedKeyObjectParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull,
+			PrimaryKey:             suppliedPrimaryKey},
+		DevicePath:                     "/dev/sda1",
+		KeyslotName:                    "default",
+		RemoveLegacyKey:                true,
+		LegacyPCRPolicyCounterKeyPaths: []string{path}})
+	c.Check(err, Equals, AuthFailError{tpm2.HandleOwner})
+
+	// The new key has been stored, so it should be returned.
+	c.Assert(k, NotNil)
+	c.Check(primaryKey, DeepEquals, suppliedPrimaryKey)
+	s.checkNewKey(c, k, primaryKey)
+
+	// The legacy key should be untouched.
+	c.Check(s.TPM().DoesHandleExist(legacyHandle), testutil.IsTrue)
+	_, err = os.Stat(path)
+	c.Check(err, IsNil)
+}
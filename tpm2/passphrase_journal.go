@@ -0,0 +1,202 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+// JournaledPassphraseChangeParams provides arguments for
+// ChangeKeyDataPassphraseJournaled.
+type JournaledPassphraseChangeParams struct {
+	// JournalPath is the path of the journal file used to make the change
+	// recoverable. It must be on persistent storage and must be the same for
+	// every change of the same key so that an interrupted change can be
+	// completed.
+	JournalPath string
+
+	// Key is the location of the KeyData object to change the passphrase for.
+	Key KeyDataLocation
+
+	// OldPassphrase is the current passphrase.
+	OldPassphrase string
+
+	// NewPassphrase is the new passphrase.
+	NewPassphrase string
+}
+
+// passphraseChangeJournal is the on-disk format of the journal for a passphrase change.
+// It contains the key data from before the change, which doesn't contain any secrets.
+type passphraseChangeJournal struct {
+	Location KeyDataLocation `json:"location"`
+	KeyData  []byte          `json:"keydata"`
+}
+
+func readPassphraseChangeJournal(path string) (*passphraseChangeJournal, error) {
+	var journal *passphraseChangeJournal
+	if err := readJournal(path, &journal); err != nil {
+		return nil, err
+	}
+	if journal == nil {
+		return nil, errors.New("journal is empty")
+	}
+	return journal, nil
+}
+
+// completePassphraseChange changes the passphrase of the key data in the supplied journal,
+// writes the result to the journaled location and then removes the journal. It can be
+// called any number of times for the same journal, because changing the passphrase of
+// the same key data again leaves a NV index that the authorization value is bound to
+// alone if it already has the new value.
+func completePassphraseChange(path string, journal *passphraseChangeJournal, oldPassphrase, newPassphrase string) error {
+	k, err := secboot.ReadKeyData(&keyDataBufferReader{journal.Location.String(), bytes.NewReader(journal.KeyData)})
+	if err != nil {
+		return xerrors.Errorf("cannot decode key data: %w", err)
+	}
+	if err := k.ChangePassphrase(oldPassphrase, newPassphrase); err != nil {
+		return xerrors.Errorf("cannot change passphrase: %w", err)
+	}
+
+	w, err := journal.Location.newWriter()
+	if err != nil {
+		return xerrors.Errorf("cannot create key data writer: %w", err)
+	}
+	if err := k.WriteAtomic(w); err != nil {
+		return xerrors.Errorf("cannot write key data: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return xerrors.Errorf("cannot remove journal: %w", err)
+	}
+
+	return nil
+}
+
+// RecoverPassphraseChangeJournal completes a passphrase change made with
+// ChangeKeyDataPassphraseJournaled that was interrupted, using the journal at the
+// specified path. If the change was interrupted before it was committed, it is
+// rolled back and the key is not modified. If it was interrupted after it was
+// committed, it is rolled forward by changing the passphrase of the journaled
+// copy of the original key data again and writing the result to the key's
+// location. This requires the same old and new passphrases as the interrupted
+// change.
+//
+// If the interrupted change had already changed the authorization value of the
+// NV index that the key's authorization value is bound to (see
+// PassphraseProtectKeyParams.AuthValueIndexHandle), this will count as one
+// authorization failure for the purposes of the TPM's dictionary attack
+// protection.
+//
+// This does nothing if there is no journal at the specified path.
+func RecoverPassphraseChangeJournal(path, oldPassphrase, newPassphrase string) error {
+	if err := removePartialJournals(path); err != nil {
+		return err
+	}
+
+	journal, err := readPassphraseChangeJournal(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return xerrors.Errorf("cannot read journal: %w", err)
+	}
+
+	return completePassphraseChange(path, journal, oldPassphrase, newPassphrase)
+}
+
+// ChangeKeyDataPassphraseJournaled changes the passphrase for a TPM protected KeyData
+// object that is persisted in a file or LUKS2 token, in the same way as
+// secboot.KeyData.ChangePassphrase. Unlike that function, the updated key is persisted
+// by this function, with the help of a journal that makes it possible to complete the
+// change if it is interrupted.
+//
+// This is most useful for keys with an authorization value that is bound to a NV
+// index (see PassphraseProtectKeyParams.AuthValueIndexHandle). Changing the passphrase
+// of these keys revokes every earlier copy of the key data immediately, so an
+// interruption before the new key data is persisted would otherwise leave a key that
+// can't be recovered with either passphrase.
+//
+// The key is read from the supplied location and written to the journal, which is the
+// point at which the change is committed. The passphrase is then changed and the new
+// key data is written back to the location. The journal is removed once the change is
+// complete.
+//
+// If the old passphrase is incorrect, the change is rolled back and an error that wraps
+// secboot.ErrInvalidPassphrase is returned.
+//
+// Before changing the passphrase, any previous change that was interrupted is completed
+// or discarded by calling RecoverPassphraseChangeJournal with the supplied passphrases.
+func ChangeKeyDataPassphraseJournaled(params *JournaledPassphraseChangeParams) error {
+	// params is mandatory.
+	if params == nil {
+		return errors.New("no JournaledPassphraseChangeParams provided")
+	}
+	if params.JournalPath == "" {
+		return errors.New("no journal path provided")
+	}
+	if err := params.Key.validate(); err != nil {
+		return xerrors.Errorf("invalid key location: %w", err)
+	}
+
+	if err := RecoverPassphraseChangeJournal(params.JournalPath, params.OldPassphrase, params.NewPassphrase); err != nil {
+		return xerrors.Errorf("cannot recover interrupted change: %w", err)
+	}
+
+	r, err := params.Key.newReader()
+	if err != nil {
+		return xerrors.Errorf("cannot create key data reader: %w", err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return xerrors.Errorf("cannot read key: %w", err)
+	}
+	k, err := secboot.ReadKeyData(&keyDataBufferReader{params.Key.String(), bytes.NewReader(data)})
+	if err != nil {
+		return xerrors.Errorf("cannot decode key: %w", err)
+	}
+	if k.AuthMode()&secboot.AuthModePassphrase == 0 {
+		return errors.New("cannot change passphrase without setting an initial passphrase")
+	}
+
+	journal := &passphraseChangeJournal{
+		Location: params.Key,
+		KeyData:  data}
+	if err := writeJournal(params.JournalPath, journal); err != nil {
+		return xerrors.Errorf("cannot write journal: %w", err)
+	}
+
+	if err := completePassphraseChange(params.JournalPath, journal, params.OldPassphrase, params.NewPassphrase); err != nil {
+		if xerrors.Is(err, secboot.ErrInvalidPassphrase) {
+			// Nothing has been changed if the old passphrase is wrong,
+			// so roll back the change.
+			os.Remove(params.JournalPath)
+		}
+		return xerrors.Errorf("cannot complete change: %w", err)
+	}
+
+	return nil
+}
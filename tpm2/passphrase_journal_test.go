@@ -0,0 +1,198 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/canonical/go-tpm2"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type passphraseJournalSuiteNoTPM struct{}
+
+var _ = Suite(&passphraseJournalSuiteNoTPM{})
+
+func (s *passphraseJournalSuiteNoTPM) TestChangeNoParams(c *C) {
+	c.Check(ChangeKeyDataPassphraseJournaled(nil), ErrorMatches, `no JournaledPassphraseChangeParams provided`)
+}
+
+func (s *passphraseJournalSuiteNoTPM) TestChangeNoJournalPath(c *C) {
+	c.Check(ChangeKeyDataPassphraseJournaled(&JournaledPassphraseChangeParams{
+		Key: KeyDataLocation{Path: "/foo"}}), ErrorMatches, `no journal path provided`)
+}
+
+func (s *passphraseJournalSuiteNoTPM) TestChangeInvalidLocation(c *C) {
+	c.Check(ChangeKeyDataPassphraseJournaled(&JournaledPassphraseChangeParams{
+		JournalPath: filepath.Join(c.MkDir(), "journal"),
+		Key:         KeyDataLocation{DevicePath: "/dev/sda1"}}), ErrorMatches,
+		`invalid key location: no path or LUKS2 token is specified`)
+}
+
+func (s *passphraseJournalSuiteNoTPM) TestRecoverNoJournal(c *C) {
+	c.Check(RecoverPassphraseChangeJournal(filepath.Join(c.MkDir(), "journal"), "old", "new"), IsNil)
+}
+
+func (s *passphraseJournalSuiteNoTPM) TestRecoverRemovesUncommittedJournal(c *C) {
+	dir := c.MkDir()
+	tmp := filepath.Join(dir, "journal.XXXXXXXXXXXX~")
+	c.Assert(ioutil.WriteFile(tmp, []byte("{"), 0600), IsNil)
+
+	c.Check(RecoverPassphraseChangeJournal(filepath.Join(dir, "journal"), "old", "new"), IsNil)
+	_, err := os.Stat(tmp)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *passphraseJournalSuiteNoTPM) TestRecoverNullJournal(c *C) {
+	path := filepath.Join(c.MkDir(), "journal")
+	c.Assert(ioutil.WriteFile(path, []byte("null"), 0600), IsNil)
+
+	c.Check(RecoverPassphraseChangeJournal(path, "old", "new"), ErrorMatches, `cannot read journal: journal is empty`)
+}
+
+type passphraseJournalSuite struct {
+	tpm2test.TPMTest
+}
+
+func (s *passphraseJournalSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureEndorsementHierarchy |
+		tpm2test.TPMFeatureLockoutHierarchy | // Allow the test fixture to reset the DA counter
+		tpm2test.TPMFeaturePCR |
+		tpm2test.TPMFeatureNV
+}
+
+func (s *passphraseJournalSuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+}
+
+var _ = Suite(&passphraseJournalSuite{})
+
+// newKey creates a passphrase protected key with its authorization value bound to
+// a NV index, saving it to a file in the supplied directory.
+func (s *passphraseJournalSuite) newKey(c *C, dir string) (unlockKey secboot.DiskUnlockKey, location KeyDataLocation) {
+	params := &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		AuthValueIndexHandle: s.NextAvailableHandle(c, 0x0181fff0)}
+
+	k, _, unlockKey, err := NewTPMPassphraseProtectedKey(s.TPM(), params, "passphrase")
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(dir, "key")
+	c.Assert(k.WriteAtomic(secboot.NewFileKeyDataWriter(path)), IsNil)
+	return unlockKey, KeyDataLocation{Path: path}
+}
+
+func (s *passphraseJournalSuite) readKey(c *C, location KeyDataLocation) *secboot.KeyData {
+	r, err := secboot.NewFileKeyDataReader(location.Path)
+	c.Assert(err, IsNil)
+	k, err := secboot.ReadKeyData(r)
+	c.Assert(err, IsNil)
+	return k
+}
+
+func (s *passphraseJournalSuite) TestChange(c *C) {
+	dir := c.MkDir()
+	unlockKey, location := s.newKey(c, dir)
+	oldKey := s.readKey(c, location)
+
+	journalPath := filepath.Join(dir, "journal")
+	c.Check(ChangeKeyDataPassphraseJournaled(&JournaledPassphraseChangeParams{
+		JournalPath:   journalPath,
+		Key:           location,
+		OldPassphrase: "passphrase",
+		NewPassphrase: "1234"}), IsNil)
+
+	unlockKeyUnsealed, _, err := s.readKey(c, location).RecoverKeysWithPassphrase("1234")
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+
+	_, _, err = oldKey.RecoverKeysWithPassphrase("passphrase")
+	c.Check(err, Equals, secboot.ErrInvalidPassphrase)
+
+	_, err = os.Stat(journalPath)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *passphraseJournalSuite) TestChangeWrongPassphrase(c *C) {
+	dir := c.MkDir()
+	unlockKey, location := s.newKey(c, dir)
+
+	journalPath := filepath.Join(dir, "journal")
+	err := ChangeKeyDataPassphraseJournaled(&JournaledPassphraseChangeParams{
+		JournalPath:   journalPath,
+		Key:           location,
+		OldPassphrase: "foo",
+		NewPassphrase: "1234"})
+	c.Check(err, ErrorMatches, `cannot complete change: cannot change passphrase: the supplied passphrase is incorrect`)
+
+	// The change should have been rolled back.
+	_, err = os.Stat(journalPath)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+
+	unlockKeyUnsealed, _, err := s.readKey(c, location).RecoverKeysWithPassphrase("passphrase")
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+}
+
+func (s *passphraseJournalSuite) TestChangeInterruptedAndRecovered(c *C) {
+	dir := c.MkDir()
+	unlockKey, location := s.newKey(c, dir)
+
+	// Fail to write the new key, which simulates an interruption after the
+	// NV index has been changed.
+	restore := MockSecbootNewFileKeyDataWriter(func(path string) secboot.KeyDataWriter {
+		return &mockFailingKeyDataWriter{secboot.NewFileKeyDataWriter(path)}
+	})
+	journalPath := filepath.Join(dir, "journal")
+	err := ChangeKeyDataPassphraseJournaled(&JournaledPassphraseChangeParams{
+		JournalPath:   journalPath,
+		Key:           location,
+		OldPassphrase: "passphrase",
+		NewPassphrase: "1234"})
+	restore()
+	c.Check(err, ErrorMatches, `cannot complete change: cannot write key data: cannot commit keydata: interrupted`)
+
+	// The key on disk can't be used with either passphrase now.
+	_, _, err = s.readKey(c, location).RecoverKeysWithPassphrase("passphrase")
+	c.Check(err, Equals, secboot.ErrInvalidPassphrase)
+	_, err = os.Stat(journalPath)
+	c.Check(err, IsNil)
+
+	c.Check(RecoverPassphraseChangeJournal(journalPath, "passphrase", "1234"), IsNil)
+
+	unlockKeyUnsealed, _, err := s.readKey(c, location).RecoverKeysWithPassphrase("1234")
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	_, err = os.Stat(journalPath)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
@@ -0,0 +1,281 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"bytes"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+const (
+	ownerNVIndexFirst tpm2.Handle = 0x01800000 // First NV index handle in the block reserved for owner objects
+	ownerNVIndexLast  tpm2.Handle = 0x01bfffff // Last NV index handle in the block reserved for owner objects
+)
+
+// PCRPolicyCounterInfo describes a NV index on the TPM that is a PCR policy
+// counter created by this package.
+type PCRPolicyCounterInfo struct {
+	Handle tpm2.Handle // The handle of the NV index
+	Name   tpm2.Name   // The name of the NV index
+
+	// Legacy indicates that the index was created for a legacy sealed key
+	// object. These counters can't be associated with a secboot.KeyData and
+	// are never considered to be orphaned.
+	Legacy bool
+
+	// Orphaned indicates that the index is not associated with any of the
+	// live keys supplied to ListPCRPolicyCounters.
+	Orphaned bool
+}
+
+// isPcrPolicyCounterPublic determines whether the supplied public area looks
+// like it belongs to a PCR policy counter created by this package. The first
+// return value indicates whether it does, and the second return value indicates
+// whether it is a counter created for a legacy sealed key object.
+func isPcrPolicyCounterPublic(pub *tpm2.NVPublic) (ok, legacy bool) {
+	if pub.NameAlg != tpm2.HashAlgorithmSHA256 || pub.Size != 8 {
+		return false, false
+	}
+
+	const commonAttrs = tpm2.AttrNVPolicyWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA | tpm2.AttrNVWritten
+	switch pub.Attrs {
+	case tpm2.NVTypeCounter.WithAttrs(commonAttrs | tpm2.AttrNVPolicyRead):
+		return true, false
+	case tpm2.NVTypeCounter.WithAttrs(commonAttrs):
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// isPcrPolicyCounterAuthorizedBy indicates whether the authorization policy of
+// the supplied NV index public area is the one that ensurePcrPolicyCounter
+// computes for the index with one of the supplied update keys.
+func isPcrPolicyCounterAuthorizedBy(pub *tpm2.NVPublic, updateKeys []*tpm2.Public) bool {
+	for _, key := range updateKeys {
+		if bytes.Equal(newPcrPolicyCounterPublic(pub.Index, key).AuthPolicy, pub.AuthPolicy) {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedPcrPolicyCounterName returns the expected name of the PCR policy
+// counter associated with the supplied key. It returns nil if the key
+// version doesn't permit the name to be computed.
+func expectedPcrPolicyCounterName(k *SealedKeyData) tpm2.Name {
+	policy, ok := k.data.Policy().(externalPCRPolicyAuthorizer)
+	if !ok {
+		return nil
+	}
+	pub := newPcrPolicyCounterPublic(k.PCRPolicyCounterHandle(), policy.authPublicKey())
+	pub.Attrs |= tpm2.AttrNVWritten
+	return pub.Name()
+}
+
+// ListPCRPolicyCounters returns a list of NV indices on the TPM in the block
+// reserved for owner objects (0x01800000 - 0x01bfffff), which is where this
+// package recommends that PCR policy counters are created, that are PCR policy
+// counters created by this package.
+//
+// An index is only considered to be a PCR policy counter created by this package
+// if it has the attributes, size and name algorithm that this package uses, and if
+// its authorization policy is the one that this package computes for the index
+// with the key used to authorize PCR policy updates for one of the supplied live
+// keys, or with the update key derived from one of the supplied primary keys. As
+// these update keys are derived from the primary key, this identifies counters for
+// keys that share a primary key with one of the live keys or that were created with
+// one of the supplied primary keys, but it never identifies indices created by other
+// software. Indices that can't be attributed to one of these update keys are omitted.
+//
+// The primaryKeys argument permits the caller to supply primary keys that it knows
+// about but that aren't used by any of the live keys, such as the primary key of
+// a key that has been deleted, so that counters created for these keys can be
+// identified and marked as orphaned.
+//
+// Each index is checked against the supplied live keys - an index is considered
+// to be in use if one of the keys references its handle via
+// SealedKeyData.PCRPolicyCounterHandle and, where it can be computed for the
+// key version, the expected name of the counter matches the name of the index.
+// Indices that are not in use are marked as orphaned.
+//
+// Keys that are not protected by this platform are ignored. Counters created
+// for legacy sealed key objects are never marked as orphaned, as these keys
+// can't be supplied here.
+func (t *Connection) ListPCRPolicyCounters(liveKeys []*secboot.KeyData, primaryKeys []secboot.PrimaryKey) ([]*PCRPolicyCounterInfo, error) {
+	type liveCounter struct {
+		names    []tpm2.Name
+		anyNames bool
+	}
+	live := make(map[tpm2.Handle]*liveCounter)
+	var updateKeys []*tpm2.Public
+
+	for i, k := range liveKeys {
+		if k.PlatformName() != platformName {
+			continue
+		}
+		skd, err := NewSealedKeyData(k)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot decode key %d: %w", i, err)
+		}
+		if policy, ok := skd.data.Policy().(externalPCRPolicyAuthorizer); ok {
+			updateKeys = append(updateKeys, policy.authPublicKey())
+		}
+
+		handle := skd.PCRPolicyCounterHandle()
+		if handle == tpm2.HandleNull {
+			continue
+		}
+
+		c, exists := live[handle]
+		if !exists {
+			c = new(liveCounter)
+			live[handle] = c
+		}
+		if name := expectedPcrPolicyCounterName(skd); name != nil {
+			c.names = append(c.names, name)
+		} else {
+			c.anyNames = true
+		}
+	}
+
+	for i, key := range primaryKeys {
+		updateKey, err := newPolicyAuthPublicKey(key)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot derive PCR policy update key from primary key %d: %w", i, err)
+		}
+		updateKeys = append(updateKeys, updateKey)
+	}
+
+	handles, err := t.GetCapabilityHandles(ownerNVIndexFirst, tpm2.CapabilityMaxProperties)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot obtain NV index handles: %w", err)
+	}
+
+	var out []*PCRPolicyCounterInfo
+	for _, handle := range handles {
+		if handle > ownerNVIndexLast {
+			break
+		}
+
+		index, err := t.CreateResourceContextFromTPM(handle)
+		switch {
+		case tpm2.IsResourceUnavailableError(err, handle):
+			// The index was undefined after we obtained the list of handles.
+			continue
+		case err != nil:
+			return nil, xerrors.Errorf("cannot create context for NV index %v: %w", handle, err)
+		}
+
+		pub, _, err := t.NVReadPublic(index)
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read public area of NV index %v: %w", handle, err)
+		}
+		ok, legacy := isPcrPolicyCounterPublic(pub)
+		if !ok {
+			continue
+		}
+		if !legacy && !isPcrPolicyCounterAuthorizedBy(pub, updateKeys) {
+			// This index can't be attributed to any of the live keys, so
+			// we don't know that it was created by this package.
+			continue
+		}
+
+		info := &PCRPolicyCounterInfo{
+			Handle:   handle,
+			Name:     index.Name(),
+			Legacy:   legacy,
+			Orphaned: !legacy}
+		if c, exists := live[handle]; exists {
+			if c.anyNames {
+				info.Orphaned = false
+			}
+			for _, name := range c.names {
+				if bytes.Equal(name, info.Name) {
+					info.Orphaned = false
+					break
+				}
+			}
+		}
+
+		out = append(out, info)
+	}
+
+	return out, nil
+}
+
+// RemoveOrphanedPCRPolicyCounters undefines the NV indices returned from
+// ListPCRPolicyCounters for the supplied live keys and primary keys that are
+// marked as orphaned, and returns the handles of the indices that were removed.
+//
+// This requires knowledge of the authorization value for the storage hierarchy,
+// which must be set on the context returned from Connection.OwnerHandleContext.
+// If the wrong value is set, then a AuthFailError error will be returned.
+//
+// Only counters that can be attributed to the update key of one of the supplied
+// live keys or primary keys are candidates for removal, so indices created by other
+// software are never removed. The caller must still supply every live key associated
+// with this TPM, else the PCR policy counters for any omitted keys that share a
+// primary key with one of the supplied keys will be removed, and these keys will no
+// longer be able to be unsealed.
+func (t *Connection) RemoveOrphanedPCRPolicyCounters(liveKeys []*secboot.KeyData, primaryKeys []secboot.PrimaryKey) (removed []tpm2.Handle, err error) {
+	counters, err := t.ListPCRPolicyCounters(liveKeys, primaryKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, counter := range counters {
+		if !counter.Orphaned {
+			continue
+		}
+
+		index, err := t.CreateResourceContextFromTPM(counter.Handle)
+		switch {
+		case tpm2.IsResourceUnavailableError(err, counter.Handle):
+			continue
+		case err != nil:
+			return removed, xerrors.Errorf("cannot create context for NV index %v: %w", counter.Handle, err)
+		}
+		if !bytes.Equal(index.Name(), counter.Name) {
+			// The index was replaced after it was listed.
+			continue
+		}
+
+		// Pass the HMAC session here so that we don't supply the cleartext
+		// auth value for the storage hierarchy. As the name of the index is
+		// bound to the command parameters, this will fail if the index is
+		// replaced before the command executes.
+		if err := t.NVUndefineSpace(t.OwnerHandleContext(), index, t.HmacSession()); err != nil {
+			if isAuthFailError(err, tpm2.CommandNVUndefineSpace, 1) {
+				return removed, AuthFailError{tpm2.HandleOwner}
+			}
+			return removed, xerrors.Errorf("cannot undefine NV index %v: %w", counter.Handle, err)
+		}
+
+		removed = append(removed, counter.Handle)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,290 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"github.com/canonical/go-tpm2"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type pcrPolicyCounterGCSuiteNoTPM struct{}
+
+type pcrPolicyCounterGCSuite struct {
+	tpm2test.TPMTest
+	primaryKey secboot.PrimaryKey
+}
+
+func (s *pcrPolicyCounterGCSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureEndorsementHierarchy |
+		tpm2test.TPMFeatureNV
+}
+
+func (s *pcrPolicyCounterGCSuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+
+	// Keys that share a primary key have the same PCR policy update key.
+	s.primaryKey = testutil.DecodeHexString(c, "9f2b6e6fb3f0d5f06d1cd5d1a2d95aaf55c0fa9c1b2da2ac2cbd51dc1f45b9d8")
+}
+
+var _ = Suite(&pcrPolicyCounterGCSuiteNoTPM{})
+var _ = Suite(&pcrPolicyCounterGCSuite{})
+
+func (s *pcrPolicyCounterGCSuiteNoTPM) TestIsPcrPolicyCounterPublic(c *C) {
+	pub := &tpm2.NVPublic{
+		Index:   0x01810000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVPolicyWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyRead | tpm2.AttrNVNoDA | tpm2.AttrNVWritten),
+		Size:    8}
+	ok, legacy := IsPcrPolicyCounterPublic(pub)
+	c.Check(ok, testutil.IsTrue)
+	c.Check(legacy, testutil.IsFalse)
+}
+
+func (s *pcrPolicyCounterGCSuiteNoTPM) TestIsPcrPolicyCounterPublicLegacy(c *C) {
+	pub := &tpm2.NVPublic{
+		Index:   0x01810000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVPolicyWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA | tpm2.AttrNVWritten),
+		Size:    8}
+	ok, legacy := IsPcrPolicyCounterPublic(pub)
+	c.Check(ok, testutil.IsTrue)
+	c.Check(legacy, testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuiteNoTPM) TestIsPcrPolicyCounterPublicNotWritten(c *C) {
+	pub := &tpm2.NVPublic{
+		Index:   0x01810000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVPolicyWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyRead | tpm2.AttrNVNoDA),
+		Size:    8}
+	ok, _ := IsPcrPolicyCounterPublic(pub)
+	c.Check(ok, testutil.IsFalse)
+}
+
+func (s *pcrPolicyCounterGCSuiteNoTPM) TestIsPcrPolicyCounterPublicOrdinaryIndex(c *C) {
+	pub := &tpm2.NVPublic{
+		Index:   0x01810000,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVOwnerWrite | tpm2.AttrNVOwnerRead | tpm2.AttrNVWritten),
+		Size:    8}
+	ok, _ := IsPcrPolicyCounterPublic(pub)
+	c.Check(ok, testutil.IsFalse)
+}
+
+func (s *pcrPolicyCounterGCSuiteNoTPM) TestIsPcrPolicyCounterAuthorizedBy(c *C) {
+	key1, err := NewPolicyAuthPublicKey(make(secboot.PrimaryKey, 32))
+	c.Assert(err, IsNil)
+	key2, err := NewPolicyAuthPublicKey(testutil.DecodeHexString(c, "d4f5d5a1e43e0ea1c1e0e5b2a4a53cd3b1a6d1dfb84e4e9bf9c0b8b1c5f3b2d6"))
+	c.Assert(err, IsNil)
+
+	pub := NewPcrPolicyCounterPublic(0x01810000, key1)
+	pub.Attrs |= tpm2.AttrNVWritten
+	c.Check(IsPcrPolicyCounterAuthorizedBy(pub, []*tpm2.Public{key2, key1}), testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuiteNoTPM) TestIsPcrPolicyCounterAuthorizedByUnknownKey(c *C) {
+	key1, err := NewPolicyAuthPublicKey(make(secboot.PrimaryKey, 32))
+	c.Assert(err, IsNil)
+	key2, err := NewPolicyAuthPublicKey(testutil.DecodeHexString(c, "d4f5d5a1e43e0ea1c1e0e5b2a4a53cd3b1a6d1dfb84e4e9bf9c0b8b1c5f3b2d6"))
+	c.Assert(err, IsNil)
+
+	pub := NewPcrPolicyCounterPublic(0x01810000, key1)
+	pub.Attrs |= tpm2.AttrNVWritten
+	c.Check(IsPcrPolicyCounterAuthorizedBy(pub, []*tpm2.Public{key2}), testutil.IsFalse)
+	c.Check(IsPcrPolicyCounterAuthorizedBy(pub, nil), testutil.IsFalse)
+}
+
+func (s *pcrPolicyCounterGCSuite) newKey(c *C, handle tpm2.Handle, primaryKey secboot.PrimaryKey) *secboot.KeyData {
+	k, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PrimaryKey:             primaryKey,
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: handle})
+	c.Assert(err, IsNil)
+	return k
+}
+
+func (s *pcrPolicyCounterGCSuite) TestListPCRPolicyCountersAllLive(c *C) {
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1, s.primaryKey)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	k2 := s.newKey(c, handle2, s.primaryKey)
+
+	counters, err := s.TPM().ListPCRPolicyCounters([]*secboot.KeyData{k1, k2}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(counters, HasLen, 2)
+	c.Check(counters[0].Handle, Equals, handle1)
+	c.Check(counters[0].Orphaned, testutil.IsFalse)
+	c.Check(counters[0].Legacy, testutil.IsFalse)
+	c.Check(counters[1].Handle, Equals, handle2)
+	c.Check(counters[1].Orphaned, testutil.IsFalse)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestListPCRPolicyCountersOrphaned(c *C) {
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1, s.primaryKey)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.newKey(c, handle2, s.primaryKey)
+
+	counters, err := s.TPM().ListPCRPolicyCounters([]*secboot.KeyData{k1}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(counters, HasLen, 2)
+	c.Check(counters[0].Orphaned, testutil.IsFalse)
+	c.Check(counters[1].Handle, Equals, handle2)
+	c.Check(counters[1].Orphaned, testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestListPCRPolicyCountersNameMismatch(c *C) {
+	// Create a key, and then replace its counter with one for a different key.
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k := s.newKey(c, handle, s.primaryKey)
+
+	index, err := s.TPM().CreateResourceContextFromTPM(handle)
+	c.Assert(err, IsNil)
+	c.Assert(s.TPM().NVUndefineSpace(s.TPM().OwnerHandleContext(), index, nil), IsNil)
+	s.newKey(c, handle, s.primaryKey)
+
+	counters, err := s.TPM().ListPCRPolicyCounters([]*secboot.KeyData{k}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(counters, HasLen, 1)
+	c.Check(counters[0].Handle, Equals, handle)
+	c.Check(counters[0].Orphaned, testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestListPCRPolicyCountersIgnoresOtherIndices(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   handle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVOwnerWrite | tpm2.AttrNVOwnerRead),
+		Size:    8})
+
+	counters, err := s.TPM().ListPCRPolicyCounters(nil, nil)
+	c.Check(err, IsNil)
+	c.Check(counters, HasLen, 0)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestRemoveOrphanedPCRPolicyCounters(c *C) {
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1, s.primaryKey)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.newKey(c, handle2, s.primaryKey)
+
+	removed, err := s.TPM().RemoveOrphanedPCRPolicyCounters([]*secboot.KeyData{k1}, nil)
+	c.Check(err, IsNil)
+	c.Check(removed, DeepEquals, []tpm2.Handle{handle2})
+
+	c.Check(s.TPM().DoesHandleExist(handle1), testutil.IsTrue)
+	c.Check(s.TPM().DoesHandleExist(handle2), testutil.IsFalse)
+
+	// The remaining key should still be usable.
+	_, _, err = k1.RecoverKeys()
+	c.Check(err, IsNil)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestRemoveOrphanedPCRPolicyCountersNone(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k := s.newKey(c, handle, s.primaryKey)
+
+	removed, err := s.TPM().RemoveOrphanedPCRPolicyCounters([]*secboot.KeyData{k}, nil)
+	c.Check(err, IsNil)
+	c.Check(removed, HasLen, 0)
+	c.Check(s.TPM().DoesHandleExist(handle), testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestRemoveOrphanedPCRPolicyCountersAuthFail(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	s.newKey(c, handle, s.primaryKey)
+
+	s.HierarchyChangeAuth(c, tpm2.HandleOwner, []byte("1234"))
+	s.TPM().OwnerHandleContext().SetAuthValue(nil)
+
+	_, err := s.TPM().RemoveOrphanedPCRPolicyCounters(nil, []secboot.PrimaryKey{s.primaryKey})
+	c.Check(err, Equals, AuthFailError{tpm2.HandleOwner})
+	c.Check(s.TPM().DoesHandleExist(handle), testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestListPCRPolicyCountersIgnoresOtherUpdateKeys(c *C) {
+	// A counter with the same attributes as ours, but with an authorization
+	// policy that can't be attributed to any of the live keys, should be
+	// ignored.
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1, s.primaryKey)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.newKey(c, handle2, nil)
+
+	counters, err := s.TPM().ListPCRPolicyCounters([]*secboot.KeyData{k1}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(counters, HasLen, 1)
+	c.Check(counters[0].Handle, Equals, handle1)
+	c.Check(counters[0].Orphaned, testutil.IsFalse)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestRemoveOrphanedPCRPolicyCountersIgnoresOtherUpdateKeys(c *C) {
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	s.newKey(c, handle1, nil)
+
+	removed, err := s.TPM().RemoveOrphanedPCRPolicyCounters(nil, nil)
+	c.Check(err, IsNil)
+	c.Check(removed, HasLen, 0)
+	c.Check(s.TPM().DoesHandleExist(handle1), testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestListPCRPolicyCountersWithPrimaryKeys(c *C) {
+	// A counter for a key with a different primary key can be attributed
+	// if that primary key is supplied.
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	k1 := s.newKey(c, handle1, s.primaryKey)
+	primaryKey := testutil.DecodeHexString(c, "4a0e4c4d8d0c32c6e1f2c8b4b33a5d52b3d3b7e0d9b6c1f0a2e8d4c6b8a0f2e4")
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.newKey(c, handle2, primaryKey)
+
+	counters, err := s.TPM().ListPCRPolicyCounters([]*secboot.KeyData{k1}, []secboot.PrimaryKey{primaryKey})
+	c.Assert(err, IsNil)
+	c.Assert(counters, HasLen, 2)
+	c.Check(counters[0].Handle, Equals, handle1)
+	c.Check(counters[0].Orphaned, testutil.IsFalse)
+	c.Check(counters[1].Handle, Equals, handle2)
+	c.Check(counters[1].Orphaned, testutil.IsTrue)
+}
+
+func (s *pcrPolicyCounterGCSuite) TestRemoveOrphanedPCRPolicyCountersWithPrimaryKeys(c *C) {
+	// Counters for deleted keys can be removed when there are no live keys
+	// if the primary key is supplied.
+	handle1 := s.NextAvailableHandle(c, 0x01810000)
+	s.newKey(c, handle1, s.primaryKey)
+	handle2 := s.NextAvailableHandle(c, handle1+1)
+	s.newKey(c, handle2, nil)
+
+	removed, err := s.TPM().RemoveOrphanedPCRPolicyCounters(nil, []secboot.PrimaryKey{s.primaryKey})
+	c.Check(err, IsNil)
+	c.Check(removed, DeepEquals, []tpm2.Handle{handle1})
+
+	c.Check(s.TPM().DoesHandleExist(handle1), testutil.IsFalse)
+	c.Check(s.TPM().DoesHandleExist(handle2), testutil.IsTrue)
+}
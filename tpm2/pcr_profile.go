@@ -1110,43 +1110,80 @@ func (p *PCRProtectionProfile) ComputePCRValues(tpm *tpm2.TPMContext) ([]tpm2.PC
 	return []tpm2.PCRValues(context.currentBranch().subBranchValues), nil
 }
 
-// ComputePCRDigests computes a PCR policy consisting of a PCR selection and
-// a list of composite PCR digests from this PCRProtectionProfile (one
-// composite digest per branch). Note that there isn't a one-to-one association
-// between a branch in the computed policy and a branch in the profile.
+// PCRBankDigests corresponds to a PCR selection for a single PCR bank and a list
+// of composite PCR digests computed from a PCRProtectionProfile for it.
+type PCRBankDigests struct {
+	PCRs    tpm2.PCRSelectionList // The PCR selection
+	Digests tpm2.DigestList       // The composite PCR digests, one per branch
+}
+
+// isSingleBankSelection indicates whether the supplied PCR selection selects PCRs
+// from exactly one bank.
+func isSingleBankSelection(pcrs tpm2.PCRSelectionList) bool {
+	return len(pcrs) == 1 && len(pcrs[0].Select) > 0
+}
+
+// isAlternateBankSelection indicates whether the supplied PCR selections both select
+// PCRs from exactly one bank, with the same set of PCRs selected from a different bank.
+func isAlternateBankSelection(a, b tpm2.PCRSelectionList) bool {
+	if !isSingleBankSelection(a) || !isSingleBankSelection(b) {
+		return false
+	}
+	if a[0].Hash == b[0].Hash {
+		return false
+	}
+	return mu.DeepEqual(a, tpm2.PCRSelectionList{{Hash: a[0].Hash, Select: b[0].Select}})
+}
+
+// ComputePCRBankDigests computes a PCR policy consisting of one or more PCR
+// selections, each with a list of composite PCR digests, from this
+// PCRProtectionProfile. This is similar to ComputePCRDigests, but it permits
+// the profile to contain branches with values for different PCR banks, in
+// order to produce a policy that can be satisfied by either of the PCR banks.
 //
-// The returned list of composite PCR digests is de-duplicated.
-func (p *PCRProtectionProfile) ComputePCRDigests(tpm *tpm2.TPMContext, alg tpm2.HashAlgorithmId) (tpm2.PCRSelectionList, tpm2.DigestList, error) {
+// Each branch of the profile must either contain values for the same set of
+// PCRs in every bank, or it must contain values for a single bank where every
+// other branch that contains values for a different single bank selects the
+// same set of PCRs. The first returned element corresponds to the PCR bank
+// that appears first in the profile. This is the preferred PCR bank when the
+// resulting policy is executed, and subsequent elements are tried as fallbacks.
+//
+// The returned lists of composite PCR digests are de-duplicated.
+func (p *PCRProtectionProfile) ComputePCRBankDigests(tpm *tpm2.TPMContext, alg tpm2.HashAlgorithmId) ([]PCRBankDigests, error) {
 	// Compute the sets of PCR values for all branches
 	values, err := p.ComputePCRValues(tpm)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// Compute the PCR selection for this profile from the first branch.
-	pcrs, err := values[0].SelectionList()
-	if err != nil {
-		return nil, nil, xerrors.Errorf("cannot compute selection list: %w", err)
-	}
+	var out []PCRBankDigests
 
-	// Compute the PCR digests for all branches, making sure that they all contain values for the same sets of PCRs.
-	var pcrDigests tpm2.DigestList
+	// Compute the PCR digests for all branches, making sure that they all contain values for
+	// the same sets of PCRs or for the same sets of PCRs in alternate banks.
 	for _, v := range values {
-		p, digest, err := util.ComputePCRDigestFromAllValues(alg, v)
+		pcrs, digest, err := util.ComputePCRDigestFromAllValues(alg, v)
 		if err != nil {
-			return nil, nil, xerrors.Errorf("cannot compute PCR digest from values: %w", err)
+			return nil, xerrors.Errorf("cannot compute PCR digest from values: %w", err)
 		}
-		if !mu.DeepEqual(p, pcrs) {
-			return nil, nil, errors.New("not all branches contain values for the same sets of PCRs")
+
+		var bank *PCRBankDigests
+		for i := range out {
+			if mu.DeepEqual(pcrs, out[i].PCRs) {
+				bank = &out[i]
+				break
+			}
+			if !isAlternateBankSelection(pcrs, out[i].PCRs) {
+				return nil, errors.New("not all branches contain values for the same sets of PCRs")
+			}
+		}
+		if bank == nil {
+			out = append(out, PCRBankDigests{PCRs: pcrs})
+			bank = &out[len(out)-1]
 		}
-		pcrDigests = append(pcrDigests, digest)
-	}
 
-	var uniquePcrDigests tpm2.DigestList
-	for _, d := range pcrDigests {
 		found := false
-		for _, f := range uniquePcrDigests {
-			if bytes.Equal(d, f) {
+		for _, d := range bank.Digests {
+			if bytes.Equal(d, digest) {
 				found = true
 				break
 			}
@@ -1154,8 +1191,29 @@ func (p *PCRProtectionProfile) ComputePCRDigests(tpm *tpm2.TPMContext, alg tpm2.
 		if found {
 			continue
 		}
-		uniquePcrDigests = append(uniquePcrDigests, d)
+		bank.Digests = append(bank.Digests, digest)
+	}
+
+	return out, nil
+}
+
+// ComputePCRDigests computes a PCR policy consisting of a PCR selection and
+// a list of composite PCR digests from this PCRProtectionProfile (one
+// composite digest per branch). Note that there isn't a one-to-one association
+// between a branch in the computed policy and a branch in the profile.
+//
+// Profiles that contain values for alternate PCR banks in different branches
+// are not supported by this function - use ComputePCRBankDigests instead.
+//
+// The returned list of composite PCR digests is de-duplicated.
+func (p *PCRProtectionProfile) ComputePCRDigests(tpm *tpm2.TPMContext, alg tpm2.HashAlgorithmId) (tpm2.PCRSelectionList, tpm2.DigestList, error) {
+	banks, err := p.ComputePCRBankDigests(tpm, alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(banks) > 1 {
+		return nil, nil, errors.New("not all branches contain values for the same sets of PCRs")
 	}
 
-	return pcrs, uniquePcrDigests, nil
+	return banks[0].PCRs, banks[0].Digests, nil
 }
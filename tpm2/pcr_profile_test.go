@@ -907,6 +907,128 @@ func (s *pcrProfileSuite) TestUnbalancedBranchesFails(c *C) {
 	c.Check(err, ErrorMatches, `not all branches contain values for the same sets of PCRs`)
 }
 
+func (s *pcrProfileSuite) TestComputePCRDigestsMultipleBanksFails(c *C) {
+	profile := NewPCRProtectionProfile()
+	profile.RootBranch().
+		AddBranchPoint().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make([]byte, 32)).
+		EndBranch().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA384, 7, make([]byte, 48)).
+		EndBranch().
+		EndBranchPoint()
+
+	_, _, err := profile.ComputePCRDigests(nil, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `not all branches contain values for the same sets of PCRs`)
+}
+
+func (s *pcrProfileSuite) TestComputePCRBankDigestsSingleBank(c *C) {
+	profile := NewPCRProtectionProfile()
+	profile.RootBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 7, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "foo")).
+		AddBranchPoint().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 8, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "bar")).
+		EndBranch().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 8, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "bar2")).
+		EndBranch().
+		EndBranchPoint()
+
+	expectedPcrs, expectedDigests, err := profile.ComputePCRDigests(nil, tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+
+	banks, err := profile.ComputePCRBankDigests(nil, tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Assert(banks, HasLen, 1)
+	c.Check(banks[0].PCRs, tpm2_testutil.TPMValueDeepEquals, expectedPcrs)
+	c.Check(banks[0].Digests, DeepEquals, expectedDigests)
+}
+
+func (s *pcrProfileSuite) TestComputePCRBankDigestsMultipleBanks(c *C) {
+	profile := NewPCRProtectionProfile()
+	profile.RootBranch().
+		AddBranchPoint().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA384, 7, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA384, "foo")).
+		AddPCRValue(tpm2.HashAlgorithmSHA384, 8, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA384, "bar")).
+		EndBranch().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 7, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "foo")).
+		AddBranchPoint().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 8, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "bar")).
+		EndBranch().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 8, tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "bar2")).
+		EndBranch().
+		EndBranchPoint().
+		EndBranch().
+		EndBranchPoint()
+
+	banks, err := profile.ComputePCRBankDigests(nil, tpm2.HashAlgorithmSHA256)
+	c.Assert(err, IsNil)
+	c.Assert(banks, HasLen, 2)
+
+	// The SHA-384 bank appears first in the profile, so it is preferred.
+	c.Check(banks[0].PCRs, tpm2_testutil.TPMValueDeepEquals, tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA384, Select: []int{7, 8}}})
+	digest, _ := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, banks[0].PCRs, tpm2.PCRValues{
+		tpm2.HashAlgorithmSHA384: {
+			7: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA384, "foo"),
+			8: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA384, "bar"),
+		},
+	})
+	c.Check(banks[0].Digests, DeepEquals, tpm2.DigestList{digest})
+
+	c.Check(banks[1].PCRs, tpm2_testutil.TPMValueDeepEquals, tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7, 8}}})
+	var expectedDigests tpm2.DigestList
+	for _, v := range []string{"bar", "bar2"} {
+		digest, _ := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, banks[1].PCRs, tpm2.PCRValues{
+			tpm2.HashAlgorithmSHA256: {
+				7: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "foo"),
+				8: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, v),
+			},
+		})
+		expectedDigests = append(expectedDigests, digest)
+	}
+	c.Check(banks[1].Digests, DeepEquals, expectedDigests)
+}
+
+func (s *pcrProfileSuite) TestComputePCRBankDigestsMultipleBanksUnbalancedFails(c *C) {
+	profile := NewPCRProtectionProfile()
+	profile.RootBranch().
+		AddBranchPoint().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make([]byte, 32)).
+		EndBranch().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA384, 7, make([]byte, 48)).
+		AddPCRValue(tpm2.HashAlgorithmSHA384, 8, make([]byte, 48)).
+		EndBranch().
+		EndBranchPoint()
+
+	_, err := profile.ComputePCRBankDigests(nil, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `not all branches contain values for the same sets of PCRs`)
+}
+
+func (s *pcrProfileSuite) TestComputePCRBankDigestsMixedBanksFails(c *C) {
+	profile := NewPCRProtectionProfile()
+	profile.RootBranch().
+		AddBranchPoint().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make([]byte, 32)).
+		EndBranch().
+		AddBranch().
+		AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make([]byte, 32)).
+		AddPCRValue(tpm2.HashAlgorithmSHA384, 7, make([]byte, 48)).
+		EndBranch().
+		EndBranchPoint()
+
+	_, err := profile.ComputePCRBankDigests(nil, tpm2.HashAlgorithmSHA256)
+	c.Check(err, ErrorMatches, `not all branches contain values for the same sets of PCRs`)
+}
+
 func (s *pcrProfileSuite) TestMarshalAndUnmarshal(c *C) {
 	p := NewPCRProtectionProfile()
 	p.RootBranch().
@@ -78,10 +78,24 @@ func (h *platformKeyDataHandler) recoverKeysCommon(data *secboot.PlatformKeyData
 	}
 	defer tpm.Close()
 
-	symKey, err := k.unsealDataFromTPM(tpm.TPMContext, authKey, tpm.HmacSession())
+	// If the key is bound to PCR policies signed by systemd-measure, obtain the
+	// signed policies for the running UKI.
+	var systemdPCRSignatures SystemdPCRSignatures
+	if p, ok := k.data.Policy().(systemdPCRPolicy); ok && p.SystemdPCRPolicyKey() != nil {
+		systemdPCRSignatures, err = readSystemdPCRSignatures()
+		if err != nil {
+			return nil, xerrors.Errorf("cannot read signed PCR policies: %w", err)
+		}
+	}
+
+	symKey, err := k.unsealDataFromTPM(tpm.TPMContext, authKey, systemdPCRSignatures, tpm.HmacSession())
 	if err != nil {
 		var e InvalidKeyDataError
 		switch {
+		case isSRKMismatchError(err):
+			return nil, &secboot.PlatformHandlerError{
+				Type: secboot.PlatformHandlerErrorInvalidData,
+				Err:  err}
 		case xerrors.As(err, &e):
 			return nil, &secboot.PlatformHandlerError{
 				Type: secboot.PlatformHandlerErrorInvalidData,
@@ -94,7 +108,18 @@ func (h *platformKeyDataHandler) recoverKeysCommon(data *secboot.PlatformKeyData
 			return nil, &secboot.PlatformHandlerError{
 				Type: secboot.PlatformHandlerErrorUnavailable,
 				Err:  err}
-		case tpm2.IsTPMSessionError(err, tpm2.ErrorAuthFail, tpm2.CommandUnseal, 1):
+		case err == ErrWrongLocality:
+			return nil, &secboot.PlatformHandlerError{
+				Type: secboot.PlatformHandlerErrorUnavailable,
+				Err:  err}
+		case err == ErrTimeConstraintsNotSatisfied:
+			return nil, &secboot.PlatformHandlerError{
+				Type: secboot.PlatformHandlerErrorInvalidData,
+				Err:  err}
+		case tpm2.IsTPMSessionError(err, tpm2.ErrorAuthFail, tpm2.CommandUnseal, 1),
+			tpm2.IsTPMSessionError(err, tpm2.ErrorAuthFail, tpm2.CommandPolicySecret, 1):
+			// The second case is for keys with an authorization value that is
+			// bound to a NV index.
 			return nil, &secboot.PlatformHandlerError{
 				Type: secboot.PlatformHandlerErrorInvalidAuthKey,
 				Err:  err}
@@ -150,7 +175,7 @@ func (h *platformKeyDataHandler) ChangeAuthKey(data *secboot.PlatformKeyData, ol
 	// Validate the initial key data
 	_, err = k.validateData(tpm.TPMContext, data.Role)
 	switch {
-	case isKeyDataError(err):
+	case isKeyDataError(err) || isSRKMismatchError(err):
 		return nil, &secboot.PlatformHandlerError{
 			Type: secboot.PlatformHandlerErrorInvalidData,
 			Err:  err}
@@ -158,9 +183,13 @@ func (h *platformKeyDataHandler) ChangeAuthKey(data *secboot.PlatformKeyData, ol
 		return nil, xerrors.Errorf("cannot validate key data: %w", err)
 	}
 
-	srk, err := tpm.CreateResourceContextFromTPM(tcg.SRKHandle)
+	srkHandle, err := tcg.SelectSRKHandle(tpm.TPMContext)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot select SRK handle: %w", err)
+	}
+	srk, err := tpm.CreateResourceContextFromTPM(srkHandle)
 	switch {
-	case tpm2.IsResourceUnavailableError(err, tcg.SRKHandle):
+	case tpm2.IsResourceUnavailableError(err, srkHandle):
 		return nil, &secboot.PlatformHandlerError{
 			Type: secboot.PlatformHandlerErrorUninitialized,
 			Err:  ErrTPMProvisioning}
@@ -170,6 +199,11 @@ func (h *platformKeyDataHandler) ChangeAuthKey(data *secboot.PlatformKeyData, ol
 
 	keyObject, err := k.load(tpm.TPMContext, srk)
 	switch {
+	case isLoadParentMismatchError(err) || isImportParentMismatchError(err):
+		// The supplied key data is not protected by the persistent SRK.
+		return nil, &secboot.PlatformHandlerError{
+			Type: secboot.PlatformHandlerErrorInvalidData,
+			Err:  SRKMismatchError{srkHandle}}
 	case isLoadInvalidParamError(err) || isImportInvalidParamError(err):
 		// The supplied key data is invalid or is not protected by the supplied SRK.
 		return nil, &secboot.PlatformHandlerError{
@@ -222,6 +256,37 @@ func (h *platformKeyDataHandler) ChangeAuthKey(data *secboot.PlatformKeyData, ol
 		return nil, xerrors.Errorf("cannot validate key data after auth value change: %w", err)
 	}
 
+	// If the authorization value is bound to a NV index, change the authorization value of
+	// the index as well. This revokes every earlier copy of the key data, so this is the
+	// last step. If the returned key data is not persisted after this, the change can be
+	// repeated with the previous copy of the key data and the same old and new values -
+	// the NV index is left alone in this case if it already has the new value.
+	// ChangeKeyDataPassphraseJournaled makes use of this.
+	if p, ok := k.data.Policy().(authValueIndexPolicy); ok && p.AuthValueIndex() != nil {
+		if err := changeAuthValueIndexAuth(tpm.TPMContext, p.AuthValueIndex(), srk, old, new); err != nil {
+			switch {
+			case isPolicyDataError(err):
+				return nil, &secboot.PlatformHandlerError{
+					Type: secboot.PlatformHandlerErrorInvalidData,
+					Err:  err}
+			case tpm2.IsTPMSessionError(err, tpm2.ErrorAuthFail, tpm2.CommandNVChangeAuth, 1):
+				// The NV index doesn't have the old value. This is fine if an earlier
+				// change was interrupted after it had been changed to the new value.
+				changed, checkErr := authValueIndexHasAuthValue(tpm.TPMContext, p.AuthValueIndex(), new, tpm.HmacSession())
+				switch {
+				case checkErr != nil:
+					return nil, xerrors.Errorf("cannot check authorization value of NV index: %w", checkErr)
+				case !changed:
+					return nil, &secboot.PlatformHandlerError{
+						Type: secboot.PlatformHandlerErrorInvalidAuthKey,
+						Err:  err}
+				}
+			default:
+				return nil, xerrors.Errorf("cannot change authorization value of NV index: %w", err)
+			}
+		}
+	}
+
 	newHandle, err := json.Marshal(k)
 	if err != nil {
 		return nil, err
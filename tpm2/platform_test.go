@@ -26,6 +26,7 @@ import (
 	"io"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"syscall"
 
 	"github.com/canonical/go-tpm2"
@@ -173,6 +174,118 @@ func (s *platformSuite) TestChangePassphraseIntegrated(c *C) {
 	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
 }
 
+func (s *platformSuite) TestChangePassphraseWithAuthValueIndexIntegrated(c *C) {
+	passphraseParams := &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull,
+			Role:                   "",
+		},
+		AuthValueIndexHandle: s.NextAvailableHandle(c, 0x0181fff0),
+	}
+
+	k, primaryKey, unlockKey, err := NewTPMPassphraseProtectedKey(s.TPM(), passphraseParams, "passphrase")
+	c.Assert(err, IsNil)
+
+	// Keep a copy of the key data protected with the old passphrase.
+	path := filepath.Join(c.MkDir(), "key")
+	c.Assert(k.WriteAtomic(secboot.NewFileKeyDataWriter(path)), IsNil)
+
+	c.Check(k.ChangePassphrase("passphrase", "1234"), IsNil)
+
+	unlockKeyUnsealed, primaryKeyUnsealed, err := k.RecoverKeysWithPassphrase("1234")
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
+
+	// The old copy can't be used with the old passphrase anymore.
+	r, err := secboot.NewFileKeyDataReader(path)
+	c.Assert(err, IsNil)
+	oldKey, err := secboot.ReadKeyData(r)
+	c.Assert(err, IsNil)
+
+	_, _, err = oldKey.RecoverKeysWithPassphrase("passphrase")
+	c.Check(err, Equals, secboot.ErrInvalidPassphrase)
+}
+
+func (s *platformSuite) TestChangePassphraseWithAuthValueIndexTwiceIntegrated(c *C) {
+	passphraseParams := &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull,
+			Role:                   "",
+		},
+		AuthValueIndexHandle: s.NextAvailableHandle(c, 0x0181fff0),
+	}
+
+	k, primaryKey, unlockKey, err := NewTPMPassphraseProtectedKey(s.TPM(), passphraseParams, "passphrase")
+	c.Assert(err, IsNil)
+
+	c.Check(k.ChangePassphrase("passphrase", "1234"), IsNil)
+
+	// Keep a copy of the key data protected with the intermediate passphrase.
+	path := filepath.Join(c.MkDir(), "key")
+	c.Assert(k.WriteAtomic(secboot.NewFileKeyDataWriter(path)), IsNil)
+
+	c.Check(k.ChangePassphrase("1234", "5678"), IsNil)
+
+	unlockKeyUnsealed, primaryKeyUnsealed, err := k.RecoverKeysWithPassphrase("5678")
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
+
+	// The old copy is revoked immediately, without the new key data having
+	// to be used first.
+	r, err := secboot.NewFileKeyDataReader(path)
+	c.Assert(err, IsNil)
+	oldKey, err := secboot.ReadKeyData(r)
+	c.Assert(err, IsNil)
+
+	_, _, err = oldKey.RecoverKeysWithPassphrase("1234")
+	c.Check(err, Equals, secboot.ErrInvalidPassphrase)
+}
+
+func (s *platformSuite) TestChangePassphraseWithAuthValueIndexRepeatIntegrated(c *C) {
+	passphraseParams := &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull,
+			Role:                   "",
+		},
+		AuthValueIndexHandle: s.NextAvailableHandle(c, 0x0181fff0),
+	}
+
+	k, primaryKey, unlockKey, err := NewTPMPassphraseProtectedKey(s.TPM(), passphraseParams, "passphrase")
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(c.MkDir(), "key")
+	c.Assert(k.WriteAtomic(secboot.NewFileKeyDataWriter(path)), IsNil)
+
+	// Change the passphrase and discard the result, which simulates an
+	// interruption before the new key data is persisted.
+	c.Check(k.ChangePassphrase("passphrase", "1234"), IsNil)
+
+	readKey := func() *secboot.KeyData {
+		r, err := secboot.NewFileKeyDataReader(path)
+		c.Assert(err, IsNil)
+		k, err := secboot.ReadKeyData(r)
+		c.Assert(err, IsNil)
+		return k
+	}
+
+	// Repeating the change with a different new passphrase fails.
+	c.Check(readKey().ChangePassphrase("passphrase", "5678"), Equals, secboot.ErrInvalidPassphrase)
+
+	// Repeating the same change with the original key data succeeds.
+	k = readKey()
+	c.Check(k.ChangePassphrase("passphrase", "1234"), IsNil)
+
+	unlockKeyUnsealed, primaryKeyUnsealed, err := k.RecoverKeysWithPassphrase("1234")
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
+}
+
 func (s *platformSuite) TestChangePassphraseWithBadPassphraseIntegrated(c *C) {
 	params := &ProtectKeyParams{
 		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
@@ -420,6 +533,31 @@ func (s *platformSuite) TestRecoverKeysUnsealErrorHandlingLockout(c *C) {
 	c.Check(err, ErrorMatches, "the TPM is in DA lockout mode")
 }
 
+func (s *platformSuite) TestRecoverKeysUnsealErrorHandlingWrongLocality(c *C) {
+	// The test harness sends commands from locality 0.
+	k, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		PolicyLocality:         tpm2.LocalityOne | tpm2.LocalityTwo})
+	c.Assert(err, IsNil)
+
+	var platformHandle json.RawMessage
+	c.Check(k.UnmarshalPlatformHandle(&platformHandle), IsNil)
+
+	var handler PlatformKeyDataHandler
+	_, err = handler.RecoverKeys(&secboot.PlatformKeyData{
+		Generation:    k.Generation(),
+		AuthMode:      secboot.AuthModeNone,
+		Role:          "",
+		KDFAlg:        crypto.Hash(crypto.SHA256),
+		EncodedHandle: platformHandle},
+		s.lastEncryptedPayload)
+	c.Assert(err, testutil.ConvertibleTo, &secboot.PlatformHandlerError{})
+	c.Check(err.(*secboot.PlatformHandlerError).Type, Equals, secboot.PlatformHandlerErrorUnavailable)
+	c.Check(err, testutil.ErrorIs, ErrWrongLocality)
+	c.Check(err, ErrorMatches, "the sealed key object cannot be unsealed from the current locality")
+}
+
 func (s *platformSuite) TestRecoverKeysUnsealErrorHandlingInvalidPCRProfile(c *C) {
 	err := s.testRecoverKeysUnsealErrorHandling(c, func(_ *secboot.KeyData, _ secboot.PrimaryKey) {
 		_, err := s.TPM().PCREvent(s.TPM().PCRHandleContext(23), []byte("foo"), nil)
@@ -693,3 +831,40 @@ func (s *platformSuite) TestChangeAuthKeyWithIncorrectAuthKey(c *C) {
 	c.Check(err, ErrorMatches, "TPM returned an error for session 1 whilst executing command TPM_CC_ObjectChangeAuth: "+
 		"TPM_RC_AUTH_FAIL \\(the authorization HMAC check failed and DA counter incremented\\)")
 }
+
+func (s *platformSuite) TestChangeAuthKeyWrongSRK(c *C) {
+	params := &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x0181fff0),
+		Role:                   "",
+	}
+
+	k, _, _, err := NewTPMProtectedKey(s.TPM(), params)
+	c.Assert(err, IsNil)
+
+	var platformHandle json.RawMessage
+	c.Check(k.UnmarshalPlatformHandle(&platformHandle), IsNil)
+
+	srk, err := s.TPM().CreateResourceContextFromTPM(tcg.SRKHandle)
+	c.Assert(err, IsNil)
+	s.EvictControl(c, tpm2.HandleOwner, srk, srk.Handle())
+
+	srkTemplate := tcg.MakeDefaultSRKTemplate()
+	srkTemplate.Unique.RSA = nil
+	srk = s.CreatePrimary(c, tpm2.HandleOwner, srkTemplate)
+	s.EvictControl(c, tpm2.HandleOwner, srk, tcg.SRKHandle)
+
+	platformKeyData := &secboot.PlatformKeyData{
+		Generation:    k.Generation(),
+		EncodedHandle: platformHandle,
+		KDFAlg:        crypto.Hash(crypto.SHA256),
+		AuthMode:      k.AuthMode(),
+	}
+
+	var handler PlatformKeyDataHandler
+	_, err = handler.ChangeAuthKey(platformKeyData, nil, []byte{1, 2, 3, 4})
+	c.Assert(err, testutil.ConvertibleTo, &secboot.PlatformHandlerError{})
+	c.Check(err.(*secboot.PlatformHandlerError).Type, Equals, secboot.PlatformHandlerErrorInvalidData)
+	c.Check(err, ErrorMatches, "the sealed key object is not protected by the storage root key at handle 0x81000001 "+
+		"\\(the TPM may have been cleared since the key was created\\)")
+}
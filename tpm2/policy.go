@@ -22,6 +22,8 @@ package tpm2
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	_ "crypto/sha256"
 	"errors"
 
@@ -47,9 +49,21 @@ type pcrPolicyParams struct {
 	key  secboot.PrimaryKey // Key used to authorize the generated dynamic authorization policy
 	role []byte
 
+	// signer is an optional external key used to authorize the generated dynamic
+	// authorization policy instead of key. This is only supported for v3 and later
+	// policies.
+	signer crypto.Signer
+
 	pcrs       tpm2.PCRSelectionList // PCR selection
 	pcrDigests tpm2.DigestList       // Approved PCR digests
 
+	// fallbackPCRs contains approved PCR digests for the same PCRs
+	// in alternate PCR banks. The PCR selection for each of these must
+	// select the same PCRs as pcrs in a different bank. These are used
+	// if the PCR values for the bank selected by pcrs don't match any of
+	// the approved digests when the policy is executed.
+	fallbackPCRs []PCRBankDigests
+
 	// policyCounterName is the name of the NV index used for revoking authorization
 	// policies. The name must be associated with the handle in the keyDataPolicy,
 	// else the policy will not work.
@@ -196,6 +210,24 @@ func createPcrPolicyCounterLegacy(tpm *tpm2.TPMContext, handle tpm2.Handle, upda
 	return public, value, nil
 }
 
+// newPcrPolicyCounterPublic returns the public area of a NV counter used for
+// implementing PCR policy revocation, created by ensurePcrPolicyCounter, that can
+// be updated with the supplied key. The returned public area does not have the
+// AttrNVWritten attribute set.
+func newPcrPolicyCounterPublic(handle tpm2.Handle, updateKey *tpm2.Public) *tpm2.NVPublic {
+	nameAlg := tpm2.HashAlgorithmSHA256
+
+	trial := util.ComputeAuthPolicy(nameAlg)
+	trial.PolicyOR(computeV3PcrPolicyCounterAuthPolicies(nameAlg, updateKey.Name()))
+
+	return &tpm2.NVPublic{
+		Index:      handle,
+		NameAlg:    nameAlg,
+		Attrs:      tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVPolicyWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyRead | tpm2.AttrNVNoDA),
+		AuthPolicy: trial.GetDigest(),
+		Size:       8}
+}
+
 // ensurePcrPolicyCounter creates and initializes a NV counter that is associated with a sealed key object
 // and is used for implementing PCR policy revocation.
 //
@@ -205,19 +237,8 @@ func createPcrPolicyCounterLegacy(tpm *tpm2.TPMContext, handle tpm2.Handle, upda
 // If hmacSession is supplied, it is used for authenticating with the storage hierarchy, in order to avoid
 // transmitting the cleartext auth value, and must have the AttrContinueSession attribute set
 var ensurePcrPolicyCounter = func(tpm *tpm2.TPMContext, handle tpm2.Handle, updateKey *tpm2.Public, hmacSession tpm2.SessionContext) (public *tpm2.NVPublic, err error) {
-	nameAlg := tpm2.HashAlgorithmSHA256
-
-	authPolicies := computeV3PcrPolicyCounterAuthPolicies(nameAlg, updateKey.Name())
-
-	trial := util.ComputeAuthPolicy(nameAlg)
-	trial.PolicyOR(authPolicies)
-
-	public = &tpm2.NVPublic{
-		Index:      handle,
-		NameAlg:    tpm2.HashAlgorithmSHA256,
-		Attrs:      tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVPolicyWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVPolicyRead | tpm2.AttrNVNoDA),
-		AuthPolicy: trial.GetDigest(),
-		Size:       8}
+	public = newPcrPolicyCounterPublic(handle, updateKey)
+	authPolicies := computeV3PcrPolicyCounterAuthPolicies(public.NameAlg, updateKey.Name())
 
 	index, err := tpm.CreateResourceContextFromTPM(handle)
 	switch {
@@ -283,6 +304,23 @@ var newPolicyAuthPublicKey = func(key secboot.PrimaryKey) (*tpm2.Public, error)
 	return util.NewExternalECCPublicKey(tpm2.HashAlgorithmSHA256, templates.KeyUsageSign, nil, &ecdsaKey.PublicKey), nil
 }
 
+// newExternalPolicyAuthPublicKey returns the public area for the supplied
+// external key for authorizing PCR policies. Only ECDSA keys with a NIST
+// P-256, P-384 or P-521 curve are supported.
+func newExternalPolicyAuthPublicKey(key crypto.PublicKey) (*tpm2.Public, error) {
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	switch ecdsaKey.Curve {
+	case elliptic.P256(), elliptic.P384(), elliptic.P521():
+	default:
+		return nil, errors.New("unsupported curve")
+	}
+
+	return util.NewExternalECCPublicKey(tpm2.HashAlgorithmSHA256, templates.KeyUsageSign, nil, ecdsaKey), nil
+}
+
 // ensureSufficientORDigests turns a single digest in to a pair of identical digests.
 // This is because TPM2_PolicyOR assertions require more than one digest. This avoids
 // having a separate policy sequence when there is only a single digest, without having
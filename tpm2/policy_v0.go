@@ -21,6 +21,7 @@ package tpm2
 
 import (
 	"crypto"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/binary"
@@ -28,6 +29,7 @@ import (
 	"fmt"
 
 	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/cryptutil"
 	"github.com/canonical/go-tpm2/util"
 
 	"golang.org/x/xerrors"
@@ -252,7 +254,7 @@ type pcrPolicyData_v0 struct {
 	AuthorizedPolicySignature *tpm2.Signature
 }
 
-func (d *pcrPolicyData_v0) addPcrAssertions(alg tpm2.HashAlgorithmId, trial *util.TrialAuthPolicy, pcrs tpm2.PCRSelectionList, digests tpm2.DigestList) error {
+func (d *pcrPolicyData_v0) addPcrAssertions(alg tpm2.HashAlgorithmId, trial *util.TrialAuthPolicy, pcrs tpm2.PCRSelectionList, digests tpm2.DigestList, fallbackPCRs []PCRBankDigests) error {
 	// Compute the policy digest that would result from a TPM2_PolicyPCR assertion for each condition
 	var orDigests tpm2.DigestList
 
@@ -265,6 +267,22 @@ func (d *pcrPolicyData_v0) addPcrAssertions(alg tpm2.HashAlgorithmId, trial *uti
 		orDigests = append(orDigests, trial2.GetDigest())
 	}
 
+	// Compute the policy digests for each condition in alternate PCR banks. These
+	// are added to the same tree, and the alternate selections are determined
+	// at execution time from the primary selection and the banks that are active
+	// on the TPM.
+	for _, bank := range fallbackPCRs {
+		if !isAlternateBankSelection(pcrs, bank.PCRs) {
+			return errors.New("invalid fallback PCR selection")
+		}
+		for _, digest := range bank.Digests {
+			trial2 := util.ComputeAuthPolicy(alg)
+			trial2.SetDigest(trial.GetDigest())
+			trial2.PolicyPCR(digest, bank.PCRs)
+			orDigests = append(orDigests, trial2.GetDigest())
+		}
+	}
+
 	orTree, err := newPolicyOrTree(alg, trial, orDigests)
 	if err != nil {
 		return xerrors.Errorf("cannot create tree for PolicyOR digests: %w", err)
@@ -291,18 +309,62 @@ func (d *pcrPolicyData_v0) authorizePolicy(key crypto.PrivateKey, scheme *tpm2.S
 	return nil
 }
 
-func (d *pcrPolicyData_v0) executePcrAssertions(tpm *tpm2.TPMContext, session tpm2.SessionContext) error {
-	if err := tpm.PolicyPCR(session, nil, d.Selection); err != nil {
+// authorizePolicyWithSigner authorizes the supplied policy with the supplied external
+// signer, using the specified digest algorithm.
+func (d *pcrPolicyData_v0) authorizePolicyWithSigner(signer crypto.Signer, alg tpm2.HashAlgorithmId, approvedPolicy tpm2.Digest, policyRef tpm2.Nonce) error {
+	digest, err := util.ComputePolicyAuthorizeDigest(alg, approvedPolicy, policyRef)
+	if err != nil {
+		return err
+	}
+
+	signature, err := cryptutil.Sign(rand.Reader, signer, digest, alg.GetHash())
+	if err != nil {
+		return err
+	}
+
+	d.AuthorizedPolicy = approvedPolicy
+	d.AuthorizedPolicySignature = signature
+	return nil
+}
+
+// fallbackSelections returns the PCR selections for alternate PCR banks that are
+// active on the TPM and which select the same PCRs as the primary selection. These
+// are only returned if the primary selection selects PCRs from a single bank.
+func (d *pcrPolicyData_v0) fallbackSelections(tpm *tpm2.TPMContext) (tpm2.PCRSelectionList, error) {
+	if !isSingleBankSelection(d.Selection) {
+		return nil, nil
+	}
+
+	active, err := tpm.GetCapabilityPCRs()
+	if err != nil {
+		return nil, err
+	}
+
+	var out tpm2.PCRSelectionList
+	for _, bank := range active {
+		if bank.Hash == d.Selection[0].Hash {
+			continue
+		}
+		selection := tpm2.PCRSelectionList{{Hash: bank.Hash, Select: d.Selection[0].Select}}
+		remaining, err := selection.Remove(tpm2.PCRSelectionList{bank})
+		if err != nil || !remaining.IsEmpty() {
+			// Not all of the selected PCRs are active in this bank.
+			continue
+		}
+		out = append(out, selection[0])
+	}
+
+	return out, nil
+}
+
+func (d *pcrPolicyData_v0) executePcrAssertionsWithSelection(tpm *tpm2.TPMContext, session tpm2.SessionContext, tree *policyOrTree, pcrs tpm2.PCRSelectionList) error {
+	if err := tpm.PolicyPCR(session, nil, pcrs); err != nil {
 		if tpm2.IsTPMParameterError(err, tpm2.ErrorValue, tpm2.CommandPolicyPCR, 2) {
 			return policyDataError{errors.New("invalid PCR selection")}
 		}
 		return err
 	}
 
-	tree, err := d.OrData.resolve()
-	if err != nil {
-		return policyDataError{xerrors.Errorf("cannot resolve PolicyOR tree: %w", err)}
-	}
 	if err := tree.executeAssertions(tpm, session); err != nil {
 		err = xerrors.Errorf("cannot execute PolicyOR assertions: %w", err)
 		switch {
@@ -321,6 +383,57 @@ func (d *pcrPolicyData_v0) executePcrAssertions(tpm *tpm2.TPMContext, session tp
 	return nil
 }
 
+func (d *pcrPolicyData_v0) executePcrAssertions(tpm *tpm2.TPMContext, session tpm2.SessionContext) error {
+	return d.executePcrAssertionsWithPrefix(tpm, session, nil)
+}
+
+// executePcrAssertionsWithPrefix executes the PCR assertions for this policy. If
+// supplied, the prefix function is called to execute any assertions that precede
+// the PCR assertions in the authorized policy again whenever the session has to be
+// restarted in order to try an alternate PCR bank. It is the responsibility of the
+// caller to execute these before calling this function.
+func (d *pcrPolicyData_v0) executePcrAssertionsWithPrefix(tpm *tpm2.TPMContext, session tpm2.SessionContext, prefix func() error) error {
+	tree, err := d.OrData.resolve()
+	if err != nil {
+		return policyDataError{xerrors.Errorf("cannot resolve PolicyOR tree: %w", err)}
+	}
+
+	err = d.executePcrAssertionsWithSelection(tpm, session, tree, d.Selection)
+	if err == nil || !xerrors.Is(err, errSessionDigestNotFound) {
+		return err
+	}
+
+	// The PCR values for the preferred bank don't match any of the approved
+	// values. The policy may contain approved values for alternate banks, so
+	// try each of these.
+	fallback, fallbackErr := d.fallbackSelections(tpm)
+	if fallbackErr != nil {
+		return xerrors.Errorf("cannot determine active PCR banks: %w", fallbackErr)
+	}
+	for _, selection := range fallback {
+		if err := tpm.PolicyRestart(session); err != nil {
+			return err
+		}
+		if prefix != nil {
+			if err := prefix(); err != nil {
+				return err
+			}
+		}
+
+		fallbackErr := d.executePcrAssertionsWithSelection(tpm, session, tree, tpm2.PCRSelectionList{selection})
+		switch {
+		case fallbackErr == nil:
+			return nil
+		case xerrors.Is(fallbackErr, errSessionDigestNotFound):
+			// Try the next bank.
+		default:
+			return fallbackErr
+		}
+	}
+
+	return err
+}
+
 func (d *pcrPolicyData_v0) executeRevocationCheck(tpm *tpm2.TPMContext, counter tpm2.ResourceContext, policySession, revocationCheckSession tpm2.SessionContext) error {
 	operandB := make([]byte, 8)
 	binary.BigEndian.PutUint64(operandB, d.PolicySequence)
@@ -370,7 +483,7 @@ func (p *keyDataPolicy_v0) UpdatePCRPolicy(alg tpm2.HashAlgorithmId, params *pcr
 	pcrData := new(pcrPolicyData_v0)
 
 	trial := util.ComputeAuthPolicy(alg)
-	if err := pcrData.addPcrAssertions(alg, trial, params.pcrs, params.pcrDigests); err != nil {
+	if err := pcrData.addPcrAssertions(alg, trial, params.pcrs, params.pcrDigests, params.fallbackPCRs); err != nil {
 		return xerrors.Errorf("cannot compute base PCR policy: %w", err)
 	}
 
@@ -142,7 +142,7 @@ func (p *keyDataPolicy_v1) UpdatePCRPolicy(alg tpm2.HashAlgorithmId, params *pcr
 	pcrData := new(pcrPolicyData_v1)
 
 	trial := util.ComputeAuthPolicy(alg)
-	if err := pcrData.addPcrAssertions(alg, trial, params.pcrs, params.pcrDigests); err != nil {
+	if err := pcrData.addPcrAssertions(alg, trial, params.pcrs, params.pcrDigests, params.fallbackPCRs); err != nil {
 		return xerrors.Errorf("cannot compute base PCR policy: %w", err)
 	}
 
@@ -23,12 +23,14 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"hash"
 	"math"
 
 	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/cryptutil"
 	"github.com/canonical/go-tpm2/mu"
 	"github.com/canonical/go-tpm2/util"
 
@@ -172,10 +174,16 @@ func (p *keyDataPolicy_v3) PCRPolicySequence() uint64 {
 // validated during execution before executing the corresponding PolicyAuthorize assertion as part of the
 // static policy.
 func (p *keyDataPolicy_v3) UpdatePCRPolicy(alg tpm2.HashAlgorithmId, params *pcrPolicyParams) error {
+	return p.updatePCRPolicy(alg, params, util.ComputeAuthPolicy(alg))
+}
+
+// updatePCRPolicy updates the PCR policy associated with this keyDataPolicy, starting
+// from the digest of the supplied trial policy, which will contain assertions that are
+// executed before the PCR assertions.
+func (p *keyDataPolicy_v3) updatePCRPolicy(alg tpm2.HashAlgorithmId, params *pcrPolicyParams, trial *util.TrialAuthPolicy) error {
 	pcrData := new(pcrPolicyData_v3)
 
-	trial := util.ComputeAuthPolicy(alg)
-	if err := pcrData.addPcrAssertions(alg, trial, params.pcrs, params.pcrDigests); err != nil {
+	if err := pcrData.addPcrAssertions(alg, trial, params.pcrs, params.pcrDigests, params.fallbackPCRs); err != nil {
 		return xerrors.Errorf("cannot compute base PCR policy: %w", err)
 	}
 
@@ -183,6 +191,18 @@ func (p *keyDataPolicy_v3) UpdatePCRPolicy(alg tpm2.HashAlgorithmId, params *pcr
 		pcrData.addRevocationCheck(trial, params.policyCounterName, params.policySequence)
 	}
 
+	if params.signer != nil {
+		if err := p.validateSigner(params.signer); err != nil {
+			return err
+		}
+		if err := pcrData.authorizePolicyWithSigner(params.signer, p.StaticData.AuthPublicKey.NameAlg, trial.GetDigest(), p.StaticData.PCRPolicyRef); err != nil {
+			return xerrors.Errorf("cannot authorize policy: %w", err)
+		}
+
+		p.PCRData = pcrData
+		return nil
+	}
+
 	key, err := deriveV3PolicyAuthKey(p.StaticData.AuthPublicKey.NameAlg.GetHash(), params.key)
 	if err != nil {
 		return xerrors.Errorf("cannot derive auth key: %w", err)
@@ -206,7 +226,20 @@ func (p *keyDataPolicy_v3) SetPCRPolicyFrom(src keyDataPolicy) {
 }
 
 func (p *keyDataPolicy_v3) ExecutePCRPolicy(tpm *tpm2.TPMContext, policySession, _ tpm2.SessionContext) error {
-	if err := p.PCRData.executePcrAssertions(tpm, policySession); err != nil {
+	return p.executePCRPolicy(tpm, policySession, nil)
+}
+
+// executePCRPolicy executes the PCR policy associated with this keyDataPolicy. If
+// supplied, the prefix function is called to execute assertions that precede the PCR
+// assertions in the authorized policy. It is called at the start and again if the
+// session has to be restarted.
+func (p *keyDataPolicy_v3) executePCRPolicy(tpm *tpm2.TPMContext, policySession tpm2.SessionContext, prefix func() error) error {
+	if prefix != nil {
+		if err := prefix(); err != nil {
+			return err
+		}
+	}
+	if err := p.PCRData.executePcrAssertionsWithPrefix(tpm, policySession, prefix); err != nil {
 		return xerrors.Errorf("cannot execute PCR assertions: %w", err)
 	}
 
@@ -276,6 +309,19 @@ func (p *keyDataPolicy_v3) ExecutePCRPolicy(tpm *tpm2.TPMContext, policySession,
 	return nil
 }
 
+// validateSigner verifies that the supplied external signer is associated with
+// this keyDataPolicy.
+func (p *keyDataPolicy_v3) validateSigner(signer crypto.Signer) error {
+	pub, ok := p.StaticData.AuthPublicKey.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return policyDataError{errors.New("unexpected dynamic authorization policy public key type")}
+	}
+	if !pub.Equal(signer.Public()) {
+		return errors.New("signer does not match dynamic authorization policy public key")
+	}
+	return nil
+}
+
 type pcrPolicyCounterContext_v3 struct {
 	tpm       *tpm2.TPMContext
 	index     tpm2.ResourceContext
@@ -292,6 +338,12 @@ func (c *pcrPolicyCounterContext_v3) Increment(key secboot.PrimaryKey) error {
 		return xerrors.Errorf("cannot derive auth key: %w", err)
 	}
 
+	return c.incrementWithSigner(ecdsaKey)
+}
+
+// incrementWithSigner increments the counter value using the supplied signer for
+// authorization, which must correspond to the update key.
+func (c *pcrPolicyCounterContext_v3) incrementWithSigner(signer crypto.Signer) error {
 	// Begin a policy session to increment the index.
 	policySession, err := c.tpm.StartAuthSession(nil, nil, tpm2.SessionTypePolicy, nil, c.index.Name().Algorithm())
 	if err != nil {
@@ -309,12 +361,10 @@ func (c *pcrPolicyCounterContext_v3) Increment(key secboot.PrimaryKey) error {
 	defer c.tpm.FlushContext(keyLoaded)
 
 	// Create a signed authorization. keyData.validate checks that this scheme is compatible with the key
-	scheme := tpm2.SigScheme{
-		Scheme: tpm2.SigSchemeAlgECDSA,
-		Details: &tpm2.SigSchemeU{
-			ECDSA: &tpm2.SigSchemeECDSA{
-				HashAlg: c.updateKey.NameAlg}}}
-	signature, err := util.SignPolicyAuthorization(ecdsaKey, &scheme, policySession.NonceTPM(), nil, []byte("PCR-POLICY-REVOKE"), 0)
+	h := c.updateKey.NameAlg.NewHash()
+	mu.MustMarshalToWriter(h, mu.Raw(policySession.NonceTPM()), int32(0))
+	h.Write([]byte("PCR-POLICY-REVOKE"))
+	signature, err := cryptutil.Sign(rand.Reader, signer, h.Sum(nil), c.updateKey.NameAlg.GetHash())
 	if err != nil {
 		return xerrors.Errorf("cannot sign authorization: %w", err)
 	}
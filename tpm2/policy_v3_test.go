@@ -281,6 +281,73 @@ func (s *policyV3SuiteNoTPM) TestUpdatePCRPolicyDifferentPCRs(c *C) {
 		expectedPolicy:      testutil.DecodeHexString(c, "ce6e3eb8ecd88ef2e21327ad58c77b21a8b563b5b373f1eab08dcc8296c6ee56")})
 }
 
+func (s *policyV3SuiteNoTPM) TestUpdatePCRPolicyWithFallbackPCRs(c *C) {
+	key := make(secboot.PrimaryKey, 32)
+	rand.Read(key)
+
+	authPublicKey := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, key)
+
+	var policyData KeyDataPolicy = &KeyDataPolicy_v3{
+		StaticData: &StaticPolicyData_v3{
+			AuthPublicKey: authPublicKey},
+	}
+
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{4, 7, 12}}}
+	pcrDigests := tpm2.DigestList{hash(crypto.SHA256, "1"), hash(crypto.SHA256, "2")}
+	fallbackPCRs := []PCRBankDigests{
+		{
+			PCRs:    tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA384, Select: []int{4, 7, 12}}},
+			Digests: tpm2.DigestList{hash(crypto.SHA256, "3")},
+		},
+	}
+
+	params := NewPcrPolicyParamsWithFallbackPCRs(key, pcrs, pcrDigests, fallbackPCRs, nil, 0)
+	c.Check(policyData.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+
+	c.Check(policyData.(*KeyDataPolicy_v3).PCRData.Selection, tpm2_testutil.TPMValueDeepEquals, pcrs)
+
+	orTree, err := policyData.(*KeyDataPolicy_v3).PCRData.OrData.Resolve()
+	c.Assert(err, IsNil)
+	var digests tpm2.DigestList
+	for _, digest := range pcrDigests {
+		trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+		trial.PolicyPCR(digest, pcrs)
+		digests = append(digests, trial.GetDigest())
+	}
+	for _, digest := range fallbackPCRs[0].Digests {
+		trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+		trial.PolicyPCR(digest, fallbackPCRs[0].PCRs)
+		digests = append(digests, trial.GetDigest())
+	}
+	s.checkPolicyOrTree(c, tpm2.HashAlgorithmSHA256, digests, orTree)
+
+	trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+	trial.PolicyOR(digests)
+	c.Check(policyData.(*KeyDataPolicy_v3).PCRData.AuthorizedPolicy, DeepEquals, trial.GetDigest())
+}
+
+func (s *policyV3SuiteNoTPM) TestUpdatePCRPolicyWithInvalidFallbackPCRs(c *C) {
+	key := make(secboot.PrimaryKey, 32)
+	rand.Read(key)
+
+	var policyData KeyDataPolicy = &KeyDataPolicy_v3{
+		StaticData: &StaticPolicyData_v3{
+			AuthPublicKey: s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, key)},
+	}
+
+	params := NewPcrPolicyParamsWithFallbackPCRs(key,
+		tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{4, 7, 12}}},
+		tpm2.DigestList{hash(crypto.SHA256, "1")},
+		[]PCRBankDigests{
+			{
+				PCRs:    tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA384, Select: []int{4, 7}}},
+				Digests: tpm2.DigestList{hash(crypto.SHA256, "2")},
+			},
+		}, nil, 0)
+	c.Check(policyData.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), ErrorMatches,
+		`cannot compute base PCR policy: invalid fallback PCR selection`)
+}
+
 func (s *policyV3SuiteNoTPM) TestSetPCRPolicyFrom(c *C) {
 	key := make(secboot.PrimaryKey, 32)
 	rand.Read(key)
@@ -412,6 +479,72 @@ func (s *policyV3Suite) TestExecutePCRPolicy(c *C) {
 	})
 }
 
+func (s *policyV3Suite) TestExecutePCRPolicyFallbackPCRs(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, expectedDigest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, false)
+	c.Assert(err, IsNil)
+
+	// Create a policy where the approved values for the preferred SHA-256 bank
+	// don't match, but the approved values for the fallback SHA-1 bank do.
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{16}}}
+	digest, _ := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, pcrs, tpm2.PCRValues{
+		tpm2.HashAlgorithmSHA256: {16: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "bar")}})
+
+	fallbackPcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA1, Select: []int{16}}}
+	fallbackDigest, _ := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, fallbackPcrs, tpm2.PCRValues{
+		tpm2.HashAlgorithmSHA1: {16: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA1, "foo")}})
+
+	params := NewPcrPolicyParamsWithFallbackPCRs(primaryKey, pcrs, tpm2.DigestList{digest},
+		[]PCRBankDigests{{PCRs: fallbackPcrs, Digests: tpm2.DigestList{fallbackDigest}}}, nil, 0)
+	c.Check(policyData.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+
+	c.Check(s.TPM().PCRReset(s.TPM().PCRHandleContext(16), nil), IsNil)
+	_, err = s.TPM().PCREvent(s.TPM().PCRHandleContext(16), []byte("foo"), nil)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	c.Check(policyData.ExecutePCRPolicy(s.TPM().TPMContext, session, s.TPM().HmacSession()), IsNil)
+
+	digest, err = s.TPM().PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *policyV3Suite) TestExecutePCRPolicyFallbackPCRsNoMatch(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, _, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, false)
+	c.Assert(err, IsNil)
+
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{16}}}
+	digest, _ := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, pcrs, tpm2.PCRValues{
+		tpm2.HashAlgorithmSHA256: {16: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA256, "bar")}})
+
+	fallbackPcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA1, Select: []int{16}}}
+	fallbackDigest, _ := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, fallbackPcrs, tpm2.PCRValues{
+		tpm2.HashAlgorithmSHA1: {16: tpm2test.MakePCRValueFromEvents(tpm2.HashAlgorithmSHA1, "bar")}})
+
+	params := NewPcrPolicyParamsWithFallbackPCRs(primaryKey, pcrs, tpm2.DigestList{digest},
+		[]PCRBankDigests{{PCRs: fallbackPcrs, Digests: tpm2.DigestList{fallbackDigest}}}, nil, 0)
+	c.Check(policyData.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+
+	c.Check(s.TPM().PCRReset(s.TPM().PCRHandleContext(16), nil), IsNil)
+	_, err = s.TPM().PCREvent(s.TPM().PCRHandleContext(16), []byte("foo"), nil)
+	c.Check(err, IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	err = policyData.ExecutePCRPolicy(s.TPM().TPMContext, session, s.TPM().HmacSession())
+	c.Check(IsPolicyDataError(err), testutil.IsTrue)
+	c.Check(err, ErrorMatches, "cannot execute PCR assertions: cannot execute PolicyOR assertions: current session digest not found in policy data")
+}
+
 func (s *policyV3Suite) TestExecutePCRPolicyNoPCRs(c *C) {
 	s.testExecutePCRPolicy(c, &testV3ExecutePCRPolicyData{
 		authKeyNameAlg:      tpm2.HashAlgorithmSHA256,
@@ -0,0 +1,431 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/util"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+type staticPolicyAssertionType uint8
+
+const (
+	staticPolicyAssertionLocality staticPolicyAssertionType = iota + 1
+	staticPolicyAssertionSystemdPCRPolicy
+	staticPolicyAssertionCounterTimer
+	staticPolicyAssertionAuthValueIndex
+)
+
+// policyCounterTimerData contains the arguments for a TPM2_PolicyCounterTimer
+// assertion.
+type policyCounterTimerData struct {
+	OperandB  tpm2.Operand
+	Offset    uint16
+	Operation tpm2.ArithmeticOp
+}
+
+// staticPolicyAssertionData represents the data associated with a single
+// additional assertion in a static policy.
+type staticPolicyAssertionData struct {
+	Locality            *tpm2.Locality
+	SystemdPCRPolicyKey *tpm2.Public
+	CounterTimer        *policyCounterTimerData
+	AuthValueIndex      *tpm2.NVPublic
+}
+
+// Select implements the mu.Union interface.
+func (d *staticPolicyAssertionData) Select(selector reflect.Value) interface{} {
+	switch selector.Interface().(staticPolicyAssertionType) {
+	case staticPolicyAssertionLocality:
+		return &d.Locality
+	case staticPolicyAssertionSystemdPCRPolicy:
+		return &d.SystemdPCRPolicyKey
+	case staticPolicyAssertionCounterTimer:
+		return &d.CounterTimer
+	case staticPolicyAssertionAuthValueIndex:
+		return &d.AuthValueIndex
+	default:
+		return nil
+	}
+}
+
+// staticPolicyAssertion represents an additional assertion in a static
+// policy. Most assertions are executed after the PolicyAuthorize and optional
+// PolicyAuthValue assertions. Assertions that contain their own PolicyAuthorize
+// assertion are executed at the start of the session instead, and form the start
+// of the authorized PCR policy (see isPCRPolicyPrefix).
+type staticPolicyAssertion struct {
+	Type staticPolicyAssertionType
+	Data *staticPolicyAssertionData
+}
+
+// newStaticPolicyLocalityAssertion returns a new assertion that restricts
+// use of the sealed object to the specified localities.
+func newStaticPolicyLocalityAssertion(locality tpm2.Locality) *staticPolicyAssertion {
+	return &staticPolicyAssertion{
+		Type: staticPolicyAssertionLocality,
+		Data: &staticPolicyAssertionData{Locality: &locality}}
+}
+
+// newStaticPolicySystemdPCRPolicyAssertion returns a new assertion that requires
+// a PCR policy signed by systemd-measure with the supplied key to be satisfied.
+func newStaticPolicySystemdPCRPolicyAssertion(key *tpm2.Public) *staticPolicyAssertion {
+	return &staticPolicyAssertion{
+		Type: staticPolicyAssertionSystemdPCRPolicy,
+		Data: &staticPolicyAssertionData{SystemdPCRPolicyKey: key}}
+}
+
+// newStaticPolicyCounterTimerAssertion returns a new assertion that restricts
+// use of the sealed object based on the contents of the TPM's TPMS_TIME_INFO
+// structure.
+func newStaticPolicyCounterTimerAssertion(operandB tpm2.Operand, offset uint16, operation tpm2.ArithmeticOp) *staticPolicyAssertion {
+	return &staticPolicyAssertion{
+		Type: staticPolicyAssertionCounterTimer,
+		Data: &staticPolicyAssertionData{
+			CounterTimer: &policyCounterTimerData{
+				OperandB:  operandB,
+				Offset:    offset,
+				Operation: operation}}}
+}
+
+// newStaticPolicyAuthValueIndexAssertion returns a new assertion that requires
+// knowledge of the authorization value of the NV index with the supplied public
+// area, by way of a TPM2_PolicySecret assertion.
+func newStaticPolicyAuthValueIndexAssertion(pub *tpm2.NVPublic) *staticPolicyAssertion {
+	return &staticPolicyAssertion{
+		Type: staticPolicyAssertionAuthValueIndex,
+		Data: &staticPolicyAssertionData{AuthValueIndex: pub}}
+}
+
+// isPCRPolicyPrefix indicates whether this assertion is executed at the start of
+// the session as part of the authorized PCR policy rather than after the
+// PolicyAuthorize assertion. This is the case for assertions that contain their own
+// PolicyAuthorize assertion, as this resets the session digest.
+func (a *staticPolicyAssertion) isPCRPolicyPrefix() bool {
+	return a.Type == staticPolicyAssertionSystemdPCRPolicy
+}
+
+// computeTrialPolicyLocality updates the supplied trial policy digest
+// for a TPM2_PolicyLocality assertion, which isn't supported by
+// util.TrialAuthPolicy.
+func computeTrialPolicyLocality(alg tpm2.HashAlgorithmId, trial *util.TrialAuthPolicy, locality tpm2.Locality) {
+	h := alg.NewHash()
+	h.Write(trial.GetDigest())
+	mu.MustMarshalToWriter(h, tpm2.CommandPolicyLocality, locality)
+	trial.SetDigest(h.Sum(nil))
+}
+
+// executePolicyLocality executes a TPM2_PolicyLocality assertion, which
+// isn't supported by tpm2.TPMContext.
+func executePolicyLocality(tpm *tpm2.TPMContext, policySession tpm2.SessionContext, locality tpm2.Locality) error {
+	return tpm.StartCommand(tpm2.CommandPolicyLocality).
+		AddHandles(tpm2.UseHandleContext(policySession)).
+		AddParams(locality).
+		Run(nil)
+}
+
+// addToTrial updates the supplied trial policy digest for this assertion.
+func (a *staticPolicyAssertion) addToTrial(alg tpm2.HashAlgorithmId, trial *util.TrialAuthPolicy) error {
+	switch {
+	case a.Type == staticPolicyAssertionLocality && a.Data != nil && a.Data.Locality != nil:
+		computeTrialPolicyLocality(alg, trial, *a.Data.Locality)
+		return nil
+	case a.Type == staticPolicyAssertionSystemdPCRPolicy && a.Data != nil && a.Data.SystemdPCRPolicyKey != nil:
+		name, err := a.Data.SystemdPCRPolicyKey.ComputeName()
+		if err != nil {
+			return xerrors.Errorf("cannot compute name of systemd PCR policy key: %w", err)
+		}
+		trial.PolicyAuthorize(nil, name)
+		return nil
+	case a.Type == staticPolicyAssertionCounterTimer && a.Data != nil && a.Data.CounterTimer != nil:
+		trial.PolicyCounterTimer(a.Data.CounterTimer.OperandB, a.Data.CounterTimer.Offset, a.Data.CounterTimer.Operation)
+		return nil
+	case a.Type == staticPolicyAssertionAuthValueIndex && a.Data != nil && a.Data.AuthValueIndex != nil:
+		name, err := a.Data.AuthValueIndex.ComputeName()
+		if err != nil {
+			return xerrors.Errorf("cannot compute name of authorization value NV index: %w", err)
+		}
+		trial.PolicySecret(name, nil)
+		return nil
+	default:
+		return fmt.Errorf("invalid static policy assertion type %d", a.Type)
+	}
+}
+
+// staticPolicyExecuteParams contains data supplied by the caller that is required
+// to execute some static policy assertions.
+type staticPolicyExecuteParams struct {
+	AuthValue            []byte               // The authorization value of the sealed key object
+	SystemdPCRSignatures SystemdPCRSignatures // The PCR policies signed by systemd-measure for the running UKI
+}
+
+// staticPolicyParamsExecutor is implemented by keyDataPolicy versions that have
+// static policy assertions which require data supplied by the caller.
+type staticPolicyParamsExecutor interface {
+	// ExecutePCRPolicyWithParams is the same as ExecutePCRPolicy, but
+	// also permits assertions that require data supplied by the caller,
+	// such as the authorization value, to be executed.
+	ExecutePCRPolicyWithParams(tpm *tpm2.TPMContext, policySession, hmacSession tpm2.SessionContext, params *staticPolicyExecuteParams) error
+}
+
+// execute executes this assertion with the supplied policy session. The supplied
+// params are only used by assertions that require them. If the authorization value
+// is required, the supplied HMAC session is used to avoid transmitting it in the clear.
+func (a *staticPolicyAssertion) execute(tpm *tpm2.TPMContext, policySession tpm2.SessionContext, params *staticPolicyExecuteParams, hmacSession tpm2.SessionContext) error {
+	if params == nil {
+		params = new(staticPolicyExecuteParams)
+	}
+
+	switch {
+	case a.Type == staticPolicyAssertionLocality && a.Data != nil && a.Data.Locality != nil:
+		if err := executePolicyLocality(tpm, policySession, *a.Data.Locality); err != nil {
+			if tpm2.IsTPMParameterError(err, tpm2.AnyErrorCode, tpm2.CommandPolicyLocality, 1) {
+				return policyDataError{xerrors.Errorf("invalid locality: %w", err)}
+			}
+			return err
+		}
+		return nil
+	case a.Type == staticPolicyAssertionSystemdPCRPolicy && a.Data != nil && a.Data.SystemdPCRPolicyKey != nil:
+		return executeSystemdPCRPolicy(tpm, policySession, a.Data.SystemdPCRPolicyKey, params.SystemdPCRSignatures)
+	case a.Type == staticPolicyAssertionCounterTimer && a.Data != nil && a.Data.CounterTimer != nil:
+		d := a.Data.CounterTimer
+		err := tpm.PolicyCounterTimer(policySession, d.OperandB, d.Offset, d.Operation)
+		switch {
+		case tpm2.IsTPMError(err, tpm2.ErrorPolicy, tpm2.CommandPolicyCounterTimer):
+			return ErrTimeConstraintsNotSatisfied
+		case tpm2.IsTPMParameterError(err, tpm2.AnyErrorCode, tpm2.CommandPolicyCounterTimer, tpm2.AnyParameterIndex):
+			return policyDataError{xerrors.Errorf("invalid counter timer assertion: %w", err)}
+		}
+		return err
+	case a.Type == staticPolicyAssertionAuthValueIndex && a.Data != nil && a.Data.AuthValueIndex != nil:
+		return executeAuthValueIndexAssertion(tpm, policySession, a.Data.AuthValueIndex, params.AuthValue, hmacSession)
+	default:
+		return policyDataError{fmt.Errorf("invalid static policy assertion type %d", a.Type)}
+	}
+}
+
+// staticPolicyAssertions is a list of additional assertions in a static policy.
+type staticPolicyAssertions []*staticPolicyAssertion
+
+// authValueIndex returns the public area of the NV index that the authorization
+// value is bound to, or nil if there isn't one.
+func (l staticPolicyAssertions) authValueIndex() *tpm2.NVPublic {
+	for _, a := range l {
+		if a.Type == staticPolicyAssertionAuthValueIndex && a.Data != nil && a.Data.AuthValueIndex != nil {
+			return a.Data.AuthValueIndex
+		}
+	}
+	return nil
+}
+
+// systemdPCRPolicyKey returns the public area of the key used to sign PCR
+// policies with systemd-measure, or nil if there isn't one.
+func (l staticPolicyAssertions) systemdPCRPolicyKey() *tpm2.Public {
+	for _, a := range l {
+		if a.Type == staticPolicyAssertionSystemdPCRPolicy && a.Data != nil && a.Data.SystemdPCRPolicyKey != nil {
+			return a.Data.SystemdPCRPolicyKey
+		}
+	}
+	return nil
+}
+
+// split returns the assertions that are executed at the start of the session as
+// part of the authorized PCR policy and the assertions that are executed after the
+// PolicyAuthorize assertion, preserving their order.
+func (l staticPolicyAssertions) split() (pcrPolicyPrefix, static staticPolicyAssertions) {
+	for _, a := range l {
+		if a.isPCRPolicyPrefix() {
+			pcrPolicyPrefix = append(pcrPolicyPrefix, a)
+		} else {
+			static = append(static, a)
+		}
+	}
+	return pcrPolicyPrefix, static
+}
+
+func (l staticPolicyAssertions) addToTrial(alg tpm2.HashAlgorithmId, trial *util.TrialAuthPolicy) error {
+	for i, a := range l {
+		if err := a.addToTrial(alg, trial); err != nil {
+			return xerrors.Errorf("cannot compute assertion %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (l staticPolicyAssertions) execute(tpm *tpm2.TPMContext, policySession tpm2.SessionContext, params *staticPolicyExecuteParams, hmacSession tpm2.SessionContext) error {
+	for i, a := range l {
+		if err := a.execute(tpm, policySession, params, hmacSession); err != nil {
+			return xerrors.Errorf("cannot execute assertion %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// staticPolicyData_v4 represents version 4 of the metadata for executing a
+// policy session that never changes for the life of a key. It is the same
+// as version 3, with the addition of a list of assertions that are executed
+// after the PolicyAuthorize and optional PolicyAuthValue assertions, or at the
+// start of the authorized PCR policy.
+type staticPolicyData_v4 struct {
+	AuthPublicKey          *tpm2.Public
+	PCRPolicyRef           tpm2.Nonce
+	PCRPolicyCounterHandle tpm2.Handle
+	RequireAuthValue       bool
+	Assertions             staticPolicyAssertions
+}
+
+// pcrPolicyData_v4 represents version 4 of the PCR policy metadata for
+// executing a policy session, and can be updated. It has the same format
+// as version 3.
+type pcrPolicyData_v4 = pcrPolicyData_v3
+
+// keyDataPolicy_v4 represents version 4 of the metadata for executing a
+// policy session.
+type keyDataPolicy_v4 struct {
+	StaticData *staticPolicyData_v4
+	PCRData    *pcrPolicyData_v4
+}
+
+// newKeyDataPolicyV4 creates a version 4 keyDataPolicy by appending the supplied
+// assertions to the static policy of the supplied policy, which must have been
+// created by newKeyDataPolicy. The supplied digest must be the authorization policy
+// digest returned from newKeyDataPolicy.
+//
+// This returns some policy metadata and a policy digest which is used as the auth
+// policy field of the protected object.
+func newKeyDataPolicyV4(alg tpm2.HashAlgorithmId, policy keyDataPolicy, digest tpm2.Digest, assertions staticPolicyAssertions) (keyDataPolicy, tpm2.Digest, error) {
+	v3, ok := policy.(*keyDataPolicy_v3)
+	if !ok {
+		return nil, nil, errors.New("unexpected policy type")
+	}
+
+	_, static := assertions.split()
+
+	trial := util.ComputeAuthPolicy(alg)
+	trial.SetDigest(digest)
+	if err := static.addToTrial(alg, trial); err != nil {
+		return nil, nil, err
+	}
+
+	return &keyDataPolicy_v4{
+		StaticData: &staticPolicyData_v4{
+			AuthPublicKey:          v3.StaticData.AuthPublicKey,
+			PCRPolicyRef:           v3.StaticData.PCRPolicyRef,
+			PCRPolicyCounterHandle: v3.StaticData.PCRPolicyCounterHandle,
+			RequireAuthValue:       v3.StaticData.RequireAuthValue,
+			Assertions:             assertions},
+		PCRData: v3.PCRData}, trial.GetDigest(), nil
+}
+
+// asV3 returns a version 3 view of this policy, which shares the PCR policy
+// data. The returned policy does not include the additional static assertions.
+func (p *keyDataPolicy_v4) asV3() *keyDataPolicy_v3 {
+	return &keyDataPolicy_v3{
+		StaticData: &staticPolicyData_v3{
+			AuthPublicKey:          p.StaticData.AuthPublicKey,
+			PCRPolicyRef:           p.StaticData.PCRPolicyRef,
+			PCRPolicyCounterHandle: p.StaticData.PCRPolicyCounterHandle,
+			RequireAuthValue:       p.StaticData.RequireAuthValue},
+		PCRData: p.PCRData}
+}
+
+func (p *keyDataPolicy_v4) PCRPolicyCounterHandle() tpm2.Handle {
+	return p.StaticData.PCRPolicyCounterHandle
+}
+
+func (p *keyDataPolicy_v4) PCRPolicySequence() uint64 {
+	return p.PCRData.PolicySequence
+}
+
+// UpdatePCRPolicy updates the PCR policy associated with this keyDataPolicy. This
+// is the same as version 3, except that the PCR policy starts with any assertions
+// that must be executed at the start of the session.
+func (p *keyDataPolicy_v4) UpdatePCRPolicy(alg tpm2.HashAlgorithmId, params *pcrPolicyParams) error {
+	prefix, _ := p.StaticData.Assertions.split()
+
+	trial := util.ComputeAuthPolicy(alg)
+	if err := prefix.addToTrial(alg, trial); err != nil {
+		return xerrors.Errorf("cannot compute PCR policy prefix: %w", err)
+	}
+
+	v3 := p.asV3()
+	if err := v3.updatePCRPolicy(alg, params, trial); err != nil {
+		return err
+	}
+	p.PCRData = v3.PCRData
+	return nil
+}
+
+func (p *keyDataPolicy_v4) SetPCRPolicyFrom(src keyDataPolicy) {
+	p.PCRData = src.(*keyDataPolicy_v4).PCRData
+}
+
+func (p *keyDataPolicy_v4) ExecutePCRPolicy(tpm *tpm2.TPMContext, policySession, hmacSession tpm2.SessionContext) error {
+	return p.ExecutePCRPolicyWithParams(tpm, policySession, hmacSession, nil)
+}
+
+func (p *keyDataPolicy_v4) AuthValueIndex() *tpm2.NVPublic {
+	return p.StaticData.Assertions.authValueIndex()
+}
+
+func (p *keyDataPolicy_v4) SystemdPCRPolicyKey() *tpm2.Public {
+	return p.StaticData.Assertions.systemdPCRPolicyKey()
+}
+
+func (p *keyDataPolicy_v4) ExecutePCRPolicyWithParams(tpm *tpm2.TPMContext, policySession, hmacSession tpm2.SessionContext, params *staticPolicyExecuteParams) error {
+	prefix, static := p.StaticData.Assertions.split()
+
+	var executePrefix func() error
+	if len(prefix) > 0 {
+		executePrefix = func() error {
+			if err := prefix.execute(tpm, policySession, params, hmacSession); err != nil {
+				return xerrors.Errorf("cannot execute PCR policy prefix assertions: %w", err)
+			}
+			return nil
+		}
+	}
+
+	if err := p.asV3().executePCRPolicy(tpm, policySession, executePrefix); err != nil {
+		return err
+	}
+
+	if err := static.execute(tpm, policySession, params, hmacSession); err != nil {
+		return xerrors.Errorf("cannot execute static policy assertions: %w", err)
+	}
+
+	return nil
+}
+
+func (p *keyDataPolicy_v4) PCRPolicyCounterContext(tpm *tpm2.TPMContext, pub *tpm2.NVPublic) (pcrPolicyCounterContext, error) {
+	return p.asV3().PCRPolicyCounterContext(tpm, pub)
+}
+
+func (p *keyDataPolicy_v4) ValidateAuthKey(key secboot.PrimaryKey) error {
+	return p.asV3().ValidateAuthKey(key)
+}
@@ -0,0 +1,196 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"math/rand"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+	tpm2_testutil "github.com/canonical/go-tpm2/testutil"
+	"github.com/canonical/go-tpm2/util"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type policyV4SuiteNoTPM struct {
+	policyV3Mixin
+}
+
+type policyV4Suite struct {
+	tpm2test.TPMTest
+	policyV3Mixin
+}
+
+func (s *policyV4Suite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy | tpm2test.TPMFeatureNV
+}
+
+var _ = Suite(&policyV4Suite{})
+var _ = Suite(&policyV4SuiteNoTPM{})
+
+func (s *policyV4SuiteNoTPM) TestNewKeyDataPolicyV4Locality(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "foo", nil, false)
+	c.Assert(err, IsNil)
+
+	assertions := StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(tpm2.LocalityThree | tpm2.LocalityFour)}
+	policyDataV4, digestV4, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest, assertions)
+	c.Assert(err, IsNil)
+	c.Assert(policyDataV4, testutil.ConvertibleTo, &KeyDataPolicy_v4{})
+
+	// The locality assertion extends the digest as H(digest || TPM_CC_PolicyLocality || locality).
+	h := tpm2.HashAlgorithmSHA256.NewHash()
+	h.Write(digest)
+	mu.MustMarshalToWriter(h, tpm2.CommandPolicyLocality, tpm2.LocalityThree|tpm2.LocalityFour)
+	c.Check(digestV4, DeepEquals, tpm2.Digest(h.Sum(nil)))
+
+	v3 := policyData.(*KeyDataPolicy_v3)
+	c.Check(policyDataV4.(*KeyDataPolicy_v4).StaticData, tpm2_testutil.TPMValueDeepEquals, &StaticPolicyData_v4{
+		AuthPublicKey:          v3.StaticData.AuthPublicKey,
+		PCRPolicyRef:           v3.StaticData.PCRPolicyRef,
+		PCRPolicyCounterHandle: v3.StaticData.PCRPolicyCounterHandle,
+		RequireAuthValue:       v3.StaticData.RequireAuthValue,
+		Assertions:             assertions})
+	c.Check(policyDataV4.PCRPolicyCounterHandle(), Equals, tpm2.HandleNull)
+	c.Check(policyDataV4.ValidateAuthKey(primaryKey), IsNil)
+}
+
+func (s *policyV4SuiteNoTPM) TestNewKeyDataPolicyV4AuthValueIndex(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, true)
+	c.Assert(err, IsNil)
+
+	pub := NewAuthValueIndexPublic(0x01810000)
+	pub.Attrs |= tpm2.AttrNVWritten
+
+	policyDataV4, digestV4, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest,
+		StaticPolicyAssertions{NewStaticPolicyAuthValueIndexAssertion(pub)})
+	c.Assert(err, IsNil)
+
+	trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+	trial.SetDigest(digest)
+	trial.PolicySecret(pub.Name(), nil)
+	c.Check(digestV4, DeepEquals, trial.GetDigest())
+
+	c.Check(policyDataV4.(*KeyDataPolicy_v4).AuthValueIndex(), Equals, pub)
+}
+
+func (s *policyV4SuiteNoTPM) TestAuthValueIndexPublic(c *C) {
+	pub := NewAuthValueIndexPublic(0x01810000)
+	c.Check(pub.Index, Equals, tpm2.Handle(0x01810000))
+	c.Check(pub.Attrs, Equals, tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite|tpm2.AttrNVAuthRead))
+
+	// The index is subject to dictionary attack protection.
+	c.Check(pub.Attrs&tpm2.AttrNVNoDA, Equals, tpm2.NVAttributes(0))
+
+	trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+	trial.PolicyCommandCode(tpm2.CommandNVChangeAuth)
+	trial.PolicyAuthValue()
+	c.Check(pub.AuthPolicy, DeepEquals, trial.GetDigest())
+}
+
+func (s *policyV4SuiteNoTPM) TestNewKeyDataPolicyV4InvalidPolicy(c *C) {
+	_, _, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, new(KeyDataPolicy_v2), nil,
+		StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(tpm2.LocalityZero)})
+	c.Check(err, ErrorMatches, "unexpected policy type")
+}
+
+func (s *policyV4SuiteNoTPM) TestSerialization(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, false)
+	c.Assert(err, IsNil)
+	policyData, _, err = NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest,
+		StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(tpm2.LocalityThree | tpm2.LocalityFour)})
+	c.Assert(err, IsNil)
+
+	b, err := mu.MarshalToBytes(policyData)
+	c.Assert(err, IsNil)
+
+	var policyData2 *KeyDataPolicy_v4
+	_, err = mu.UnmarshalFromBytes(b, &policyData2)
+	c.Assert(err, IsNil)
+	c.Check(policyData2, tpm2_testutil.TPMValueDeepEquals, policyData)
+}
+
+func (s *policyV4SuiteNoTPM) TestUpdatePCRPolicy(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, false)
+	c.Assert(err, IsNil)
+	policyDataV4, _, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest,
+		StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(tpm2.LocalityZero)})
+	c.Assert(err, IsNil)
+
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7}}}
+	params := NewPcrPolicyParams(primaryKey, pcrs, tpm2.DigestList{make(tpm2.Digest, 32)}, nil, 0)
+	c.Check(policyDataV4.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+
+	// The v3 policy produces the same PCR policy.
+	c.Check(policyData.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+	c.Check(policyDataV4.(*KeyDataPolicy_v4).PCRData.AuthorizedPolicy, DeepEquals, policyData.(*KeyDataPolicy_v3).PCRData.AuthorizedPolicy)
+	c.Check(policyDataV4.(*KeyDataPolicy_v4).PCRData.Selection, tpm2_testutil.TPMValueDeepEquals, pcrs)
+}
+
+func (s *policyV4Suite) testExecutePCRPolicyLocality(c *C, locality tpm2.Locality) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, false)
+	c.Assert(err, IsNil)
+	policyData, expectedDigest, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest,
+		StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(locality)})
+	c.Assert(err, IsNil)
+
+	params := NewPcrPolicyParams(primaryKey, tpm2.PCRSelectionList{}, nil, nil, 0)
+	c.Check(policyData.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	c.Check(policyData.ExecutePCRPolicy(s.TPM().TPMContext, session, s.TPM().HmacSession()), IsNil)
+
+	digest, err = s.TPM().PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+}
+
+func (s *policyV4Suite) TestExecutePCRPolicyLocalityZero(c *C) {
+	s.testExecutePCRPolicyLocality(c, tpm2.LocalityZero)
+}
+
+func (s *policyV4Suite) TestExecutePCRPolicyLocalityThreeAndFour(c *C) {
+	s.testExecutePCRPolicyLocality(c, tpm2.LocalityThree|tpm2.LocalityFour)
+}
@@ -20,7 +20,9 @@
 package tpm2
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 
 	"github.com/canonical/go-tpm2"
@@ -38,7 +40,7 @@ const (
 	// Presence Interface Specification", version 1.30, revision 00.52, 28 July 2015.
 	clearPPIRequest string = "5"
 
-	// DA lockout parameters.
+	// Default DA lockout parameters.
 	maxTries        uint32 = 32
 	recoveryTime    uint32 = 7200
 	lockoutRecovery uint32 = 86400
@@ -68,11 +70,93 @@ const (
 	ProvisionModeClear
 )
 
+// DAParameters contains the parameters of the TPM's dictionary attack protection logic.
+type DAParameters struct {
+	// MaxTries is the number of authorization failures for DA protected objects
+	// before the TPM enters lockout mode.
+	MaxTries uint32
+
+	// RecoveryTime is the time in seconds after which the authorization failure
+	// count is decremented by one.
+	RecoveryTime uint32
+
+	// LockoutRecovery is the time in seconds after an authorization failure for
+	// the lockout hierarchy before it can be used again.
+	LockoutRecovery uint32
+}
+
+// DefaultDAParameters returns the dictionary attack parameters that are configured
+// by EnsureProvisioned.
+func DefaultDAParameters() *DAParameters {
+	return &DAParameters{
+		MaxTries:        maxTries,
+		RecoveryTime:    recoveryTime,
+		LockoutRecovery: lockoutRecovery}
+}
+
+// isSatisfiedBy indicates whether the supplied current parameters are at least as
+// strict as these parameters.
+func (p *DAParameters) isSatisfiedBy(current *DAParameters) bool {
+	return current.MaxTries <= p.MaxTries && current.RecoveryTime >= p.RecoveryTime && current.LockoutRecovery >= p.LockoutRecovery
+}
+
+// SRKAlgorithm specifies the algorithm of the storage root key created by
+// Connection.EnsureProvisionedWithOptions.
+type SRKAlgorithm int
+
+const (
+	// SRKAlgorithmDefault specifies that the storage root key should be created
+	// with a custom template that has previously been stored in the TPM, unless
+	// the TPM is cleared, else the default RSA2048 template is used.
+	SRKAlgorithmDefault SRKAlgorithm = iota
+
+	// SRKAlgorithmRSA2048 specifies that the storage root key should be created
+	// with the default RSA2048 template defined in the "TCG TPM v2.0 Provisioning
+	// Guidance" specification. Any custom template that has previously been stored
+	// in the TPM is removed.
+	SRKAlgorithmRSA2048
+
+	// SRKAlgorithmECCNISTP256 specifies that the storage root key should be created
+	// with the ECC NIST P256 template defined in the "TCG TPM v2.0 Provisioning
+	// Guidance" specification. This is much faster to create than a RSA2048 key. The
+	// template is stored in the TPM in the same way as a custom template.
+	SRKAlgorithmECCNISTP256
+)
+
+// ProvisioningOptions provides options for Connection.EnsureProvisionedWithOptions.
+type ProvisioningOptions struct {
+	// SRKTemplate is an optional custom template for the storage root key. If
+	// this is not supplied, a custom template that has previously been stored in
+	// the TPM will be used unless the TPM is cleared. This can't be used in
+	// combination with SRKAlgorithm.
+	SRKTemplate *tpm2.Public
+
+	// SRKAlgorithm optionally selects one of the standard templates for the
+	// storage root key.
+	SRKAlgorithm SRKAlgorithm
+
+	// SRKHandle is an optional persistent handle for the storage root key, which
+	// must be in the range reserved for primary keys in the storage hierarchy
+	// (0x81000000 to 0x8100ffff). If this is not
+	// supplied, a handle that has previously been stored in the TPM will be used
+	// unless the TPM is cleared, else the handle defined in the "TCG TPM v2.0
+	// Provisioning Guidance" specification is used. If there is already an object at
+	// the supplied handle that doesn't match the storage root key template, a
+	// TPMResourceExistsError error is returned rather than evicting it.
+	SRKHandle tpm2.Handle
+
+	// DAParameters are optional custom parameters for the TPM's dictionary attack
+	// protection logic. If these are not supplied, DefaultDAParameters is used.
+	DAParameters *DAParameters
+}
+
 // provisionPrimaryKey provisions a primary key in the specified hierarchy at the specified persistent
-// handle. If session is supplied, it is expected to be a HMAC session with the AttrContinueSession
-// attribute set, and is used for authenticating with the relevant hierarchies to avoid sending the
-// authorization value in the clear.
-func provisionPrimaryKey(tpm *tpm2.TPMContext, hierarchy tpm2.ResourceContext, template *tpm2.Public, handle tpm2.Handle, session tpm2.SessionContext) (tpm2.ResourceContext, error) {
+// handle. If owned is true, any existing object at the handle is evicted. If owned is false, an existing
+// object is only evicted if its public area matches the supplied template, else a TPMResourceExistsError
+// error is returned. If session is supplied, it is expected to be a HMAC session with the
+// AttrContinueSession attribute set, and is used for authenticating with the relevant hierarchies to
+// avoid sending the authorization value in the clear.
+func provisionPrimaryKey(tpm *tpm2.TPMContext, hierarchy tpm2.ResourceContext, template *tpm2.Public, handle tpm2.Handle, owned bool, session tpm2.SessionContext) (tpm2.ResourceContext, error) {
 	obj, err := tpm.CreateResourceContextFromTPM(handle)
 	switch {
 	case err != nil && !tpm2.IsResourceUnavailableError(err, handle):
@@ -81,6 +165,16 @@ func provisionPrimaryKey(tpm *tpm2.TPMContext, hierarchy tpm2.ResourceContext, t
 	case tpm2.IsResourceUnavailableError(err, handle):
 		// No existing object to evict
 	default:
+		if !owned {
+			pub, _, _, err := tpm.ReadPublic(obj)
+			if err != nil {
+				return nil, xerrors.Errorf("cannot read public area of existing object at persistent handle: %w", err)
+			}
+			if !publicMatchesTemplate(pub, template) {
+				return nil, TPMResourceExistsError{handle}
+			}
+		}
+
 		// Evict the current object
 		if _, err := tpm.EvictControl(tpm.OwnerHandleContext(), obj, handle, session); err != nil {
 			return nil, xerrors.Errorf("cannot evict existing object at persistent handle: %w", err)
@@ -134,12 +228,16 @@ func selectSrkTemplate(tpm *tpm2.TPMContext, session tpm2.SessionContext) *tpm2.
 	return tmpl
 }
 
-// provisionStoragePrimaryKey provisions a storage primary key at the well known persistent
+// provisionStoragePrimaryKey provisions a storage primary key at the selected persistent
 // handle. If session is supplied, it is expected to be a HMAC session with the AttrContinueSession
 // attribute set, and is used for authenticating with the relevant hierarchies to avoid sending
 // authorization values in the clear.
 func provisionStoragePrimaryKey(tpm *tpm2.TPMContext, session tpm2.SessionContext) (tpm2.ResourceContext, error) {
-	return provisionPrimaryKey(tpm, tpm.OwnerHandleContext(), selectSrkTemplate(tpm, session), tcg.SRKHandle, session)
+	srkHandle, err := tcg.SelectSRKHandle(tpm)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot select SRK handle: %w", err)
+	}
+	return provisionPrimaryKey(tpm, tpm.OwnerHandleContext(), selectSrkTemplate(tpm, session), srkHandle, true, session)
 }
 
 // storeSrkTemplate stores the supplied template at a well known handle. If session is supplied,
@@ -193,7 +291,103 @@ func removeStoredSrkTemplate(tpm *tpm2.TPMContext, session tpm2.SessionContext)
 	return nil
 }
 
-func (t *Connection) ensureProvisionedInternal(mode ProvisionMode, newLockoutAuth []byte, srkTemplate *tpm2.Public, useExistingSrkTemplate bool) error {
+// storeSrkHandle stores the supplied persistent handle for the storage primary key at a well known
+// handle. If session is supplied, it must be a HMAC session and is used for authenticating with the
+// storage hierarchy to avoid sending authorization values in the clear.
+func storeSrkHandle(tpm *tpm2.TPMContext, handle tpm2.Handle, session tpm2.SessionContext) error {
+	handleB, err := mu.MarshalToBytes(handle)
+	if err != nil {
+		return xerrors.Errorf("cannot marshal handle: %w", err)
+	}
+
+	nv, err := tpm.NVDefineSpace(tpm.OwnerHandleContext(), nil, tcg.MakeSRKHandleIndexPublic(), session)
+	if err != nil {
+		return xerrors.Errorf("cannot define NV index: %w", err)
+	}
+
+	if err := tpm.NVWrite(nv, nv, handleB, 0, nil); err != nil {
+		return xerrors.Errorf("cannot write NV index: %w", err)
+	}
+
+	if err := tpm.NVWriteLock(nv, nv, nil); err != nil {
+		return xerrors.Errorf("cannot write lock NV index: %w", err)
+	}
+
+	return nil
+}
+
+// removeStoredSrkHandle removes the persistent handle for the storage primary key stored at the
+// well known handle, if there is one. If a session is supplied, it must be a HMAC session and is
+// used for authenticating with the storage hierarchy to avoid sending the authorization value in
+// the clear.
+func removeStoredSrkHandle(tpm *tpm2.TPMContext, session tpm2.SessionContext) error {
+	nv, err := tpm.CreateResourceContextFromTPM(tcg.SRKHandleIndexHandle)
+	switch {
+	case err != nil && !tpm2.IsResourceUnavailableError(err, tcg.SRKHandleIndexHandle):
+		// Unexpected error
+		return xerrors.Errorf("cannot create resource context: %w", err)
+	case tpm2.IsResourceUnavailableError(err, tcg.SRKHandleIndexHandle):
+		// Ok, nothing to do
+		return nil
+	}
+
+	if err := tpm.NVUndefineSpace(tpm.OwnerHandleContext(), nv, session); err != nil {
+		return xerrors.Errorf("cannot undefine index: %w", err)
+	}
+
+	return nil
+}
+
+// changeSrkHandle moves the storage primary key from its current persistent handle to the
+// supplied one. The new key is created and persisted and the new handle is stored before the
+// object at the current handle is evicted, so that an interruption never leaves the TPM without
+// a storage primary key at the stored handle. An existing object at the new handle is only
+// evicted if it matches the storage primary key template, else a TPMResourceExistsError error is
+// returned. If session is supplied, it must be a HMAC session and is used for authenticating with
+// the storage hierarchy to avoid sending authorization values in the clear.
+func changeSrkHandle(tpm *tpm2.TPMContext, handle tpm2.Handle, session tpm2.SessionContext) error {
+	current, err := tcg.SelectSRKHandle(tpm)
+	if err != nil {
+		return xerrors.Errorf("cannot select current SRK handle: %w", err)
+	}
+	if handle == current {
+		return nil
+	}
+
+	if _, err := provisionPrimaryKey(tpm, tpm.OwnerHandleContext(), selectSrkTemplate(tpm, session), handle, false, session); err != nil {
+		return xerrors.Errorf("cannot provision storage root key at new handle: %w", err)
+	}
+
+	if err := removeStoredSrkHandle(tpm, session); err != nil {
+		return xerrors.Errorf("cannot remove stored handle: %w", err)
+	}
+	if handle != tcg.SRKHandle {
+		if err := storeSrkHandle(tpm, handle, session); err != nil {
+			return xerrors.Errorf("cannot store handle: %w", err)
+		}
+	}
+
+	obj, err := tpm.CreateResourceContextFromTPM(current)
+	switch {
+	case err != nil && !tpm2.IsResourceUnavailableError(err, current):
+		// Unexpected error
+		return xerrors.Errorf("cannot create context for existing storage root key: %w", err)
+	case tpm2.IsResourceUnavailableError(err, current):
+		// No existing object to evict
+	default:
+		if _, err := tpm.EvictControl(tpm.OwnerHandleContext(), obj, current, session); err != nil {
+			return xerrors.Errorf("cannot evict existing storage root key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *Connection) ensureProvisionedInternal(mode ProvisionMode, newLockoutAuth []byte, srkTemplate *tpm2.Public, useExistingSrkTemplate bool, srkHandle tpm2.Handle, daParams *DAParameters) error {
+	if daParams == nil {
+		daParams = DefaultDAParameters()
+	}
+
 	session := t.HmacSession()
 
 	props, err := t.GetCapabilityTPMProperties(tpm2.PropertyPermanent, 1)
@@ -221,7 +415,7 @@ func (t *Connection) ensureProvisionedInternal(mode ProvisionMode, newLockoutAut
 	}
 
 	// Provision an endorsement key
-	if _, err := provisionPrimaryKey(t.TPMContext, t.EndorsementHandleContext(), tcg.EKTemplate, tcg.EKHandle, session); err != nil {
+	if _, err := provisionPrimaryKey(t.TPMContext, t.EndorsementHandleContext(), tcg.EKTemplate, tcg.EKHandle, true, session); err != nil {
 		switch {
 		case isAuthFailError(err, tpm2.CommandEvictControl, 1):
 			return AuthFailError{tpm2.HandleOwner}
@@ -254,6 +448,19 @@ func (t *Connection) ensureProvisionedInternal(mode ProvisionMode, newLockoutAut
 			return xerrors.Errorf("cannot store custom SRK template: %w", err)
 		}
 	}
+	if srkHandle != tpm2.HandleUnassigned {
+		if err := changeSrkHandle(t.TPMContext, srkHandle, session); err != nil {
+			var e TPMResourceExistsError
+			switch {
+			case isAuthFailError(err, tpm2.AnyCommandCode, 1):
+				return AuthFailError{tpm2.HandleOwner}
+			case xerrors.As(err, &e):
+				return e
+			default:
+				return xerrors.Errorf("cannot change SRK handle: %w", err)
+			}
+		}
+	}
 
 	srk, err := provisionStoragePrimaryKey(t.TPMContext, session)
 	if err != nil {
@@ -286,7 +493,7 @@ func (t *Connection) ensureProvisionedInternal(mode ProvisionMode, newLockoutAut
 		if props[0].Property != tpm2.PropertyMaxAuthFail || props[1].Property != tpm2.PropertyLockoutInterval || props[2].Property != tpm2.PropertyLockoutRecovery {
 			return errors.New("TPM returned values for the wrong properties")
 		}
-		if props[0].Value > maxTries || props[1].Value < recoveryTime || props[2].Value < lockoutRecovery {
+		if !daParams.isSatisfiedBy(&DAParameters{MaxTries: props[0].Value, RecoveryTime: props[1].Value, LockoutRecovery: props[2].Value}) {
 			return ErrTPMProvisioningRequiresLockout
 		}
 
@@ -297,7 +504,7 @@ func (t *Connection) ensureProvisionedInternal(mode ProvisionMode, newLockoutAut
 
 	// Set the DA parameters. Pass the HMAC session here so we don't supply the cleartext auth
 	// value for the lockout hierarchy.
-	if err := t.DictionaryAttackParameters(t.LockoutHandleContext(), maxTries, recoveryTime, lockoutRecovery, session); err != nil {
+	if err := t.DictionaryAttackParameters(t.LockoutHandleContext(), daParams.MaxTries, daParams.RecoveryTime, daParams.LockoutRecovery, session); err != nil {
 		switch {
 		case isAuthFailError(err, tpm2.CommandDictionaryAttackParameters, 1):
 			return AuthFailError{tpm2.HandleLockout}
@@ -379,7 +586,7 @@ func (t *Connection) EnsureProvisionedWithCustomSRK(mode ProvisionMode, newLocko
 		return errors.New("supplied SRK template is not valid for a parent key")
 	}
 
-	return t.ensureProvisionedInternal(mode, newLockoutAuth, srkTemplate, false)
+	return t.ensureProvisionedInternal(mode, newLockoutAuth, srkTemplate, false, tpm2.HandleUnassigned, nil)
 }
 
 // EnsureProvisioned prepares the TPM for full disk encryption. The mode parameter specifies the behaviour of this function.
@@ -428,7 +635,240 @@ func (t *Connection) EnsureProvisionedWithCustomSRK(mode ProvisionMode, newLocko
 // completed without using the lockout hierarchy, but the function should be called again either with mode set to ProvisionModeFull
 // (if the authorization value for the lockout hierarchy is known), or ProvisionModeClear.
 func (t *Connection) EnsureProvisioned(mode ProvisionMode, newLockoutAuth []byte) error {
-	return t.ensureProvisionedInternal(mode, newLockoutAuth, nil, true)
+	return t.ensureProvisionedInternal(mode, newLockoutAuth, nil, true, tpm2.HandleUnassigned, nil)
+}
+
+// EnsureProvisionedWithOptions prepares the TPM for full disk encryption in the same way as
+// EnsureProvisioned, but with the supplied options.
+//
+// If a custom SRK template is supplied, it will be persisted inside the TPM in the same way as
+// EnsureProvisionedWithCustomSRK. If it is not supplied, this behaves like EnsureProvisioned
+// with respect to any previously persisted template. Alternatively, one of the standard SRK
+// templates can be selected with the SRKAlgorithm option. A ECC NIST P256 storage root key is
+// much faster to create than the default RSA2048 one.
+//
+// If a SRK handle is supplied, the storage root key is persisted at this handle instead of the
+// default one, and the handle is persisted inside the TPM so that keys can be unsealed later on.
+// Any storage root key at the previous handle is evicted. If it is not supplied, a previously
+// persisted handle is used unless mode is ProvisionModeClear.
+//
+// If custom dictionary attack parameters are supplied, these are configured instead of the
+// defaults if mode is ProvisionModeClear or ProvisionModeFull. If mode is
+// ProvisionModeWithoutLockout, a ErrTPMProvisioningRequiresLockout error will be returned if
+// the current parameters are less strict than the supplied ones.
+func (t *Connection) EnsureProvisionedWithOptions(mode ProvisionMode, newLockoutAuth []byte, opts *ProvisioningOptions) error {
+	if opts == nil {
+		opts = new(ProvisioningOptions)
+	}
+	if opts.SRKTemplate != nil && !opts.SRKTemplate.IsStorageParent() {
+		return errors.New("supplied SRK template is not valid for a parent key")
+	}
+	if opts.SRKHandle != tpm2.HandleUnassigned && !tcg.IsValidSRKHandle(opts.SRKHandle) {
+		return fmt.Errorf("invalid SRK handle %v", opts.SRKHandle)
+	}
+	if opts.DAParameters != nil && opts.DAParameters.MaxTries == 0 {
+		return errors.New("invalid DA parameters: MaxTries must be greater than zero")
+	}
+
+	srkTemplate := opts.SRKTemplate
+	useExistingSrkTemplate := true
+	switch opts.SRKAlgorithm {
+	case SRKAlgorithmDefault:
+		useExistingSrkTemplate = srkTemplate == nil
+	case SRKAlgorithmRSA2048, SRKAlgorithmECCNISTP256:
+		if srkTemplate != nil {
+			return errors.New("cannot supply both a SRK template and a SRK algorithm")
+		}
+		if opts.SRKAlgorithm == SRKAlgorithmECCNISTP256 {
+			srkTemplate = tcg.ECCSRKTemplate
+		}
+		useExistingSrkTemplate = false
+	default:
+		return fmt.Errorf("invalid SRK algorithm %d", opts.SRKAlgorithm)
+	}
+
+	return t.ensureProvisionedInternal(mode, newLockoutAuth, srkTemplate, useExistingSrkTemplate, opts.SRKHandle, opts.DAParameters)
+}
+
+// ProvisioningStatus describes the current state of the TPM with respect to the
+// changes that EnsureProvisioned makes. It is returned from
+// Connection.ProvisioningStatus.
+type ProvisioningStatus struct {
+	// EKPresent indicates that there is an object at the persistent handle for the
+	// endorsement key.
+	EKPresent bool
+
+	// EKMatchesTemplate indicates that the persistent endorsement key was created
+	// with the template that EnsureProvisioned uses.
+	EKMatchesTemplate bool
+
+	// SRKHandle is the persistent handle for the storage root key, which is a
+	// handle stored in the TPM if one was supplied during provisioning.
+	SRKHandle tpm2.Handle
+
+	// SRKPresent indicates that there is an object at the persistent handle for the
+	// storage root key.
+	SRKPresent bool
+
+	// SRKMatchesTemplate indicates that the persistent storage root key was created
+	// with the template that EnsureProvisioned uses, which is the custom template
+	// if one is stored in the TPM.
+	SRKMatchesTemplate bool
+
+	// CustomSRKTemplate indicates that a custom template for the storage root key
+	// is stored in the TPM (see EnsureProvisionedWithCustomSRK).
+	CustomSRKTemplate bool
+
+	// MaxTries, RecoveryTime and LockoutRecovery are the current dictionary attack
+	// parameters.
+	MaxTries        uint32
+	RecoveryTime    uint32
+	LockoutRecovery uint32
+
+	// DAParametersOK indicates that the dictionary attack parameters are at least
+	// as strict as the ones that provisioning configures. These are the ones
+	// supplied to Connection.ProvisioningStatusWithDAParameters, or
+	// DefaultDAParameters when using Connection.ProvisioningStatus. This is
+	// consistent with Connection.EnsureProvisioned, which doesn't require the
+	// lockout hierarchy for parameters that are already at least as strict.
+	DAParametersOK bool
+
+	// OwnerClearDisabled indicates that TPM2_Clear is disabled.
+	OwnerClearDisabled bool
+
+	// OwnerAuthSet, EndorsementAuthSet and LockoutAuthSet indicate whether the
+	// authorization values for the storage, endorsement and lockout hierarchies
+	// are set.
+	OwnerAuthSet       bool
+	EndorsementAuthSet bool
+	LockoutAuthSet     bool
+
+	// InLockout indicates that the TPM is in dictionary attack lockout mode.
+	InLockout bool
+
+	// LockoutCounter is the current value of the dictionary attack failure counter.
+	LockoutCounter uint32
+}
+
+// IsFullyProvisioned indicates whether the TPM is in the state that
+// EnsureProvisioned with ProvisionModeFull would leave it in.
+func (s *ProvisioningStatus) IsFullyProvisioned() bool {
+	return s.EKPresent && s.EKMatchesTemplate && s.SRKPresent && s.SRKMatchesTemplate &&
+		s.DAParametersOK && s.OwnerClearDisabled && s.LockoutAuthSet
+}
+
+// publicMatchesTemplate indicates whether the supplied public area of a primary
+// key was created from the supplied template, ignoring the unique field.
+func publicMatchesTemplate(pub, template *tpm2.Public) bool {
+	tmpl := *template
+	tmpl.Unique = pub.Unique
+
+	a, err := mu.MarshalToBytes(pub)
+	if err != nil {
+		return false
+	}
+	b, err := mu.MarshalToBytes(&tmpl)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
+}
+
+// persistentKeyStatus returns whether there is a persistent object at the specified
+// handle and whether it matches the supplied template.
+func (t *Connection) persistentKeyStatus(handle tpm2.Handle, template *tpm2.Public) (present, matches bool, err error) {
+	obj, err := t.CreateResourceContextFromTPM(handle)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, handle):
+		return false, false, nil
+	case err != nil:
+		return false, false, xerrors.Errorf("cannot create context: %w", err)
+	}
+
+	pub, _, _, err := t.ReadPublic(obj)
+	if err != nil {
+		return false, false, xerrors.Errorf("cannot read public area: %w", err)
+	}
+	return true, publicMatchesTemplate(pub, template), nil
+}
+
+// ProvisioningStatus returns the current state of the TPM with respect to the
+// changes that EnsureProvisioned makes, without modifying the TPM. This can be
+// used to detect whether a TPM needs to be reprovisioned.
+//
+// Determining whether the storage root key matches a custom template requires
+// knowledge of the authorization value for the storage hierarchy. If this has
+// been set, it must be provided by calling Connection.OwnerHandleContext().SetAuthValue()
+// prior to calling this function, else the default template is assumed.
+//
+// The dictionary attack parameters are compared against DefaultDAParameters. If the
+// TPM is provisioned with custom parameters, use ProvisioningStatusWithDAParameters
+// instead.
+func (t *Connection) ProvisioningStatus() (*ProvisioningStatus, error) {
+	return t.ProvisioningStatusWithDAParameters(nil)
+}
+
+// ProvisioningStatusWithDAParameters is the same as ProvisioningStatus, except that
+// the dictionary attack parameters are compared against the supplied parameters,
+// which should be the ones supplied to EnsureProvisionedWithOptions via
+// ProvisioningOptions.DAParameters. If these are nil, DefaultDAParameters is used.
+func (t *Connection) ProvisioningStatusWithDAParameters(expected *DAParameters) (*ProvisioningStatus, error) {
+	if expected == nil {
+		expected = DefaultDAParameters()
+	}
+
+	status := new(ProvisioningStatus)
+
+	var err error
+	status.EKPresent, status.EKMatchesTemplate, err = t.persistentKeyStatus(tcg.EKHandle, tcg.EKTemplate)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot determine endorsement key status: %w", err)
+	}
+
+	_, err = t.CreateResourceContextFromTPM(srkTemplateHandle)
+	switch {
+	case tpm2.IsResourceUnavailableError(err, srkTemplateHandle):
+		// No custom template
+	case err != nil:
+		return nil, xerrors.Errorf("cannot create context for custom SRK template: %w", err)
+	default:
+		status.CustomSRKTemplate = true
+	}
+
+	status.SRKHandle, err = tcg.SelectSRKHandle(t.TPMContext)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot select storage root key handle: %w", err)
+	}
+	status.SRKPresent, status.SRKMatchesTemplate, err = t.persistentKeyStatus(status.SRKHandle, selectSrkTemplate(t.TPMContext, t.HmacSession()))
+	if err != nil {
+		return nil, xerrors.Errorf("cannot determine storage root key status: %w", err)
+	}
+
+	props, err := t.GetCapabilityTPMProperties(tpm2.PropertyPermanent, 1)
+	if err != nil {
+		return nil, xerrors.Errorf("cannot fetch permanent properties: %w", err)
+	}
+	if len(props) == 0 || props[0].Property != tpm2.PropertyPermanent {
+		return nil, errors.New("TPM returned value for the wrong property")
+	}
+	permanent := tpm2.PermanentAttributes(props[0].Value)
+	status.OwnerAuthSet = permanent&tpm2.AttrOwnerAuthSet > 0
+	status.EndorsementAuthSet = permanent&tpm2.AttrEndorsementAuthSet > 0
+	status.LockoutAuthSet = permanent&tpm2.AttrLockoutAuthSet > 0
+	status.OwnerClearDisabled = permanent&tpm2.AttrDisableClear > 0
+	status.InLockout = permanent&tpm2.AttrInLockout > 0
+
+	da, err := t.DictionaryAttackStatus()
+	if err != nil {
+		return nil, err
+	}
+	status.LockoutCounter = da.FailedTries
+	status.MaxTries = da.MaxTries
+	status.RecoveryTime = da.RecoveryTime
+	status.LockoutRecovery = da.LockoutRecovery
+	status.DAParametersOK = expected.isSatisfiedBy(&da.DAParameters)
+
+	return status, nil
 }
 
 // RequestTPMClearUsingPPI submits a request to the firmware to clear the TPM on the next reboot. This is the only way to clear
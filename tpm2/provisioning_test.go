@@ -543,3 +543,295 @@ func (s *provisioningSuite) TestProvisionWithCustomSRKTemplateOverwritesExisting
 	c.Check(err, IsNil)
 	c.Check(tmplBytes, DeepEquals, mu.MustMarshalToBytes(&template2))
 }
+
+func (s *provisioningSimulatorSuite) TestProvisioningStatusNewTPM(c *C) {
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.EKPresent, testutil.IsFalse)
+	c.Check(status.SRKPresent, testutil.IsFalse)
+	c.Check(status.CustomSRKTemplate, testutil.IsFalse)
+	c.Check(status.OwnerClearDisabled, testutil.IsFalse)
+	c.Check(status.LockoutAuthSet, testutil.IsFalse)
+	c.Check(status.IsFullyProvisioned(), testutil.IsFalse)
+}
+
+func (s *provisioningSimulatorSuite) TestProvisioningStatusAfterProvisioning(c *C) {
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeFull, []byte("1234")), IsNil)
+	s.AddCleanup(func() {
+		// github.com/canonical/go-tpm2/testutil cannot restore this because
+		// EnsureProvisioned uses command parameter encryption. We have to do
+		// this manually else the test fixture fails the test.
+		c.Check(s.TPM().HierarchyChangeAuth(s.TPM().LockoutHandleContext(), nil, nil), IsNil)
+	})
+
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status, DeepEquals, &ProvisioningStatus{
+		EKPresent:          true,
+		EKMatchesTemplate:  true,
+		SRKHandle:          tcg.SRKHandle,
+		SRKPresent:         true,
+		SRKMatchesTemplate: true,
+		MaxTries:           32,
+		RecoveryTime:       7200,
+		LockoutRecovery:    86400,
+		DAParametersOK:     true,
+		OwnerClearDisabled: true,
+		LockoutAuthSet:     true})
+	c.Check(status.IsFullyProvisioned(), testutil.IsTrue)
+}
+
+func (s *provisioningSuite) TestProvisioningStatusSRKMismatch(c *C) {
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeFull, []byte("1234")), IsNil)
+	s.AddCleanup(func() {
+		// github.com/canonical/go-tpm2/testutil cannot restore this because
+		// EnsureProvisioned uses command parameter encryption. We have to do
+		// this manually else the test fixture fails the test.
+		s.HierarchyChangeAuth(c, tpm2.HandleLockout, nil)
+	})
+
+	// Replace the SRK with a key created from a different template
+	template := tcg.MakeDefaultSRKTemplate()
+	template.Params.RSADetail.Symmetric.KeyBits.Sym = 256
+	srk, err := s.TPM().CreateResourceContextFromTPM(tcg.SRKHandle)
+	c.Assert(err, IsNil)
+	s.EvictControl(c, tpm2.HandleOwner, srk, srk.Handle())
+	key := s.CreatePrimary(c, tpm2.HandleOwner, template)
+	s.EvictControl(c, tpm2.HandleOwner, key, tcg.SRKHandle)
+
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.EKPresent, testutil.IsTrue)
+	c.Check(status.EKMatchesTemplate, testutil.IsTrue)
+	c.Check(status.SRKPresent, testutil.IsTrue)
+	c.Check(status.SRKMatchesTemplate, testutil.IsFalse)
+	c.Check(status.DAParametersOK, testutil.IsTrue)
+	c.Check(status.IsFullyProvisioned(), testutil.IsFalse)
+}
+
+func (s *provisioningSuite) TestProvisioningStatusStricterDAParameters(c *C) {
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeFull, []byte("1234")), IsNil)
+	s.AddCleanup(func() {
+		// github.com/canonical/go-tpm2/testutil cannot restore this because
+		// EnsureProvisioned uses command parameter encryption. We have to do
+		// this manually else the test fixture fails the test.
+		s.HierarchyChangeAuth(c, tpm2.HandleLockout, nil)
+	})
+
+	// Parameters that are stricter than the defaults are accepted by
+	// EnsureProvisioned, so they should be reported as OK.
+	s.TPM().LockoutHandleContext().SetAuthValue([]byte("1234"))
+	c.Check(s.TPM().DictionaryAttackParameters(s.TPM().LockoutHandleContext(), 10, 14400, 172800, nil), IsNil)
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil), IsNil)
+
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.MaxTries, Equals, uint32(10))
+	c.Check(status.DAParametersOK, testutil.IsTrue)
+	c.Check(status.IsFullyProvisioned(), testutil.IsTrue)
+}
+
+func (s *provisioningSuite) TestProvisioningStatusWeakerDAParameters(c *C) {
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeFull, []byte("1234")), IsNil)
+	s.AddCleanup(func() {
+		// github.com/canonical/go-tpm2/testutil cannot restore this because
+		// EnsureProvisioned uses command parameter encryption. We have to do
+		// this manually else the test fixture fails the test.
+		s.HierarchyChangeAuth(c, tpm2.HandleLockout, nil)
+	})
+
+	s.TPM().LockoutHandleContext().SetAuthValue([]byte("1234"))
+	c.Check(s.TPM().DictionaryAttackParameters(s.TPM().LockoutHandleContext(), 64, 7200, 86400, nil), IsNil)
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil), Equals, ErrTPMProvisioningRequiresLockout)
+
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.MaxTries, Equals, uint32(64))
+	c.Check(status.DAParametersOK, testutil.IsFalse)
+	c.Check(status.IsFullyProvisioned(), testutil.IsFalse)
+}
+
+type provisioningSuiteNoTPM struct{}
+
+var _ = Suite(&provisioningSuiteNoTPM{})
+
+func (s *provisioningSuiteNoTPM) TestPublicMatchesTemplate(c *C) {
+	pub := tcg.MakeDefaultSRKTemplate()
+	pub.Unique = &tpm2.PublicIDU{RSA: make(tpm2.PublicKeyRSA, 256)}
+	c.Check(PublicMatchesTemplate(pub, tcg.SRKTemplate), testutil.IsTrue)
+}
+
+func (s *provisioningSuiteNoTPM) TestPublicMatchesTemplateMismatch(c *C) {
+	pub := tcg.MakeDefaultSRKTemplate()
+	pub.Unique = &tpm2.PublicIDU{RSA: make(tpm2.PublicKeyRSA, 256)}
+	pub.Attrs |= tpm2.AttrAdminWithPolicy
+	c.Check(PublicMatchesTemplate(pub, tcg.SRKTemplate), testutil.IsFalse)
+}
+
+func (s *provisioningSimulatorSuite) TestProvisionWithCustomDAParameters(c *C) {
+	params := &DAParameters{MaxTries: 10, RecoveryTime: 14400, LockoutRecovery: 172800}
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, []byte("1234"), &ProvisioningOptions{DAParameters: params}), IsNil)
+	s.AddCleanup(func() {
+		// github.com/canonical/go-tpm2/testutil cannot restore this because
+		// EnsureProvisioned uses command parameter encryption. We have to do
+		// this manually else the test fixture fails the test.
+		c.Check(s.TPM().HierarchyChangeAuth(s.TPM().LockoutHandleContext(), nil, nil), IsNil)
+	})
+
+	s.validateEK(c)
+	s.validateSRK(c)
+
+	status, err := s.TPM().DictionaryAttackStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.DAParameters, DeepEquals, *params)
+
+	provStatus, err := s.TPM().ProvisioningStatusWithDAParameters(params)
+	c.Assert(err, IsNil)
+	c.Check(provStatus.DAParametersOK, testutil.IsTrue)
+	c.Check(provStatus.IsFullyProvisioned(), testutil.IsTrue)
+
+	// The default parameters are less strict than the current ones.
+	provStatus, err = s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(provStatus.DAParametersOK, testutil.IsTrue)
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil), IsNil)
+
+	// Stricter parameters require the lockout hierarchy.
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeWithoutLockout, nil, &ProvisioningOptions{
+		DAParameters: &DAParameters{MaxTries: 5, RecoveryTime: 14400, LockoutRecovery: 172800}}), Equals, ErrTPMProvisioningRequiresLockout)
+}
+
+func (s *provisioningSuite) TestProvisionWithOptionsInvalidDAParameters(c *C) {
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, nil, &ProvisioningOptions{DAParameters: new(DAParameters)}), ErrorMatches,
+		`invalid DA parameters: MaxTries must be greater than zero`)
+}
+
+func (s *provisioningSimulatorSuite) TestProvisionWithECCSRK(c *C) {
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, []byte("1234"), &ProvisioningOptions{SRKAlgorithm: SRKAlgorithmECCNISTP256}), IsNil)
+	s.AddCleanup(func() {
+		// github.com/canonical/go-tpm2/testutil cannot restore this because
+		// EnsureProvisioned uses command parameter encryption. We have to do
+		// this manually else the test fixture fails the test.
+		c.Check(s.TPM().HierarchyChangeAuth(s.TPM().LockoutHandleContext(), nil, nil), IsNil)
+	})
+
+	s.validateEK(c)
+	s.validatePrimaryKeyAgainstTemplate(c, tpm2.HandleOwner, tcg.SRKHandle, tcg.ECCSRKTemplate)
+
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.CustomSRKTemplate, testutil.IsTrue)
+	c.Check(status.SRKMatchesTemplate, testutil.IsTrue)
+
+	// Reprovisioning without options should preserve the ECC SRK.
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil), IsNil)
+	s.validatePrimaryKeyAgainstTemplate(c, tpm2.HandleOwner, tcg.SRKHandle, tcg.ECCSRKTemplate)
+
+	// Selecting RSA2048 explicitly should remove the stored template.
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeWithoutLockout, nil, &ProvisioningOptions{SRKAlgorithm: SRKAlgorithmRSA2048}), IsNil)
+	s.validateSRK(c)
+
+	status, err = s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.CustomSRKTemplate, testutil.IsFalse)
+}
+
+func (s *provisioningSimulatorSuite) TestProvisionWithCustomSRKHandle(c *C) {
+	handle := tpm2.Handle(0x81000002)
+
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, []byte("1234"), &ProvisioningOptions{SRKHandle: handle}), IsNil)
+	s.AddCleanup(func() {
+		// github.com/canonical/go-tpm2/testutil cannot restore this because
+		// EnsureProvisioned uses command parameter encryption. We have to do
+		// this manually else the test fixture fails the test.
+		c.Check(s.TPM().HierarchyChangeAuth(s.TPM().LockoutHandleContext(), nil, nil), IsNil)
+	})
+
+	s.validateEK(c)
+	s.validatePrimaryKeyAgainstTemplate(c, tpm2.HandleOwner, handle, tcg.SRKTemplate)
+
+	// The SRK at the default handle should have been evicted.
+	_, err := s.TPM().CreateResourceContextFromTPM(tcg.SRKHandle)
+	c.Check(tpm2.IsResourceUnavailableError(err, tcg.SRKHandle), testutil.IsTrue)
+
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.SRKHandle, Equals, handle)
+	c.Check(status.SRKPresent, testutil.IsTrue)
+	c.Check(status.SRKMatchesTemplate, testutil.IsTrue)
+
+	// Reprovisioning without options should preserve the handle.
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil), IsNil)
+	s.validatePrimaryKeyAgainstTemplate(c, tpm2.HandleOwner, handle, tcg.SRKTemplate)
+
+	// Moving it back to the default handle should work.
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeWithoutLockout, nil, &ProvisioningOptions{SRKHandle: tcg.SRKHandle}), IsNil)
+	s.validateSRK(c)
+	_, err = s.TPM().CreateResourceContextFromTPM(handle)
+	c.Check(tpm2.IsResourceUnavailableError(err, handle), testutil.IsTrue)
+}
+
+func (s *provisioningSimulatorSuite) TestProvisionWithCustomSRKHandleOccupied(c *C) {
+	c.Check(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil), Equals, ErrTPMProvisioningRequiresLockout)
+
+	handle := tpm2.Handle(0x81000002)
+
+	template := tcg.MakeDefaultSRKTemplate()
+	template.Unique.RSA = nil
+	obj := s.CreatePrimary(c, tpm2.HandleOwner, template)
+	s.EvictControl(c, tpm2.HandleOwner, obj, handle)
+
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeWithoutLockout, nil, &ProvisioningOptions{SRKHandle: handle}), Equals,
+		TPMResourceExistsError{handle})
+
+	// The existing object and the SRK at the default handle should be untouched.
+	s.validatePrimaryKeyAgainstTemplate(c, tpm2.HandleOwner, handle, template)
+	s.validateSRK(c)
+
+	status, err := s.TPM().ProvisioningStatus()
+	c.Assert(err, IsNil)
+	c.Check(status.SRKHandle, Equals, tcg.SRKHandle)
+}
+
+func (s *provisioningSuite) TestProvisionWithOptionsInvalidSRKHandle(c *C) {
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, nil, &ProvisioningOptions{SRKHandle: 0x81800000}), ErrorMatches,
+		`invalid SRK handle 0x81800000`)
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, nil, &ProvisioningOptions{SRKHandle: tcg.EKHandle}), ErrorMatches,
+		`invalid SRK handle 0x81010001`)
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, nil, &ProvisioningOptions{SRKHandle: 0x81010002}), ErrorMatches,
+		`invalid SRK handle 0x81010002`)
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, nil, &ProvisioningOptions{SRKHandle: 0x81010000}), ErrorMatches,
+		`invalid SRK handle 0x81010000`)
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, nil, &ProvisioningOptions{SRKHandle: 0x01810001}), ErrorMatches,
+		`invalid SRK handle 0x01810001`)
+}
+
+func (s *provisioningSuite) TestProvisioningStatusUnlockedSRKHandleIndex(c *C) {
+	// An index at the well known SRK handle location that isn't write locked
+	// could have been defined by anyone, so it shouldn't be trusted.
+	handleB, err := mu.MarshalToBytes(tpm2.Handle(0x81000002))
+	c.Assert(err, IsNil)
+	nv := s.NVDefineSpace(c, tpm2.HandleOwner, nil, tcg.MakeSRKHandleIndexPublic())
+	c.Assert(s.TPM().NVWrite(nv, nv, handleB, 0, nil), IsNil)
+
+	_, err = s.TPM().ProvisioningStatus()
+	c.Check(err, ErrorMatches, `cannot select storage root key handle: SRK handle NV index has unexpected attributes .*`)
+}
+
+func (s *provisioningSuite) TestProvisioningStatusForeignSRKHandleIndex(c *C) {
+	s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   tcg.SRKHandleIndexHandle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead | tpm2.AttrNVNoDA),
+		Size:    8})
+
+	_, err := s.TPM().ProvisioningStatus()
+	c.Check(err, ErrorMatches, `cannot select storage root key handle: SRK handle NV index has unexpected attributes .*`)
+}
+
+func (s *provisioningSuite) TestProvisionWithOptionsSRKTemplateAndAlgorithm(c *C) {
+	c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeFull, nil, &ProvisioningOptions{
+		SRKTemplate:  tcg.MakeDefaultSRKTemplate(),
+		SRKAlgorithm: SRKAlgorithmECCNISTP256}), ErrorMatches,
+		`cannot supply both a SRK template and a SRK algorithm`)
+}
@@ -0,0 +1,214 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"errors"
+
+	"github.com/canonical/go-tpm2"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+// ResealKeyParams provides arguments for ResealKeyForTPM.
+type ResealKeyParams struct {
+	// TPM is an optional connection to the target TPM. If this is nil, the
+	// key is sealed offline to the storage primary key supplied via TPMKey.
+	TPM *Connection
+
+	// TPMKey is the public area of the storage primary key on the target TPM,
+	// persisted at the handle that was selected when the TPM was provisioned
+	// (see ProvisioningOptions.SRKHandle). This must be supplied if TPM is nil,
+	// and is ignored otherwise.
+	TPMKey *tpm2.Public
+
+	// PCRProfile defines the profile used to generate the initial PCR policy
+	// for the new sealed key data. If this is nil, the PCR policy is copied from
+	// the existing key, which is only possible for keys that were created with
+	// version 3 or later of the key data format and without a PCR policy counter.
+	// A profile should normally be supplied when moving a key to a new machine,
+	// as the PCR values will be different.
+	PCRProfile *PCRProtectionProfile
+
+	// DeferPCRPolicyCounterCreation permits a key with a PCR policy counter to be
+	// resealed offline, when TPM is nil. The counter isn't created - instead, its
+	// name is computed from its handle and the key that authorizes PCR policies.
+	// The initial PCR policy of the new key data can't be satisfied, so on the
+	// target device, SealedKeyData.EnsurePCRPolicyCounter must be called to create
+	// the counter, followed by SealedKeyData.UpdatePCRProtectionPolicy with
+	// NoNewPCRPolicyVersion.
+	DeferPCRPolicyCounterCreation bool
+}
+
+// ResealKeyForTPM creates new sealed key data for a different TPM that is
+// equivalent to the supplied existing key data, for example, after the TPM or
+// motherboard has been replaced. The primary key for the existing key data must
+// be supplied, and can be obtained by unlocking with a recovery key and then
+// calling secboot.GetPrimaryKeyFromKernel. The new key data has the same primary
+// key, role, PCR policy counter handle and static policy as the existing key data.
+//
+// This can be performed offline using the public area of the target TPM's storage
+// primary key. If the existing key data has a PCR policy counter and a connection
+// to the target TPM is supplied via the TPM field of the params argument, a NV
+// counter will be created at the same handle on the target TPM if one doesn't
+// already exist. If the key is resealed offline, the DeferPCRPolicyCounterCreation
+// field must be set, and the counter must be created on the target device later on
+// (see ResealKeyParams.DeferPCRPolicyCounterCreation).
+//
+// The supplied primary key is validated against the key that authorizes PCR
+// policies for the existing key data, which is derived from it. Keys created with
+// an external PCR policy signer (see ProtectKeyParams.PCRPolicySigner) can't be
+// resealed, as nothing in their key data is derived from the primary key. The
+// primary key couldn't be validated, and supplying the wrong one would create new
+// key data with a primary key that doesn't belong to the storage container.
+//
+// Keys that have time constraints can't be resealed, as these are bound to the
+// clock and reset count of the original TPM.
+//
+// Only keys that are not protected with a passphrase are supported. For a
+// passphrase protected key, the authorization value of the new sealed key object
+// (or of its NV index) has to be derived from the passphrase, which isn't known
+// here - the primary key alone isn't sufficient to create it.
+//
+// The unlock key is derived from the primary key and a unique value that can only
+// be recovered with the original TPM, so the new key data has a different unlock
+// key which is returned from this function and must be added to the storage
+// container.
+func ResealKeyForTPM(key *secboot.KeyData, primaryKey secboot.PrimaryKey, params *ResealKeyParams) (protectedKey *secboot.KeyData, unlockKey secboot.DiskUnlockKey, err error) {
+	// params is mandatory.
+	if params == nil {
+		return nil, nil, errors.New("no ResealKeyParams provided")
+	}
+	if key.AuthMode() != secboot.AuthModeNone {
+		return nil, nil, errors.New("cannot reseal a key that has user authorization")
+	}
+
+	skd, err := NewSealedKeyData(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy := skd.data.Policy()
+
+	// This fails for keys that were created with an external PCR policy
+	// signer, which aren't supported.
+	if err := policy.ValidateAuthKey(primaryKey); err != nil {
+		if isKeyDataError(err) {
+			return nil, nil, InvalidKeyDataError{err.Error()}
+		}
+		return nil, nil, xerrors.Errorf("cannot validate auth key: %w", err)
+	}
+
+	makeParams := &makeSealedKeyDataParams{
+		PcrProfile:             params.PCRProfile,
+		Role:                   key.Role(),
+		PcrPolicyCounterHandle: policy.PCRPolicyCounterHandle(),
+		PrimaryKey:             primaryKey,
+		AuthMode:               secboot.AuthModeNone,
+
+		DeferPcrPolicyCounterCreation: params.DeferPCRPolicyCounterCreation,
+	}
+
+	if v4, ok := policy.(*keyDataPolicy_v4); ok {
+		for _, a := range v4.StaticData.Assertions {
+			switch {
+			case a.Type == staticPolicyAssertionLocality && a.Data != nil && a.Data.Locality != nil:
+				makeParams.PolicyLocality = *a.Data.Locality
+			case a.Type == staticPolicyAssertionSystemdPCRPolicy && a.Data != nil && a.Data.SystemdPCRPolicyKey != nil:
+				makeParams.SystemdPCRPolicyKey = a.Data.SystemdPCRPolicyKey.Public()
+			case a.Type == staticPolicyAssertionCounterTimer:
+				return nil, nil, errors.New("cannot reseal a key that has time constraints")
+			default:
+				return nil, nil, InvalidKeyDataError{"invalid static policy assertion"}
+			}
+		}
+	}
+
+	if params.PCRProfile == nil {
+		switch {
+		case skd.data.Version() < 3:
+			return nil, nil, errors.New("a PCR profile must be supplied for this key data version")
+		case makeParams.PcrPolicyCounterHandle != tpm2.HandleNull:
+			return nil, nil, errors.New("a PCR profile must be supplied for a key with a PCR policy counter")
+		}
+		// The PCR policy is authorized by the same key and for the same
+		// static policy, so it can be copied to the new key.
+		makeParams.PcrPolicyFrom = policy
+	}
+
+	var (
+		tpm     *tpm2.TPMContext
+		sealer  keySealer
+		session tpm2.SessionContext
+	)
+	switch {
+	case params.TPM != nil:
+		tpm = params.TPM.TPMContext
+		sealer = &sealedObjectKeySealer{params.TPM}
+		session = params.TPM.HmacSession()
+	case makeParams.PcrPolicyCounterHandle != tpm2.HandleNull && !params.DeferPCRPolicyCounterCreation:
+		return nil, nil, errors.New("cannot reseal a key with a PCR policy counter without a connection to the target TPM")
+	case params.TPMKey == nil:
+		return nil, nil, errors.New("no TPM connection or storage key supplied")
+	default:
+		sealer = &importableObjectKeySealer{tpmKey: params.TPMKey}
+	}
+
+	protectedKey, _, unlockKey, err = makeSealedKeyData(tpm, makeParams, sealer, makeKeyDataNoAuth, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return protectedKey, unlockKey, nil
+}
+
+// EnsurePCRPolicyCounter creates the PCR policy counter for this key on the supplied
+// TPM if it doesn't already exist. This is used on the target device for keys that
+// were resealed offline with ResealKeyParams.DeferPCRPolicyCounterCreation. After
+// this, the PCR policy must be updated before the key can be used. If the key has no
+// PCR policy counter, this does nothing.
+//
+// This requires knowledge of the authorization value for the storage hierarchy, which
+// must be set on the context returned from Connection.OwnerHandleContext. If the wrong
+// value is set, then a AuthFailError error will be returned. If there is already a NV
+// index at the handle that doesn't correspond to this key's counter, a
+// TPMResourceExistsError error will be returned.
+func (k *SealedKeyData) EnsurePCRPolicyCounter(tpm *Connection) error {
+	handle := k.data.Policy().PCRPolicyCounterHandle()
+	if handle == tpm2.HandleNull {
+		return nil
+	}
+
+	policy, ok := k.data.Policy().(externalPCRPolicyAuthorizer)
+	if !ok {
+		return errors.New("cannot create a PCR policy counter for this key data version")
+	}
+
+	_, err := ensurePcrPolicyCounter(tpm.TPMContext, handle, policy.authPublicKey(), tpm.HmacSession())
+	switch {
+	case tpm2.IsTPMError(err, tpm2.ErrorNVDefined, tpm2.CommandNVDefineSpace):
+		return TPMResourceExistsError{handle}
+	case isAuthFailError(err, tpm2.CommandNVDefineSpace, 1):
+		return AuthFailError{tpm2.HandleOwner}
+	case err != nil:
+		return xerrors.Errorf("cannot create PCR policy counter: %w", err)
+	}
+	return nil
+}
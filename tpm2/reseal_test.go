@@ -0,0 +1,317 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+
+	"github.com/canonical/go-tpm2"
+	tpm2_testutil "github.com/canonical/go-tpm2/testutil"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/tcg"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type resealSuiteNoTPM struct{}
+
+type resealSuite struct {
+	tpm2test.TPMTest
+}
+
+func (s *resealSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureEndorsementHierarchy |
+		tpm2test.TPMFeaturePCR |
+		tpm2test.TPMFeatureNV
+}
+
+func (s *resealSuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+}
+
+var _ = Suite(&resealSuiteNoTPM{})
+var _ = Suite(&resealSuite{})
+
+func (s *resealSuiteNoTPM) newStorageKey(c *C) *tpm2.Public {
+	key, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+	return tpm2_testutil.NewExternalRSAStoragePublicKey(&key.PublicKey)
+}
+
+func (s *resealSuiteNoTPM) newKey(c *C, params *ProtectKeyParams) (*secboot.KeyData, secboot.PrimaryKey) {
+	params.PCRPolicyCounterHandle = tpm2.HandleNull
+	if params.PCRProfile == nil {
+		params.PCRProfile = NewPCRProtectionProfile().AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make(tpm2.Digest, 32))
+	}
+	k, primaryKey, _, err := NewExternalTPMProtectedKey(s.newStorageKey(c), params)
+	c.Assert(err, IsNil)
+	return k, primaryKey
+}
+
+func (s *resealSuiteNoTPM) TestResealOffline(c *C) {
+	k, primaryKey := s.newKey(c, &ProtectKeyParams{Role: "foo"})
+
+	newKey, unlockKey, err := ResealKeyForTPM(k, primaryKey, &ResealKeyParams{TPMKey: s.newStorageKey(c)})
+	c.Assert(err, IsNil)
+	c.Check(unlockKey, HasLen, 32)
+	c.Check(newKey.Role(), Equals, "foo")
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	newSkd, err := NewSealedKeyData(newKey)
+	c.Assert(err, IsNil)
+
+	c.Check(newSkd.Version(), Equals, uint32(3))
+	c.Check(newSkd.PCRPolicyCounterHandle(), Equals, tpm2.HandleNull)
+	c.Check(newSkd.Data().Policy().ValidateAuthKey(primaryKey), IsNil)
+	c.Check(newSkd.Data().Public().AuthPolicy, DeepEquals, skd.Data().Public().AuthPolicy)
+	c.Check(newSkd.Data().Policy().(*KeyDataPolicy_v3).PCRData, tpm2_testutil.TPMValueDeepEquals, skd.Data().Policy().(*KeyDataPolicy_v3).PCRData)
+	c.Check(newSkd.Data().ImportSymSeed(), Not(DeepEquals), skd.Data().ImportSymSeed())
+}
+
+func (s *resealSuiteNoTPM) TestResealOfflineWithProfile(c *C) {
+	k, primaryKey := s.newKey(c, &ProtectKeyParams{})
+
+	profile := NewPCRProtectionProfile().AddPCRValue(tpm2.HashAlgorithmSHA256, 7, testutil.DecodeHexString(c, "a6ec8f6e3b4e4b2b0ad0a1b1bcbe3e8e7c8e3c8e4f1b6f8c5f1c8e7b5a4d3c2b"))
+	newKey, _, err := ResealKeyForTPM(k, primaryKey, &ResealKeyParams{
+		TPMKey:     s.newStorageKey(c),
+		PCRProfile: profile})
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	newSkd, err := NewSealedKeyData(newKey)
+	c.Assert(err, IsNil)
+
+	c.Check(newSkd.Data().Public().AuthPolicy, DeepEquals, skd.Data().Public().AuthPolicy)
+	c.Check(newSkd.Data().Policy().(*KeyDataPolicy_v3).PCRData.AuthorizedPolicy, Not(DeepEquals), skd.Data().Policy().(*KeyDataPolicy_v3).PCRData.AuthorizedPolicy)
+}
+
+func (s *resealSuiteNoTPM) TestResealOfflineV4(c *C) {
+	k, primaryKey := s.newKey(c, &ProtectKeyParams{PolicyLocality: tpm2.LocalityZero | tpm2.LocalityTwo})
+
+	newKey, _, err := ResealKeyForTPM(k, primaryKey, &ResealKeyParams{TPMKey: s.newStorageKey(c)})
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	newSkd, err := NewSealedKeyData(newKey)
+	c.Assert(err, IsNil)
+
+	c.Check(newSkd.Version(), Equals, uint32(4))
+	c.Check(newSkd.Data().Public().AuthPolicy, DeepEquals, skd.Data().Public().AuthPolicy)
+	c.Check(newSkd.Data().Policy().(*KeyDataPolicy_v4).StaticData, tpm2_testutil.TPMValueDeepEquals, skd.Data().Policy().(*KeyDataPolicy_v4).StaticData)
+}
+
+func (s *resealSuiteNoTPM) TestResealOfflineWithSigner(c *C) {
+	// The primary key of a key created with an external PCR policy signer
+	// can't be validated, so these keys can't be resealed.
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	k, primaryKey := s.newKey(c, &ProtectKeyParams{PCRPolicySigner: signer})
+
+	_, _, err = ResealKeyForTPM(k, primaryKey, &ResealKeyParams{TPMKey: s.newStorageKey(c)})
+	c.Check(err, ErrorMatches, `cannot validate auth key: dynamic authorization policy signing private key doesn't match public key`)
+}
+
+func (s *resealSuiteNoTPM) TestResealOfflineWrongPrimaryKey(c *C) {
+	k, _ := s.newKey(c, &ProtectKeyParams{})
+
+	_, _, err := ResealKeyForTPM(k, make(secboot.PrimaryKey, 32), &ResealKeyParams{TPMKey: s.newStorageKey(c)})
+	c.Check(err, ErrorMatches, `cannot validate auth key: dynamic authorization policy signing private key doesn't match public key`)
+}
+
+func (s *resealSuiteNoTPM) TestResealOfflineTimeConstraints(c *C) {
+	resetCount := uint32(3)
+	k, primaryKey := s.newKey(c, &ProtectKeyParams{TimeConstraints: &TimeConstraints{ResetCount: &resetCount}})
+
+	_, _, err := ResealKeyForTPM(k, primaryKey, &ResealKeyParams{TPMKey: s.newStorageKey(c)})
+	c.Check(err, ErrorMatches, `cannot reseal a key that has time constraints`)
+}
+
+func (s *resealSuiteNoTPM) TestResealNoTarget(c *C) {
+	k, primaryKey := s.newKey(c, &ProtectKeyParams{})
+
+	_, _, err := ResealKeyForTPM(k, primaryKey, &ResealKeyParams{})
+	c.Check(err, ErrorMatches, `no TPM connection or storage key supplied`)
+}
+
+func (s *resealSuite) TestResealWithPCRPolicyCounter(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k, primaryKey, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: handle})
+	c.Assert(err, IsNil)
+
+	// Remove the counter to simulate a new TPM.
+	index, err := s.TPM().CreateResourceContextFromTPM(handle)
+	c.Assert(err, IsNil)
+	c.Assert(s.TPM().NVUndefineSpace(s.TPM().OwnerHandleContext(), index, nil), IsNil)
+
+	newKey, unlockKey, err := ResealKeyForTPM(k, primaryKey, &ResealKeyParams{
+		TPM:        s.TPM(),
+		PCRProfile: tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7})})
+	c.Assert(err, IsNil)
+	c.Check(s.TPM().DoesHandleExist(handle), testutil.IsTrue)
+
+	newSkd, err := NewSealedKeyData(newKey)
+	c.Assert(err, IsNil)
+	c.Check(newSkd.PCRPolicyCounterHandle(), Equals, handle)
+	c.Check(newSkd.Validate(s.TPM().TPMContext, primaryKey), IsNil)
+
+	unlockKeyUnsealed, primaryKeyUnsealed, err := newKey.RecoverKeys()
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
+}
+
+func (s *resealSuite) TestResealWithPassphrase(c *C) {
+	k, primaryKey, _, err := NewTPMPassphraseProtectedKey(s.TPM(), &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		KDFOptions: new(secboot.PBKDF2Options)}, "passphrase")
+	c.Assert(err, IsNil)
+
+	_, _, err = ResealKeyForTPM(k, primaryKey, &ResealKeyParams{TPM: s.TPM()})
+	c.Check(err, ErrorMatches, `cannot reseal a key that has user authorization`)
+}
+
+func (s *resealSuite) TestResealWithPCRPolicyCounterOffline(c *C) {
+	k, primaryKey, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000)})
+	c.Assert(err, IsNil)
+
+	srk, err := s.TPM().CreateResourceContextFromTPM(tcg.SRKHandle)
+	c.Assert(err, IsNil)
+	srkPub, _, _, err := s.TPM().ReadPublic(srk)
+	c.Assert(err, IsNil)
+
+	_, _, err = ResealKeyForTPM(k, primaryKey, &ResealKeyParams{
+		TPMKey:     srkPub,
+		PCRProfile: NewPCRProtectionProfile()})
+	c.Check(err, ErrorMatches, `cannot reseal a key with a PCR policy counter without a connection to the target TPM`)
+}
+
+func (s *resealSuite) TestResealWithPCRPolicyCounterOfflineDeferred(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k, primaryKey, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: handle})
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+
+	// Remove the counter to simulate a new TPM.
+	index, err := s.TPM().CreateResourceContextFromTPM(handle)
+	c.Assert(err, IsNil)
+	expectedName := index.Name()
+	c.Assert(s.TPM().NVUndefineSpace(s.TPM().OwnerHandleContext(), index, nil), IsNil)
+
+	srk, err := s.TPM().CreateResourceContextFromTPM(tcg.SRKHandle)
+	c.Assert(err, IsNil)
+	srkPub, _, _, err := s.TPM().ReadPublic(srk)
+	c.Assert(err, IsNil)
+
+	newKey, unlockKey, err := ResealKeyForTPM(k, primaryKey, &ResealKeyParams{
+		TPMKey:                        srkPub,
+		PCRProfile:                    tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		DeferPCRPolicyCounterCreation: true})
+	c.Assert(err, IsNil)
+	c.Check(s.TPM().DoesHandleExist(handle), testutil.IsFalse)
+
+	newSkd, err := NewSealedKeyData(newKey)
+	c.Assert(err, IsNil)
+	c.Check(newSkd.PCRPolicyCounterHandle(), Equals, handle)
+	c.Check(newSkd.Data().Public().AuthPolicy, DeepEquals, skd.Data().Public().AuthPolicy)
+	c.Check(newSkd.Data().Policy().(*KeyDataPolicy_v3).PCRData.PolicySequence, Equals, uint64(0))
+
+	// Create the counter on the target TPM.
+	c.Check(newSkd.EnsurePCRPolicyCounter(s.TPM()), IsNil)
+	index, err = s.TPM().CreateResourceContextFromTPM(handle)
+	c.Assert(err, IsNil)
+	c.Check(index.Name(), DeepEquals, expectedName)
+
+	// The initial PCR policy can't be satisfied until it is updated.
+	_, _, err = newKey.RecoverKeys()
+	c.Check(err, NotNil)
+
+	c.Check(newSkd.UpdatePCRProtectionPolicy(s.TPM(), primaryKey, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}), NoNewPCRPolicyVersion), IsNil)
+
+	unlockKeyUnsealed, primaryKeyUnsealed, err := newKey.RecoverKeys()
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
+}
+
+func (s *resealSuite) TestEnsurePCRPolicyCounterExisting(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: handle})
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	c.Check(skd.EnsurePCRPolicyCounter(s.TPM()), IsNil)
+}
+
+func (s *resealSuite) TestEnsurePCRPolicyCounterWrongIndex(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: handle})
+	c.Assert(err, IsNil)
+
+	// Replace the counter with a different index.
+	index, err := s.TPM().CreateResourceContextFromTPM(handle)
+	c.Assert(err, IsNil)
+	c.Assert(s.TPM().NVUndefineSpace(s.TPM().OwnerHandleContext(), index, nil), IsNil)
+	s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   handle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeCounter.WithAttrs(tpm2.AttrNVOwnerWrite | tpm2.AttrNVOwnerRead),
+		Size:    8})
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	c.Check(skd.EnsurePCRPolicyCounter(s.TPM()), Equals, TPMResourceExistsError{handle})
+}
+
+func (s *resealSuite) TestResealWithPCRPolicyCounterNoProfile(c *C) {
+	k, primaryKey, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}),
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000)})
+	c.Assert(err, IsNil)
+
+	_, _, err = ResealKeyForTPM(k, primaryKey, &ResealKeyParams{TPM: s.TPM()})
+	c.Check(err, ErrorMatches, `a PCR profile must be supplied for a key with a PCR policy counter`)
+}
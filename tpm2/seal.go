@@ -43,7 +43,10 @@ var (
 type ProtectKeyParams struct {
 	// PCRProfile defines the profile used to generate the initial PCR protection
 	// policy for the newly created sealed key data. This can be updated later on
-	// by calling SealedKeyData.UpdatePCRProtectionPolicy.
+	// by calling SealedKeyData.UpdatePCRProtectionPolicy. The profile may contain
+	// values for the same PCRs in more than one PCR bank in different branches, in
+	// which case the bank that appears first is preferred and the others are used as
+	// a fallback (see PCRProtectionProfile.ComputePCRBankDigests).
 	PCRProfile *PCRProtectionProfile
 
 	Role string
@@ -58,6 +61,49 @@ type ProtectKeyParams struct {
 	// owner objects (0x01800000 - 0x01bfffff).
 	PCRPolicyCounterHandle tpm2.Handle
 
+	// PolicyLocality optionally restricts the localities from which the sealed key
+	// can be unsealed, by way of a TPM2_PolicyLocality assertion in the static
+	// authorization policy. This is a bitmask of permitted localities, which must
+	// include the locality that the code unsealing the key accesses the TPM from.
+	// This is locality 0 for code running in the OS or initrd, unless the OS is
+	// launched at another locality (eg, by a dynamic root of trust), in which case
+	// this can be used to prevent the key from being unsealed by code that accesses
+	// the TPM from locality 0. Localities 3 and 4 are not available to the OS, so a
+	// bitmask that only permits these, or an extended locality, is rejected. If it is
+	// zero, then the key is not bound to any locality. Setting this creates a version
+	// 4 key.
+	PolicyLocality tpm2.Locality
+
+	// PCRPolicySigner is an optional external key, such as a key held in a HSM or
+	// an offline vendor key, which is used to authorize PCR policies for the sealed
+	// key instead of a key derived from the primary key. It must be an ECDSA key with
+	// a NIST P-256, P-384 or P-521 curve. When this is set, the initial PCR policy is
+	// authorized with it, and subsequent PCR policies can be created with
+	// NewSignedPCRPolicy and installed with SealedKeyData.InstallSignedPCRPolicy
+	// without the primary key.
+	PCRPolicySigner crypto.Signer
+
+	// SystemdPCRPolicyKey is an optional public key that is used by systemd-measure
+	// to sign PCR policies for UKIs (the key embedded in the .pcrpkey section of a
+	// UKI). When this is set, the sealed key can only be unsealed if one of the PCR
+	// policies embedded in the .pcrsig section of the running UKI is signed with this
+	// key and is satisfied by the current PCR values, in addition to the PCR policy
+	// created from PCRProfile. This means that a kernel update that ships with a new
+	// signed PCR policy doesn't require the sealed key to be updated. The signed PCR
+	// policies are read from the path that systemd-stub copies them to in the initrd.
+	// Only policies for the SHA-256 PCR bank are supported. It must be a RSA key, or
+	// an ECDSA key with a NIST P-256, P-384 or P-521 curve. Setting this creates a
+	// version 4 key.
+	SystemdPCRPolicyKey crypto.PublicKey
+
+	// TimeConstraints optionally restricts use of the sealed key based on the TPM
+	// clock and the TPM reset and restart counters, by way of TPM2_PolicyCounterTimer
+	// assertions in the static authorization policy. This can be used to create a key
+	// that expires or that can only be used until the next TPM reset (see
+	// NewSingleBootTimeConstraints and NewValidForTimeConstraints). Setting this
+	// creates a version 4 key.
+	TimeConstraints *TimeConstraints
+
 	PrimaryKey secboot.PrimaryKey
 }
 
@@ -65,6 +111,25 @@ type PassphraseProtectKeyParams struct {
 	ProtectKeyParams
 
 	KDFOptions secboot.KDFOptions
+
+	// AuthValueIndexHandle is an optional handle at which to create a NV index that
+	// the authorization value derived from the passphrase is bound to, by way of a
+	// TPM2_PolicySecret assertion in the static authorization policy. The authorization
+	// value of the NV index is changed whenever the passphrase is changed, which means
+	// that every earlier copy of the key data can no longer be used with the passphrase
+	// it was protected with. If the key data returned from changing the passphrase is
+	// not persisted, the key can't be recovered with either the old or new passphrase
+	// until the change is repeated with the previous copy of the key data.
+	// ChangeKeyDataPassphraseJournaled does this automatically after an interruption.
+	// A NV index that is no longer used by any key can be removed with
+	// Connection.RemoveOrphanedAuthValueIndices.
+	//
+	// The handle must either be zero or tpm2.HandleNull (in which case, no NV index will
+	// be created), or it must be a valid NV index handle (MSO == 0x01) at which there isn't
+	// already a NV index. The same considerations apply to the choice of handle as for
+	// PCRPolicyCounterHandle. Setting this creates a version 4 key, and requires knowledge
+	// of the authorization value for the storage hierarchy.
+	AuthValueIndexHandle tpm2.Handle
 }
 
 type keyDataConstructor func(skd *SealedKeyData, role string, encryptedPayload []byte, kdfAlg crypto.Hash) (*secboot.KeyData, error)
@@ -99,8 +164,25 @@ type makeSealedKeyDataParams struct {
 	PcrProfile             *PCRProtectionProfile
 	Role                   string
 	PcrPolicyCounterHandle tpm2.Handle
+	PolicyLocality         tpm2.Locality
+	PcrPolicySigner        crypto.Signer
+	SystemdPCRPolicyKey    crypto.PublicKey
+	TimeConstraints        *TimeConstraints
 	PrimaryKey             secboot.PrimaryKey
 	AuthMode               secboot.AuthMode
+	AuthValueIndexHandle   tpm2.Handle
+
+	// PcrPolicyFrom is an optional existing policy from which the initial PCR
+	// policy is copied instead of computing it from PcrProfile. It must be the
+	// same type as the new policy, and its PCR policy must have been authorized
+	// with the same key and for the same static policy.
+	PcrPolicyFrom keyDataPolicy
+
+	// DeferPcrPolicyCounterCreation indicates that the PCR policy counter should
+	// not be created when no TPM connection is supplied. Its public area is
+	// computed instead, and the initial PCR policy can't be satisfied until the
+	// counter is created on the target TPM and the PCR policy is updated.
+	DeferPcrPolicyCounterCreation bool
 }
 
 // makeSealedKeyData makes a sealed key data using the supplied parameters, keySealer implementation,
@@ -110,6 +192,21 @@ type makeSealedKeyDataParams struct {
 // used for authenticating the storage hierarchy in order to avoid trasmitting the cleartext authorization
 // value.
 func makeSealedKeyData(tpm *tpm2.TPMContext, params *makeSealedKeyDataParams, sealer keySealer, constructor keyDataConstructor, session tpm2.SessionContext) (*secboot.KeyData, secboot.PrimaryKey, secboot.DiskUnlockKey, error) {
+	if params.TimeConstraints != nil {
+		if err := params.TimeConstraints.validate(); err != nil {
+			return nil, nil, nil, xerrors.Errorf("invalid time constraints: %w", err)
+		}
+	}
+
+	// The OS can only access the TPM from localities 0 to 2, so a key that
+	// can only be unsealed from other localities can never be unsealed.
+	switch {
+	case params.PolicyLocality >= 32:
+		return nil, nil, nil, errors.New("invalid policy locality: extended localities are not supported")
+	case params.PolicyLocality != 0 && params.PolicyLocality&(tpm2.LocalityZero|tpm2.LocalityOne|tpm2.LocalityTwo) == 0:
+		return nil, nil, nil, errors.New("invalid policy locality: the key could not be unsealed from any locality available to the OS")
+	}
+
 	// Create a primary key, if required.
 	primaryKey := params.PrimaryKey
 	if primaryKey == nil {
@@ -120,18 +217,36 @@ func makeSealedKeyData(tpm *tpm2.TPMContext, params *makeSealedKeyDataParams, se
 	}
 
 	// Create the key for authorizing PCR policy updates.
-	authPublicKey, err := newPolicyAuthPublicKey(primaryKey)
-	if err != nil {
-		return nil, nil, nil, xerrors.Errorf("cannot derive public area of key for signing dynamic authorization policies: %w", err)
+	var authPublicKey *tpm2.Public
+	if params.PcrPolicySigner != nil {
+		var err error
+		authPublicKey, err = newExternalPolicyAuthPublicKey(params.PcrPolicySigner.Public())
+		if err != nil {
+			return nil, nil, nil, xerrors.Errorf("cannot create public area of external key for signing dynamic authorization policies: %w", err)
+		}
+	} else {
+		var err error
+		authPublicKey, err = newPolicyAuthPublicKey(primaryKey)
+		if err != nil {
+			return nil, nil, nil, xerrors.Errorf("cannot derive public area of key for signing dynamic authorization policies: %w", err)
+		}
 	}
 
 	// Create PCR policy counter, if requested and if one doesn't already exist.
 	var pcrPolicyCounterPub *tpm2.NVPublic
-	if params.PcrPolicyCounterHandle != tpm2.HandleNull {
-		if tpm == nil {
-			return nil, nil, nil, errors.New("cannot create a PCR policy counter without a TPM connection")
-		}
-
+	pcrPolicyVersion := resetPcrPolicyVersion
+	switch {
+	case params.PcrPolicyCounterHandle == tpm2.HandleNull:
+		// No PCR policy counter
+	case tpm == nil && params.DeferPcrPolicyCounterCreation:
+		// The public area of the counter is determined by its handle and
+		// the key that authorizes PCR policies.
+		pcrPolicyCounterPub = newPcrPolicyCounterPublic(params.PcrPolicyCounterHandle, authPublicKey)
+		pcrPolicyCounterPub.Attrs |= tpm2.AttrNVWritten
+		pcrPolicyVersion = deferredPcrPolicyVersion
+	case tpm == nil:
+		return nil, nil, nil, errors.New("cannot create a PCR policy counter without a TPM connection")
+	default:
 		var err error
 		pcrPolicyCounterPub, err = ensurePcrPolicyCounter(tpm, params.PcrPolicyCounterHandle, authPublicKey, session)
 		switch {
@@ -153,6 +268,50 @@ func makeSealedKeyData(tpm *tpm2.TPMContext, params *makeSealedKeyDataParams, se
 		return nil, nil, nil, xerrors.Errorf("cannot create initial policy data: %w", err)
 	}
 
+	// Add additional static policy assertions, if required.
+	var assertions staticPolicyAssertions
+	if params.SystemdPCRPolicyKey != nil {
+		key, err := newSystemdPCRPolicyPublicKey(params.SystemdPCRPolicyKey)
+		if err != nil {
+			return nil, nil, nil, xerrors.Errorf("cannot create public area of systemd PCR policy key: %w", err)
+		}
+		assertions = append(assertions, newStaticPolicySystemdPCRPolicyAssertion(key))
+	}
+	if params.PolicyLocality != 0 {
+		assertions = append(assertions, newStaticPolicyLocalityAssertion(params.PolicyLocality))
+	}
+	if params.TimeConstraints != nil {
+		assertions = append(assertions, params.TimeConstraints.assertions()...)
+	}
+	if params.AuthValueIndexHandle != 0 && params.AuthValueIndexHandle != tpm2.HandleNull {
+		if !requireAuthValue {
+			return nil, nil, nil, errors.New("cannot bind the authorization value to a NV index for a key without an authorization value")
+		}
+		if params.AuthValueIndexHandle.Type() != tpm2.HandleTypeNVIndex {
+			return nil, nil, nil, errors.New("invalid authorization value NV index handle")
+		}
+		if tpm == nil {
+			return nil, nil, nil, errors.New("cannot create an authorization value NV index without a TPM connection")
+		}
+
+		pub, err := createAuthValueIndex(tpm, params.AuthValueIndexHandle, session)
+		switch {
+		case tpm2.IsTPMError(err, tpm2.ErrorNVDefined, tpm2.CommandNVDefineSpace):
+			return nil, nil, nil, TPMResourceExistsError{params.AuthValueIndexHandle}
+		case isAuthFailError(err, tpm2.CommandNVDefineSpace, 1):
+			return nil, nil, nil, AuthFailError{tpm2.HandleOwner}
+		case err != nil:
+			return nil, nil, nil, xerrors.Errorf("cannot create new authorization value NV index: %w", err)
+		}
+		assertions = append(assertions, newStaticPolicyAuthValueIndexAssertion(pub))
+	}
+	if len(assertions) > 0 {
+		policyData, authPolicyDigest, err = newKeyDataPolicyV4(nameAlg, policyData, authPolicyDigest, assertions)
+		if err != nil {
+			return nil, nil, nil, xerrors.Errorf("cannot add static policy assertions: %w", err)
+		}
+	}
+
 	// Create a 32 byte symmetric key and 12 byte nonce.
 	var symKey [32 + 12]byte
 	if _, err := rand.Read(symKey[:]); err != nil {
@@ -177,7 +336,13 @@ func makeSealedKeyData(tpm *tpm2.TPMContext, params *makeSealedKeyDataParams, se
 	if pcrProfile == nil {
 		pcrProfile = NewPCRProtectionProfile()
 	}
-	if err := skdbUpdatePCRProtectionPolicyNoValidate(&skd.sealedKeyDataBase, tpm, primaryKey, pcrPolicyCounterPub, pcrProfile, resetPcrPolicyVersion); err != nil {
+	if params.PcrPolicyFrom != nil {
+		skd.data.Policy().SetPCRPolicyFrom(params.PcrPolicyFrom)
+	} else if params.PcrPolicySigner != nil {
+		if err := skd.updatePCRProtectionPolicyWithSignerNoValidate(tpm, params.PcrPolicySigner, pcrPolicyCounterPub, pcrProfile, pcrPolicyVersion); err != nil {
+			return nil, nil, nil, xerrors.Errorf("cannot set initial PCR policy: %w", err)
+		}
+	} else if err := skdbUpdatePCRProtectionPolicyNoValidate(&skd.sealedKeyDataBase, tpm, primaryKey, pcrPolicyCounterPub, pcrProfile, pcrPolicyVersion); err != nil {
 		return nil, nil, nil, xerrors.Errorf("cannot set initial PCR policy: %w", err)
 	}
 
@@ -224,7 +389,8 @@ func makeSealedKeyData(tpm *tpm2.TPMContext, params *makeSealedKeyDataParams, se
 // public part of the TPM's storage primary key.
 //
 // The tpmKey argument must correspond to the storage primary key on the target TPM,
-// persisted at the standard handle (0x81000001).
+// persisted at the handle that was selected when the TPM was provisioned (see
+// ProvisioningOptions.SRKHandle).
 //
 // This function cannot create a sealed key that uses a PCR policy counter. The
 // PCRPolicyCounterHandle field of the params argument must be tpm2.HandleNull.
@@ -246,6 +412,10 @@ func NewExternalTPMProtectedKey(tpmKey *tpm2.Public, params *ProtectKeyParams) (
 	return makeSealedKeyData(nil, &makeSealedKeyDataParams{
 		PrimaryKey:             params.PrimaryKey,
 		PcrPolicyCounterHandle: params.PCRPolicyCounterHandle,
+		PolicyLocality:         params.PolicyLocality,
+		PcrPolicySigner:        params.PCRPolicySigner,
+		SystemdPCRPolicyKey:    params.SystemdPCRPolicyKey,
+		TimeConstraints:        params.TimeConstraints,
 		AuthMode:               secboot.AuthModeNone,
 		Role:                   params.Role,
 		PcrProfile:             params.PCRProfile,
@@ -285,6 +455,10 @@ func NewTPMProtectedKey(tpm *Connection, params *ProtectKeyParams) (protectedKey
 		PcrProfile:             params.PCRProfile,
 		Role:                   params.Role,
 		PcrPolicyCounterHandle: params.PCRPolicyCounterHandle,
+		PolicyLocality:         params.PolicyLocality,
+		PcrPolicySigner:        params.PCRPolicySigner,
+		SystemdPCRPolicyKey:    params.SystemdPCRPolicyKey,
+		TimeConstraints:        params.TimeConstraints,
 		PrimaryKey:             params.PrimaryKey,
 		AuthMode:               secboot.AuthModeNone,
 	}, sealer, makeKeyDataNoAuth, tpm.HmacSession())
@@ -301,7 +475,12 @@ func NewTPMPassphraseProtectedKey(tpm *Connection, params *PassphraseProtectKeyP
 	return makeSealedKeyData(tpm.TPMContext, &makeSealedKeyDataParams{
 		PrimaryKey:             params.PrimaryKey,
 		PcrPolicyCounterHandle: params.PCRPolicyCounterHandle,
+		PolicyLocality:         params.PolicyLocality,
+		PcrPolicySigner:        params.PCRPolicySigner,
+		SystemdPCRPolicyKey:    params.SystemdPCRPolicyKey,
+		TimeConstraints:        params.TimeConstraints,
 		AuthMode:               secboot.AuthModePassphrase,
+		AuthValueIndexHandle:   params.AuthValueIndexHandle,
 		Role:                   params.Role,
 		PcrProfile:             params.PCRProfile,
 	}, sealer, makeKeyDataWithPassphraseConstructor(params.KDFOptions, passphrase), tpm.HmacSession())
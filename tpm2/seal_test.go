@@ -294,6 +294,84 @@ func (s *sealSuite) TestProtectKeyWithTPMWithProvidedPrimaryKey(c *C) {
 		PrimaryKey:             primaryKey})
 }
 
+func (s *sealSuite) TestProtectKeyWithTPMPolicyLocality(c *C) {
+	k, primaryKey, unlockKey, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000),
+		PolicyLocality:         tpm2.LocalityZero})
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	c.Check(skd.Validate(s.TPM().TPMContext, primaryKey), IsNil)
+	c.Check(skd.Version(), Equals, uint32(4))
+
+	unlockKeyUnsealed, primaryKeyUnsealed, err := k.RecoverKeys()
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
+}
+
+func (s *sealSuite) TestProtectKeyWithTPMPolicyLocalityWrongLocality(c *C) {
+	// The test harness sends commands from locality 0.
+	k, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		PolicyLocality:         tpm2.LocalityOne | tpm2.LocalityTwo})
+	c.Assert(err, IsNil)
+
+	_, _, err = k.RecoverKeys()
+	c.Check(err, testutil.ErrorIs, ErrWrongLocality)
+	c.Check(err, ErrorMatches, "the sealed key object cannot be unsealed from the current locality")
+}
+
+func (s *sealSuite) TestProtectKeyWithTPMPassphraseAuthValueIndex(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	k, primaryKey, unlockKey, err := NewTPMPassphraseProtectedKey(s.TPM(), &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		AuthValueIndexHandle: handle}, "passphrase")
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(k)
+	c.Assert(err, IsNil)
+	c.Check(skd.Validate(s.TPM().TPMContext, primaryKey), IsNil)
+	c.Check(skd.Version(), Equals, uint32(4))
+
+	index, err := s.TPM().CreateResourceContextFromTPM(handle)
+	c.Assert(err, IsNil)
+	pub, _, err := s.TPM().NVReadPublic(index)
+	c.Check(err, IsNil)
+	expectedPub := NewAuthValueIndexPublic(handle)
+	expectedPub.Attrs |= tpm2.AttrNVWritten
+	c.Check(pub, tpm2_testutil.TPMValueDeepEquals, expectedPub)
+
+	unlockKeyUnsealed, primaryKeyUnsealed, err := k.RecoverKeysWithPassphrase("passphrase")
+	c.Check(err, IsNil)
+	c.Check(unlockKeyUnsealed, DeepEquals, unlockKey)
+	c.Check(primaryKeyUnsealed, DeepEquals, primaryKey)
+
+	_, _, err = k.RecoverKeysWithPassphrase("1234")
+	c.Check(err, Equals, secboot.ErrInvalidPassphrase)
+}
+
+func (s *sealSuite) TestProtectKeyWithTPMPassphraseAuthValueIndexExists(c *C) {
+	handle := s.NextAvailableHandle(c, 0x01810000)
+	s.NVDefineSpace(c, tpm2.HandleOwner, nil, &tpm2.NVPublic{
+		Index:   handle,
+		NameAlg: tpm2.HashAlgorithmSHA256,
+		Attrs:   tpm2.NVTypeOrdinary.WithAttrs(tpm2.AttrNVAuthWrite | tpm2.AttrNVAuthRead),
+		Size:    8})
+
+	_, _, _, err := NewTPMPassphraseProtectedKey(s.TPM(), &PassphraseProtectKeyParams{
+		ProtectKeyParams: ProtectKeyParams{
+			PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+			PCRPolicyCounterHandle: tpm2.HandleNull},
+		AuthValueIndexHandle: handle}, "passphrase")
+	c.Check(err, Equals, TPMResourceExistsError{handle})
+}
+
 func (s *sealSuite) testProtectKeyWithTPMErrorHandling(c *C, params *ProtectKeyParams) error {
 	var origCounter tpm2.ResourceContext
 	if params != nil && params.PCRPolicyCounterHandle != tpm2.HandleNull {
@@ -670,6 +748,42 @@ func (s *sealSuiteNoTPM) TestMakeSealedKeyData(c *C) {
 	})
 }
 
+func (s *sealSuiteNoTPM) TestMakeSealedKeyDataAuthValueIndexWithoutAuthValue(c *C) {
+	_, _, _, err := MakeSealedKeyData(nil, &SealedKeyDataParams{
+		PcrPolicyCounterHandle: tpm2.HandleNull,
+		AuthMode:               secboot.AuthModeNone,
+		AuthValueIndexHandle:   0x01810000,
+	}, new(mockKeySealer), MakeKeyDataNoAuth, nil)
+	c.Check(err, ErrorMatches, `cannot bind the authorization value to a NV index for a key without an authorization value`)
+}
+
+func (s *sealSuiteNoTPM) TestMakeSealedKeyDataInvalidAuthValueIndexHandle(c *C) {
+	_, _, _, err := MakeSealedKeyData(nil, &SealedKeyDataParams{
+		PcrPolicyCounterHandle: tpm2.HandleNull,
+		AuthMode:               secboot.AuthModePassphrase,
+		AuthValueIndexHandle:   0x81000001,
+	}, new(mockKeySealer), MakeKeyDataNoAuth, nil)
+	c.Check(err, ErrorMatches, `invalid authorization value NV index handle`)
+}
+
+func (s *sealSuiteNoTPM) TestMakeSealedKeyDataProtectedStartupLocalities(c *C) {
+	_, _, _, err := MakeSealedKeyData(nil, &SealedKeyDataParams{
+		PcrPolicyCounterHandle: tpm2.HandleNull,
+		AuthMode:               secboot.AuthModeNone,
+		PolicyLocality:         tpm2.LocalityThree | tpm2.LocalityFour,
+	}, new(mockKeySealer), MakeKeyDataNoAuth, nil)
+	c.Check(err, ErrorMatches, `invalid policy locality: the key could not be unsealed from any locality available to the OS`)
+}
+
+func (s *sealSuiteNoTPM) TestMakeSealedKeyDataExtendedLocality(c *C) {
+	_, _, _, err := MakeSealedKeyData(nil, &SealedKeyDataParams{
+		PcrPolicyCounterHandle: tpm2.HandleNull,
+		AuthMode:               secboot.AuthModeNone,
+		PolicyLocality:         32,
+	}, new(mockKeySealer), MakeKeyDataNoAuth, nil)
+	c.Check(err, ErrorMatches, `invalid policy locality: extended localities are not supported`)
+}
+
 func (s *sealSuiteNoTPM) TestMakeSealedKeyData2(c *C) {
 	s.testMakeSealedKeyData(c, &testMakeSealedKeyDataData{
 		PCRProfile:             NewPCRProtectionProfile(),
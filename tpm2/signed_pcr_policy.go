@@ -0,0 +1,247 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/cryptutil"
+	"github.com/canonical/go-tpm2/mu"
+	"github.com/canonical/go-tpm2/util"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+// externalPCRPolicyAuthorizer is implemented by keyDataPolicy implementations
+// that support PCR policies authorized by an external signer.
+type externalPCRPolicyAuthorizer interface {
+	authPublicKey() *tpm2.Public
+	pcrPolicyRef() tpm2.Nonce
+	pcrPolicyData() *pcrPolicyData_v3
+	setPCRPolicyData(data *pcrPolicyData_v3)
+}
+
+func (p *keyDataPolicy_v3) authPublicKey() *tpm2.Public {
+	return p.StaticData.AuthPublicKey
+}
+
+func (p *keyDataPolicy_v3) pcrPolicyRef() tpm2.Nonce {
+	return p.StaticData.PCRPolicyRef
+}
+
+func (p *keyDataPolicy_v3) pcrPolicyData() *pcrPolicyData_v3 {
+	return p.PCRData
+}
+
+func (p *keyDataPolicy_v3) setPCRPolicyData(data *pcrPolicyData_v3) {
+	p.PCRData = data
+}
+
+func (p *keyDataPolicy_v4) authPublicKey() *tpm2.Public {
+	return p.StaticData.AuthPublicKey
+}
+
+func (p *keyDataPolicy_v4) pcrPolicyRef() tpm2.Nonce {
+	return p.StaticData.PCRPolicyRef
+}
+
+func (p *keyDataPolicy_v4) pcrPolicyData() *pcrPolicyData_v4 {
+	return p.PCRData
+}
+
+func (p *keyDataPolicy_v4) setPCRPolicyData(data *pcrPolicyData_v4) {
+	p.PCRData = data
+}
+
+// SignedPCRPolicy is a PCR policy for a sealed key created with an external
+// PCR policy signer (see ProtectKeyParams.PCRPolicySigner). It can be created
+// centrally with NewSignedPCRPolicy and installed on a device with
+// SealedKeyData.InstallSignedPCRPolicy.
+type SignedPCRPolicy struct {
+	data *pcrPolicyData_v3
+}
+
+// PolicySequence returns the sequence number of this policy, which is used for
+// revocation.
+func (p *SignedPCRPolicy) PolicySequence() uint64 {
+	return p.data.PolicySequence
+}
+
+func (p *SignedPCRPolicy) MarshalJSON() ([]byte, error) {
+	b, err := mu.MarshalToBytes(p.data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(b)
+}
+
+func (p *SignedPCRPolicy) UnmarshalJSON(data []byte) error {
+	var b []byte
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+
+	var d *pcrPolicyData_v3
+	if _, err := mu.UnmarshalFromBytes(b, &d); err != nil {
+		return err
+	}
+
+	p.data = d
+	return nil
+}
+
+// NewSignedPCRPolicy creates a new PCR policy for the supplied key from the supplied
+// profile, authorized with the supplied external signer. The key must have been created
+// with the same signer supplied via ProtectKeyParams.PCRPolicySigner. This does not
+// require access to the TPM or to the primary key, so the PCR profile must not contain
+// values that are read from the TPM.
+//
+// If the key was created with a PCR policy counter, the new policy will include a
+// revocation check for the supplied policy sequence number. The policy can only be
+// installed if the sequence number is not lower than the current value of the counter
+// on the device, and it is revoked when the counter is incremented beyond it. If the
+// key was created without a PCR policy counter, the sequence number is ignored.
+func NewSignedPCRPolicy(key *secboot.KeyData, signer crypto.Signer, pcrProfile *PCRProtectionProfile, policySequence uint64) (*SignedPCRPolicy, error) {
+	skd, err := NewSealedKeyData(key)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, ok := skd.data.Policy().(externalPCRPolicyAuthorizer)
+	if !ok {
+		return nil, errors.New("external PCR policy signers are not supported by this key data version")
+	}
+
+	if pcrProfile == nil {
+		pcrProfile = NewPCRProtectionProfile()
+	}
+	params, err := skd.newPcrPolicyParams(nil, nil, pcrProfile, resetPcrPolicyVersion)
+	if err != nil {
+		return nil, err
+	}
+	params.signer = signer
+
+	if handle := skd.data.Policy().PCRPolicyCounterHandle(); handle != tpm2.HandleNull {
+		// The public area of the counter is determined by its handle and
+		// the key that authorizes PCR policies.
+		counterPub := newPcrPolicyCounterPublic(handle, policy.authPublicKey())
+		counterPub.Attrs |= tpm2.AttrNVWritten
+		params.policyCounterName = counterPub.Name()
+		params.policySequence = policySequence
+	}
+
+	if err := skd.data.Policy().UpdatePCRPolicy(skd.data.Public().NameAlg, params); err != nil {
+		return nil, xerrors.Errorf("cannot create PCR policy: %w", err)
+	}
+
+	return &SignedPCRPolicy{data: policy.pcrPolicyData()}, nil
+}
+
+func (k *sealedKeyDataBase) installSignedPCRPolicy(tpm *tpm2.TPMContext, role string, signedPolicy *SignedPCRPolicy) error {
+	pcrPolicyCounterPub, err := k.validateData(tpm, role)
+	if err != nil {
+		if isKeyDataError(err) {
+			return InvalidKeyDataError{err.Error()}
+		}
+		return xerrors.Errorf("cannot validate key data: %w", err)
+	}
+
+	policy, ok := k.data.Policy().(externalPCRPolicyAuthorizer)
+	if !ok {
+		return errors.New("external PCR policy signers are not supported by this key data version")
+	}
+
+	data := signedPolicy.data
+	if data == nil || data.AuthorizedPolicySignature == nil {
+		return errors.New("invalid PCR policy: no signature")
+	}
+	if _, err := data.OrData.resolve(); err != nil {
+		return xerrors.Errorf("invalid PCR policy: %w", err)
+	}
+
+	authPublicKey := policy.authPublicKey()
+	digest, err := util.ComputePolicyAuthorizeDigest(authPublicKey.NameAlg, data.AuthorizedPolicy, policy.pcrPolicyRef())
+	if err != nil {
+		return xerrors.Errorf("cannot compute PCR policy digest: %w", err)
+	}
+	ok, err = cryptutil.VerifySignature(authPublicKey.Public(), digest, data.AuthorizedPolicySignature)
+	switch {
+	case err != nil:
+		return xerrors.Errorf("cannot verify PCR policy signature: %w", err)
+	case !ok:
+		return errors.New("invalid PCR policy signature")
+	}
+
+	if pcrPolicyCounterPub != nil {
+		context, err := k.data.Policy().PCRPolicyCounterContext(tpm, pcrPolicyCounterPub)
+		if err != nil {
+			return xerrors.Errorf("cannot create context for PCR policy counter: %w", err)
+		}
+		current, err := context.Get()
+		if err != nil {
+			return xerrors.Errorf("cannot read PCR policy counter: %w", err)
+		}
+		if data.PolicySequence < current {
+			return errors.New("PCR policy has been revoked")
+		}
+	}
+	if data.PolicySequence < k.data.Policy().PCRPolicySequence() {
+		return errors.New("PCR policy is older than the current policy")
+	}
+
+	policy.setPCRPolicyData(data)
+	return nil
+}
+
+// InstallSignedPCRPolicy verifies the supplied PCR policy, which must have been created
+// with NewSignedPCRPolicy using the external signer associated with this sealed key, and
+// installs it. This does not require the primary key. The policy will not be installed if
+// it has already been revoked, or if its sequence number is lower than that of the
+// current policy.
+//
+// If validation of the key data fails, a InvalidKeyDataError error will be returned.
+//
+// On success, this SealedKeyData will have an updated PCR policy. It must be persisted
+// using secboot.KeyData.WriteAtomic.
+func (k *SealedKeyData) InstallSignedPCRPolicy(tpm *Connection, policy *SignedPCRPolicy) error {
+	if err := k.installSignedPCRPolicy(tpm.TPMContext, k.k.Role(), policy); err != nil {
+		return xerrors.Errorf("cannot install signed PCR policy: %w", err)
+	}
+	if err := k.k.MarshalAndUpdatePlatformHandle(k); err != nil {
+		return xerrors.Errorf("cannot update TPM platform handle on KeyData: %w", err)
+	}
+	return nil
+}
+
+// PCRPolicyAuthPublicKey returns the public key used to authorize PCR policies for
+// this sealed key. For keys created with an external PCR policy signer, this is the
+// public key of that signer.
+func (k *SealedKeyData) PCRPolicyAuthPublicKey() (crypto.PublicKey, error) {
+	policy, ok := k.data.Policy().(externalPCRPolicyAuthorizer)
+	if !ok {
+		return nil, errors.New("unsupported key data version")
+	}
+	return policy.authPublicKey().Public(), nil
+}
@@ -0,0 +1,251 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+
+	"github.com/canonical/go-tpm2"
+	tpm2_testutil "github.com/canonical/go-tpm2/testutil"
+	"github.com/canonical/go-tpm2/util"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type signedPCRPolicyMixin struct{}
+
+func (_ signedPCRPolicyMixin) checkPolicySignature(c *C, skd *SealedKeyData, data *PcrPolicyData_v3, signer crypto.Signer) {
+	var pcrPolicyRef tpm2.Nonce
+	switch p := skd.Data().Policy().(type) {
+	case *KeyDataPolicy_v3:
+		pcrPolicyRef = p.StaticData.PCRPolicyRef
+	case *KeyDataPolicy_v4:
+		pcrPolicyRef = p.StaticData.PCRPolicyRef
+	default:
+		c.Fatalf("unexpected policy type %T", p)
+	}
+
+	digest, err := util.ComputePolicyAuthorizeDigest(tpm2.HashAlgorithmSHA256, data.AuthorizedPolicy, pcrPolicyRef)
+	c.Assert(err, IsNil)
+
+	c.Assert(data.AuthorizedPolicySignature.SigAlg, Equals, tpm2.SigSchemeAlgECDSA)
+	sig := data.AuthorizedPolicySignature.Signature.ECDSA
+	c.Check(ecdsa.Verify(signer.Public().(*ecdsa.PublicKey), digest,
+		new(big.Int).SetBytes(sig.SignatureR), new(big.Int).SetBytes(sig.SignatureS)), testutil.IsTrue)
+}
+
+type signedPCRPolicySuiteNoTPM struct {
+	signedPCRPolicyMixin
+}
+
+var _ = Suite(&signedPCRPolicySuiteNoTPM{})
+
+func (s *signedPCRPolicySuiteNoTPM) newSigner(c *C) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	return key
+}
+
+func (s *signedPCRPolicySuiteNoTPM) newKey(c *C, signer crypto.Signer) *secboot.KeyData {
+	key, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+	srk := tpm2_testutil.NewExternalRSAStoragePublicKey(&key.PublicKey)
+
+	kd, _, _, err := NewExternalTPMProtectedKey(srk, &ProtectKeyParams{
+		PCRProfile:             NewPCRProtectionProfile().AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make(tpm2.Digest, 32)),
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		PCRPolicySigner:        signer})
+	c.Assert(err, IsNil)
+	return kd
+}
+
+func (s *signedPCRPolicySuiteNoTPM) TestProtectKeyWithSigner(c *C) {
+	signer := s.newSigner(c)
+	kd := s.newKey(c, signer)
+
+	skd, err := NewSealedKeyData(kd)
+	c.Assert(err, IsNil)
+	c.Check(skd.Version(), Equals, uint32(3))
+
+	pub, err := skd.PCRPolicyAuthPublicKey()
+	c.Check(err, IsNil)
+	c.Check(pub, DeepEquals, signer.Public())
+
+	s.checkPolicySignature(c, skd, skd.Data().Policy().(*KeyDataPolicy_v3).PCRData, signer)
+}
+
+func (s *signedPCRPolicySuiteNoTPM) TestProtectKeyWithUnsupportedSigner(c *C) {
+	signer, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+
+	key, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+	srk := tpm2_testutil.NewExternalRSAStoragePublicKey(&key.PublicKey)
+
+	_, _, _, err = NewExternalTPMProtectedKey(srk, &ProtectKeyParams{
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		PCRPolicySigner:        signer})
+	c.Check(err, ErrorMatches, "cannot create public area of external key for signing dynamic authorization policies: unsupported key type")
+}
+
+func (s *signedPCRPolicySuiteNoTPM) TestNewSignedPCRPolicy(c *C) {
+	signer := s.newSigner(c)
+	kd := s.newKey(c, signer)
+
+	profile := NewPCRProtectionProfile().AddPCRValue(tpm2.HashAlgorithmSHA256, 7, testutil.DecodeHexString(c, "a6ec8f6e3b4e4b2b0ad0a1b1bcbe3e8e7c8e3c8e4f1b6f8c5f1c8e7b5a4d3c2b"))
+	policy, err := NewSignedPCRPolicy(kd, signer, profile, 5)
+	c.Assert(err, IsNil)
+
+	// The key has no PCR policy counter, so the sequence is ignored.
+	c.Check(policy.PolicySequence(), Equals, uint64(0))
+	c.Check(policy.Data().Selection, tpm2_testutil.TPMValueDeepEquals, tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7}}})
+
+	skd, err := NewSealedKeyData(kd)
+	c.Assert(err, IsNil)
+	s.checkPolicySignature(c, skd, policy.Data(), signer)
+
+	// The policy is not applied to the supplied key.
+	c.Check(skd.Data().Policy().(*KeyDataPolicy_v3).PCRData.AuthorizedPolicy, Not(DeepEquals), policy.Data().AuthorizedPolicy)
+}
+
+func (s *signedPCRPolicySuiteNoTPM) TestNewSignedPCRPolicyWrongSigner(c *C) {
+	kd := s.newKey(c, s.newSigner(c))
+
+	_, err := NewSignedPCRPolicy(kd, s.newSigner(c), nil, 0)
+	c.Check(err, ErrorMatches, "cannot create PCR policy: signer does not match dynamic authorization policy public key")
+}
+
+func (s *signedPCRPolicySuiteNoTPM) TestSignedPCRPolicyJSON(c *C) {
+	signer := s.newSigner(c)
+	kd := s.newKey(c, signer)
+
+	policy, err := NewSignedPCRPolicy(kd, signer, NewPCRProtectionProfile().AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make(tpm2.Digest, 32)), 0)
+	c.Assert(err, IsNil)
+
+	b, err := json.Marshal(policy)
+	c.Check(err, IsNil)
+
+	var policy2 *SignedPCRPolicy
+	c.Check(json.Unmarshal(b, &policy2), IsNil)
+	c.Check(policy2.Data(), tpm2_testutil.TPMValueDeepEquals, policy.Data())
+}
+
+type signedPCRPolicySuite struct {
+	tpm2test.TPMTest
+	signedPCRPolicyMixin
+}
+
+func (s *signedPCRPolicySuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy | tpm2test.TPMFeatureNV
+}
+
+func (s *signedPCRPolicySuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+}
+
+var _ = Suite(&signedPCRPolicySuite{})
+
+func (s *signedPCRPolicySuite) newKey(c *C, signer crypto.Signer) (*secboot.KeyData, *SealedKeyData) {
+	kd, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             NewPCRProtectionProfile().AddPCRValue(tpm2.HashAlgorithmSHA256, 7, make(tpm2.Digest, 32)),
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000),
+		PCRPolicySigner:        signer})
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(kd)
+	c.Assert(err, IsNil)
+	return kd, skd
+}
+
+func (s *signedPCRPolicySuite) counterValue(c *C, skd *SealedKeyData) uint64 {
+	index, err := s.TPM().CreateResourceContextFromTPM(skd.PCRPolicyCounterHandle())
+	c.Assert(err, IsNil)
+	value, err := s.TPM().NVReadCounter(index, index, nil)
+	c.Assert(err, IsNil)
+	return value
+}
+
+func (s *signedPCRPolicySuite) TestInstallSignedPCRPolicy(c *C) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	kd, skd := s.newKey(c, signer)
+
+	// The initial policy can't be satisfied.
+	_, _, err = kd.RecoverKeys()
+	c.Check(err, NotNil)
+
+	policy, err := NewSignedPCRPolicy(kd, signer, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}), s.counterValue(c, skd))
+	c.Assert(err, IsNil)
+
+	c.Check(skd.InstallSignedPCRPolicy(s.TPM(), policy), IsNil)
+
+	_, _, err = kd.RecoverKeys()
+	c.Check(err, IsNil)
+}
+
+func (s *signedPCRPolicySuite) TestInstallSignedPCRPolicyInvalidSignature(c *C) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	kd, skd := s.newKey(c, signer)
+
+	policy, err := NewSignedPCRPolicy(kd, signer, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}), s.counterValue(c, skd))
+	c.Assert(err, IsNil)
+	policy.Data().AuthorizedPolicy[0] ^= 0xff
+
+	c.Check(skd.InstallSignedPCRPolicy(s.TPM(), policy), ErrorMatches, "cannot install signed PCR policy: invalid PCR policy signature")
+}
+
+func (s *signedPCRPolicySuite) TestRevokeOldPCRProtectionPoliciesWithSigner(c *C) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	kd, skd := s.newKey(c, signer)
+
+	value := s.counterValue(c, skd)
+
+	oldPolicy, err := NewSignedPCRPolicy(kd, signer, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}), value)
+	c.Assert(err, IsNil)
+	newPolicy, err := NewSignedPCRPolicy(kd, signer, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}), value+1)
+	c.Assert(err, IsNil)
+
+	c.Check(skd.InstallSignedPCRPolicy(s.TPM(), newPolicy), IsNil)
+	c.Check(skd.RevokeOldPCRProtectionPoliciesWithSigner(s.TPM(), signer), IsNil)
+	c.Check(s.counterValue(c, skd), Equals, value+1)
+
+	c.Check(skd.InstallSignedPCRPolicy(s.TPM(), oldPolicy), ErrorMatches, "cannot install signed PCR policy: PCR policy has been revoked")
+
+	_, _, err = kd.RecoverKeys()
+	c.Check(err, IsNil)
+}
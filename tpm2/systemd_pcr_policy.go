@@ -0,0 +1,347 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/cryptutil"
+	"github.com/canonical/go-tpm2/templates"
+	"github.com/canonical/go-tpm2/util"
+
+	"golang.org/x/xerrors"
+)
+
+// systemdPCRSignaturePath is the path of the signed PCR policies for the running
+// UKI. systemd-stub copies these from the .pcrsig section of the UKI to the initrd.
+var systemdPCRSignaturePath = "/.extra/tpm2-pcr-signature.json"
+
+// systemdPCRPolicy is implemented by keyDataPolicy versions that support
+// binding a sealed key object to PCR policies signed by systemd-measure.
+type systemdPCRPolicy interface {
+	// SystemdPCRPolicyKey returns the public area of the key used to sign
+	// PCR policies, or nil if there isn't one.
+	SystemdPCRPolicyKey() *tpm2.Public
+}
+
+// SystemdPCRSignature corresponds to a single PCR policy signed by
+// systemd-measure.
+type SystemdPCRSignature struct {
+	PCRs                 []int       // The PCRs included in the policy
+	PublicKeyFingerprint []byte      // The SHA-256 digest of the DER encoded signing key
+	PolicyDigest         tpm2.Digest // The TPM2_PolicyPCR digest that was signed
+	Signature            []byte      // The signature of the SHA-256 digest of PolicyDigest
+}
+
+type systemdPCRSignatureJSON struct {
+	PCRs                 []int  `json:"pcrs"`
+	PublicKeyFingerprint string `json:"pkfp"`
+	PolicyDigest         string `json:"pol"`
+	Signature            string `json:"sig"`
+}
+
+func (s SystemdPCRSignature) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&systemdPCRSignatureJSON{
+		PCRs:                 s.PCRs,
+		PublicKeyFingerprint: hex.EncodeToString(s.PublicKeyFingerprint),
+		PolicyDigest:         hex.EncodeToString(s.PolicyDigest),
+		Signature:            base64.StdEncoding.EncodeToString(s.Signature)})
+}
+
+func (s *SystemdPCRSignature) UnmarshalJSON(data []byte) error {
+	var j *systemdPCRSignatureJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	fp, err := hex.DecodeString(j.PublicKeyFingerprint)
+	if err != nil {
+		return xerrors.Errorf("cannot decode public key fingerprint: %w", err)
+	}
+	pol, err := hex.DecodeString(j.PolicyDigest)
+	if err != nil {
+		return xerrors.Errorf("cannot decode policy digest: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(j.Signature)
+	if err != nil {
+		return xerrors.Errorf("cannot decode signature: %w", err)
+	}
+
+	*s = SystemdPCRSignature{
+		PCRs:                 j.PCRs,
+		PublicKeyFingerprint: fp,
+		PolicyDigest:         pol,
+		Signature:            sig}
+	return nil
+}
+
+// SystemdPCRSignatures corresponds to the signed PCR policies in the JSON format
+// produced by systemd-measure, which is found in the .pcrsig section of a UKI. The
+// policies are indexed by PCR bank. Note that only policies for the SHA-256 bank
+// are supported.
+type SystemdPCRSignatures map[tpm2.HashAlgorithmId][]*SystemdPCRSignature
+
+var systemdPCRBanks = map[string]tpm2.HashAlgorithmId{
+	"sha1":   tpm2.HashAlgorithmSHA1,
+	"sha256": tpm2.HashAlgorithmSHA256,
+	"sha384": tpm2.HashAlgorithmSHA384,
+	"sha512": tpm2.HashAlgorithmSHA512,
+}
+
+func (s SystemdPCRSignatures) MarshalJSON() ([]byte, error) {
+	j := make(map[string][]*SystemdPCRSignature)
+	for name, alg := range systemdPCRBanks {
+		if sigs, ok := s[alg]; ok {
+			j[name] = sigs
+		}
+	}
+	return json.Marshal(j)
+}
+
+func (s *SystemdPCRSignatures) UnmarshalJSON(data []byte) error {
+	var j map[string][]*SystemdPCRSignature
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*s = make(SystemdPCRSignatures)
+	for name, sigs := range j {
+		alg, ok := systemdPCRBanks[name]
+		if !ok {
+			// Ignore banks we don't know about.
+			continue
+		}
+		(*s)[alg] = sigs
+	}
+	return nil
+}
+
+// ReadSystemdPCRSignatures decodes signed PCR policies from the supplied data,
+// which is in the JSON format produced by systemd-measure. Trailing NULL bytes,
+// which are present when reading the contents of a PE section, are ignored.
+func ReadSystemdPCRSignatures(data []byte) (SystemdPCRSignatures, error) {
+	var sigs SystemdPCRSignatures
+	if err := json.Unmarshal(bytes.TrimRight(data, "\x00"), &sigs); err != nil {
+		return nil, err
+	}
+	return sigs, nil
+}
+
+// readSystemdPCRSignatures reads the PCR policies signed by systemd-measure for
+// the running UKI from the path that systemd-stub copies them to in the initrd.
+func readSystemdPCRSignatures() (SystemdPCRSignatures, error) {
+	data, err := os.ReadFile(systemdPCRSignaturePath)
+	if err != nil {
+		return nil, err
+	}
+	return ReadSystemdPCRSignatures(data)
+}
+
+// computeSystemdPCRPublicKeyFingerprint computes the fingerprint of the supplied
+// key in the same way as systemd, which is the SHA-256 digest of its DER encoded
+// SubjectPublicKeyInfo.
+func computeSystemdPCRPublicKeyFingerprint(key crypto.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(der)
+	return h[:], nil
+}
+
+// tpmSignature returns the signature of this policy in a form that can be
+// supplied to the TPM, for the supplied public key.
+func (s *SystemdPCRSignature) tpmSignature(key crypto.PublicKey) (*tpm2.Signature, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return &tpm2.Signature{
+			SigAlg: tpm2.SigSchemeAlgRSASSA,
+			Signature: &tpm2.SignatureU{
+				RSASSA: &tpm2.SignatureRSA{
+					Hash: tpm2.HashAlgorithmSHA256,
+					Sig:  s.Signature}}}, nil
+	case *ecdsa.PublicKey:
+		var sig struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(s.Signature, &sig); err != nil {
+			return nil, xerrors.Errorf("cannot decode ECDSA signature: %w", err)
+		}
+		return &tpm2.Signature{
+			SigAlg: tpm2.SigSchemeAlgECDSA,
+			Signature: &tpm2.SignatureU{
+				ECDSA: &tpm2.SignatureECC{
+					Hash:       tpm2.HashAlgorithmSHA256,
+					SignatureR: sig.R.Bytes(),
+					SignatureS: sig.S.Bytes()}}}, nil
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+}
+
+// Verify checks that there is at least one signed PCR policy for the SHA-256 bank
+// associated with the supplied key, and that the signatures of all of the policies
+// associated with the key are valid.
+func (s SystemdPCRSignatures) Verify(key crypto.PublicKey) error {
+	fp, err := computeSystemdPCRPublicKeyFingerprint(key)
+	if err != nil {
+		return xerrors.Errorf("cannot compute public key fingerprint: %w", err)
+	}
+
+	n := 0
+	for i, sig := range s[tpm2.HashAlgorithmSHA256] {
+		if !bytes.Equal(sig.PublicKeyFingerprint, fp) {
+			continue
+		}
+		n++
+
+		tpmSig, err := sig.tpmSignature(key)
+		if err != nil {
+			return xerrors.Errorf("invalid signature for policy %d: %w", i, err)
+		}
+		digest := sha256.Sum256(sig.PolicyDigest)
+		ok, err := cryptutil.VerifySignature(key, digest[:], tpmSig)
+		switch {
+		case err != nil:
+			return xerrors.Errorf("cannot verify signature for policy %d: %w", i, err)
+		case !ok:
+			return fmt.Errorf("invalid signature for policy %d", i)
+		}
+	}
+
+	if n == 0 {
+		return errors.New("no signed PCR policies for the supplied key")
+	}
+	return nil
+}
+
+// newSystemdPCRPolicyPublicKey returns the public area for the supplied key that
+// is used to sign PCR policies with systemd-measure. RSA and ECDSA keys are
+// supported.
+func newSystemdPCRPolicyPublicKey(key crypto.PublicKey) (*tpm2.Public, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return util.NewExternalRSAPublicKey(tpm2.HashAlgorithmSHA256, templates.KeyUsageSign, nil, k), nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+		default:
+			return nil, errors.New("unsupported curve")
+		}
+		return util.NewExternalECCPublicKey(tpm2.HashAlgorithmSHA256, templates.KeyUsageSign, nil, k), nil
+	default:
+		return nil, errors.New("unsupported key type")
+	}
+}
+
+// executeSystemdPCRPolicy executes a PCR policy signed by systemd-measure with the
+// supplied key, using the supplied signed policies for the running UKI. This selects
+// the signed policy that corresponds to the current PCR values, executes the
+// TPM2_PolicyPCR assertion, and then executes a TPM2_PolicyAuthorize assertion with
+// the signature.
+func executeSystemdPCRPolicy(tpm *tpm2.TPMContext, policySession tpm2.SessionContext, key *tpm2.Public, sigs SystemdPCRSignatures) error {
+	if sigs == nil {
+		return errors.New("no signed PCR policies were supplied")
+	}
+
+	pub := key.Public()
+	fp, err := computeSystemdPCRPublicKeyFingerprint(pub)
+	if err != nil {
+		return policyDataError{xerrors.Errorf("cannot compute fingerprint of systemd PCR policy key: %w", err)}
+	}
+
+	// Find the signed policy that matches the current PCR values.
+	var sig *SystemdPCRSignature
+	var selection tpm2.PCRSelectionList
+	for _, s := range sigs[tpm2.HashAlgorithmSHA256] {
+		if !bytes.Equal(s.PublicKeyFingerprint, fp) {
+			continue
+		}
+
+		pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: s.PCRs}}
+		_, values, err := tpm.PCRRead(pcrs)
+		if err != nil {
+			return xerrors.Errorf("cannot read PCR values: %w", err)
+		}
+		pcrDigest, err := util.ComputePCRDigest(policySession.HashAlg(), pcrs, values)
+		if err != nil {
+			return xerrors.Errorf("cannot compute PCR digest: %w", err)
+		}
+
+		trial := util.ComputeAuthPolicy(policySession.HashAlg())
+		trial.PolicyPCR(pcrDigest, pcrs)
+		if bytes.Equal(trial.GetDigest(), s.PolicyDigest) {
+			sig = s
+			selection = pcrs
+			break
+		}
+	}
+	if sig == nil {
+		return errors.New("no signed PCR policy matches the current PCR values")
+	}
+
+	tpmSig, err := sig.tpmSignature(pub)
+	if err != nil {
+		return xerrors.Errorf("invalid signed PCR policy: %w", err)
+	}
+
+	if err := tpm.PolicyPCR(policySession, nil, selection); err != nil {
+		return err
+	}
+
+	authorizeKey, err := tpm.LoadExternal(nil, key, tpm2.HandleOwner)
+	if err != nil {
+		if tpm2.IsTPMParameterError(err, tpm2.AnyErrorCode, tpm2.CommandLoadExternal, 2) {
+			return policyDataError{xerrors.Errorf("public area of systemd PCR policy key is invalid: %w", err)}
+		}
+		return err
+	}
+	defer tpm.FlushContext(authorizeKey)
+
+	digest, err := util.ComputePolicyAuthorizeDigest(key.NameAlg, sig.PolicyDigest, nil)
+	if err != nil {
+		return policyDataError{xerrors.Errorf("cannot compute signed PCR policy digest: %w", err)}
+	}
+
+	ticket, err := tpm.VerifySignature(authorizeKey, digest, tpmSig)
+	if err != nil {
+		if tpm2.IsTPMParameterError(err, tpm2.AnyErrorCode, tpm2.CommandVerifySignature, 2) {
+			return xerrors.Errorf("cannot verify signed PCR policy signature: %w", err)
+		}
+		return err
+	}
+
+	return tpm.PolicyAuthorize(policySession, sig.PolicyDigest, nil, authorizeKey.Name(), ticket)
+}
@@ -0,0 +1,330 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/util"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type systemdPCRPolicyMixin struct{}
+
+// signSystemdPCRPolicy creates a signed PCR policy for the supplied PCR values
+// in the same way as systemd-measure.
+func (_ systemdPCRPolicyMixin) signSystemdPCRPolicy(c *C, key crypto.Signer, pcrs []int, values tpm2.PCRValues) *SystemdPCRSignature {
+	selection := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: pcrs}}
+	pcrDigest, err := util.ComputePCRDigest(tpm2.HashAlgorithmSHA256, selection, values)
+	c.Assert(err, IsNil)
+
+	trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+	trial.PolicyPCR(pcrDigest, selection)
+	pol := trial.GetDigest()
+
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	c.Assert(err, IsNil)
+	fp := sha256.Sum256(der)
+
+	digest := sha256.Sum256(pol)
+	sig, err := key.Sign(testutil.RandReader, digest[:], crypto.SHA256)
+	c.Assert(err, IsNil)
+
+	return &SystemdPCRSignature{
+		PCRs:                 pcrs,
+		PublicKeyFingerprint: fp[:],
+		PolicyDigest:         pol,
+		Signature:            sig}
+}
+
+func (_ systemdPCRPolicyMixin) pcr11Values(value tpm2.Digest) tpm2.PCRValues {
+	return tpm2.PCRValues{tpm2.HashAlgorithmSHA256: {11: value}}
+}
+
+type systemdPCRPolicySuiteNoTPM struct {
+	systemdPCRPolicyMixin
+}
+
+var _ = Suite(&systemdPCRPolicySuiteNoTPM{})
+
+func (s *systemdPCRPolicySuiteNoTPM) TestReadSystemdPCRSignatures(c *C) {
+	data := []byte(`{"sha256":[{"pcrs":[11],"pkfp":"0102","pol":"a1b2c3","sig":"Zm9v"}],"sm3":[{"pcrs":[11],"pkfp":"","pol":"","sig":""}]}` + "\x00\x00")
+	sigs, err := ReadSystemdPCRSignatures(data)
+	c.Assert(err, IsNil)
+	c.Check(sigs, DeepEquals, SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {
+			{
+				PCRs:                 []int{11},
+				PublicKeyFingerprint: []byte{0x01, 0x02},
+				PolicyDigest:         tpm2.Digest{0xa1, 0xb2, 0xc3},
+				Signature:            []byte("foo"),
+			},
+		},
+	})
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestReadSystemdPCRSignaturesInvalidDigest(c *C) {
+	_, err := ReadSystemdPCRSignatures([]byte(`{"sha256":[{"pcrs":[11],"pkfp":"0102","pol":"xyz","sig":"Zm9v"}]}`))
+	c.Check(err, ErrorMatches, "cannot decode policy digest: .*")
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestMarshalSystemdPCRSignatures(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	sigs := SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {s.signSystemdPCRPolicy(c, key, []int{11}, s.pcr11Values(make(tpm2.Digest, 32)))},
+	}
+	data, err := json.Marshal(sigs)
+	c.Assert(err, IsNil)
+
+	sigs2, err := ReadSystemdPCRSignatures(data)
+	c.Check(err, IsNil)
+	c.Check(sigs2, DeepEquals, sigs)
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) testVerify(c *C, key crypto.Signer) {
+	sigs := SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {
+			s.signSystemdPCRPolicy(c, key, []int{11}, s.pcr11Values(testutil.DecodeHexString(c, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))),
+			s.signSystemdPCRPolicy(c, key, []int{11}, s.pcr11Values(testutil.DecodeHexString(c, "8a5edab282632443219e051e4ade2d1d5bbc671c781051bf1437897cbdfea0f1"))),
+		},
+	}
+	c.Check(sigs.Verify(key.Public()), IsNil)
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestVerifyRSA(c *C) {
+	key, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+	s.testVerify(c, key)
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestVerifyECDSA(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	s.testVerify(c, key)
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestVerifyNoPoliciesForKey(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	sigs := SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {s.signSystemdPCRPolicy(c, otherKey, []int{11}, s.pcr11Values(make(tpm2.Digest, 32)))},
+	}
+	c.Check(sigs.Verify(key.Public()), ErrorMatches, "no signed PCR policies for the supplied key")
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestVerifyInvalidSignature(c *C) {
+	key, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+
+	sig := s.signSystemdPCRPolicy(c, key, []int{11}, s.pcr11Values(make(tpm2.Digest, 32)))
+	sig.PolicyDigest[0] ^= 0xff
+
+	sigs := SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {sig},
+	}
+	c.Check(sigs.Verify(key.Public()), ErrorMatches, "invalid signature for policy 0")
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestNewSystemdPCRPolicyPublicKeyUnsupportedCurve(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	_, err = NewSystemdPCRPolicyPublicKey(key.Public())
+	c.Check(err, ErrorMatches, "unsupported curve")
+}
+
+func (s *systemdPCRPolicySuiteNoTPM) TestNewKeyDataPolicyV4SystemdPCRPolicy(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic, err := NewPolicyAuthPublicKey(primaryKey)
+	c.Assert(err, IsNil)
+
+	systemdKey, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+	systemdKeyPublic, err := NewSystemdPCRPolicyPublicKey(systemdKey.Public())
+	c.Assert(err, IsNil)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, false)
+	c.Assert(err, IsNil)
+	policyDataV4, digestV4, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest,
+		StaticPolicyAssertions{NewStaticPolicySystemdPCRPolicyAssertion(systemdKeyPublic)})
+	c.Assert(err, IsNil)
+
+	// The signed PCR policy is part of the authorized PCR policy, so it doesn't
+	// affect the static policy digest.
+	c.Check(digestV4, DeepEquals, digest)
+
+	pcrs := tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{7}}}
+	pcrDigests := tpm2.DigestList{make(tpm2.Digest, 32)}
+	params := NewPcrPolicyParams(primaryKey, pcrs, pcrDigests, nil, 0)
+	c.Check(policyDataV4.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+
+	// The authorized PCR policy starts with a PolicyAuthorize assertion for the
+	// systemd PCR policy key.
+	trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+	trial.PolicyAuthorize(nil, systemdKeyPublic.Name())
+	trial.PolicyPCR(pcrDigests[0], pcrs)
+	trial.PolicyOR(tpm2.DigestList{trial.GetDigest(), trial.GetDigest()})
+	c.Check(policyDataV4.(*KeyDataPolicy_v4).PCRData.AuthorizedPolicy, DeepEquals, trial.GetDigest())
+}
+
+type systemdPCRPolicySuite struct {
+	tpm2test.TPMTest
+	systemdPCRPolicyMixin
+}
+
+func (s *systemdPCRPolicySuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy | tpm2test.TPMFeatureNV | tpm2test.TPMFeaturePCR
+}
+
+func (s *systemdPCRPolicySuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+}
+
+var _ = Suite(&systemdPCRPolicySuite{})
+
+func (s *systemdPCRPolicySuite) setSignatures(c *C, sigs SystemdPCRSignatures) {
+	data, err := json.Marshal(sigs)
+	c.Assert(err, IsNil)
+
+	path := filepath.Join(c.MkDir(), "tpm2-pcr-signature.json")
+	c.Assert(os.WriteFile(path, data, 0644), IsNil)
+	s.AddCleanup(MockSystemdPCRSignaturePath(path))
+}
+
+func (s *systemdPCRPolicySuite) testProtectKeyWithSystemdPCRPolicy(c *C, key crypto.Signer) {
+	kd, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000),
+		SystemdPCRPolicyKey:    key.Public()})
+	c.Assert(err, IsNil)
+
+	skd, err := NewSealedKeyData(kd)
+	c.Assert(err, IsNil)
+	c.Check(skd.Version(), Equals, uint32(4))
+
+	_, values, err := s.TPM().PCRRead(tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{11}}})
+	c.Assert(err, IsNil)
+
+	s.setSignatures(c, SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {
+			s.signSystemdPCRPolicy(c, key, []int{11}, s.pcr11Values(make(tpm2.Digest, 32))),
+			s.signSystemdPCRPolicy(c, key, []int{11}, values),
+		},
+	})
+
+	_, _, err = kd.RecoverKeys()
+	c.Check(err, IsNil)
+}
+
+func (s *systemdPCRPolicySuite) TestProtectKeyWithSystemdPCRPolicyRSA(c *C) {
+	key, err := rsa.GenerateKey(testutil.RandReader, 2048)
+	c.Assert(err, IsNil)
+	s.testProtectKeyWithSystemdPCRPolicy(c, key)
+}
+
+func (s *systemdPCRPolicySuite) TestProtectKeyWithSystemdPCRPolicyECDSA(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	s.testProtectKeyWithSystemdPCRPolicy(c, key)
+}
+
+func (s *systemdPCRPolicySuite) TestProtectKeyWithSystemdPCRPolicyNoMatchingPolicy(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	kd, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		SystemdPCRPolicyKey:    key.Public()})
+	c.Assert(err, IsNil)
+
+	s.setSignatures(c, SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {
+			s.signSystemdPCRPolicy(c, key, []int{11}, s.pcr11Values(make(tpm2.Digest, 32))),
+		},
+	})
+
+	_, _, err = kd.RecoverKeys()
+	c.Check(err, ErrorMatches, ".*no signed PCR policy matches the current PCR values")
+}
+
+func (s *systemdPCRPolicySuite) TestProtectKeyWithSystemdPCRPolicyWrongKey(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	kd, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		SystemdPCRPolicyKey:    key.Public()})
+	c.Assert(err, IsNil)
+
+	_, values, err := s.TPM().PCRRead(tpm2.PCRSelectionList{{Hash: tpm2.HashAlgorithmSHA256, Select: []int{11}}})
+	c.Assert(err, IsNil)
+
+	s.setSignatures(c, SystemdPCRSignatures{
+		tpm2.HashAlgorithmSHA256: {s.signSystemdPCRPolicy(c, otherKey, []int{11}, values)},
+	})
+
+	_, _, err = kd.RecoverKeys()
+	c.Check(err, ErrorMatches, ".*no signed PCR policy matches the current PCR values")
+}
+
+func (s *systemdPCRPolicySuite) TestProtectKeyWithSystemdPCRPolicyNoSignatures(c *C) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), testutil.RandReader)
+	c.Assert(err, IsNil)
+
+	kd, _, _, err := NewTPMProtectedKey(s.TPM(), &ProtectKeyParams{
+		PCRProfile:             tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		SystemdPCRPolicyKey:    key.Public()})
+	c.Assert(err, IsNil)
+
+	s.AddCleanup(MockSystemdPCRSignaturePath(filepath.Join(c.MkDir(), "tpm2-pcr-signature.json")))
+
+	_, _, err = kd.RecoverKeys()
+	c.Check(err, ErrorMatches, ".*cannot read signed PCR policies: .*no such file or directory")
+}
@@ -0,0 +1,213 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/mu"
+
+	"golang.org/x/xerrors"
+)
+
+// Offsets of fields in the TPMS_TIME_INFO structure, used as the operandA
+// of a TPM2_PolicyCounterTimer assertion.
+const (
+	timeInfoClockOffset        uint16 = 8
+	timeInfoResetCountOffset   uint16 = 16
+	timeInfoRestartCountOffset uint16 = 20
+)
+
+// TimeConstraints restricts use of a sealed key based on the TPM's clock and its
+// reset and restart counters, by way of TPM2_PolicyCounterTimer assertions in the
+// static authorization policy. Note that the TPM clock only advances whilst the TPM
+// is powered on, and that it can be advanced by the owner of the storage hierarchy
+// with TPM2_ClockSet.
+type TimeConstraints struct {
+	// ClockNotBefore is the TPM clock value in milliseconds before which the key
+	// cannot be unsealed. A zero value means that there is no lower bound.
+	ClockNotBefore uint64
+
+	// ClockNotAfter is the TPM clock value in milliseconds from which the key
+	// can no longer be unsealed. A zero value means that there is no upper bound.
+	ClockNotAfter uint64
+
+	// ResetCount optionally restricts the key so that it can only be unsealed
+	// with the specified TPM reset count. As this is incremented on every TPM
+	// reset, this can be used to restrict the key to a single boot.
+	ResetCount *uint32
+
+	// RestartCount optionally restricts the key so that it can only be unsealed
+	// with the specified TPM restart count. This is incremented on every TPM
+	// restart or resume from hibernation and is reset to zero on every TPM reset,
+	// so it should be used in combination with ResetCount.
+	RestartCount *uint32
+}
+
+// NewSingleBootTimeConstraints returns time constraints that restrict a sealed key
+// so that it can only be unsealed until the next TPM reset, which normally happens
+// on the next reboot.
+func NewSingleBootTimeConstraints(tpm *Connection) (*TimeConstraints, error) {
+	info, err := tpm.ReadClock()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read TPM clock: %w", err)
+	}
+	resetCount := info.ClockInfo.ResetCount
+	return &TimeConstraints{ResetCount: &resetCount}, nil
+}
+
+// NewValidForTimeConstraints returns time constraints that restrict a sealed key
+// so that it can only be unsealed until the TPM clock has advanced by the specified
+// duration. As the TPM clock only advances whilst the TPM is powered on, the key may
+// remain valid for longer than the specified duration in wall-clock time.
+func NewValidForTimeConstraints(tpm *Connection, validFor time.Duration) (*TimeConstraints, error) {
+	if validFor <= 0 {
+		return nil, errors.New("invalid duration")
+	}
+	info, err := tpm.ReadClock()
+	if err != nil {
+		return nil, xerrors.Errorf("cannot read TPM clock: %w", err)
+	}
+	return &TimeConstraints{ClockNotAfter: info.ClockInfo.Clock + uint64(validFor.Milliseconds())}, nil
+}
+
+func (c *TimeConstraints) validate() error {
+	if c.ClockNotAfter != 0 && c.ClockNotBefore >= c.ClockNotAfter {
+		return errors.New("ClockNotBefore must be less than ClockNotAfter")
+	}
+	return nil
+}
+
+// assertions returns the static policy assertions for these constraints.
+func (c *TimeConstraints) assertions() (out staticPolicyAssertions) {
+	if c.ClockNotBefore != 0 {
+		out = append(out, newStaticPolicyCounterTimerAssertion(
+			mu.MustMarshalToBytes(c.ClockNotBefore), timeInfoClockOffset, tpm2.OpUnsignedGE))
+	}
+	if c.ClockNotAfter != 0 {
+		out = append(out, newStaticPolicyCounterTimerAssertion(
+			mu.MustMarshalToBytes(c.ClockNotAfter), timeInfoClockOffset, tpm2.OpUnsignedLT))
+	}
+	if c.ResetCount != nil {
+		out = append(out, newStaticPolicyCounterTimerAssertion(
+			mu.MustMarshalToBytes(*c.ResetCount), timeInfoResetCountOffset, tpm2.OpEq))
+	}
+	if c.RestartCount != nil {
+		out = append(out, newStaticPolicyCounterTimerAssertion(
+			mu.MustMarshalToBytes(*c.RestartCount), timeInfoRestartCountOffset, tpm2.OpEq))
+	}
+	return out
+}
+
+// timeConstraintsFromAssertions returns the time constraints represented by the
+// TPM2_PolicyCounterTimer assertions in the supplied list, or nil if there are
+// none.
+func timeConstraintsFromAssertions(assertions staticPolicyAssertions) (*TimeConstraints, error) {
+	var out *TimeConstraints
+	for _, a := range assertions {
+		if a.Type != staticPolicyAssertionCounterTimer {
+			continue
+		}
+		if a.Data == nil || a.Data.CounterTimer == nil {
+			return nil, errors.New("invalid counter timer assertion")
+		}
+		if out == nil {
+			out = new(TimeConstraints)
+		}
+
+		d := a.Data.CounterTimer
+		switch {
+		case d.Offset == timeInfoClockOffset && len(d.OperandB) == 8 && d.Operation == tpm2.OpUnsignedGE:
+			out.ClockNotBefore = binary.BigEndian.Uint64(d.OperandB)
+		case d.Offset == timeInfoClockOffset && len(d.OperandB) == 8 && d.Operation == tpm2.OpUnsignedLT:
+			out.ClockNotAfter = binary.BigEndian.Uint64(d.OperandB)
+		case d.Offset == timeInfoResetCountOffset && len(d.OperandB) == 4 && d.Operation == tpm2.OpEq:
+			resetCount := binary.BigEndian.Uint32(d.OperandB)
+			out.ResetCount = &resetCount
+		case d.Offset == timeInfoRestartCountOffset && len(d.OperandB) == 4 && d.Operation == tpm2.OpEq:
+			restartCount := binary.BigEndian.Uint32(d.OperandB)
+			out.RestartCount = &restartCount
+		default:
+			return nil, errors.New("unrecognized counter timer assertion")
+		}
+	}
+	return out, nil
+}
+
+// Satisfied indicates whether these constraints are satisfied by the supplied
+// TPM time information, as returned from TPM2_ReadClock.
+func (c *TimeConstraints) Satisfied(info *tpm2.TimeInfo) bool {
+	switch {
+	case info.ClockInfo.Clock < c.ClockNotBefore:
+		return false
+	case c.ClockNotAfter != 0 && info.ClockInfo.Clock >= c.ClockNotAfter:
+		return false
+	case c.ResetCount != nil && info.ClockInfo.ResetCount != *c.ResetCount:
+		return false
+	case c.RestartCount != nil && info.ClockInfo.RestartCount != *c.RestartCount:
+		return false
+	default:
+		return true
+	}
+}
+
+// Expired indicates whether these constraints can no longer be satisfied based
+// on the supplied TPM time information, as returned from TPM2_ReadClock, because
+// the TPM clock or reset count has advanced beyond them. A key that is not yet
+// valid because of ClockNotBefore is not expired.
+func (c *TimeConstraints) Expired(info *tpm2.TimeInfo) bool {
+	switch {
+	case c.ClockNotAfter != 0 && info.ClockInfo.Clock >= c.ClockNotAfter:
+		return true
+	case c.ResetCount != nil && info.ClockInfo.ResetCount != *c.ResetCount:
+		return true
+	case c.ResetCount != nil && c.RestartCount != nil && info.ClockInfo.RestartCount > *c.RestartCount:
+		return true
+	default:
+		return false
+	}
+}
+
+// Remaining returns the amount of TPM clock time remaining before these
+// constraints expire based on the supplied TPM time information, as returned
+// from TPM2_ReadClock. It returns false if there is no upper bound on the TPM
+// clock.
+func (c *TimeConstraints) Remaining(info *tpm2.TimeInfo) (time.Duration, bool) {
+	if c.ClockNotAfter == 0 {
+		return 0, false
+	}
+	if info.ClockInfo.Clock >= c.ClockNotAfter {
+		return 0, true
+	}
+	return time.Duration(c.ClockNotAfter-info.ClockInfo.Clock) * time.Millisecond, true
+}
+
+// TimeConstraints returns the time constraints that this sealed key was created
+// with, or nil if it has none.
+func (k *SealedKeyData) TimeConstraints() (*TimeConstraints, error) {
+	policy, ok := k.data.Policy().(*keyDataPolicy_v4)
+	if !ok {
+		return nil, nil
+	}
+	return timeConstraintsFromAssertions(policy.StaticData.Assertions)
+}
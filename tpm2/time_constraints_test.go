@@ -0,0 +1,218 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/canonical/go-tpm2"
+	"github.com/canonical/go-tpm2/util"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type timeConstraintsSuiteNoTPM struct {
+	policyV3Mixin
+}
+
+type timeConstraintsSuite struct {
+	tpm2test.TPMTest
+	policyV3Mixin
+}
+
+func (s *timeConstraintsSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy | tpm2test.TPMFeatureNV
+}
+
+var _ = Suite(&timeConstraintsSuiteNoTPM{})
+var _ = Suite(&timeConstraintsSuite{})
+
+func makeTimeInfo(clock uint64, resetCount, restartCount uint32) *tpm2.TimeInfo {
+	return &tpm2.TimeInfo{ClockInfo: tpm2.ClockInfo{Clock: clock, ResetCount: resetCount, RestartCount: restartCount, Safe: true}}
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestAssertions(c *C) {
+	resetCount := uint32(5)
+	restartCount := uint32(2)
+	constraints := &TimeConstraints{
+		ClockNotBefore: 1000,
+		ClockNotAfter:  50000,
+		ResetCount:     &resetCount,
+		RestartCount:   &restartCount}
+
+	assertions := constraints.Assertions()
+	c.Check(assertions, DeepEquals, StaticPolicyAssertions{
+		NewStaticPolicyCounterTimerAssertion(tpm2.Operand{0, 0, 0, 0, 0, 0, 0x03, 0xe8}, 8, tpm2.OpUnsignedGE),
+		NewStaticPolicyCounterTimerAssertion(tpm2.Operand{0, 0, 0, 0, 0, 0, 0xc3, 0x50}, 8, tpm2.OpUnsignedLT),
+		NewStaticPolicyCounterTimerAssertion(tpm2.Operand{0, 0, 0, 5}, 16, tpm2.OpEq),
+		NewStaticPolicyCounterTimerAssertion(tpm2.Operand{0, 0, 0, 2}, 20, tpm2.OpEq),
+	})
+
+	// Check that the constraints can be recovered from the assertions
+	recovered, err := TimeConstraintsFromAssertions(append(StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(tpm2.LocalityZero)}, assertions...))
+	c.Check(err, IsNil)
+	c.Check(recovered, DeepEquals, constraints)
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestTimeConstraintsFromAssertionsNone(c *C) {
+	recovered, err := TimeConstraintsFromAssertions(StaticPolicyAssertions{NewStaticPolicyLocalityAssertion(tpm2.LocalityZero)})
+	c.Check(err, IsNil)
+	c.Check(recovered, IsNil)
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestTimeConstraintsFromAssertionsUnrecognized(c *C) {
+	_, err := TimeConstraintsFromAssertions(StaticPolicyAssertions{NewStaticPolicyCounterTimerAssertion(tpm2.Operand{0, 0, 0, 5}, 24, tpm2.OpEq)})
+	c.Check(err, ErrorMatches, `unrecognized counter timer assertion`)
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestSatisfiedAndExpiredSingleBoot(c *C) {
+	resetCount := uint32(5)
+	constraints := &TimeConstraints{ResetCount: &resetCount}
+
+	c.Check(constraints.Satisfied(makeTimeInfo(1000, 5, 0)), testutil.IsTrue)
+	c.Check(constraints.Expired(makeTimeInfo(1000, 5, 0)), testutil.IsFalse)
+	c.Check(constraints.Satisfied(makeTimeInfo(1000, 5, 1)), testutil.IsTrue)
+
+	c.Check(constraints.Satisfied(makeTimeInfo(2000, 6, 0)), testutil.IsFalse)
+	c.Check(constraints.Expired(makeTimeInfo(2000, 6, 0)), testutil.IsTrue)
+
+	_, ok := constraints.Remaining(makeTimeInfo(1000, 5, 0))
+	c.Check(ok, testutil.IsFalse)
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestSatisfiedAndExpiredRestartCount(c *C) {
+	resetCount := uint32(5)
+	restartCount := uint32(1)
+	constraints := &TimeConstraints{ResetCount: &resetCount, RestartCount: &restartCount}
+
+	c.Check(constraints.Satisfied(makeTimeInfo(1000, 5, 0)), testutil.IsFalse)
+	c.Check(constraints.Expired(makeTimeInfo(1000, 5, 0)), testutil.IsFalse)
+	c.Check(constraints.Satisfied(makeTimeInfo(1000, 5, 1)), testutil.IsTrue)
+	c.Check(constraints.Satisfied(makeTimeInfo(1000, 5, 2)), testutil.IsFalse)
+	c.Check(constraints.Expired(makeTimeInfo(1000, 5, 2)), testutil.IsTrue)
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestSatisfiedAndExpiredClockWindow(c *C) {
+	constraints := &TimeConstraints{ClockNotBefore: 1000, ClockNotAfter: 5000}
+
+	c.Check(constraints.Satisfied(makeTimeInfo(500, 5, 0)), testutil.IsFalse)
+	c.Check(constraints.Expired(makeTimeInfo(500, 5, 0)), testutil.IsFalse)
+	c.Check(constraints.Satisfied(makeTimeInfo(1000, 5, 0)), testutil.IsTrue)
+	c.Check(constraints.Satisfied(makeTimeInfo(4999, 5, 0)), testutil.IsTrue)
+	c.Check(constraints.Satisfied(makeTimeInfo(5000, 5, 0)), testutil.IsFalse)
+	c.Check(constraints.Expired(makeTimeInfo(5000, 5, 0)), testutil.IsTrue)
+
+	remaining, ok := constraints.Remaining(makeTimeInfo(2000, 5, 0))
+	c.Check(ok, testutil.IsTrue)
+	c.Check(remaining, Equals, 3*time.Second)
+
+	remaining, ok = constraints.Remaining(makeTimeInfo(6000, 5, 0))
+	c.Check(ok, testutil.IsTrue)
+	c.Check(remaining, Equals, time.Duration(0))
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestNewKeyDataPolicyV4CounterTimer(c *C) {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "foo", nil, false)
+	c.Assert(err, IsNil)
+
+	resetCount := uint32(3)
+	constraints := &TimeConstraints{ClockNotAfter: 10000, ResetCount: &resetCount}
+	_, digestV4, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest, constraints.Assertions())
+	c.Assert(err, IsNil)
+
+	trial := util.ComputeAuthPolicy(tpm2.HashAlgorithmSHA256)
+	trial.SetDigest(digest)
+	trial.PolicyCounterTimer(tpm2.Operand{0, 0, 0, 0, 0, 0, 0x27, 0x10}, 8, tpm2.OpUnsignedLT)
+	trial.PolicyCounterTimer(tpm2.Operand{0, 0, 0, 3}, 16, tpm2.OpEq)
+	c.Check(digestV4, DeepEquals, trial.GetDigest())
+}
+
+func (s *timeConstraintsSuiteNoTPM) TestProtectKeyInvalidTimeConstraints(c *C) {
+	_, _, _, err := NewExternalTPMProtectedKey(nil, &ProtectKeyParams{
+		PCRPolicyCounterHandle: tpm2.HandleNull,
+		TimeConstraints:        &TimeConstraints{ClockNotBefore: 5000, ClockNotAfter: 1000}})
+	c.Check(err, ErrorMatches, `invalid time constraints: ClockNotBefore must be less than ClockNotAfter`)
+}
+
+func (s *timeConstraintsSuite) testExecutePCRPolicy(c *C, constraints *TimeConstraints) error {
+	primaryKey := make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+	authKeyPublic := s.newPolicyAuthPublicKey(c, tpm2.HashAlgorithmSHA256, primaryKey)
+
+	policyData, digest, err := NewKeyDataPolicy(tpm2.HashAlgorithmSHA256, authKeyPublic, "", nil, false)
+	c.Assert(err, IsNil)
+	policyData, expectedDigest, err := NewKeyDataPolicyV4(tpm2.HashAlgorithmSHA256, policyData, digest, constraints.Assertions())
+	c.Assert(err, IsNil)
+
+	params := NewPcrPolicyParams(primaryKey, tpm2.PCRSelectionList{}, nil, nil, 0)
+	c.Check(policyData.UpdatePCRPolicy(tpm2.HashAlgorithmSHA256, params), IsNil)
+
+	session := s.StartAuthSession(c, nil, nil, tpm2.SessionTypePolicy, nil, tpm2.HashAlgorithmSHA256)
+	if err := policyData.ExecutePCRPolicy(s.TPM().TPMContext, session, s.TPM().HmacSession()); err != nil {
+		return err
+	}
+
+	digest, err = s.TPM().PolicyGetDigest(session)
+	c.Check(err, IsNil)
+	c.Check(digest, DeepEquals, expectedDigest)
+	return nil
+}
+
+func (s *timeConstraintsSuite) TestExecutePCRPolicySingleBoot(c *C) {
+	constraints, err := NewSingleBootTimeConstraints(s.TPM())
+	c.Assert(err, IsNil)
+	c.Check(s.testExecutePCRPolicy(c, constraints), IsNil)
+
+	info, err := s.TPM().ReadClock()
+	c.Assert(err, IsNil)
+	c.Check(constraints.Satisfied(info), testutil.IsTrue)
+}
+
+func (s *timeConstraintsSuite) TestExecutePCRPolicyValidFor(c *C) {
+	constraints, err := NewValidForTimeConstraints(s.TPM(), time.Hour)
+	c.Assert(err, IsNil)
+	c.Check(s.testExecutePCRPolicy(c, constraints), IsNil)
+
+	info, err := s.TPM().ReadClock()
+	c.Assert(err, IsNil)
+	remaining, ok := constraints.Remaining(info)
+	c.Check(ok, testutil.IsTrue)
+	c.Check(remaining <= time.Hour, testutil.IsTrue)
+}
+
+func (s *timeConstraintsSuite) TestExecutePCRPolicyExpired(c *C) {
+	info, err := s.TPM().ReadClock()
+	c.Assert(err, IsNil)
+	resetCount := info.ClockInfo.ResetCount + 1
+
+	err = s.testExecutePCRPolicy(c, &TimeConstraints{ResetCount: &resetCount})
+	c.Check(err, ErrorMatches, `cannot execute static policy assertions: cannot execute assertion 0: `+ErrTimeConstraintsNotSatisfied.Error())
+	c.Check(err, testutil.ErrorIs, ErrTimeConstraintsNotSatisfied)
+}
@@ -20,7 +20,10 @@
 package tpm2
 
 import (
+	"bytes"
 	_ "crypto/sha256"
+	"crypto/x509"
+	"errors"
 
 	"github.com/canonical/go-tpm2"
 
@@ -35,6 +38,8 @@ type Connection struct {
 	*tpm2.TPMContext
 	provisionedSrk tpm2.ResourceContext
 	hmacSession    tpm2.SessionContext
+	ekPublic       *tpm2.Public      // public area of the EK used to salt hmacSession
+	ekCert         *x509.Certificate // verified EK certificate, set by VerifyEndorsementKey
 }
 
 // IsEnabled indicates whether the TPM is enabled or whether it has been disabled by the platform firmware. A TPM device can be
@@ -57,18 +62,18 @@ func (t *Connection) LockoutAuthSet() bool {
 	return tpm2.PermanentAttributes(value)&tpm2.AttrLockoutAuthSet > 0
 }
 
-// HmacSession returns a HMAC session with the AttrContinueSession attribute
-// set. If an endorsement key exists, it is also salted with this and configured
-// with parameter encryption. Note that this relies on reading the public area
-// from the TPM and there is no validation of the endorsement key against the
-// supplied manufacturer certificate, so this is vulnerable to active interposer
-// type attacks where an adversary could provide a public area for a non-TPM protected
-// key to us, whilst making it look like a TPM protected key, in order to perform MITM
-// attacks. If used for parameter encryption, this only provides protection against
-// passive interposer attacks. Other types of attacks are outside of the scope of this
-// package due to limitations in the way that TPM2_Unseal works, and the fact that the
-// platform firmware doesn't integrity protect commands that are critical to measured
-// boot such as PCR extends.
+// HmacSession returns a HMAC session with the AttrContinueSession attribute set. If an
+// endorsement key exists, it is also salted with this and configured with parameter
+// encryption. Note that this relies on reading the public area from the TPM and there
+// is no validation of the endorsement key against the supplied manufacturer certificate
+// unless VerifyEndorsementKey is called, so without this it is vulnerable to active
+// interposer type attacks where an adversary could provide a public area for a non-TPM
+// protected key to us, whilst making it look like a TPM protected key, in order to
+// perform MITM attacks. If used for parameter encryption, this only provides protection
+// against passive interposer attacks. Other types of attacks are outside of the scope
+// of this package due to limitations in the way that TPM2_Unseal works, and the fact
+// that the platform firmware doesn't integrity protect commands that are critical to
+// measured boot such as PCR extends.
 func (t *Connection) HmacSession() tpm2.SessionContext {
 	if t.hmacSession == nil {
 		return nil
@@ -88,6 +93,8 @@ func (t *Connection) init() (err error) {
 		t.hmacSession = nil
 	}
 	t.provisionedSrk = nil
+	t.ekPublic = nil
+	t.ekCert = nil
 
 	ek, err := t.CreateResourceContextFromTPM(tcg.EKHandle)
 	switch {
@@ -99,13 +106,26 @@ func (t *Connection) init() (err error) {
 		// Do a sanity check that the obtained context corresponds to a suitable key.
 		// A suitable key is a non-duplicable aysymmetric storage parent. If it's not,
 		// then don't use it.
-		pub, _, _, err := t.ReadPublic(ek)
-		if err != nil {
-			return xerrors.Errorf("cannot obtain EK public area: %w", err)
+		//
+		// Use the public area associated with the context rather than reading it
+		// again, as this is the one that is used to salt the session. A second
+		// TPM2_ReadPublic could return a different public area if there is an active
+		// interposer, which would then be the one checked by VerifyEndorsementKey.
+		var pub *tpm2.Public
+		if obj, ok := ek.(tpm2.ObjectContext); ok {
+			pub = obj.Public()
+		}
+		if pub == nil {
+			return errors.New("cannot obtain EK public area")
+		}
+		if !bytes.Equal(pub.Name(), ek.Name()) {
+			return errors.New("EK public area is inconsistent with its name")
 		}
 
 		if !pub.IsAsymmetric() || !pub.IsStorageParent() || pub.Attrs&(tpm2.AttrFixedParent|tpm2.AttrFixedTPM) != tpm2.AttrFixedParent|tpm2.AttrFixedTPM {
 			ek = nil
+		} else {
+			t.ekPublic = pub
 		}
 	}
 
@@ -43,7 +43,9 @@ const (
 // key object by specifying the newly created transient object as the parent.
 //
 // If both attempts to load the sealed key object fail, or if the first attempt fails
-// and a transient SRK cannot be created, an error will be returned.
+// and a transient SRK cannot be created, an error will be returned. If loading fails
+// because the sealed key object is not protected by the SRK, a SRKMismatchError error
+// will be returned.
 //
 // If a transient SRK is created, it is flushed from the TPM before this function
 // returns.
@@ -53,12 +55,17 @@ const (
 // primary key needs to be created, in order to avoid transmitting the cleartext authorzation
 // value.
 func (k *sealedKeyDataBase) loadForUnseal(tpm *tpm2.TPMContext, session tpm2.SessionContext) (keyObject tpm2.ResourceContext, policySession tpm2.SessionContext, err error) {
+	srkHandle, err := tcg.SelectSRKHandle(tpm)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("cannot select SRK handle: %w", err)
+	}
+
 	for try := tryPersistentSRK; try <= tryMax; try++ {
 		var srk tpm2.ResourceContext
 		var thisErr error
 		if try == tryPersistentSRK {
-			srk, thisErr = tpm.CreateResourceContextFromTPM(tcg.SRKHandle)
-			if tpm2.IsResourceUnavailableError(thisErr, tcg.SRKHandle) {
+			srk, thisErr = tpm.CreateResourceContextFromTPM(srkHandle)
+			if tpm2.IsResourceUnavailableError(thisErr, srkHandle) {
 				// No SRK - save the error and try creating a transient
 				err = ErrTPMProvisioning
 				continue
@@ -81,7 +88,17 @@ func (k *sealedKeyDataBase) loadForUnseal(tpm *tpm2.TPMContext, session tpm2.Ses
 
 		// Load the key data
 		keyObject, err = k.load(tpm, srk)
-		if isLoadInvalidParamError(err) || isImportInvalidParamError(err) {
+		if (isLoadParentMismatchError(err) || isImportParentMismatchError(err)) && try == tryPersistentSRK {
+			// The supplied key data is not protected by the persistent SRK.
+			err = SRKMismatchError{srkHandle}
+			continue
+		} else if isLoadParentMismatchError(err) || isImportParentMismatchError(err) {
+			// The supplied key data is not protected by a SRK created with the
+			// current template either.
+			err = InvalidKeyDataError{
+				fmt.Sprintf("cannot load sealed key object into TPM: %v. Either the sealed key object is bad or the TPM owner has changed", err)}
+			continue
+		} else if isLoadInvalidParamError(err) || isImportInvalidParamError(err) {
 			// The supplied key data is invalid or is not protected by the supplied SRK.
 			err = InvalidKeyDataError{
 				fmt.Sprintf("cannot load sealed key object into TPM: %v. Either the sealed key object is bad or the TPM owner has changed", err)}
@@ -152,7 +169,7 @@ func (k *sealedKeyDataBase) loadForUnseal(tpm *tpm2.TPMContext, session tpm2.Ses
 // attribute set, used for authenticating use of the storage hierarchy if a transient
 // storage primary key needs to be created, in order to avoid transmitting the cleartext
 // authorization value.
-func (k *sealedKeyDataBase) unsealDataFromTPM(tpm *tpm2.TPMContext, authValue []byte, hmacSession tpm2.SessionContext) (data []byte, err error) {
+func (k *sealedKeyDataBase) unsealDataFromTPM(tpm *tpm2.TPMContext, authValue []byte, systemdPCRSignatures SystemdPCRSignatures, hmacSession tpm2.SessionContext) (data []byte, err error) {
 	// Check if the TPM is in lockout mode
 	props, err := tpm.GetCapabilityTPMProperties(tpm2.PropertyPermanent, 1)
 	if err != nil {
@@ -174,12 +191,29 @@ func (k *sealedKeyDataBase) unsealDataFromTPM(tpm *tpm2.TPMContext, authValue []
 
 	keyObject.SetAuthValue(authValue)
 
-	// Execute policy session
-	if err := k.data.Policy().ExecutePCRPolicy(tpm, policySession, hmacSession); err != nil {
+	// Execute policy session. If the authorization value is bound to a NV index,
+	// the policy needs the authorization value as well, and if the key is bound to
+	// PCR policies signed by systemd-measure, it needs the signed policies.
+	policy := k.data.Policy()
+	if p, ok := policy.(staticPolicyParamsExecutor); ok {
+		params := new(staticPolicyExecuteParams)
+		if p, ok := policy.(authValueIndexPolicy); ok && p.AuthValueIndex() != nil {
+			params.AuthValue = authValue
+		}
+		if p, ok := policy.(systemdPCRPolicy); ok && p.SystemdPCRPolicyKey() != nil {
+			params.SystemdPCRSignatures = systemdPCRSignatures
+		}
+		err = p.ExecutePCRPolicyWithParams(tpm, policySession, hmacSession, params)
+	} else {
+		err = policy.ExecutePCRPolicy(tpm, policySession, hmacSession)
+	}
+	if err != nil {
 		err = xerrors.Errorf("cannot complete authorization policy assertions: %w", err)
 		switch {
 		case isPolicyDataError(err):
 			return nil, InvalidKeyDataError{err.Error()}
+		case xerrors.Is(err, ErrTimeConstraintsNotSatisfied):
+			return nil, ErrTimeConstraintsNotSatisfied
 		case tpm2.IsResourceUnavailableError(err, lockNVHandle):
 			return nil, InvalidKeyDataError{"required legacy lock NV index is not present"}
 		}
@@ -191,6 +225,8 @@ func (k *sealedKeyDataBase) unsealDataFromTPM(tpm *tpm2.TPMContext, authValue []
 	switch {
 	case tpm2.IsTPMSessionError(err, tpm2.ErrorPolicyFail, tpm2.CommandUnseal, 1):
 		return nil, InvalidKeyDataError{"the authorization policy check failed during unsealing"}
+	case tpm2.IsTPMWarning(err, tpm2.WarningLocality, tpm2.CommandUnseal):
+		return nil, ErrWrongLocality
 	case err != nil:
 		return nil, xerrors.Errorf("cannot unseal key: %w", err)
 	}
@@ -36,16 +36,20 @@ import (
 // In this case, Connection.EnsureProvisioned should be called to attempt to resolve
 // this.
 //
-// If the TPM sealed object cannot be loaded in to the TPM for reasons other than
-// the lack of a valid storage root key, then a InvalidKeyDataError error will be returned.
-// This could be caused because the sealed object data is invalid in some way, or because
-// the sealed object is associated with another TPM owner (the TPM has been cleared
-// since the sealed key data file was created with SealKeyToTPM), or because the
-// TPM object at the persistent handle reserved for the storage root key has a public area
-// that looks like a valid storage root key but it was created with a different template.
-// This latter case is really caused by an incorrectly provisioned TPM, but it isn't
-// possible to differentiate between the 2 errors. A subsequent call to SealKeyToTPM
-// or Connection.EnsureProvisioned may rectify this.
+// If the TPM sealed object cannot be loaded in to the TPM because it is not protected
+// by the storage root key, then a SRKMismatchError error will be returned. This is
+// normally because the sealed object is associated with another TPM owner (the TPM
+// has been cleared since the sealed key data file was created with SealKeyToTPM), but
+// it could also be because the sealed object data has been modified.
+//
+// If the TPM sealed object cannot be loaded in to the TPM for other reasons, then a
+// InvalidKeyDataError error will be returned. This could be caused because the sealed
+// object data is invalid in some way, or because the TPM object at the persistent
+// handle reserved for the storage root key has a public area that looks like a valid
+// storage root key but it was created with a different template. This latter case is
+// really caused by an incorrectly provisioned TPM, but it isn't possible to differentiate
+// between the 2 errors. A subsequent call to SealKeyToTPM or Connection.EnsureProvisioned
+// may rectify this.
 //
 // If the TPM's current PCR values are not consistent with the PCR protection policy
 // for this key file, a InvalidKeyDataError error will be returned.
@@ -75,7 +79,7 @@ import (
 //
 // Deprecated: Use NewKeyData and the secboot.KeyData API for key recovery.
 func (k *SealedKeyObject) UnsealFromTPM(tpm *Connection) (key secboot.DiskUnlockKey, authKey secboot.PrimaryKey, err error) {
-	data, err := k.unsealDataFromTPM(tpm.TPMContext, nil, tpm.HmacSession())
+	data, err := k.unsealDataFromTPM(tpm.TPMContext, nil, nil, tpm.HmacSession())
 	if err != nil {
 		return nil, nil, err
 	}
@@ -218,6 +218,39 @@ func (s *unsealSuite) TestUnsealFromTPMErrorHandlingRevokedPolicy(c *C) {
 		"the PCR policy has been revoked")
 }
 
+func (s *unsealSuite) TestUnsealFromTPMErrorHandlingSRKMismatch(c *C) {
+	err := s.testUnsealFromTPMErrorHandling(c, func(_ string, _ secboot.PrimaryKey) {
+		// Reprovision the TPM with a different SRK, which is also used
+		// for creating a transient SRK.
+		c.Check(s.TPM().EnsureProvisionedWithOptions(ProvisionModeWithoutLockout, nil, &ProvisioningOptions{SRKAlgorithm: SRKAlgorithmECCNISTP256}),
+			testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+	})
+	c.Check(err, testutil.ConvertibleTo, InvalidKeyDataError{})
+	c.Check(err, ErrorMatches, "invalid key data: cannot load sealed key object into TPM: .* "+
+		"Either the sealed key object is bad or the TPM owner has changed")
+}
+
+func (s *unsealSuite) TestUnsealFromTPMErrorHandlingPersistentSRKMismatch(c *C) {
+	err := s.testUnsealFromTPMErrorHandling(c, func(_ string, _ secboot.PrimaryKey) {
+		// Replace the persistent SRK with a different key, and make it
+		// impossible to create a transient SRK.
+		srk, err := s.TPM().CreateResourceContextFromTPM(tcg.SRKHandle)
+		c.Assert(err, IsNil)
+		s.EvictControl(c, tpm2.HandleOwner, srk, srk.Handle())
+
+		srkTemplate := tcg.MakeDefaultSRKTemplate()
+		srkTemplate.Unique.RSA = nil
+		srk = s.CreatePrimary(c, tpm2.HandleOwner, srkTemplate)
+		s.EvictControl(c, tpm2.HandleOwner, srk, tcg.SRKHandle)
+
+		s.HierarchyChangeAuth(c, tpm2.HandleOwner, []byte("1234"))
+		s.TPM().OwnerHandleContext().SetAuthValue(nil)
+	})
+	c.Check(err, Equals, SRKMismatchError{tcg.SRKHandle})
+	c.Check(err, ErrorMatches, "the sealed key object is not protected by the storage root key at handle 0x81000001 "+
+		"\\(the TPM may have been cleared since the key was created\\)")
+}
+
 func (s *unsealSuite) TestUnsealFromTPMErrorHandlingSealedKeyAccessLocked(c *C) {
 	err := s.testUnsealFromTPMErrorHandling(c, func(_ string, _ secboot.PrimaryKey) {
 		c.Check(BlockPCRProtectionPolicies(s.TPM(), []int{23}), IsNil)
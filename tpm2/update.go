@@ -20,6 +20,7 @@
 package tpm2
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 
@@ -58,6 +59,13 @@ const (
 	// revocation, but this may require multiple counter increments (one per created
 	// policy).
 	incrementPcrPolicyVersion
+
+	// deferredPcrPolicyVersion indicates that the new policy version should be 0,
+	// without reading the counter. This is used for the initial policy when creating
+	// a key offline where the counter will be created later on the target TPM. As
+	// counters are initialized to a non-zero value, this policy can't be satisfied
+	// until it is replaced with one created with resetPcrPolicyVersion.
+	deferredPcrPolicyVersion
 )
 
 // updatePCRProtectionPolicyNoValidate is a helper to update the PCR policy using the supplied
@@ -72,11 +80,41 @@ const (
 // must be supplied, and it must correspond to the public area associated with that handle.
 func (k *sealedKeyDataBase) updatePCRProtectionPolicyNoValidate(tpm *tpm2.TPMContext, key secboot.PrimaryKey,
 	counterPub *tpm2.NVPublic, profile *PCRProtectionProfile, policyVersionOption pcrPolicyVersionOption) error {
+	params, err := k.newPcrPolicyParams(tpm, counterPub, profile, policyVersionOption)
+	if err != nil {
+		return err
+	}
+	params.key = key
+	return k.data.Policy().UpdatePCRPolicy(k.data.Public().NameAlg, params)
+}
+
+// updatePCRProtectionPolicyWithSignerNoValidate is a helper to update the PCR policy using the
+// supplied profile, authorized with the supplied external signer. The arguments are otherwise
+// the same as updatePCRProtectionPolicyNoValidate.
+func (k *sealedKeyDataBase) updatePCRProtectionPolicyWithSignerNoValidate(tpm *tpm2.TPMContext, signer crypto.Signer,
+	counterPub *tpm2.NVPublic, profile *PCRProtectionProfile, policyVersionOption pcrPolicyVersionOption) error {
+	if k.data.Version() < 3 {
+		return errors.New("external PCR policy signers are not supported by this key data version")
+	}
+
+	params, err := k.newPcrPolicyParams(tpm, counterPub, profile, policyVersionOption)
+	if err != nil {
+		return err
+	}
+	params.signer = signer
+	return k.data.Policy().UpdatePCRPolicy(k.data.Public().NameAlg, params)
+}
+
+// newPcrPolicyParams computes the parameters for a new PCR policy from the supplied
+// profile, without the key used to authorize it. See updatePCRProtectionPolicyNoValidate
+// for a description of the arguments.
+func (k *sealedKeyDataBase) newPcrPolicyParams(tpm *tpm2.TPMContext, counterPub *tpm2.NVPublic,
+	profile *PCRProtectionProfile, policyVersionOption pcrPolicyVersionOption) (*pcrPolicyParams, error) {
 	var counterName tpm2.Name
 	var policySequence uint64
 	if counterPub != nil {
-		if tpm == nil {
-			return errors.New("TPM connection required to update PCR policy with revocation")
+		if tpm == nil && policyVersionOption != deferredPcrPolicyVersion {
+			return nil, errors.New("TPM connection required to update PCR policy with revocation")
 		}
 
 		// Callers obtain a valid counterPub from sealedKeyDataBase.validateData, so
@@ -84,15 +122,17 @@ func (k *sealedKeyDataBase) updatePCRProtectionPolicyNoValidate(tpm *tpm2.TPMCon
 		counterName = counterPub.Name()
 
 		switch policyVersionOption {
+		case deferredPcrPolicyVersion:
+			policySequence = 0
 		case resetPcrPolicyVersion, newPcrPolicyVersion:
 			counterContext, err := k.data.Policy().PCRPolicyCounterContext(tpm, counterPub)
 			if err != nil {
-				return xerrors.Errorf("cannot obtain PCR policy counter context: %w", err)
+				return nil, xerrors.Errorf("cannot obtain PCR policy counter context: %w", err)
 			}
 
 			value, err := counterContext.Get()
 			if err != nil {
-				return xerrors.Errorf("cannot obtain PCR policy counter value: %w", err)
+				return nil, xerrors.Errorf("cannot obtain PCR policy counter value: %w", err)
 			}
 
 			policySequence = value
@@ -109,7 +149,7 @@ func (k *sealedKeyDataBase) updatePCRProtectionPolicyNoValidate(tpm *tpm2.TPMCon
 		var err error
 		supportedPcrs, err = tpm.GetCapabilityPCRs()
 		if err != nil {
-			return xerrors.Errorf("cannot determine supported PCRs: %w", err)
+			return nil, xerrors.Errorf("cannot determine supported PCRs: %w", err)
 		}
 	} else {
 		// Defined as mandatory in the TCG PC Client Platform TPM Profile Specification for TPM 2.0
@@ -121,15 +161,43 @@ func (k *sealedKeyDataBase) updatePCRProtectionPolicyNoValidate(tpm *tpm2.TPMCon
 	alg := k.data.Public().NameAlg
 
 	// Compute PCR digests
-	pcrs, pcrDigests, err := profile.ComputePCRDigests(tpm, alg)
+	banks, err := profile.ComputePCRBankDigests(tpm, alg)
 	if err != nil {
-		return xerrors.Errorf("cannot compute PCR digests from protection profile: %w", err)
+		return nil, xerrors.Errorf("cannot compute PCR digests from protection profile: %w", err)
 	}
 
-	if len(pcrDigests) == 0 {
-		return errors.New("PCR protection profile contains no digests")
+	for _, bank := range banks {
+		if len(bank.Digests) == 0 {
+			return nil, errors.New("PCR protection profile contains no digests")
+		}
+	}
+
+	// Make sure that the PCRs for at least one of the PCR banks are supported.
+	// When the profile contains values for more than one bank, it's permitted
+	// for some of them to be unsupported at the moment because the firmware
+	// may change the active PCR banks.
+	supported := false
+	for _, bank := range banks {
+		if isPCRSelectionSupported(bank.PCRs, supportedPcrs) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, errors.New("PCR protection profile contains digests for unsupported PCRs")
 	}
 
+	return &pcrPolicyParams{
+		pcrs:              banks[0].PCRs,
+		pcrDigests:        banks[0].Digests,
+		fallbackPCRs:      banks[1:],
+		policyCounterName: counterName,
+		policySequence:    policySequence}, nil
+}
+
+// isPCRSelectionSupported determines whether all of the PCRs in the supplied
+// selection are in the supplied list of supported PCRs.
+func isPCRSelectionSupported(pcrs, supportedPcrs tpm2.PCRSelectionList) bool {
 	for _, p := range pcrs {
 		for _, s := range p.Select {
 			found := false
@@ -148,21 +216,32 @@ func (k *sealedKeyDataBase) updatePCRProtectionPolicyNoValidate(tpm *tpm2.TPMCon
 				}
 			}
 			if !found {
-				return errors.New("PCR protection profile contains digests for unsupported PCRs")
+				return false
 			}
 		}
 	}
-
-	params := &pcrPolicyParams{
-		key:               key,
-		pcrs:              pcrs,
-		pcrDigests:        pcrDigests,
-		policyCounterName: counterName,
-		policySequence:    policySequence}
-	return k.data.Policy().UpdatePCRPolicy(alg, params)
+	return true
 }
 
 func (k *sealedKeyDataBase) revokeOldPCRProtectionPolicies(tpm *tpm2.TPMContext, key secboot.PrimaryKey, role string) error {
+	return k.revokeOldPCRProtectionPoliciesWithIncrementFn(tpm, role, func(context pcrPolicyCounterContext) error {
+		return context.Increment(key)
+	})
+}
+
+func (k *sealedKeyDataBase) revokeOldPCRProtectionPoliciesWithSigner(tpm *tpm2.TPMContext, signer crypto.Signer, role string) error {
+	return k.revokeOldPCRProtectionPoliciesWithIncrementFn(tpm, role, func(context pcrPolicyCounterContext) error {
+		c, ok := context.(*pcrPolicyCounterContext_v3)
+		if !ok {
+			return errors.New("external PCR policy signers are not supported by this key data version")
+		}
+		return c.incrementWithSigner(signer)
+	})
+}
+
+// revokeOldPCRProtectionPoliciesWithIncrementFn increments the PCR policy counter to the
+// sequence number of the current PCR policy using the supplied function.
+func (k *sealedKeyDataBase) revokeOldPCRProtectionPoliciesWithIncrementFn(tpm *tpm2.TPMContext, role string, increment func(pcrPolicyCounterContext) error) error {
 	pcrPolicyCounterPub, err := k.validateData(tpm, role)
 	if err != nil {
 		if isKeyDataError(err) {
@@ -201,7 +280,7 @@ func (k *sealedKeyDataBase) revokeOldPCRProtectionPolicies(tpm *tpm2.TPMContext,
 
 		lastCurrent = current
 
-		if err := context.Increment(key); err != nil {
+		if err := increment(context); err != nil {
 			return xerrors.Errorf("cannot increment counter: %w", err)
 		}
 		incremented = true
@@ -297,6 +376,18 @@ func (k *SealedKeyData) RevokeOldPCRProtectionPolicies(tpm *Connection, authKey
 	return k.revokeOldPCRProtectionPolicies(tpm.TPMContext, authKey, k.k.Role())
 }
 
+// RevokeOldPCRProtectionPoliciesWithSigner revokes old PCR protection policies associated
+// with this sealed key in the same way as RevokeOldPCRProtectionPolicies, but is used for
+// sealed keys created with an external PCR policy signer (see
+// ProtectKeyParams.PCRPolicySigner). The supplied signer must correspond to the one used
+// to create the sealed key. As the TPM requires a fresh signed authorization for each
+// increment of the PCR policy counter, the signer must be accessible from the device.
+//
+// If validation of the key data fails, a InvalidKeyDataError error will be returned.
+func (k *SealedKeyData) RevokeOldPCRProtectionPoliciesWithSigner(tpm *Connection, signer crypto.Signer) error {
+	return k.revokeOldPCRProtectionPoliciesWithSigner(tpm.TPMContext, signer, k.k.Role())
+}
+
 // UpdateKeyPCRProtectionPolicy updates the PCR protection policy for one or more TPM protected KeyData
 // objects to the profile defined by the pcrProfile argument. The keys must all be related (ie, they were
 // created using NewKeyDataMultiple). If any key in the supplied set is not related, an error will be returned.
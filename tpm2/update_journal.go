@@ -0,0 +1,352 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/snapcore/snapd/osutil"
+	"github.com/snapcore/snapd/osutil/sys"
+
+	"golang.org/x/xerrors"
+
+	"github.com/snapcore/secboot"
+)
+
+var (
+	secbootNewFileKeyDataWriter = func(path string) secboot.KeyDataWriter {
+		return secboot.NewFileKeyDataWriter(path)
+	}
+	secbootNewLUKS2KeyDataReader = func(devicePath, name string) (secboot.KeyDataReader, error) {
+		return secboot.NewLUKS2KeyDataReader(devicePath, name)
+	}
+)
+
+// KeyDataLocation describes where a KeyData object is persisted. Either Path
+// must be set, or both DevicePath and TokenName must be set.
+type KeyDataLocation struct {
+	// Path is the path of a file containing the key data.
+	Path string `json:"path,omitempty"`
+
+	// DevicePath is the path of a LUKS2 container with a KeyData token
+	// containing the key data.
+	DevicePath string `json:"device-path,omitempty"`
+
+	// TokenName is the name of the KeyData token on the LUKS2 container
+	// at DevicePath.
+	TokenName string `json:"token-name,omitempty"`
+}
+
+func (l *KeyDataLocation) String() string {
+	if l.Path != "" {
+		return l.Path
+	}
+	return fmt.Sprintf("%s:%s", l.DevicePath, l.TokenName)
+}
+
+func (l *KeyDataLocation) validate() error {
+	switch {
+	case l.Path != "" && (l.DevicePath != "" || l.TokenName != ""):
+		return errors.New("both a path and a LUKS2 token are specified")
+	case l.Path != "":
+		return nil
+	case l.DevicePath == "" || l.TokenName == "":
+		return errors.New("no path or LUKS2 token is specified")
+	default:
+		return nil
+	}
+}
+
+func (l *KeyDataLocation) newReader() (secboot.KeyDataReader, error) {
+	if l.Path != "" {
+		return secboot.NewFileKeyDataReader(l.Path)
+	}
+	return secbootNewLUKS2KeyDataReader(l.DevicePath, l.TokenName)
+}
+
+func (l *KeyDataLocation) newWriter() (secboot.KeyDataWriter, error) {
+	if l.Path != "" {
+		return secbootNewFileKeyDataWriter(l.Path), nil
+	}
+	return secbootNewLUKS2KeyDataWriter(l.DevicePath, l.TokenName)
+}
+
+// JournaledPCRPolicyUpdateParams provides arguments for
+// UpdateKeyDataPCRProtectionPolicyJournaled.
+type JournaledPCRPolicyUpdateParams struct {
+	// JournalPath is the path of the journal file used to make the update
+	// atomic. It must be on persistent storage and must be the same for
+	// every update of the same set of keys so that an interrupted update
+	// can be completed.
+	JournalPath string
+
+	// PCRProfile is the new PCR profile for every key.
+	PCRProfile *PCRProtectionProfile
+
+	// PolicyVersionOption specifies how to set the version of the new PCR
+	// policy, in the same way as for UpdateKeyDataPCRProtectionPolicy.
+	PolicyVersionOption PCRPolicyVersionOption
+
+	// RevokeOldPCRProtectionPolicies indicates that old PCR policies should
+	// be revoked once every key has been updated.
+	RevokeOldPCRProtectionPolicies bool
+
+	// Keys are the locations of the related KeyData objects to update.
+	Keys []KeyDataLocation
+}
+
+// pcrPolicyUpdateJournal is the on-disk format of the journal for a PCR policy update
+// of multiple keys.
+type pcrPolicyUpdateJournal struct {
+	Revoke  bool                          `json:"revoke"`
+	Entries []pcrPolicyUpdateJournalEntry `json:"entries"`
+}
+
+type pcrPolicyUpdateJournalEntry struct {
+	Location KeyDataLocation `json:"location"`
+	KeyData  []byte          `json:"keydata"`
+}
+
+// keyDataBuffer is a secboot.KeyDataWriter that serializes a KeyData to memory.
+type keyDataBuffer struct {
+	*bytes.Buffer
+}
+
+func (*keyDataBuffer) Commit() error { return nil }
+
+// keyDataBufferReader is a secboot.KeyDataReader that reads a KeyData from memory.
+type keyDataBufferReader struct {
+	name string
+	*bytes.Reader
+}
+
+func (r *keyDataBufferReader) ReadableName() string {
+	return r.name
+}
+
+// readJournal decodes the journal at the specified path into the value pointed
+// to by journal.
+func readJournal(path string, journal interface{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(journal); err != nil {
+		return xerrors.Errorf("cannot decode journal: %w", err)
+	}
+	return nil
+}
+
+// writeJournal atomically writes the supplied journal to the specified path. Once
+// this succeeds, the operation that it journals is committed.
+func writeJournal(path string, journal interface{}) error {
+	f, err := osutil.NewAtomicFile(path, 0600, 0, sys.UserID(osutil.NoChown), sys.GroupID(osutil.NoChown))
+	if err != nil {
+		return xerrors.Errorf("cannot create new atomic file: %w", err)
+	}
+	defer f.Cancel()
+
+	if err := json.NewEncoder(f).Encode(journal); err != nil {
+		return xerrors.Errorf("cannot encode journal: %w", err)
+	}
+
+	if err := f.Commit(); err != nil {
+		return xerrors.Errorf("cannot commit journal: %w", err)
+	}
+
+	return nil
+}
+
+// removePartialJournals removes any partially written journal for the specified
+// path, which rolls back an operation that wasn't committed.
+func removePartialJournals(path string) error {
+	tmps, err := filepath.Glob(path + ".*~")
+	if err != nil {
+		return xerrors.Errorf("cannot search for partially written journals: %w", err)
+	}
+	for _, tmp := range tmps {
+		if err := os.Remove(tmp); err != nil {
+			return xerrors.Errorf("cannot remove partially written journal: %w", err)
+		}
+	}
+	return nil
+}
+
+func readPcrPolicyUpdateJournal(path string) (*pcrPolicyUpdateJournal, error) {
+	var journal *pcrPolicyUpdateJournal
+	if err := readJournal(path, &journal); err != nil {
+		return nil, err
+	}
+	if journal == nil {
+		return nil, errors.New("journal is empty")
+	}
+	return journal, nil
+}
+
+// completePcrPolicyUpdate writes the new key data in the supplied journal to each
+// location, revokes old PCR policies if required and then removes the journal. It
+// can be called any number of times for the same journal.
+func completePcrPolicyUpdate(tpm *Connection, authKey secboot.PrimaryKey, path string, journal *pcrPolicyUpdateJournal) error {
+	for _, entry := range journal.Entries {
+		w, err := entry.Location.newWriter()
+		if err != nil {
+			return xerrors.Errorf("cannot create key data writer for %s: %w", &entry.Location, err)
+		}
+		if _, err := w.Write(entry.KeyData); err != nil {
+			return xerrors.Errorf("cannot write key data for %s: %w", &entry.Location, err)
+		}
+		if err := w.Commit(); err != nil {
+			return xerrors.Errorf("cannot commit key data for %s: %w", &entry.Location, err)
+		}
+	}
+
+	if journal.Revoke {
+		for _, entry := range journal.Entries {
+			k, err := secboot.ReadKeyData(&keyDataBufferReader{entry.Location.String(), bytes.NewReader(entry.KeyData)})
+			if err != nil {
+				return xerrors.Errorf("cannot decode key data for %s: %w", &entry.Location, err)
+			}
+			skd, err := NewSealedKeyData(k)
+			if err != nil {
+				return xerrors.Errorf("cannot obtain SealedKeyData for %s: %w", &entry.Location, err)
+			}
+			// The keys are related so this only increments the PCR policy
+			// counter for the first one.
+			if err := skd.RevokeOldPCRProtectionPolicies(tpm, authKey); err != nil {
+				return xerrors.Errorf("cannot revoke old PCR policies for %s: %w", &entry.Location, err)
+			}
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return xerrors.Errorf("cannot remove journal: %w", err)
+	}
+
+	return nil
+}
+
+// RecoverPCRPolicyUpdateJournal completes or discards a PCR policy update made with
+// UpdateKeyDataPCRProtectionPolicyJournaled that was interrupted, using the journal
+// at the specified path. If the update was interrupted before it was committed, it is
+// rolled back and the keys are not modified. If it was interrupted after it was
+// committed, it is rolled forward by writing the new key data to every location and
+// then revoking old PCR policies if this was requested. This requires the same
+// authorization key as the interrupted update.
+//
+// This does nothing if there is no journal at the specified path.
+func RecoverPCRPolicyUpdateJournal(tpm *Connection, authKey secboot.PrimaryKey, path string) error {
+	if err := removePartialJournals(path); err != nil {
+		return err
+	}
+
+	journal, err := readPcrPolicyUpdateJournal(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return xerrors.Errorf("cannot read journal: %w", err)
+	}
+
+	return completePcrPolicyUpdate(tpm, authKey, path, journal)
+}
+
+// UpdateKeyDataPCRProtectionPolicyJournaled updates the PCR protection policy for one or
+// more related TPM protected KeyData objects that are persisted in files or LUKS2 tokens,
+// in the same way as UpdateKeyDataPCRProtectionPolicy. Unlike that function, the updated
+// keys are persisted by this function, and this happens atomically with the help of a
+// journal.
+//
+// Each key is read from the supplied locations and updated in memory. The new key data
+// for every key is then written to the journal, which is the point at which the update
+// is committed. After this, the new key data is written back to each location, and old
+// PCR policies are revoked if requested. Revocation only happens once every key has been
+// written successfully, so an interruption never leaves a key that has an old PCR policy
+// that has been revoked. The journal is removed once the update is complete.
+//
+// Before updating the keys, any previous update that was interrupted is completed or
+// discarded by calling RecoverPCRPolicyUpdateJournal.
+//
+// If validation of any KeyData object fails, an InvalidKeyDataError error will be returned.
+func UpdateKeyDataPCRProtectionPolicyJournaled(tpm *Connection, authKey secboot.PrimaryKey, params *JournaledPCRPolicyUpdateParams) error {
+	// params is mandatory.
+	if params == nil {
+		return errors.New("no JournaledPCRPolicyUpdateParams provided")
+	}
+	if params.JournalPath == "" {
+		return errors.New("no journal path provided")
+	}
+	if len(params.Keys) == 0 {
+		return errors.New("no keys supplied")
+	}
+	for i, location := range params.Keys {
+		if err := location.validate(); err != nil {
+			return xerrors.Errorf("invalid location for key at index %d: %w", i, err)
+		}
+	}
+
+	if err := RecoverPCRPolicyUpdateJournal(tpm, authKey, params.JournalPath); err != nil {
+		return xerrors.Errorf("cannot recover interrupted update: %w", err)
+	}
+
+	var keys []*secboot.KeyData
+	for i, location := range params.Keys {
+		r, err := location.newReader()
+		if err != nil {
+			return xerrors.Errorf("cannot create key data reader for key at index %d: %w", i, err)
+		}
+		k, err := secboot.ReadKeyData(r)
+		if err != nil {
+			return xerrors.Errorf("cannot read key at index %d: %w", i, err)
+		}
+		keys = append(keys, k)
+	}
+
+	if err := UpdateKeyDataPCRProtectionPolicy(tpm, authKey, params.PCRProfile, params.PolicyVersionOption, keys...); err != nil {
+		return err
+	}
+
+	journal := &pcrPolicyUpdateJournal{Revoke: params.RevokeOldPCRProtectionPolicies}
+	for i, k := range keys {
+		w := &keyDataBuffer{new(bytes.Buffer)}
+		if err := k.WriteAtomic(w); err != nil {
+			return xerrors.Errorf("cannot serialize key at index %d: %w", i, err)
+		}
+		journal.Entries = append(journal.Entries, pcrPolicyUpdateJournalEntry{
+			Location: params.Keys[i],
+			KeyData:  w.Bytes()})
+	}
+
+	if err := writeJournal(params.JournalPath, journal); err != nil {
+		return xerrors.Errorf("cannot write journal: %w", err)
+	}
+
+	if err := completePcrPolicyUpdate(tpm, authKey, params.JournalPath, journal); err != nil {
+		return xerrors.Errorf("cannot complete update: %w", err)
+	}
+
+	return nil
+}
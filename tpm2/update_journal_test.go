@@ -0,0 +1,304 @@
+// -*- Mode: Go; indent-tabs-mode: t -*-
+
+/*
+ * Copyright (C) 2026 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package tpm2_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/canonical/go-tpm2"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/snapcore/secboot"
+	"github.com/snapcore/secboot/internal/testutil"
+	"github.com/snapcore/secboot/internal/tpm2test"
+	. "github.com/snapcore/secboot/tpm2"
+)
+
+type updateJournalSuiteNoTPM struct{}
+
+var _ = Suite(&updateJournalSuiteNoTPM{})
+
+func (s *updateJournalSuiteNoTPM) TestUpdateNoParams(c *C) {
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(nil, nil, nil), ErrorMatches, `no JournaledPCRPolicyUpdateParams provided`)
+}
+
+func (s *updateJournalSuiteNoTPM) TestUpdateNoJournalPath(c *C) {
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(nil, nil, &JournaledPCRPolicyUpdateParams{
+		Keys: []KeyDataLocation{{Path: "/foo"}}}), ErrorMatches, `no journal path provided`)
+}
+
+func (s *updateJournalSuiteNoTPM) TestUpdateNoKeys(c *C) {
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(nil, nil, &JournaledPCRPolicyUpdateParams{
+		JournalPath: filepath.Join(c.MkDir(), "journal")}), ErrorMatches, `no keys supplied`)
+}
+
+func (s *updateJournalSuiteNoTPM) TestUpdateInvalidLocation1(c *C) {
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(nil, nil, &JournaledPCRPolicyUpdateParams{
+		JournalPath: filepath.Join(c.MkDir(), "journal"),
+		Keys:        []KeyDataLocation{{Path: "/foo"}, {DevicePath: "/dev/sda1"}}}), ErrorMatches,
+		`invalid location for key at index 1: no path or LUKS2 token is specified`)
+}
+
+func (s *updateJournalSuiteNoTPM) TestUpdateInvalidLocation2(c *C) {
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(nil, nil, &JournaledPCRPolicyUpdateParams{
+		JournalPath: filepath.Join(c.MkDir(), "journal"),
+		Keys:        []KeyDataLocation{{Path: "/foo", DevicePath: "/dev/sda1", TokenName: "default"}}}), ErrorMatches,
+		`invalid location for key at index 0: both a path and a LUKS2 token are specified`)
+}
+
+func (s *updateJournalSuiteNoTPM) TestRecoverNoJournal(c *C) {
+	c.Check(RecoverPCRPolicyUpdateJournal(nil, nil, filepath.Join(c.MkDir(), "journal")), IsNil)
+}
+
+func (s *updateJournalSuiteNoTPM) TestRecoverRemovesUncommittedJournal(c *C) {
+	dir := c.MkDir()
+	tmp := filepath.Join(dir, "journal.XXXXXXXXXXXX~")
+	c.Assert(ioutil.WriteFile(tmp, []byte("{"), 0600), IsNil)
+
+	c.Check(RecoverPCRPolicyUpdateJournal(nil, nil, filepath.Join(dir, "journal")), IsNil)
+	_, err := os.Stat(tmp)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *updateJournalSuiteNoTPM) TestRecoverInvalidJournal(c *C) {
+	path := filepath.Join(c.MkDir(), "journal")
+	c.Assert(ioutil.WriteFile(path, []byte("{"), 0600), IsNil)
+
+	c.Check(RecoverPCRPolicyUpdateJournal(nil, nil, path), ErrorMatches, `cannot read journal: cannot decode journal: unexpected EOF`)
+}
+
+func (s *updateJournalSuiteNoTPM) TestRecoverNullJournal(c *C) {
+	path := filepath.Join(c.MkDir(), "journal")
+	c.Assert(ioutil.WriteFile(path, []byte("null"), 0600), IsNil)
+
+	c.Check(RecoverPCRPolicyUpdateJournal(nil, nil, path), ErrorMatches, `cannot read journal: journal is empty`)
+}
+
+type updateJournalSuite struct {
+	tpm2test.TPMTest
+}
+
+func (s *updateJournalSuite) SetUpSuite(c *C) {
+	s.TPMFeatures = tpm2test.TPMFeatureOwnerHierarchy |
+		tpm2test.TPMFeatureEndorsementHierarchy |
+		tpm2test.TPMFeatureLockoutHierarchy | // Allow the test fixture to reset the DA counter
+		tpm2test.TPMFeaturePCR |
+		tpm2test.TPMFeatureNV
+}
+
+func (s *updateJournalSuite) SetUpTest(c *C) {
+	s.TPMTest.SetUpTest(c)
+	c.Assert(s.TPM().EnsureProvisioned(ProvisionModeWithoutLockout, nil),
+		testutil.InSlice(Equals), []error{ErrTPMProvisioningRequiresLockout, nil})
+}
+
+var _ = Suite(&updateJournalSuite{})
+
+// newKeys creates 2 related keys with the supplied PCR profile, saving them to files in
+// the supplied directory.
+func (s *updateJournalSuite) newKeys(c *C, dir string, profile *PCRProtectionProfile) (primaryKey secboot.PrimaryKey, locations []KeyDataLocation) {
+	primaryKey = make(secboot.PrimaryKey, 32)
+	rand.Read(primaryKey)
+
+	params := &ProtectKeyParams{
+		PCRProfile:             profile,
+		PCRPolicyCounterHandle: s.NextAvailableHandle(c, 0x01810000),
+		PrimaryKey:             primaryKey}
+
+	for _, name := range []string{"key1", "key2"} {
+		k, _, _, err := NewTPMProtectedKey(s.TPM(), params)
+		c.Assert(err, IsNil)
+
+		path := filepath.Join(dir, name)
+		c.Assert(k.WriteAtomic(secboot.NewFileKeyDataWriter(path)), IsNil)
+		locations = append(locations, KeyDataLocation{Path: path})
+	}
+
+	return primaryKey, locations
+}
+
+func (s *updateJournalSuite) readKey(c *C, location KeyDataLocation) *secboot.KeyData {
+	r, err := secboot.NewFileKeyDataReader(location.Path)
+	c.Assert(err, IsNil)
+	k, err := secboot.ReadKeyData(r)
+	c.Assert(err, IsNil)
+	return k
+}
+
+func (s *updateJournalSuite) TestUpdate(c *C) {
+	dir := c.MkDir()
+	// Protect the keys with an initial PCR policy that can't be satisfied
+	primaryKey, locations := s.newKeys(c, dir, NewPCRProtectionProfile().AddPCRValue(tpm2.HashAlgorithmSHA256, 7, testutil.DecodeHexString(c, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")))
+
+	journalPath := filepath.Join(dir, "journal")
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(s.TPM(), primaryKey, &JournaledPCRPolicyUpdateParams{
+		JournalPath: journalPath,
+		PCRProfile:  tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		Keys:        locations}), IsNil)
+
+	for _, location := range locations {
+		_, _, err := s.readKey(c, location).RecoverKeys()
+		c.Check(err, IsNil)
+	}
+
+	_, err := os.Stat(journalPath)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *updateJournalSuite) TestUpdateWithRevoke(c *C) {
+	dir := c.MkDir()
+	primaryKey, locations := s.newKeys(c, dir, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}))
+	oldKey := s.readKey(c, locations[0])
+
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(s.TPM(), primaryKey, &JournaledPCRPolicyUpdateParams{
+		JournalPath:                    filepath.Join(dir, "journal"),
+		PCRProfile:                     tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PolicyVersionOption:            NewPCRPolicyVersion,
+		RevokeOldPCRProtectionPolicies: true,
+		Keys:                           locations}), IsNil)
+
+	for _, location := range locations {
+		_, _, err := s.readKey(c, location).RecoverKeys()
+		c.Check(err, IsNil)
+	}
+
+	_, _, err := oldKey.RecoverKeys()
+	c.Check(err, ErrorMatches, "invalid key data: cannot complete authorization policy assertions: the PCR policy has been revoked")
+}
+
+func (s *updateJournalSuite) TestUpdateInterruptedAndRecovered(c *C) {
+	dir := c.MkDir()
+	primaryKey, locations := s.newKeys(c, dir, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}))
+	oldKey := s.readKey(c, locations[1])
+
+	// Fail to write the second key, which simulates an interruption after
+	// the update has been committed.
+	restore := MockSecbootNewFileKeyDataWriter(func(path string) secboot.KeyDataWriter {
+		w := secboot.NewFileKeyDataWriter(path)
+		if path != locations[1].Path {
+			return w
+		}
+		return &mockFailingKeyDataWriter{w}
+	})
+	journalPath := filepath.Join(dir, "journal")
+	params := &JournaledPCRPolicyUpdateParams{
+		JournalPath:                    journalPath,
+		PCRProfile:                     tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PolicyVersionOption:            NewPCRPolicyVersion,
+		RevokeOldPCRProtectionPolicies: true,
+		Keys:                           locations}
+	err := UpdateKeyDataPCRProtectionPolicyJournaled(s.TPM(), primaryKey, params)
+	restore()
+	c.Check(err, ErrorMatches, `cannot complete update: cannot commit key data for .*/key2: interrupted`)
+
+	// The first key has been updated, but the old policies haven't been revoked
+	// yet so the second key is still usable.
+	_, _, err = s.readKey(c, locations[0]).RecoverKeys()
+	c.Check(err, IsNil)
+	_, _, err = oldKey.RecoverKeys()
+	c.Check(err, IsNil)
+	_, err = os.Stat(journalPath)
+	c.Check(err, IsNil)
+
+	c.Check(RecoverPCRPolicyUpdateJournal(s.TPM(), primaryKey, journalPath), IsNil)
+
+	for _, location := range locations {
+		_, _, err := s.readKey(c, location).RecoverKeys()
+		c.Check(err, IsNil)
+	}
+	_, _, err = oldKey.RecoverKeys()
+	c.Check(err, ErrorMatches, "invalid key data: cannot complete authorization policy assertions: the PCR policy has been revoked")
+	_, err = os.Stat(journalPath)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+func (s *updateJournalSuite) TestUpdateLUKS2Tokens(c *C) {
+	dir := c.MkDir()
+	primaryKey, files := s.newKeys(c, dir, tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7}))
+
+	// Move the keys to mock LUKS2 tokens.
+	tokens := make(map[string][]byte)
+	var locations []KeyDataLocation
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file.Path)
+		c.Assert(err, IsNil)
+		location := KeyDataLocation{DevicePath: "/dev/sda1", TokenName: filepath.Base(file.Path)}
+		tokens[location.String()] = data
+		locations = append(locations, location)
+		c.Assert(os.Remove(file.Path), IsNil)
+	}
+
+	restoreReader := MockSecbootNewLUKS2KeyDataReader(func(devicePath, name string) (secboot.KeyDataReader, error) {
+		data, ok := tokens[devicePath+":"+name]
+		if !ok {
+			return nil, errors.New("no token")
+		}
+		return &mockKeyDataReader{bytes.NewReader(data)}, nil
+	})
+	defer restoreReader()
+	writers := make(map[string]*mockKeyDataWriter)
+	restoreWriter := MockSecbootNewLUKS2KeyDataWriter(func(devicePath, name string) (secboot.KeyDataWriter, error) {
+		w := newMockKeyDataWriter()
+		writers[devicePath+":"+name] = w
+		return w, nil
+	})
+	defer restoreWriter()
+
+	journalPath := filepath.Join(dir, "journal")
+	c.Check(UpdateKeyDataPCRProtectionPolicyJournaled(s.TPM(), primaryKey, &JournaledPCRPolicyUpdateParams{
+		JournalPath:                    journalPath,
+		PCRProfile:                     tpm2test.NewPCRProfileFromCurrentValues(tpm2.HashAlgorithmSHA256, []int{7, 23}),
+		PolicyVersionOption:            NewPCRPolicyVersion,
+		RevokeOldPCRProtectionPolicies: true,
+		Keys:                           locations}), IsNil)
+
+	c.Assert(writers, HasLen, len(locations))
+	for _, location := range locations {
+		w, ok := writers[location.String()]
+		c.Assert(ok, testutil.IsTrue)
+		k, err := secboot.ReadKeyData(w.Reader())
+		c.Assert(err, IsNil)
+		_, _, err = k.RecoverKeys()
+		c.Check(err, IsNil)
+
+		// The old key in the token should have been revoked.
+		old, err := secboot.ReadKeyData(&mockKeyDataReader{bytes.NewReader(tokens[location.String()])})
+		c.Assert(err, IsNil)
+		_, _, err = old.RecoverKeys()
+		c.Check(err, ErrorMatches, "invalid key data: cannot complete authorization policy assertions: the PCR policy has been revoked")
+	}
+
+	_, err := os.Stat(journalPath)
+	c.Check(os.IsNotExist(err), testutil.IsTrue)
+}
+
+type mockFailingKeyDataWriter struct {
+	secboot.KeyDataWriter
+}
+
+func (*mockFailingKeyDataWriter) Commit() error {
+	return errors.New("interrupted")
+}
@@ -57,6 +57,21 @@ func isImportInvalidParamError(err error) bool {
 		!tpm2.IsTPMParameterError(err, tpm2.ErrorScheme, tpm2.CommandImport, 4)
 }
 
+// isLoadParentMismatchError indicates whether the specified error is a TPM error that is caused
+// by the integrity check of the private area failing during a TPM2_Load command, which normally
+// indicates that the object was created with a different parent.
+func isLoadParentMismatchError(err error) bool {
+	return tpm2.IsTPMParameterError(err, tpm2.ErrorIntegrity, tpm2.CommandLoad, 1)
+}
+
+// isImportParentMismatchError indicates whether the specified error is a TPM error that is caused
+// by the seed or the integrity check of the duplication blob being invalid during a TPM2_Import
+// command, which normally indicates that the object was exported to a different parent.
+func isImportParentMismatchError(err error) bool {
+	return tpm2.IsTPMParameterError(err, tpm2.ErrorIntegrity, tpm2.CommandImport, 3) ||
+		tpm2.IsTPMParameterError(err, tpm2.ErrorValue, tpm2.CommandImport, 4)
+}
+
 // isLoadInvalidParentError indicates whether the specified error is a TPM error associated with an invalid parent
 // handle supplied to a TPM2_Load command.
 func isLoadInvalidParentError(err error) bool {